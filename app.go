@@ -4,14 +4,17 @@ import (
 	"context"
 	"embed"
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/wangle201210/wachat/backend"
 	"github.com/wangle201210/wachat/backend/config"
 	"github.com/wangle201210/wachat/backend/model"
+	"github.com/wangle201210/wachat/backend/secret"
 	"github.com/wangle201210/wachat/backend/service"
+	"github.com/wangle201210/wachat/backend/vectorstore"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
@@ -21,40 +24,73 @@ var binaries embed.FS
 // App struct
 type App struct {
 	ctx           context.Context
-	chatAPI       *backend.API
 	binaryManager *service.BinaryManager
+
+	apiMu    sync.RWMutex
+	chatAPI  *backend.API // 切换配置方案时重建
+	switchMu sync.Mutex   // 串行化配置方案切换
+
+	logMu            sync.Mutex
+	logSubscriptions map[string]func() // service name -> unsubscribe
+
+	unsubscribeConfig func() // 取消配置变更订阅
 }
 
 // NewApp creates new App
 func NewApp(cfg *config.Config) *App {
-	// Use background context for API initialization
-	api, err := backend.NewAPI(context.Background())
-	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize API: %v", err))
+	app := &App{
+		logSubscriptions: make(map[string]func()),
 	}
 
 	// Create binary manager from config
 	binaryManager, err := service.NewBinaryManagerFromConfig(cfg.Binaries, binaries)
 	if err != nil {
 		g.Log().Warningf(context.Background(), "Binary manager: %v", err)
+	} else {
+		app.binaryManager = binaryManager
+	}
+
+	// Use background context for API initialization
+	api, err := app.newBackend(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize API: %v", err))
 	}
+	app.chatAPI = api
+	return app
+}
 
-	return &App{
-		chatAPI:       api,
-		binaryManager: binaryManager,
+// api returns the backend of the active profile
+func (a *App) api() *backend.API {
+	a.apiMu.RLock()
+	defer a.apiMu.RUnlock()
+	return a.chatAPI
+}
+
+// newBackend creates the backend API for the active profile and registers the binaries with its orchestrator
+func (a *App) newBackend(ctx context.Context) (*backend.API, error) {
+	api, err := backend.NewAPI(ctx)
+	if err != nil {
+		return nil, err
 	}
+	if a.binaryManager != nil {
+		a.binaryManager.RegisterWith(api.GetOrchestrator())
+	}
+	api.GetOrchestrator().SetLogConfig(config.GetServiceLogConfig())
+	return api, nil
 }
 
 // startup is called when app starts
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-	a.chatAPI.SetContext(ctx)
 
-	// Setup config change callback to notify frontend
-	config.SetOnConfigChange(func() {
-		g.Log().Info(ctx, "Configuration changed, notifying frontend...")
-		runtime.EventsEmit(ctx, "config:changed", map[string]interface{}{
+	// Notify the frontend of every changed config section (the backend services subscribe on their own)
+	a.unsubscribeConfig = config.Subscribe(func(ctx context.Context, change config.ConfigChange) {
+		g.Log().Infof(ctx, "Config section %s changed (%s), notifying frontend...", change.Section, change.Source)
+		runtime.EventsEmit(a.ctx, "config:changed", map[string]interface{}{
 			"message": "配置文件已更新",
+			"section": change.Section,
+			"source":  change.Source,
+			"fields":  change.Fields,
 		})
 	})
 
@@ -63,8 +99,15 @@ func (a *App) startup(ctx context.Context) {
 		g.Log().Warningf(ctx, "Warning: Failed to start config watcher: %v", err)
 	}
 
+	a.startBackend(ctx, a.api())
+}
+
+// startBackend wires progress and event callbacks of the backend to the frontend and starts its services
+func (a *App) startBackend(ctx context.Context, api *backend.API) {
+	api.SetContext(ctx)
+
 	// Setup RAG manager progress callback
-	ragManager := a.chatAPI.GetRAGManager()
+	ragManager := api.GetRAGManager()
 	if ragManager != nil {
 		ragManager.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
 			runtime.EventsEmit(ctx, "rag:download:progress", map[string]interface{}{
@@ -77,7 +120,7 @@ func (a *App) startup(ctx context.Context) {
 	}
 
 	// Setup Qdrant manager progress callback
-	qdrantManager := a.chatAPI.GetQdrantManager()
+	qdrantManager := api.GetQdrantManager()
 	if qdrantManager != nil {
 		qdrantManager.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
 			runtime.EventsEmit(ctx, "qdrant:download:progress", map[string]interface{}{
@@ -89,42 +132,67 @@ func (a *App) startup(ctx context.Context) {
 		})
 	}
 
-	// Start all embedded binaries
-	if a.binaryManager != nil {
-		if err := a.binaryManager.StartAll(ctx); err != nil {
-			g.Log().Warningf(ctx, "Warning: Failed to start binaries: %v", err)
-		}
+	// Setup Ollama manager progress callback (下载二进制和拉取模型共用)
+	ollamaManager := api.GetOllamaManager()
+	if ollamaManager != nil {
+		ollamaManager.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
+			runtime.EventsEmit(ctx, "ollama:download:progress", map[string]interface{}{
+				"downloaded": downloaded,
+				"total":      total,
+				"percent":    percent,
+				"status":     status,
+			})
+		})
 	}
 
-	// Auto-start Qdrant if configured
-	qdrantConfig := config.GetQdrantConfig()
-	if qdrantConfig != nil && qdrantConfig.AutoStart {
-		if qdrantManager != nil && qdrantManager.IsInstalled() {
-			g.Log().Info(ctx, "Auto-starting Qdrant service...")
-			if err := qdrantManager.Start(); err != nil {
-				g.Log().Warningf(ctx, "Warning: Failed to auto-start Qdrant service: %v", err)
-			} else {
-				g.Log().Info(ctx, "Qdrant service auto-started successfully")
-			}
-		} else if qdrantManager != nil {
-			g.Log().Info(ctx, "Qdrant auto-start is enabled but Qdrant is not installed yet")
+	// Setup managed services progress callback
+	services := api.GetManagedServices()
+	if services != nil {
+		services.SetProgressCallback(func(name string, downloaded, total int64, percent float64, status string) {
+			runtime.EventsEmit(ctx, "service:download:progress", map[string]interface{}{
+				"service":    name,
+				"downloaded": downloaded,
+				"total":      total,
+				"percent":    percent,
+				"status":     status,
+			})
+		})
+	}
+
+	// Forward crash / restart events of supervised processes to the frontend
+	api.GetOrchestrator().SetEventCallback(func(event string, data map[string]interface{}) {
+		runtime.EventsEmit(ctx, event, data)
+	})
+
+	// Connect MCP servers marked as autoStart
+	if mcpManager := api.GetMCPManager(); mcpManager != nil {
+		mcpManager.StartAutoStart()
+	}
+
+	// Start OpenAI-compatible API server if enabled
+	apiServerConfig := config.GetAPIServerConfig()
+	if apiServerConfig.IsEnabled() {
+		if err := api.StartAPIServer(); err != nil {
+			g.Log().Warningf(ctx, "Warning: Failed to start API server: %v", err)
 		}
 	}
 
-	// Only auto-start go-rag server if autoStart is true
-	ragConfig := config.GetRAGConfig()
-	if ragConfig != nil && ragConfig.AutoStart {
-		if ragManager != nil && ragManager.IsInstalled() {
-			g.Log().Info(ctx, "Auto-starting RAG service...")
-			if err := ragManager.Start(); err != nil {
-				g.Log().Warningf(ctx, "Warning: Failed to auto-start RAG service: %v", err)
-			} else {
-				g.Log().Info(ctx, "RAG service auto-started successfully")
+	// Start embedded binaries and auto-start services in dependency order
+	// 每一步都等待健康，放到后台执行以免阻塞界面
+	go func() {
+		// 先清理上次崩溃遗留的进程，再启动或接管已在运行的外部实例
+		api.GetOrchestrator().CleanupOrphans()
+		if err := api.GetOrchestrator().StartAutoStart(); err != nil {
+			g.Log().Warningf(ctx, "Warning: Failed to auto-start services: %v", err)
+		}
+
+		// Register local Ollama as an AI provider once it is healthy
+		if ollamaManager != nil && ollamaManager.CheckHealth() == nil {
+			if err := ollamaManager.RegisterProvider(); err != nil {
+				g.Log().Warningf(ctx, "Warning: Failed to register Ollama provider: %v", err)
 			}
-		} else if ragManager != nil {
-			g.Log().Info(ctx, "RAG auto-start is enabled but go-rag is not installed yet")
 		}
-	}
+	}()
 }
 
 // shutdown is called when app stops
@@ -133,56 +201,135 @@ func (a *App) shutdown(ctx context.Context) {
 
 	// Stop config watcher
 	config.StopWatch()
+	if a.unsubscribeConfig != nil {
+		a.unsubscribeConfig()
+	}
+
+	// Stop services, the API server and MCP servers, then close the database
+	a.api().Close()
+
+	g.Log().Info(ctx, "Application shutdown complete")
+}
+
+// ListProfiles returns every profile under ~/.wachat/profiles
+func (a *App) ListProfiles() ([]*config.Profile, error) {
+	return config.ListProfiles()
+}
+
+// GetActiveProfile returns the name of the active profile ("" when only config.yaml is used)
+func (a *App) GetActiveProfile() string {
+	return config.ActiveProfile()
+}
+
+// CreateProfile creates a profile seeded with the current AI, RAG and Qdrant settings
+func (a *App) CreateProfile(name, description string, ownDatabase bool) (*config.Profile, error) {
+	return config.CreateProfile(a.uiCtx(), name, description, ownDatabase)
+}
+
+// SwitchProfile activates a profile ("" for config.yaml only) and rebuilds the backend without restarting the app
+// Services of the old profile are stopped first so the new one can bind the same ports and database
+func (a *App) SwitchProfile(name string) error {
+	a.switchMu.Lock()
+	defer a.switchMu.Unlock()
+
+	previous := config.ActiveProfile()
+	if name == previous {
+		return nil
+	}
+	if err := config.CheckProfileSwitch(name); err != nil {
+		return err
+	}
 
-	// Stop RAG manager (which manages the go-rag process)
-	ragManager := a.chatAPI.GetRAGManager()
-	if ragManager != nil && ragManager.IsRunning() {
-		g.Log().Info(ctx, "Stopping RAG manager...")
-		if err := ragManager.Stop(); err != nil {
-			g.Log().Warningf(ctx, "Warning: Failed to stop RAG manager: %v", err)
-		} else {
-			g.Log().Info(ctx, "RAG manager stopped successfully")
+	// Bindings wait for the new backend instead of reaching the closed database of the old one
+	a.apiMu.Lock()
+	defer a.apiMu.Unlock()
+
+	// Close the old backend before the config changes, so that it doesn't react to the new profile
+	// (e.g. restart its services on the new profile's ports)
+	a.unsubscribeAllLogs()
+	a.chatAPI.Close()
+
+	if err := config.SwitchProfile(a.uiCtx(), name); err != nil {
+		if restoreErr := a.restoreBackend(previous); restoreErr != nil {
+			return fmt.Errorf("failed to switch to profile %q: %w (%v)", name, err, restoreErr)
 		}
+		return err
 	}
+	return a.rebuildBackend(previous)
+}
 
-	// Stop Qdrant manager
-	qdrantManager := a.chatAPI.GetQdrantManager()
-	if qdrantManager != nil && qdrantManager.IsRunning() {
-		g.Log().Info(ctx, "Stopping Qdrant manager...")
-		if err := qdrantManager.Stop(); err != nil {
-			g.Log().Warningf(ctx, "Warning: Failed to stop Qdrant manager: %v", err)
-		} else {
-			g.Log().Info(ctx, "Qdrant manager stopped successfully")
+// rebuildBackend starts the backend after the active profile changed, switching back to previous if the new one fails to start
+// The caller holds switchMu and apiMu, and has closed the old backend
+func (a *App) rebuildBackend(previous string) error {
+	name := config.ActiveProfile()
+	api, err := a.newBackend(a.ctx)
+	if err != nil {
+		g.Log().Errorf(a.ctx, "Failed to build backend for profile %q, switching back to %q: %v", name, previous, err)
+		if rollbackErr := config.SwitchProfile(a.uiCtx(), previous); rollbackErr != nil {
+			g.Log().Errorf(a.ctx, "Failed to switch back to profile %q: %v", previous, rollbackErr)
 		}
+		if restoreErr := a.restoreBackend(previous); restoreErr != nil {
+			return fmt.Errorf("failed to switch to profile %q: %w (%v)", name, err, restoreErr)
+		}
+		return fmt.Errorf("failed to switch to profile %q: %w", name, err)
 	}
 
-	// Cleanup managed binaries
-	if a.binaryManager != nil {
-		g.Log().Info(ctx, "Cleaning up binary manager...")
-		a.binaryManager.Cleanup()
+	a.chatAPI = api
+	a.startBackend(a.ctx, api)
+	runtime.EventsEmit(a.ctx, "profile:changed", map[string]interface{}{
+		"previous": previous,
+		"profile":  name,
+	})
+	return nil
+}
+
+// restoreBackend rebuilds the backend of the active profile after a failed switch
+// When that fails too the closed backend is kept: bindings return errors until the app is restarted
+// The caller holds switchMu and apiMu
+func (a *App) restoreBackend(previous string) error {
+	api, err := a.newBackend(a.ctx)
+	if err != nil {
+		g.Log().Errorf(a.ctx, "Failed to restore the backend of profile %q, restart the app: %v", previous, err)
+		return fmt.Errorf("failed to restore profile %q, restart the app: %w", previous, err)
 	}
+	a.chatAPI = api
+	a.startBackend(a.ctx, api)
+	return nil
+}
 
-	g.Log().Info(ctx, "Application shutdown complete")
+// unsubscribeAllLogs stops every service log stream (the services belong to the old backend)
+func (a *App) unsubscribeAllLogs() {
+	a.logMu.Lock()
+	defer a.logMu.Unlock()
+	for name, unsubscribe := range a.logSubscriptions {
+		unsubscribe()
+		delete(a.logSubscriptions, name)
+	}
+}
+
+// uiCtx returns the app context marking config changes as made from the UI (for the config history)
+func (a *App) uiCtx() context.Context {
+	return config.WithChangeSource(a.ctx, config.ChangeUI)
 }
 
 // CreateConversation creates new conversation
 func (a *App) CreateConversation(title string) (*model.Conversation, error) {
-	return a.chatAPI.CreateConversation(title)
+	return a.api().CreateConversation(title)
 }
 
 // ListConversations returns all conversations
 func (a *App) ListConversations() ([]*model.Conversation, error) {
-	return a.chatAPI.ListConversations()
+	return a.api().ListConversations()
 }
 
 // GetConversation returns conversation with messages
 func (a *App) GetConversation(id string) (*model.Conversation, error) {
-	return a.chatAPI.GetConversation(id)
+	return a.api().GetConversation(id)
 }
 
 // DeleteConversation deletes conversation
 func (a *App) DeleteConversation(id string) error {
-	return a.chatAPI.DeleteConversation(id)
+	return a.api().DeleteConversation(id)
 }
 
 // SendMessageStream streams AI response using eino
@@ -193,7 +340,46 @@ func (a *App) SendMessageStream(conversationID, content string) error {
 	}
 
 	// Delegate to service layer
-	return a.chatAPI.SendMessageStream(conversationID, content, eventCallback)
+	return a.api().SendMessageStream(conversationID, content, eventCallback)
+}
+
+// MCP Methods
+
+// ListMCPServers returns status of all configured MCP servers
+func (a *App) ListMCPServers() []map[string]interface{} {
+	return a.api().ListMCPServers()
+}
+
+// StartMCPServer connects to the given MCP server
+func (a *App) StartMCPServer(name string) error {
+	return a.api().StartMCPServer(name)
+}
+
+// StopMCPServer disconnects from the given MCP server
+func (a *App) StopMCPServer(name string) error {
+	return a.api().StopMCPServer(name)
+}
+
+// UpdateConversationMCPServers sets the MCP servers enabled for a conversation
+func (a *App) UpdateConversationMCPServers(id string, servers []string) error {
+	return a.api().UpdateConversationMCPServers(id, servers)
+}
+
+// API Server Methods
+
+// StartAPIServer starts the local OpenAI-compatible API server
+func (a *App) StartAPIServer() error {
+	return a.api().StartAPIServer()
+}
+
+// StopAPIServer stops the local OpenAI-compatible API server
+func (a *App) StopAPIServer() error {
+	return a.api().StopAPIServer()
+}
+
+// GetAPIServerStatus returns the local OpenAI-compatible API server status
+func (a *App) GetAPIServerStatus() map[string]interface{} {
+	return a.api().GetAPIServerStatus()
 }
 
 // RAGServerInfo holds RAG server configuration info
@@ -214,8 +400,8 @@ func (a *App) GetRAGServerInfo() *RAGServerInfo {
 		}
 	}
 
-	// Construct URL from config
-	url := fmt.Sprintf("http://localhost%s", cfg.Server.Address)
+	// Construct URL from config (rag.server.url or server.address)
+	url := cfg.GetServerURL()
 
 	return &RAGServerInfo{
 		Enabled: true,
@@ -228,7 +414,7 @@ func (a *App) GetRAGServerInfo() *RAGServerInfo {
 // DownloadRAG downloads go-rag binary with progress
 func (a *App) DownloadRAG() error {
 	runtime.EventsEmit(a.ctx, "rag:download:start", nil)
-	err := a.chatAPI.DownloadRAG()
+	err := a.api().DownloadRAG()
 	if err != nil {
 		runtime.EventsEmit(a.ctx, "rag:download:error", map[string]interface{}{
 			"error": err.Error(),
@@ -239,59 +425,13 @@ func (a *App) DownloadRAG() error {
 	return nil
 }
 
-// StartRAG starts go-rag service
+// StartRAG starts go-rag service (and Qdrant first when it is enabled)
 func (a *App) StartRAG() error {
-	// Check if Qdrant is required and start it if needed
-	qdrantManager := a.chatAPI.GetQdrantManager()
-	qdrantConfig := config.GetQdrantConfig()
-
-	// If Qdrant is enabled and not running, start it first
-	if qdrantConfig != nil && qdrantConfig.IsEnabled() && qdrantManager != nil {
-		if !qdrantManager.IsRunning() {
-			g.Log().Info(a.ctx, "Qdrant is required but not running, starting it first...")
-			runtime.EventsEmit(a.ctx, "rag:start:progress", map[string]interface{}{
-				"status": "正在启动 Qdrant...",
-			})
-
-			// Check if Qdrant is installed
-			if !qdrantManager.IsInstalled() {
-				err := fmt.Errorf("Qdrant 未安装，请先下载并安装 Qdrant")
-				runtime.EventsEmit(a.ctx, "rag:start:error", map[string]interface{}{
-					"error": err.Error(),
-				})
-				return err
-			}
-
-			// Start Qdrant
-			if err := qdrantManager.Start(); err != nil {
-				runtime.EventsEmit(a.ctx, "rag:start:error", map[string]interface{}{
-					"error": fmt.Sprintf("启动 Qdrant 失败: %v", err),
-				})
-				return err
-			}
-
-			// Wait for Qdrant to become healthy
-			runtime.EventsEmit(a.ctx, "rag:start:progress", map[string]interface{}{
-				"status": "等待 Qdrant 服务启动...",
-			})
-			if err := qdrantManager.WaitForHealth(30 * time.Second); err != nil {
-				runtime.EventsEmit(a.ctx, "rag:start:error", map[string]interface{}{
-					"error": fmt.Sprintf("Qdrant 服务启动超时: %v", err),
-				})
-				return err
-			}
-			g.Log().Info(a.ctx, "Qdrant started successfully")
-		} else {
-			g.Log().Info(a.ctx, "Qdrant is already running")
-		}
-	}
-
-	// Now start RAG service
-	runtime.EventsEmit(a.ctx, "rag:start:progress", map[string]interface{}{
-		"status": "正在启动 RAG 服务...",
+	err := a.api().StartService("rag", func(status string) {
+		runtime.EventsEmit(a.ctx, "rag:start:progress", map[string]interface{}{
+			"status": status,
+		})
 	})
-
-	err := a.chatAPI.StartRAG()
 	if err != nil {
 		runtime.EventsEmit(a.ctx, "rag:start:error", map[string]interface{}{
 			"error": err.Error(),
@@ -299,21 +439,6 @@ func (a *App) StartRAG() error {
 		return err
 	}
 
-	// Wait for service to become healthy
-	ragManager := a.chatAPI.GetRAGManager()
-	if ragManager != nil {
-		runtime.EventsEmit(a.ctx, "rag:start:progress", map[string]interface{}{
-			"status": "等待 RAG 服务启动...",
-		})
-
-		if err := ragManager.WaitForHealth(30 * time.Second); err != nil {
-			runtime.EventsEmit(a.ctx, "rag:start:error", map[string]interface{}{
-				"error": err.Error(),
-			})
-			return err
-		}
-	}
-
 	runtime.EventsEmit(a.ctx, "rag:start:complete", nil)
 	return nil
 }
@@ -327,7 +452,7 @@ func (a *App) StopRAG() error {
 	})
 
 	g.Log().Info(a.ctx, "Calling chatAPI.StopRAG()")
-	err := a.chatAPI.StopRAG()
+	err := a.api().StopRAG()
 	if err != nil {
 		g.Log().Errorf(a.ctx, "StopRAG error: %v", err)
 		runtime.EventsEmit(a.ctx, "rag:stop:error", map[string]interface{}{
@@ -343,22 +468,28 @@ func (a *App) StopRAG() error {
 
 // GetRAGStatus returns RAG service status
 func (a *App) GetRAGStatus() map[string]interface{} {
-	return a.chatAPI.GetRAGStatus()
+	return a.api().GetRAGStatus()
 }
 
 // CheckRAGHealth checks if RAG service is healthy
 func (a *App) CheckRAGHealth() error {
-	return a.chatAPI.CheckRAGHealth()
+	return a.api().CheckRAGHealth()
 }
 
-// GetRAGConfig reads RAG config file content
+// GetRAGConfig reads RAG config file content (secrets masked)
 func (a *App) GetRAGConfig() (string, error) {
-	return a.chatAPI.GetRAGConfigContent()
+	content, err := a.api().GetRAGConfigContent()
+	return secret.MaskText(content), err
 }
 
-// SaveRAGConfig saves RAG config file content
+// SaveRAGConfig saves RAG config file content, restoring masked secrets
+// Content that still has a masked secret (two keys sharing a mask) is rejected
 func (a *App) SaveRAGConfig(content string) error {
-	return a.chatAPI.SaveRAGConfigContent(content)
+	content = secret.UnmaskText(content)
+	if err := config.CheckMaskedSecrets(content); err != nil {
+		return err
+	}
+	return a.api().SaveRAGConfigContent(a.uiCtx(), content)
 }
 
 // Qdrant Manager Methods
@@ -366,7 +497,7 @@ func (a *App) SaveRAGConfig(content string) error {
 // DownloadQdrant downloads Qdrant binary with progress
 func (a *App) DownloadQdrant() error {
 	runtime.EventsEmit(a.ctx, "qdrant:download:start", nil)
-	err := a.chatAPI.DownloadQdrant()
+	err := a.api().DownloadQdrant()
 	if err != nil {
 		runtime.EventsEmit(a.ctx, "qdrant:download:error", map[string]interface{}{
 			"error": err.Error(),
@@ -379,11 +510,11 @@ func (a *App) DownloadQdrant() error {
 
 // StartQdrant starts Qdrant service
 func (a *App) StartQdrant() error {
-	runtime.EventsEmit(a.ctx, "qdrant:start:progress", map[string]interface{}{
-		"status": "正在启动 Qdrant...",
+	err := a.api().StartService("qdrant", func(status string) {
+		runtime.EventsEmit(a.ctx, "qdrant:start:progress", map[string]interface{}{
+			"status": status,
+		})
 	})
-
-	err := a.chatAPI.StartQdrant()
 	if err != nil {
 		runtime.EventsEmit(a.ctx, "qdrant:start:error", map[string]interface{}{
 			"error": err.Error(),
@@ -391,21 +522,6 @@ func (a *App) StartQdrant() error {
 		return err
 	}
 
-	// Wait for service to become healthy
-	qdrantManager := a.chatAPI.GetQdrantManager()
-	if qdrantManager != nil {
-		runtime.EventsEmit(a.ctx, "qdrant:start:progress", map[string]interface{}{
-			"status": "等待 Qdrant 服务启动...",
-		})
-
-		if err := qdrantManager.WaitForHealth(30 * time.Second); err != nil {
-			runtime.EventsEmit(a.ctx, "qdrant:start:error", map[string]interface{}{
-				"error": err.Error(),
-			})
-			return err
-		}
-	}
-
 	runtime.EventsEmit(a.ctx, "qdrant:start:complete", nil)
 	return nil
 }
@@ -418,7 +534,7 @@ func (a *App) StopQdrant() error {
 		"status": "正在停止 Qdrant...",
 	})
 
-	err := a.chatAPI.StopQdrant()
+	err := a.api().StopQdrant()
 	if err != nil {
 		g.Log().Errorf(a.ctx, "StopQdrant error: %v", err)
 		runtime.EventsEmit(a.ctx, "qdrant:stop:error", map[string]interface{}{
@@ -434,12 +550,325 @@ func (a *App) StopQdrant() error {
 
 // GetQdrantStatus returns Qdrant service status
 func (a *App) GetQdrantStatus() map[string]interface{} {
-	return a.chatAPI.GetQdrantStatus()
+	return a.api().GetQdrantStatus()
 }
 
 // CheckQdrantHealth checks if Qdrant service is healthy
 func (a *App) CheckQdrantHealth() error {
-	return a.chatAPI.CheckQdrantHealth()
+	return a.api().CheckQdrantHealth()
+}
+
+// Ollama Manager Methods
+
+// DownloadOllama downloads Ollama binary with progress
+func (a *App) DownloadOllama() error {
+	runtime.EventsEmit(a.ctx, "ollama:download:start", nil)
+	err := a.api().DownloadOllama()
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "ollama:download:error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "ollama:download:complete", nil)
+	return nil
+}
+
+// StartOllama starts Ollama service and registers it as an AI provider
+func (a *App) StartOllama() error {
+	err := a.api().StartService("ollama", func(status string) {
+		runtime.EventsEmit(a.ctx, "ollama:start:progress", map[string]interface{}{
+			"status": status,
+		})
+	})
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "ollama:start:error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return err
+	}
+
+	// 注册为 AI 提供方失败不影响服务本身
+	if err := a.api().RegisterOllamaProvider(); err != nil {
+		g.Log().Warningf(a.ctx, "Warning: Failed to register Ollama provider: %v", err)
+	}
+
+	runtime.EventsEmit(a.ctx, "ollama:start:complete", nil)
+	return nil
+}
+
+// StopOllama stops Ollama service
+func (a *App) StopOllama() error {
+	runtime.EventsEmit(a.ctx, "ollama:stop:progress", map[string]interface{}{
+		"status": "正在停止 Ollama...",
+	})
+
+	err := a.api().StopOllama()
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "ollama:stop:error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return err
+	}
+
+	runtime.EventsEmit(a.ctx, "ollama:stop:complete", nil)
+	return nil
+}
+
+// GetOllamaStatus returns Ollama service status
+func (a *App) GetOllamaStatus() map[string]interface{} {
+	return a.api().GetOllamaStatus()
+}
+
+// ListOllamaModels returns models downloaded into the local Ollama server
+func (a *App) ListOllamaModels() ([]service.OllamaModel, error) {
+	return a.api().ListOllamaModels()
+}
+
+// PullOllamaModel pulls a model with progress and refreshes the registered provider
+func (a *App) PullOllamaModel(name string) error {
+	runtime.EventsEmit(a.ctx, "ollama:pull:start", map[string]interface{}{
+		"model": name,
+	})
+	if err := a.api().PullOllamaModel(name); err != nil {
+		runtime.EventsEmit(a.ctx, "ollama:pull:error", map[string]interface{}{
+			"model": name,
+			"error": err.Error(),
+		})
+		return err
+	}
+
+	// 刷新提供方的模型列表
+	if err := a.api().RegisterOllamaProvider(); err != nil {
+		g.Log().Warningf(a.ctx, "Warning: Failed to register Ollama provider: %v", err)
+	}
+
+	runtime.EventsEmit(a.ctx, "ollama:pull:complete", map[string]interface{}{
+		"model": name,
+	})
+	return nil
+}
+
+// Managed Services Methods
+
+// ListManagedServices returns status of services declared in the services section of config
+func (a *App) ListManagedServices() []map[string]interface{} {
+	return a.api().ListManagedServices()
+}
+
+// DownloadManagedService downloads a config-declared service with progress
+func (a *App) DownloadManagedService(name string) error {
+	runtime.EventsEmit(a.ctx, "service:download:start", map[string]interface{}{
+		"service": name,
+	})
+	if err := a.api().DownloadManagedService(name); err != nil {
+		runtime.EventsEmit(a.ctx, "service:download:error", map[string]interface{}{
+			"service": name,
+			"error":   err.Error(),
+		})
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "service:download:complete", map[string]interface{}{
+		"service": name,
+	})
+	return nil
+}
+
+// StartManagedService starts a config-declared service and its dependencies
+func (a *App) StartManagedService(name string) error {
+	err := a.api().StartService(name, func(status string) {
+		runtime.EventsEmit(a.ctx, "service:start:progress", map[string]interface{}{
+			"service": name,
+			"status":  status,
+		})
+	})
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "service:start:error", map[string]interface{}{
+			"service": name,
+			"error":   err.Error(),
+		})
+		return err
+	}
+
+	runtime.EventsEmit(a.ctx, "service:start:complete", map[string]interface{}{
+		"service": name,
+	})
+	return nil
+}
+
+// StopManagedService stops a config-declared service
+func (a *App) StopManagedService(name string) error {
+	return a.api().StopManagedService(name)
+}
+
+// GetServicesStatus returns the aggregated status of all managed processes
+func (a *App) GetServicesStatus() map[string]interface{} {
+	return a.api().GetServicesStatus()
+}
+
+// GetServiceLogs returns the last tail lines of a service's output (all buffered lines if tail <= 0)
+func (a *App) GetServiceLogs(name string, tail int) ([]service.LogLine, error) {
+	return a.api().GetServiceLogs(name, tail)
+}
+
+// SubscribeServiceLogs streams new output lines of a service as service:log events
+func (a *App) SubscribeServiceLogs(name string) error {
+	a.logMu.Lock()
+	defer a.logMu.Unlock()
+
+	if _, ok := a.logSubscriptions[name]; ok {
+		return nil
+	}
+	unsubscribe, err := a.api().SubscribeServiceLogs(name, func(line service.LogLine) {
+		runtime.EventsEmit(a.ctx, "service:log", line)
+	})
+	if err != nil {
+		return err
+	}
+	a.logSubscriptions[name] = unsubscribe
+	return nil
+}
+
+// UnsubscribeServiceLogs stops streaming the output of a service
+func (a *App) UnsubscribeServiceLogs(name string) {
+	a.logMu.Lock()
+	defer a.logMu.Unlock()
+
+	if unsubscribe, ok := a.logSubscriptions[name]; ok {
+		unsubscribe()
+		delete(a.logSubscriptions, name)
+	}
+}
+
+// CancelDownload cancels the in-progress download or upgrade of a service; the next download resumes it
+func (a *App) CancelDownload(name string) error {
+	return a.api().CancelDownload(name)
+}
+
+// InstallFromArchive installs go-rag, Qdrant or another service from a local archive without network access
+// An empty path opens a file picker
+func (a *App) InstallFromArchive(name, archivePath string) error {
+	if archivePath == "" {
+		var err error
+		archivePath, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "选择安装包",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "安装包 (*.tar.gz, *.tgz, *.zip)", Pattern: "*.tar.gz;*.tgz;*.zip"},
+				{DisplayName: "所有文件", Pattern: "*"},
+			},
+		})
+		if err != nil || archivePath == "" {
+			return err
+		}
+	}
+
+	runtime.EventsEmit(a.ctx, "service:download:start", map[string]interface{}{
+		"service": name,
+	})
+	if err := a.api().InstallFromArchive(name, archivePath); err != nil {
+		runtime.EventsEmit(a.ctx, "service:download:error", map[string]interface{}{
+			"service": name,
+			"error":   err.Error(),
+		})
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "service:download:complete", map[string]interface{}{
+		"service": name,
+	})
+	return nil
+}
+
+// ExportBundle saves the installed services and configs as an offline bundle, an empty path opens a save dialog
+func (a *App) ExportBundle(bundlePath string) (*service.BundleManifest, error) {
+	if bundlePath == "" {
+		var err error
+		bundlePath, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "导出离线安装包",
+			DefaultFilename: "wachat-bundle.tar.gz",
+		})
+		if err != nil || bundlePath == "" {
+			return nil, err
+		}
+	}
+	return a.api().ExportBundle(bundlePath)
+}
+
+// ImportBundle installs the services of an offline bundle, an empty path opens a file picker
+// applyConfig replaces config.yaml with the one in the bundle
+func (a *App) ImportBundle(bundlePath string, applyConfig bool) (*service.BundleManifest, error) {
+	if bundlePath == "" {
+		var err error
+		bundlePath, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:   "导入离线安装包",
+			Filters: []runtime.FileFilter{{DisplayName: "离线安装包 (*.tar.gz)", Pattern: "*.tar.gz"}},
+		})
+		if err != nil || bundlePath == "" {
+			return nil, err
+		}
+	}
+	return a.api().ImportBundle(bundlePath, applyConfig)
+}
+
+// CheckForUpdates queries the GitHub releases API for newer versions of go-rag, Qdrant and other services
+func (a *App) CheckForUpdates() []*service.UpdateInfo {
+	return a.api().CheckForUpdates()
+}
+
+// UpgradeService upgrades a service to the latest release with progress, keeping the previous version
+func (a *App) UpgradeService(name string) error {
+	runtime.EventsEmit(a.ctx, "service:upgrade:start", map[string]interface{}{
+		"service": name,
+	})
+	if err := a.api().UpgradeService(name); err != nil {
+		runtime.EventsEmit(a.ctx, "service:upgrade:error", map[string]interface{}{
+			"service": name,
+			"error":   err.Error(),
+		})
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "service:upgrade:complete", map[string]interface{}{
+		"service": name,
+	})
+	return nil
+}
+
+// Rollback switches a service back to the version installed before the last upgrade
+func (a *App) Rollback(name string) error {
+	return a.api().RollbackService(name)
+}
+
+// ListAIProviders returns the configured AI providers (API keys masked)
+func (a *App) ListAIProviders() []*config.AIProviderConfig {
+	aiConfig := config.GetAIConfig()
+	if aiConfig == nil {
+		return []*config.AIProviderConfig{}
+	}
+	providers := make([]*config.AIProviderConfig, 0, len(aiConfig.Providers))
+	for _, p := range aiConfig.Providers {
+		if p == nil {
+			continue
+		}
+		masked := *p
+		masked.APIKey = secret.Mask(p.APIKey)
+		providers = append(providers, &masked)
+	}
+	return providers
+}
+
+// UseAIProvider switches the active AI settings to a configured provider
+func (a *App) UseAIProvider(name, model string) error {
+	provider := config.GetAIConfig().GetProvider(name)
+	if provider == nil {
+		return fmt.Errorf("AI provider not found: %s", name)
+	}
+	if model == "" && len(provider.Models) > 0 {
+		model = provider.Models[0]
+	}
+	if model == "" {
+		return fmt.Errorf("model cannot be empty")
+	}
+
+	return config.UpdateAISettings(a.uiCtx(), provider.BaseURL, provider.APIKey, model)
 }
 
 // RAGSettings represents RAG configuration settings
@@ -466,12 +895,55 @@ func (a *App) UpdateRAGSettings(topK int, defaultKnowledgeBase string) error {
 		return fmt.Errorf("topK must not exceed 100")
 	}
 
-	return config.UpdateRAGSettings(a.ctx, topK, defaultKnowledgeBase)
+	return config.UpdateRAGSettings(a.uiCtx(), topK, defaultKnowledgeBase)
 }
 
 // GetKnowledgeBases returns list of available knowledge bases
 func (a *App) GetKnowledgeBases() ([]string, error) {
-	return a.chatAPI.GetKnowledgeBases(a.ctx)
+	return a.api().GetKnowledgeBases(a.ctx)
+}
+
+// IngestText adds a document to a knowledge base of the embedded vector store (rag.backend: embedded)
+func (a *App) IngestText(knowledgeBase, name, text string) (*vectorstore.Document, error) {
+	return a.api().IngestDocument(a.ctx, service.IngestRequest{KnowledgeBase: knowledgeBase, Name: name, Text: text})
+}
+
+// IngestFiles adds UTF-8 text files to a knowledge base of the embedded vector store, stopping at the first failure
+func (a *App) IngestFiles(knowledgeBase string, paths []string) ([]*vectorstore.Document, error) {
+	docs := make([]*vectorstore.Document, 0, len(paths))
+	for _, path := range paths {
+		doc, err := a.api().IngestFile(a.ctx, knowledgeBase, path, nil)
+		if err != nil {
+			return docs, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ListDocuments returns the documents of a knowledge base in the embedded vector store (all when empty)
+func (a *App) ListDocuments(knowledgeBase string) ([]vectorstore.Document, error) {
+	return a.api().ListDocuments(knowledgeBase)
+}
+
+// DeleteDocument removes a document from the embedded vector store
+func (a *App) DeleteDocument(id string) error {
+	return a.api().DeleteDocument(id)
+}
+
+// DeleteKnowledgeBase removes a knowledge base from the embedded vector store and returns the number of deleted documents
+func (a *App) DeleteKnowledgeBase(knowledgeBase string) (int, error) {
+	return a.api().DeleteKnowledgeBase(knowledgeBase)
+}
+
+// SearchDocuments searches the embedded vector store (all knowledge bases when none are given)
+func (a *App) SearchDocuments(query string, knowledgeBases []string, topK int) ([]*schema.Document, error) {
+	return a.api().SearchDocuments(a.ctx, service.EmbeddedSearchRequest{Query: query, KnowledgeBases: knowledgeBases, TopK: topK})
+}
+
+// GetVectorStoreStats returns the size of the embedded vector store
+func (a *App) GetVectorStoreStats() (vectorstore.Stats, error) {
+	return a.api().GetVectorStoreStats()
 }
 
 // AISettings represents AI configuration settings
@@ -481,17 +953,17 @@ type AISettings struct {
 	Model   string `json:"model"`
 }
 
-// GetAISettings returns current AI settings
+// GetAISettings returns current AI settings (API key masked)
 func (a *App) GetAISettings() *AISettings {
 	baseURL, apiKey, model := config.GetAISettings()
 	return &AISettings{
 		BaseURL: baseURL,
-		APIKey:  apiKey,
+		APIKey:  secret.Mask(apiKey),
 		Model:   model,
 	}
 }
 
-// UpdateAISettings updates AI settings
+// UpdateAISettings updates AI settings, an unchanged masked key keeps the stored one
 func (a *App) UpdateAISettings(baseURL, apiKey, model string) error {
 	if baseURL == "" {
 		return fmt.Errorf("base URL cannot be empty")
@@ -500,15 +972,95 @@ func (a *App) UpdateAISettings(baseURL, apiKey, model string) error {
 		return fmt.Errorf("model cannot be empty")
 	}
 
-	return config.UpdateAISettings(a.ctx, baseURL, apiKey, model)
+	return config.UpdateAISettings(a.uiCtx(), baseURL, apiKey, model)
 }
 
-// GetConfig reads the entire config file content
+// GetConfig reads the entire config file content (plaintext secrets masked)
 func (a *App) GetConfig() (string, error) {
-	return config.GetConfigContent(a.ctx)
+	content, err := config.GetConfigContent(a.ctx)
+	return secret.MaskText(content), err
 }
 
-// SaveConfig saves the entire config file content
+// SaveConfig validates and saves the entire config file content, restoring masked secrets
+// Content that still has a masked secret (two keys sharing a mask) is rejected
 func (a *App) SaveConfig(content string) error {
-	return config.SaveConfigContent(a.ctx, content)
+	content = secret.UnmaskText(content)
+	if err := config.CheckMaskedSecrets(content); err != nil {
+		return err
+	}
+	return config.SaveConfigContent(a.uiCtx(), content)
+}
+
+// UpdateConfigPath sets a single value (e.g. "rag.topK") keeping the comments and layout of the config file
+func (a *App) UpdateConfigPath(path string, value interface{}) error {
+	if s, ok := value.(string); ok {
+		value = secret.UnmaskText(s)
+	}
+	return config.UpdateConfigPath(a.uiCtx(), path, value)
+}
+
+// ValidateConfig checks config file content without saving it, returning each problem with its line and column
+func (a *App) ValidateConfig(content string) []*config.ValidationError {
+	return config.ValidateContent(a.ctx, secret.UnmaskText(content))
+}
+
+// ListConfigVersions returns saved versions of a config file newest first
+// target is "wachat", "profiles/<name>" or "go-rag", "" lists every file
+func (a *App) ListConfigVersions(target string) ([]*config.ConfigVersion, error) {
+	return config.ListConfigVersions(target)
+}
+
+// DiffConfigVersions returns a unified diff between two versions ("" for the current file), secrets masked
+func (a *App) DiffConfigVersions(target, from, to string) (string, error) {
+	diff, err := config.DiffConfigVersions(target, from, to)
+	return secret.MaskText(diff), err
+}
+
+// RestoreConfigVersion writes a saved version back to its config file
+// wachat's config is reloaded, go-rag has to be restarted to use the restored config
+func (a *App) RestoreConfigVersion(target, id string) error {
+	a.switchMu.Lock()
+	defer a.switchMu.Unlock()
+
+	previous := config.ActiveProfile()
+	name, err := config.RestoredProfile(target, id)
+	if err != nil {
+		return err
+	}
+	if name == previous {
+		return config.RestoreConfigVersion(a.ctx, target, id)
+	}
+
+	// The restored config.yaml selects another profile: same sequence as SwitchProfile
+	if err := config.CheckProfileSwitch(name); err != nil {
+		return fmt.Errorf("config version %s selects profile %q: %w", id, name, err)
+	}
+	a.apiMu.Lock()
+	defer a.apiMu.Unlock()
+
+	a.unsubscribeAllLogs()
+	a.chatAPI.Close()
+
+	if err := config.RestoreConfigVersion(a.ctx, target, id); err != nil {
+		if restoreErr := a.restoreBackend(previous); restoreErr != nil {
+			return fmt.Errorf("failed to restore config version %s: %w (%v)", id, err, restoreErr)
+		}
+		return err
+	}
+	return a.rebuildBackend(previous)
+}
+
+// GetEffectiveConfig returns every config value in effect with its source (file, env or default)
+func (a *App) GetEffectiveConfig() []config.EffectiveValue {
+	return config.GetEffectiveConfig()
+}
+
+// GetSecretsStatus returns the secret store backend, whether it is locked and the stored names
+func (a *App) GetSecretsStatus() *secret.Status {
+	return secret.GetStatus()
+}
+
+// UnlockSecrets unlocks the encrypted secret file with a passphrase and reloads the config
+func (a *App) UnlockSecrets(passphrase string) error {
+	return config.UnlockSecrets(a.ctx, passphrase)
 }
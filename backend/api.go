@@ -4,28 +4,40 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/gogf/gf/v2/frame/g"
 	"github.com/wangle201210/wachat/backend/config"
 	"github.com/wangle201210/wachat/backend/database"
 	"github.com/wangle201210/wachat/backend/model"
 	"github.com/wangle201210/wachat/backend/repository"
 	"github.com/wangle201210/wachat/backend/service"
+	"github.com/wangle201210/wachat/backend/vectorstore"
 
 	"github.com/cloudwego/eino/schema"
 )
 
 // API is the main entry point for backend functionality (GoFrame version)
 type API struct {
+	db            *database.Database
 	chatService   *service.ChatService
 	aiService     *service.AIService
 	ragService    *service.RAGServiceImpl
+	qdrantRAG     *service.QdrantRAGService   // rag.backend 为 qdrant 时直接查询 Qdrant
+	embeddedRAG   *service.EmbeddedRAGService // rag.backend 为 embedded 时使用内置向量库
 	ragManager    *service.RAGManagerService
 	qdrantManager *service.QdrantManagerService
+	mcpManager    *service.MCPManagerService
+	apiServer     *service.APIServerService
+	ollamaManager *service.OllamaManagerService
+	services      *service.ManagedServiceRegistry
+	orchestrator  *service.ServiceOrchestrator
+	unsubscribe   func() // 取消配置变更订阅
 }
 
 // NewAPI creates a new backend API instance (GoFrame version)
+// The database and services follow the active profile, call Close before creating another API
 func NewAPI(ctx context.Context) (*API, error) {
-	// Initialize database
-	db, err := database.NewDatabase()
+	// Initialize database (per profile when the profile sets ownDatabase)
+	db, err := database.NewDatabase(config.GetDatabasePath())
 	if err != nil {
 		return nil, fmt.Errorf("failed to init database: %w", err)
 	}
@@ -38,57 +50,269 @@ func NewAPI(ctx context.Context) (*API, error) {
 	aiConfig := config.GetAIConfig()
 	ragConfig := config.GetRAGConfig()
 	qdrantConfig := config.GetQdrantConfig()
+	mcpConfig := config.GetMCPConfig()
+	apiServerConfig := config.GetAPIServerConfig()
+	ollamaConfig := config.GetOllamaConfig()
+
+	// Shared downloader settings (timeout, retries, proxy, mirrors)
+	service.SetDownloadConfig(config.GetDownloadConfig())
 
 	// Initialize RAG service (GoFrame version)
 	ragService, err := service.NewRAGService(ctx, ragConfig, aiConfig)
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to init RAG service: %w", err)
 	}
 
+	// Native Qdrant retrieval (rag.backend: qdrant, 无需运行 go-rag)
+	qdrantRAG := service.NewQdrantRAGService(ctx, ragConfig, qdrantConfig)
+
+	// Embedded vector store (rag.backend: embedded, 无需运行 go-rag 和 Qdrant)
+	embeddedRAG := service.NewEmbeddedRAGService(ctx, ragConfig)
+
 	// Initialize AI service
-	// 注意：AIService 需要适配 RAGServiceGF
-	// 这里暂时使用一个适配器包装
-	aiService := service.NewAIService(aiConfig, &ragServiceAdapter{ragService})
+	// 适配器按 rag.backend 选择检索后端，AIService 不关心具体实现
+	aiService := service.NewAIService(aiConfig, &ragServiceAdapter{ragService, qdrantRAG, embeddedRAG})
+
+	// Initialize MCP manager service (用于连接外部 MCP 工具服务器)
+	mcpManager := service.NewMCPManagerService(ctx, mcpConfig)
+	aiService.SetToolProvider(mcpManager)
 
 	// Initialize chat service
 	chatService := service.NewChatService(convRepo, msgRepo, aiService)
 
+	// Initialize API server (本地 OpenAI 兼容 API，默认关闭)
+	apiServer := service.NewAPIServerService(ctx, apiServerConfig, aiService, chatService)
+
 	// Initialize RAG manager service (用于下载和管理 go-rag)
 	ragManager := service.NewRAGManagerService(ctx, ragConfig)
 
 	// Initialize Qdrant manager service (用于下载和管理 Qdrant)
 	qdrantManager := service.NewQdrantManagerService(ctx, qdrantConfig)
 
-	return &API{
+	// Initialize Ollama manager service (用于下载和管理本地推理服务)
+	ollamaManager := service.NewOllamaManagerService(ctx, ollamaConfig)
+
+	// Initialize managed services declared in config (services 段)
+	services := service.NewManagedServiceRegistry(ctx, config.GetServicesConfig())
+
+	// Build the service dependency graph (go-rag 依赖 Qdrant)
+	orchestrator := service.NewServiceOrchestrator(ctx)
+	orchestrator.Register("qdrant", qdrantManager, nil, qdrantConfig.AutoStart)
+	orchestrator.Register("rag", ragManager, ragDependencies(ragConfig, qdrantConfig), ragConfig.AutoStart)
+	orchestrator.Register("ollama", ollamaManager, nil, ollamaConfig.IsEnabled() && ollamaConfig.AutoStart)
+	services.RegisterWith(orchestrator)
+
+	api := &API{
+		db:            db,
 		chatService:   chatService,
 		aiService:     aiService,
 		ragService:    ragService,
+		qdrantRAG:     qdrantRAG,
+		embeddedRAG:   embeddedRAG,
 		ragManager:    ragManager,
 		qdrantManager: qdrantManager,
-	}, nil
+		mcpManager:    mcpManager,
+		apiServer:     apiServer,
+		ollamaManager: ollamaManager,
+		services:      services,
+		orchestrator:  orchestrator,
+	}
+
+	// Reconfigure the services when their config sections change
+	api.unsubscribe = config.Subscribe(api.onConfigChange,
+		config.SectionAI, config.SectionRAG, config.SectionQdrant, config.SectionOllama,
+		config.SectionAPIServer, config.SectionServices, config.SectionLogs, config.SectionDownload)
+	return api, nil
 }
 
-// ragServiceAdapter 适配器，让 RAGServiceImpl 兼容 AIService 的接口
+// ragDependencies 返回 go-rag 依赖的服务（远程 go-rag 使用它自己的向量库，不依赖本地 Qdrant）
+func ragDependencies(ragConfig *config.RAGConfig, qdrantConfig *config.QdrantConfig) []string {
+	if qdrantConfig.IsEnabled() && !ragConfig.IsRemote() {
+		return []string{"qdrant"}
+	}
+	return nil
+}
+
+// onConfigChange 配置段变化后更新对应的服务：AI 和 RAG 的地址、模型等立即用于之后的请求，
+// go-rag、Qdrant、Ollama 等进程的启动参数变化时按依赖顺序重启，被禁用时停止
+func (a *API) onConfigChange(ctx context.Context, change config.ConfigChange) {
+	switch change.Section {
+	case config.SectionAI:
+		a.aiService.Reconfigure(change.New.(*config.AIConfig))
+
+	case config.SectionRAG:
+		ragConfig := change.New.(*config.RAGConfig)
+		oldConfig, _ := change.Old.(*config.RAGConfig)
+		a.ragService.Reconfigure(ragConfig)
+		a.qdrantRAG.Reconfigure(ragConfig, config.GetQdrantConfig())
+		a.embeddedRAG.Reconfigure(ragConfig)
+		a.reconfigureService(ctx, "rag", a.ragManager.Reconfigure(ragConfig), oldConfig.IsEnabled() && !ragConfig.IsEnabled(),
+			ragDependencies(ragConfig, config.GetQdrantConfig()), ragConfig.AutoStart)
+
+	case config.SectionQdrant:
+		qdrantConfig := change.New.(*config.QdrantConfig)
+		oldConfig, _ := change.Old.(*config.QdrantConfig)
+		a.reconfigureService(ctx, "qdrant", a.qdrantManager.Reconfigure(qdrantConfig), oldConfig.IsEnabled() && !qdrantConfig.IsEnabled(),
+			nil, qdrantConfig.AutoStart)
+		ragConfig := config.GetRAGConfig()
+		a.qdrantRAG.Reconfigure(ragConfig, qdrantConfig)
+		if err := a.orchestrator.Update("rag", ragDependencies(ragConfig, qdrantConfig), ragConfig.AutoStart); err != nil {
+			g.Log().Warningf(ctx, "Warning: Failed to update go-rag dependencies: %v", err)
+		}
+
+	case config.SectionOllama:
+		ollamaConfig := change.New.(*config.OllamaConfig)
+		oldConfig, _ := change.Old.(*config.OllamaConfig)
+		a.reconfigureService(ctx, "ollama", a.ollamaManager.Reconfigure(ollamaConfig), oldConfig.IsEnabled() && !ollamaConfig.IsEnabled(),
+			nil, ollamaConfig.IsEnabled() && ollamaConfig.AutoStart)
+		// 已注册为 AI 提供方时更新提供方的地址
+		provider := config.GetAIConfig().GetProvider(service.OllamaProviderName)
+		if provider != nil && provider.BaseURL != a.ollamaManager.OpenAIBaseURL() && a.ollamaManager.IsRunning() {
+			if err := a.ollamaManager.RegisterProvider(); err != nil {
+				g.Log().Warningf(ctx, "Warning: Failed to update the Ollama AI provider: %v", err)
+			}
+		}
+
+	case config.SectionAPIServer:
+		apiServerConfig := change.New.(*config.APIServerConfig)
+		oldConfig, _ := change.Old.(*config.APIServerConfig)
+		restart := a.apiServer.Reconfigure(apiServerConfig)
+		var err error
+		switch {
+		case oldConfig.IsEnabled() && !apiServerConfig.IsEnabled() && a.apiServer.IsRunning():
+			err = a.apiServer.Stop()
+		case !oldConfig.IsEnabled() && apiServerConfig.IsEnabled() && !a.apiServer.IsRunning():
+			err = a.apiServer.Start()
+		case restart:
+			if err = a.apiServer.Stop(); err == nil {
+				err = a.apiServer.Start()
+			}
+		}
+		if err != nil {
+			g.Log().Warningf(ctx, "Warning: Failed to apply API server config: %v", err)
+		}
+
+	case config.SectionServices:
+		specs, _ := change.New.([]*config.ManagedServiceConfig)
+		restart, removed := a.services.Reconfigure(specs)
+		for _, name := range a.services.Names() {
+			svc, err := a.services.Get(name)
+			if err != nil {
+				continue
+			}
+			spec := svc.Spec()
+			a.reconfigureService(ctx, name, restart[name], removed[name], spec.DependsOn, spec.AutoStart && !removed[name])
+		}
+
+	case config.SectionLogs:
+		a.orchestrator.SetLogConfig(change.New.(*config.ServiceLogConfig))
+
+	case config.SectionDownload:
+		// 下载设置（代理、镜像等）无需重启即可生效
+		service.SetDownloadConfig(change.New.(*config.DownloadConfig))
+	}
+}
+
+// reconfigureService 更新服务在编排器中的依赖和自动启动设置，服务刚被禁用时停止，启动参数变化时重启
+func (a *API) reconfigureService(ctx context.Context, name string, restart, disabled bool, dependsOn []string, autoStart bool) {
+	if err := a.orchestrator.Update(name, dependsOn, autoStart); err != nil {
+		g.Log().Warningf(ctx, "Warning: Failed to update %s: %v", name, err)
+		return
+	}
+
+	var err error
+	switch {
+	case disabled:
+		if a.orchestrator.IsActive(name) {
+			g.Log().Infof(ctx, "%s is disabled in the config, stopping it", name)
+			err = a.orchestrator.Stop(name)
+		}
+	case restart:
+		g.Log().Infof(ctx, "Restarting %s to apply the config change", name)
+		err = a.orchestrator.Restart(name)
+	}
+	if err != nil {
+		g.Log().Warningf(ctx, "Warning: Failed to apply the config change to %s: %v", name, err)
+	}
+}
+
+// ragServiceAdapter 适配器，按 rag.backend 使用 go-rag（RAGServiceImpl）、直接查询 Qdrant（QdrantRAGService）
+// 或内置向量库（EmbeddedRAGService）
 type ragServiceAdapter struct {
-	ragService *service.RAGServiceImpl
+	ragService  *service.RAGServiceImpl
+	qdrantRAG   *service.QdrantRAGService
+	embeddedRAG *service.EmbeddedRAGService
+}
+
+// backend 返回当前启用的检索后端，都未启用时返回 nil
+func (a *ragServiceAdapter) backend() service.RAGService {
+	switch {
+	case a.qdrantRAG != nil && a.qdrantRAG.IsEnabled():
+		return a.qdrantRAG
+	case a.embeddedRAG != nil && a.embeddedRAG.IsEnabled():
+		return a.embeddedRAG
+	case a.ragService != nil && a.ragService.IsEnabled():
+		return a.ragService
+	}
+	return nil
 }
 
 func (a *ragServiceAdapter) IsEnabled() bool {
-	return a.ragService != nil && a.ragService.IsEnabled()
+	return a.backend() != nil
 }
 
 func (a *ragServiceAdapter) RetrieveWithContext(ctx context.Context, query string) (string, error) {
-	if a.ragService == nil {
+	backend := a.backend()
+	if backend == nil {
 		return "", nil
 	}
-	return a.ragService.RetrieveWithContext(ctx, query)
+	return backend.RetrieveWithContext(ctx, query)
 }
 
 func (a *ragServiceAdapter) RetrieveDocuments(ctx context.Context, query string) ([]*schema.Document, error) {
-	if a.ragService == nil {
+	backend := a.backend()
+	if backend == nil {
+		return nil, nil
+	}
+	return backend.RetrieveDocuments(ctx, query)
+}
+
+func (a *ragServiceAdapter) RetrieveFromKnowledgeBases(ctx context.Context, query string, knowledgeBases []string) ([]*schema.Document, error) {
+	backend := a.backend()
+	if backend == nil {
 		return nil, nil
 	}
-	return a.ragService.RetrieveDocuments(ctx, query)
+	return backend.RetrieveFromKnowledgeBases(ctx, query, knowledgeBases)
+}
+
+// Close stops every service started through the API and closes the database
+func (a *API) Close() {
+	ctx := context.Background()
+
+	// Stop reacting to config changes before the services are stopped
+	a.unsubscribe()
+
+	// Stop all orchestrated services (binaries included) in reverse dependency order
+	a.orchestrator.StopAll()
+
+	// Stop API server
+	if a.apiServer != nil && a.apiServer.IsRunning() {
+		g.Log().Info(ctx, "Stopping API server...")
+		if err := a.apiServer.Stop(); err != nil {
+			g.Log().Warningf(ctx, "Warning: Failed to stop API server: %v", err)
+		}
+	}
+
+	// Stop MCP servers
+	if a.mcpManager != nil {
+		g.Log().Info(ctx, "Stopping MCP servers...")
+		a.mcpManager.StopAll()
+	}
+
+	if err := a.db.Close(); err != nil {
+		g.Log().Warningf(ctx, "Warning: Failed to close database: %v", err)
+	}
 }
 
 // SetContext sets the runtime context
@@ -141,6 +365,16 @@ func (a *API) GetRAGService() *service.RAGServiceImpl {
 	return a.ragService
 }
 
+// GetQdrantRAGService returns the native Qdrant retrieval backend
+func (a *API) GetQdrantRAGService() *service.QdrantRAGService {
+	return a.qdrantRAG
+}
+
+// GetEmbeddedRAGService returns the embedded vector store retrieval backend
+func (a *API) GetEmbeddedRAGService() *service.EmbeddedRAGService {
+	return a.embeddedRAG
+}
+
 // GetRAGManager returns RAG manager service
 func (a *API) GetRAGManager() *service.RAGManagerService {
 	return a.ragManager
@@ -155,12 +389,12 @@ func (a *API) DownloadRAG() error {
 
 // StartRAG starts go-rag service
 func (a *API) StartRAG() error {
-	return a.ragManager.Start()
+	return a.orchestrator.Start("rag", nil)
 }
 
 // StopRAG stops go-rag service
 func (a *API) StopRAG() error {
-	return a.ragManager.Stop()
+	return a.orchestrator.Stop("rag")
 }
 
 // GetRAGStatus returns RAG service status
@@ -178,9 +412,9 @@ func (a *API) GetRAGConfigContent() (string, error) {
 	return a.ragManager.GetConfigContent()
 }
 
-// SaveRAGConfigContent saves RAG config file content
-func (a *API) SaveRAGConfigContent(content string) error {
-	return a.ragManager.SaveConfigContent(content)
+// SaveRAGConfigContent saves RAG config file content, ctx carries the change source for the config history
+func (a *API) SaveRAGConfigContent(ctx context.Context, content string) error {
+	return a.ragManager.SaveConfigContent(ctx, content)
 }
 
 // Qdrant Manager API methods
@@ -197,12 +431,12 @@ func (a *API) DownloadQdrant() error {
 
 // StartQdrant starts Qdrant service
 func (a *API) StartQdrant() error {
-	return a.qdrantManager.Start()
+	return a.orchestrator.Start("qdrant", nil)
 }
 
 // StopQdrant stops Qdrant service
 func (a *API) StopQdrant() error {
-	return a.qdrantManager.Stop()
+	return a.orchestrator.Stop("qdrant")
 }
 
 // GetQdrantStatus returns Qdrant service status
@@ -215,8 +449,222 @@ func (a *API) CheckQdrantHealth() error {
 	return a.qdrantManager.CheckHealth()
 }
 
+// MCP Manager API methods
+
+// GetMCPManager returns MCP manager service
+func (a *API) GetMCPManager() *service.MCPManagerService {
+	return a.mcpManager
+}
+
+// ListMCPServers returns status of all configured MCP servers
+func (a *API) ListMCPServers() []map[string]interface{} {
+	return a.mcpManager.ListServers()
+}
+
+// StartMCPServer connects to the given MCP server
+func (a *API) StartMCPServer(name string) error {
+	return a.mcpManager.Start(name)
+}
+
+// StopMCPServer disconnects from the given MCP server
+func (a *API) StopMCPServer(name string) error {
+	return a.mcpManager.Stop(name)
+}
+
+// UpdateConversationMCPServers sets the MCP servers enabled for a conversation
+func (a *API) UpdateConversationMCPServers(id string, servers []string) error {
+	return a.chatService.UpdateConversationMCPServers(id, servers)
+}
+
+// API Server methods
+
+// GetAPIServer returns the OpenAI-compatible API server
+func (a *API) GetAPIServer() *service.APIServerService {
+	return a.apiServer
+}
+
+// StartAPIServer starts the OpenAI-compatible API server
+func (a *API) StartAPIServer() error {
+	return a.apiServer.Start()
+}
+
+// StopAPIServer stops the OpenAI-compatible API server
+func (a *API) StopAPIServer() error {
+	return a.apiServer.Stop()
+}
+
+// GetAPIServerStatus returns the OpenAI-compatible API server status
+func (a *API) GetAPIServerStatus() map[string]interface{} {
+	return a.apiServer.GetStatus()
+}
+
+// Ollama Manager API methods
+
+// GetOllamaManager returns Ollama manager service
+func (a *API) GetOllamaManager() *service.OllamaManagerService {
+	return a.ollamaManager
+}
+
+// DownloadOllama downloads Ollama binary
+func (a *API) DownloadOllama() error {
+	return a.ollamaManager.Download()
+}
+
+// StartOllama starts Ollama server
+func (a *API) StartOllama() error {
+	return a.orchestrator.Start("ollama", nil)
+}
+
+// StopOllama stops Ollama server
+func (a *API) StopOllama() error {
+	return a.orchestrator.Stop("ollama")
+}
+
+// GetOllamaStatus returns Ollama server status
+func (a *API) GetOllamaStatus() map[string]interface{} {
+	return a.ollamaManager.GetStatus()
+}
+
+// ListOllamaModels returns models available in the local Ollama server
+func (a *API) ListOllamaModels() ([]service.OllamaModel, error) {
+	return a.ollamaManager.ListModels()
+}
+
+// PullOllamaModel pulls a model into the local Ollama server
+func (a *API) PullOllamaModel(name string) error {
+	return a.ollamaManager.PullModel(name)
+}
+
+// RegisterOllamaProvider registers the local Ollama server as an AI provider
+func (a *API) RegisterOllamaProvider() error {
+	return a.ollamaManager.RegisterProvider()
+}
+
+// Managed Services API methods
+
+// GetManagedServices returns the registry of config-declared services
+func (a *API) GetManagedServices() *service.ManagedServiceRegistry {
+	return a.services
+}
+
+// ListManagedServices returns status of all config-declared services
+func (a *API) ListManagedServices() []map[string]interface{} {
+	return a.services.List()
+}
+
+// DownloadManagedService downloads the binary of a config-declared service
+func (a *API) DownloadManagedService(name string) error {
+	svc, err := a.services.Get(name)
+	if err != nil {
+		return err
+	}
+	return svc.Download()
+}
+
+// StartManagedService starts a config-declared service
+func (a *API) StartManagedService(name string) error {
+	return a.orchestrator.Start(name, nil)
+}
+
+// StopManagedService stops a config-declared service
+func (a *API) StopManagedService(name string) error {
+	return a.orchestrator.Stop(name)
+}
+
+// Service Orchestrator API methods
+
+// GetOrchestrator returns the service dependency orchestrator
+func (a *API) GetOrchestrator() *service.ServiceOrchestrator {
+	return a.orchestrator
+}
+
+// StartService starts a service and its dependencies in topological order
+func (a *API) StartService(name string, notify func(status string)) error {
+	return a.orchestrator.Start(name, notify)
+}
+
+// StopService stops a service after the services depending on it
+func (a *API) StopService(name string) error {
+	return a.orchestrator.Stop(name)
+}
+
+// GetServiceLogs returns the last tail lines captured from a service (all buffered lines if tail <= 0)
+func (a *API) GetServiceLogs(name string, tail int) ([]service.LogLine, error) {
+	logs, err := a.orchestrator.Logs(name)
+	if err != nil {
+		return nil, err
+	}
+	return logs.Tail(tail), nil
+}
+
+// SubscribeServiceLogs calls fn for every new line of a service, returns the unsubscribe function
+func (a *API) SubscribeServiceLogs(name string, fn func(service.LogLine)) (func(), error) {
+	logs, err := a.orchestrator.Logs(name)
+	if err != nil {
+		return nil, err
+	}
+	return logs.Subscribe(fn), nil
+}
+
+// CancelDownload cancels the in-progress download of a service
+func (a *API) CancelDownload(name string) error {
+	return a.orchestrator.CancelDownload(name)
+}
+
+// InstallFromArchive installs a service from a local release archive or binary (offline install)
+func (a *API) InstallFromArchive(name, archivePath string) error {
+	return a.orchestrator.InstallFromArchive(name, archivePath)
+}
+
+// ExportBundle packages the installed services, their configs and wachat's config.yaml into one archive
+func (a *API) ExportBundle(bundlePath string) (*service.BundleManifest, error) {
+	// Without a readable config file the bundle only contains the services
+	content, _ := config.GetConfigContent(context.Background())
+	return a.orchestrator.ExportBundle(bundlePath, []byte(content))
+}
+
+// ImportBundle installs the services of a bundle, replacing config.yaml with the bundled one if applyConfig is set
+func (a *API) ImportBundle(bundlePath string, applyConfig bool) (*service.BundleManifest, error) {
+	manifest, wachatConfig, err := a.orchestrator.ImportBundle(bundlePath)
+	if err != nil {
+		return manifest, err
+	}
+	if applyConfig && wachatConfig != nil {
+		if err := config.SaveConfigContent(context.Background(), string(wachatConfig)); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+// CheckForUpdates queries the latest release of every versioned service
+func (a *API) CheckForUpdates() []*service.UpdateInfo {
+	return a.orchestrator.CheckForUpdates()
+}
+
+// UpgradeService installs the latest release of a service, keeping the current version for rollback
+func (a *API) UpgradeService(name string) error {
+	return a.orchestrator.Upgrade(name)
+}
+
+// RollbackService switches a service back to its previous version
+func (a *API) RollbackService(name string) error {
+	return a.orchestrator.Rollback(name)
+}
+
+// GetServicesStatus returns the aggregated status of all orchestrated services
+func (a *API) GetServicesStatus() map[string]interface{} {
+	return a.orchestrator.GetStatus()
+}
+
 // GetKnowledgeBases returns list of knowledge bases from RAG service
 func (a *API) GetKnowledgeBases(ctx context.Context) ([]string, error) {
+	if a.qdrantRAG != nil && a.qdrantRAG.IsEnabled() {
+		return a.qdrantRAG.KnowledgeBases(ctx)
+	}
+	if a.embeddedRAG != nil && a.embeddedRAG.IsEnabled() {
+		return a.embeddedRAG.KnowledgeBases()
+	}
 	if a.ragService == nil || !a.ragService.IsEnabled() {
 		return []string{}, nil
 	}
@@ -234,3 +682,38 @@ func (a *API) GetKnowledgeBases(ctx context.Context) ([]string, error) {
 
 	return knowledgeBases, nil
 }
+
+// IngestDocument splits, embeds and stores a document in the embedded vector store (rag.backend: embedded)
+func (a *API) IngestDocument(ctx context.Context, req service.IngestRequest) (*vectorstore.Document, error) {
+	return a.embeddedRAG.Ingest(ctx, req)
+}
+
+// IngestFile stores a UTF-8 text file in a knowledge base of the embedded vector store
+func (a *API) IngestFile(ctx context.Context, knowledgeBase, path string, metadata map[string]interface{}) (*vectorstore.Document, error) {
+	return a.embeddedRAG.IngestFile(ctx, knowledgeBase, path, metadata)
+}
+
+// ListDocuments returns the documents of a knowledge base in the embedded vector store (all when empty)
+func (a *API) ListDocuments(knowledgeBase string) ([]vectorstore.Document, error) {
+	return a.embeddedRAG.Documents(knowledgeBase)
+}
+
+// DeleteDocument removes a document from the embedded vector store
+func (a *API) DeleteDocument(id string) error {
+	return a.embeddedRAG.DeleteDocument(id)
+}
+
+// DeleteKnowledgeBase removes every document of a knowledge base from the embedded vector store
+func (a *API) DeleteKnowledgeBase(knowledgeBase string) (int, error) {
+	return a.embeddedRAG.DeleteKnowledgeBase(knowledgeBase)
+}
+
+// SearchDocuments searches the embedded vector store
+func (a *API) SearchDocuments(ctx context.Context, req service.EmbeddedSearchRequest) ([]*schema.Document, error) {
+	return a.embeddedRAG.Search(ctx, req)
+}
+
+// GetVectorStoreStats returns the size of the embedded vector store
+func (a *API) GetVectorStoreStats() (vectorstore.Stats, error) {
+	return a.embeddedRAG.Stats()
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,7 +15,8 @@ import (
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/os/gcfg"
 	"github.com/gogf/gf/v2/os/gfile"
-	"gopkg.in/yaml.v3"
+	"github.com/gogf/gf/v2/os/glog"
+	"github.com/wangle201210/wachat/backend/secret"
 )
 
 var (
@@ -21,8 +25,6 @@ var (
 	configMutex  sync.RWMutex
 	watcher      *fsnotify.Watcher
 	reloadChan   chan struct{}
-	// 配置变更回调
-	onConfigChange func()
 	// 标记是否跳过下一次自动重载（用于写入配置文件时避免循环重载）
 	skipNextReload  bool
 	skipReloadMutex sync.Mutex
@@ -30,25 +32,59 @@ var (
 
 // Config holds all configuration (GoFrame style)
 type Config struct {
-	AI       *AIConfig       `json:"ai"`
-	Binaries *BinariesConfig `json:"binaries"`
-	RAG      *RAGConfig      `json:"rag"`
-	Qdrant   *QdrantConfig   `json:"qdrant"`
+	AI        *AIConfig               `json:"ai"`
+	Binaries  *BinariesConfig         `json:"binaries"`
+	RAG       *RAGConfig              `json:"rag"`
+	Qdrant    *QdrantConfig           `json:"qdrant"`
+	MCP       *MCPConfig              `json:"mcp"`
+	APIServer *APIServerConfig        `json:"apiServer"`
+	Ollama    *OllamaConfig           `json:"ollama"`
+	Services  []*ManagedServiceConfig `json:"services"`
+	Logs      *ServiceLogConfig       `json:"serviceLogs"`
+	Download  *DownloadConfig         `json:"download"`
+	Secrets   *SecretsConfig          `json:"secrets"`
+	Profile   *ProfileConfig          `json:"profile"`
+	History   *HistoryConfig          `json:"history"`
 }
 
 // AIConfig holds AI service configuration
 type AIConfig struct {
-	BaseURL string `json:"base_url"`
-	APIKey  string `json:"api_key"`
-	Model   string `json:"model"`
+	BaseURL   string              `json:"base_url"`
+	APIKey    string              `json:"api_key" secret:"true"`
+	Model     string              `json:"model"`
+	Providers []*AIProviderConfig `json:"providers"`
+}
+
+// AIProviderConfig holds an additional OpenAI-compatible provider
+type AIProviderConfig struct {
+	Name    string   `json:"name"`
+	BaseURL string   `json:"base_url"`
+	APIKey  string   `json:"api_key" secret:"true"`
+	Models  []string `json:"models"`
+}
+
+// GetProvider returns the provider with the given name
+func (c *AIConfig) GetProvider(name string) *AIProviderConfig {
+	if c == nil {
+		return nil
+	}
+	for _, p := range c.Providers {
+		if p != nil && p.Name == name {
+			return p
+		}
+	}
+	return nil
 }
 
 // BinariesConfig holds binary manager configuration
 type BinariesConfig struct {
-	Enabled      bool     `json:"enabled"`
-	UseEmbedded  bool     `json:"use_embedded"`
-	BinPath      string   `json:"bin_path"`
-	StartupOrder []string `json:"startup_order"`
+	Enabled      bool                `json:"enabled"`
+	UseEmbedded  bool                `json:"use_embedded"`
+	BinPath      string              `json:"bin_path"`
+	StartupOrder []string            `json:"startup_order"`
+	DependsOn    map[string][]string `json:"depends_on"`   // 二进制之间（或对 qdrant、rag 等服务）的依赖
+	Restart      *RestartConfig      `json:"restart"`      // 进程退出后的重启策略（对所有二进制生效）
+	StopTimeout  int                 `json:"stop_timeout"` // 停止时等待优雅退出的秒数，超时后强制结束
 }
 
 // IsEnabled returns whether binary manager is enabled
@@ -77,14 +113,39 @@ func (c *BinariesConfig) GetStartupOrder() []string {
 	return c.StartupOrder
 }
 
+// GetRestart returns the restart policy applied to every binary
+func (c *BinariesConfig) GetRestart() *RestartConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Restart
+}
+
+// GetStopTimeout returns the graceful stop timeout in seconds applied to every binary
+func (c *BinariesConfig) GetStopTimeout() int {
+	if c == nil {
+		return 0
+	}
+	return c.StopTimeout
+}
+
+// GetDependsOn returns the dependencies of each binary
+func (c *BinariesConfig) GetDependsOn() map[string][]string {
+	if c == nil {
+		return nil
+	}
+	return c.DependsOn
+}
+
 // ServerConfig holds server configuration
 type ServerConfig struct {
 	Address string `json:"address"`
+	URL     string `json:"url"` // go-rag 服务地址（如 http://10.0.0.5:8000），用于连接外部或远程的 go-rag
 }
 
 // ModelConfig holds model API configuration (reused for embedding, rerank, etc.)
 type ModelConfig struct {
-	APIKey  string `json:"apiKey"`
+	APIKey  string `json:"apiKey" secret:"true"`
 	BaseURL string `json:"baseURL"`
 	Model   string `json:"model"`
 }
@@ -93,13 +154,143 @@ type ModelConfig struct {
 // Note: go-rag server reads its own config (server, database, es, embedding, etc.)
 // from GoFrame global config (g.Cfg()), we don't need to load them here
 type RAGConfig struct {
-	Enabled              bool          `json:"enabled"`              // wailsChat 控制：是否启用 RAG 功能
-	AutoStart            bool          `json:"autoStart"`            // 是否自动启动 RAG 服务器（默认 false）
-	TopK                 int           `json:"topK"`                 // 检索返回的文档数量
-	DefaultKnowledgeBase string        `json:"defaultKnowledgeBase"` // 默认知识库名称（用于自动 RAG 增强）
-	DownloadURL          string        `json:"downloadURL"`          // go-rag 下载地址（GitHub Releases）
-	InstallPath          string        `json:"installPath"`          // go-rag 安装路径
-	Server               *ServerConfig `json:"server"`               // go-rag 服务器配置（用于判断是否启动服务器和构建 HTTP 请求）
+	Enabled              bool               `json:"enabled"`              // wailsChat 控制：是否启用 RAG 功能
+	AutoStart            bool               `json:"autoStart"`            // 是否自动启动 RAG 服务器（默认 false）
+	TopK                 int                `json:"topK"`                 // 检索返回的文档数量
+	DefaultKnowledgeBase string             `json:"defaultKnowledgeBase"` // 默认知识库名称（用于自动 RAG 增强）
+	Version              string             `json:"version"`              // 固定安装的 go-rag 版本（为空或 latest 时安装最新版本）
+	DownloadURL          string             `json:"downloadURL"`          // go-rag 下载地址（GitHub Releases）
+	InstallPath          string             `json:"installPath"`          // go-rag 安装路径
+	Server               *ServerConfig      `json:"server"`               // go-rag 服务器配置（用于判断是否启动服务器和构建 HTTP 请求）
+	Restart              *RestartConfig     `json:"restart"`              // go-rag 进程退出后的重启策略
+	StopTimeout          int                `json:"stopTimeout"`          // 停止时等待优雅退出的秒数，超时后强制结束
+	Verify               *VerifyConfig      `json:"verify"`               // 下载文件的完整性校验（默认校验发布的 checksums.txt）
+	Client               *RAGClientConfig   `json:"client"`               // 访问 go-rag API 的超时、TLS、认证、重试和熔断设置
+	Backend              string             `json:"backend"`              // 检索后端：go-rag（默认）、qdrant 或 embedded
+	Embedding            *ModelConfig       `json:"embedding"`            // 计算向量的 OpenAI 兼容 embeddings 接口（默认使用 go-rag 的顶级 embedding 段）
+	Qdrant               *RAGQdrantConfig   `json:"qdrant"`               // backend 为 qdrant 时读取的集合
+	Embedded             *RAGEmbeddedConfig `json:"embedded"`             // backend 为 embedded 时使用的内置向量库
+}
+
+// RAG 检索后端（rag.backend）
+const (
+	RAGBackendGoRAG    = "go-rag"   // 通过 go-rag 的 HTTP API 检索
+	RAGBackendQdrant   = "qdrant"   // 直接查询 Qdrant，查询向量由 embeddings 接口计算，无需运行 go-rag
+	RAGBackendEmbedded = "embedded" // 进程内的向量库，文档由 wachat 切分和写入，无需运行 go-rag 和 Qdrant
+)
+
+// RAGQdrantConfig holds how the qdrant backend reads a Qdrant collection
+// 默认值与 go-rag 写入的集合一致，可以直接检索 go-rag 建立的知识库
+type RAGQdrantConfig struct {
+	URL            string                 `json:"url"`                  // Qdrant 地址（默认使用 qdrant 段的地址）
+	APIKey         string                 `json:"apiKey" secret:"true"` // 以 api-key 请求头发送
+	Collection     string                 `json:"collection"`           // 集合名称（默认使用 go-rag 的 vector.indexName）
+	VectorName     string                 `json:"vectorName"`           // 命名向量（为空时使用 content_vector 或集合中唯一的向量）
+	ContentField   string                 `json:"contentField"`         // 正文所在的 payload 字段（默认 content）
+	KnowledgeField string                 `json:"knowledgeField"`       // 知识库名称所在的 payload 字段（默认 _knowledge_name）
+	MetadataField  string                 `json:"metadataField"`        // 元数据所在的 payload 字段（默认 ext，JSON 字符串或对象）
+	ScoreThreshold float64                `json:"scoreThreshold"`       // 最低相似度（0 表示不限制）
+	Filter         map[string]interface{} `json:"filter"`               // 每次检索附加的 payload 过滤：标量精确匹配，列表匹配其中任意一个
+	TLS            *TLSConfig             `json:"tls"`                  // https 地址的证书设置（rag.client.tls 只用于 go-rag）
+}
+
+// applyRAGQdrantDefaults fills in the payload layout written by go-rag
+func applyRAGQdrantDefaults(c *RAGQdrantConfig) *RAGQdrantConfig {
+	if c == nil {
+		c = &RAGQdrantConfig{}
+	}
+	if c.ContentField == "" {
+		c.ContentField = "content"
+	}
+	if c.KnowledgeField == "" {
+		c.KnowledgeField = "_knowledge_name"
+	}
+	if c.MetadataField == "" {
+		c.MetadataField = "ext"
+	}
+	return c
+}
+
+// RAGEmbeddedConfig holds the in-process vector store used by the embedded backend
+type RAGEmbeddedConfig struct {
+	Dir            string                 `json:"dir"`            // 向量库目录（默认 ~/.wachat/vectors）
+	ChunkSize      int                    `json:"chunkSize"`      // 文本块的最大字符数（默认 500）
+	ChunkOverlap   int                    `json:"chunkOverlap"`   // 相邻文本块重叠的字符数（默认 50）
+	BatchSize      int                    `json:"batchSize"`      // 每次请求 embeddings 接口的文本块数量（默认 16）
+	ScoreThreshold float64                `json:"scoreThreshold"` // 最低相似度（0 表示不限制）
+	Filter         map[string]interface{} `json:"filter"`         // 每次检索附加的元数据过滤：标量精确匹配，列表匹配其中任意一个，{gte: 1} 等为范围
+}
+
+// applyRAGEmbeddedDefaults fills in the embedded vector store defaults
+func applyRAGEmbeddedDefaults(c *RAGEmbeddedConfig) *RAGEmbeddedConfig {
+	if c == nil {
+		c = &RAGEmbeddedConfig{}
+	}
+	if c.Dir == "" {
+		// 默认保存到用户目录 ~/.wachat/vectors
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			c.Dir = filepath.Join(homeDir, ".wachat", "vectors")
+		} else {
+			c.Dir = "./vectors"
+		}
+	}
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 500
+	}
+	if c.ChunkOverlap == 0 {
+		c.ChunkOverlap = 50
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 16
+	}
+	return c
+}
+
+// GetBackend returns the retrieval backend (go-rag when not set)
+func (c *RAGConfig) GetBackend() string {
+	if c == nil || c.Backend == "" {
+		return RAGBackendGoRAG
+	}
+	return c.Backend
+}
+
+// RAGClientConfig holds how wachat calls the go-rag HTTP API
+type RAGClientConfig struct {
+	Timeout       int            `json:"timeout"`             // 单次请求的超时（秒，默认 30）
+	HealthTimeout int            `json:"healthTimeout"`       // 对话前检查 go-rag 是否可达的连接超时（毫秒，默认 500）
+	Retries       *int           `json:"retries"`             // 幂等请求（查询知识库、检索）连接失败或 5xx 时的重试次数（默认 2，0 表示不重试）
+	RetryBackoff  int            `json:"retryBackoff"`        // 首次重试前的等待（毫秒，默认 200），之后每次翻倍并加入随机抖动
+	Token         string         `json:"token" secret:"true"` // 以 Authorization: Bearer 请求头发送
+	APIKey        string         `json:"apiKey" secret:"true"`
+	APIKeyHeader  string         `json:"apiKeyHeader"` // 发送 apiKey 的请求头（默认 X-API-Key）
+	TLS           *TLSConfig     `json:"tls"`          // https 地址的证书设置
+	Breaker       *BreakerConfig `json:"breaker"`      // 熔断：go-rag 连续失败后暂停访问，避免每轮对话都等待超时
+}
+
+// TLSConfig holds client TLS settings (custom CA and mutual TLS)
+type TLSConfig struct {
+	CAFile             string `json:"caFile"`             // 额外信任的 CA 证书（PEM），与系统证书一起使用
+	CertFile           string `json:"certFile"`           // 客户端证书（PEM，mTLS），需要同时设置 keyFile
+	KeyFile            string `json:"keyFile"`            // 客户端私钥（PEM）
+	ServerName         string `json:"serverName"`         // 校验证书时使用的主机名（默认为地址中的主机名）
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"` // 不校验服务器证书（仅用于测试）
+}
+
+// defaultRAGRetries 未设置 retries 时幂等请求的重试次数
+const defaultRAGRetries = 2
+
+// GetRetries returns the retry count for idempotent calls (2 when not set)
+func (c *RAGClientConfig) GetRetries() int {
+	if c == nil || c.Retries == nil {
+		return defaultRAGRetries
+	}
+	return *c.Retries
+}
+
+// BreakerConfig holds circuit breaker settings
+type BreakerConfig struct {
+	Failures int `json:"failures"` // 连续失败多少次后暂停访问（默认 3）
+	Cooldown int `json:"cooldown"` // 暂停的秒数（默认 30），之后放行一次请求试探是否恢复
 }
 
 // IsEnabled returns whether RAG is enabled
@@ -109,17 +300,74 @@ func (c *RAGConfig) IsEnabled() bool {
 
 // IsServerEnabled returns whether go-rag server should be started
 func (c *RAGConfig) IsServerEnabled() bool {
-	return c != nil && c.Server != nil && c.Server.Address != ""
+	return c != nil && c.Server != nil && (c.Server.Address != "" || c.Server.URL != "")
+}
+
+// endpointURL 返回配置的 go-rag 完整地址：rag.server.url，或写成 URL 的 server.address
+func (c *RAGConfig) endpointURL() string {
+	if c.Server.URL != "" {
+		return c.Server.URL
+	}
+	if strings.Contains(c.Server.Address, "://") {
+		return c.Server.Address
+	}
+	return ""
+}
+
+// GetServerURL returns the base URL of go-rag (without the /api suffix)
+// rag.server.url（或写成 URL 的 server.address）优先，可以包含协议和路径前缀，如 https://rag.example.com/go-rag；
+// 否则由 server.address 推导（如 ":8000" -> http://localhost:8000，"0.0.0.0:8000" -> http://localhost:8000）
+func (c *RAGConfig) GetServerURL() string {
+	if !c.IsServerEnabled() {
+		return ""
+	}
+	if u := c.endpointURL(); u != "" {
+		return strings.TrimSuffix(strings.TrimRight(u, "/"), "/api")
+	}
+	return "http://" + localAddress(c.Server.Address)
+}
+
+// GetAPIURL returns the base URL of the go-rag HTTP API
+func (c *RAGConfig) GetAPIURL() string {
+	if !c.IsServerEnabled() {
+		return ""
+	}
+	return c.GetServerURL() + "/api"
+}
+
+// GetServerAddress returns the host:port of go-rag used for TCP health checks
+func (c *RAGConfig) GetServerAddress() string {
+	if !c.IsServerEnabled() {
+		return ""
+	}
+	if u := c.endpointURL(); u != "" {
+		return URLAddress(u)
+	}
+	return localAddress(c.Server.Address)
+}
+
+// IsRemote returns whether go-rag runs on another host and must not be started locally
+func (c *RAGConfig) IsRemote() bool {
+	if !c.IsServerEnabled() {
+		return false
+	}
+	u := c.endpointURL()
+	return u != "" && !isLocalURL(u)
 }
 
 // QdrantConfig holds Qdrant configuration
 type QdrantConfig struct {
-	Enabled     bool   `json:"enabled"`     // 是否启用 Qdrant
-	AutoStart   bool   `json:"autoStart"`   // 是否自动启动 Qdrant
-	Port        int    `json:"port"`        // HTTP 端口（默认 6333）
-	GrpcPort    int    `json:"grpcPort"`    // gRPC 端口（默认 6334）
-	DownloadURL string `json:"downloadURL"` // Qdrant 下载地址（GitHub Releases）
-	InstallPath string `json:"installPath"` // Qdrant 安装路径
+	Enabled     bool           `json:"enabled"`     // 是否启用 Qdrant
+	AutoStart   bool           `json:"autoStart"`   // 是否自动启动 Qdrant
+	Port        int            `json:"port"`        // HTTP 端口（默认 6333）
+	GrpcPort    int            `json:"grpcPort"`    // gRPC 端口（默认 6334）
+	Version     string         `json:"version"`     // 固定安装的 Qdrant 版本（为空或 latest 时安装最新版本）
+	DownloadURL string         `json:"downloadURL"` // Qdrant 下载地址（GitHub Releases）
+	InstallPath string         `json:"installPath"` // Qdrant 安装路径
+	URL         string         `json:"url"`         // Qdrant 服务地址（默认 http://localhost:{port}），用于连接外部或远程的 Qdrant
+	Restart     *RestartConfig `json:"restart"`     // Qdrant 进程退出后的重启策略
+	StopTimeout int            `json:"stopTimeout"` // 停止时等待优雅退出的秒数（等待落盘），超时后强制结束
+	Verify      *VerifyConfig  `json:"verify"`      // 下载文件的完整性校验
 }
 
 // IsEnabled returns whether Qdrant is enabled
@@ -127,6 +375,405 @@ func (c *QdrantConfig) IsEnabled() bool {
 	return c != nil && c.Enabled
 }
 
+// GetURL returns the HTTP base URL of Qdrant
+func (c *QdrantConfig) GetURL() string {
+	if c.URL != "" {
+		return strings.TrimRight(c.URL, "/")
+	}
+	return fmt.Sprintf("http://localhost:%d", c.Port)
+}
+
+// IsRemote returns whether Qdrant runs on another host and must not be started locally
+func (c *QdrantConfig) IsRemote() bool {
+	return c.URL != "" && !isLocalURL(c.URL)
+}
+
+// localAddress completes a listen address such as ":8000" to "localhost:8000"
+func localAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	// 监听所有地址（:8000、0.0.0.0:8000、[::]:8000）时通过 localhost 访问
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return net.JoinHostPort("localhost", port)
+	}
+	return address
+}
+
+// URLAddress returns the host:port of a URL, filling in the default port of the scheme
+func URLAddress(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// isLocalURL reports whether the URL points to this machine
+func isLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// MCPConfig holds MCP (Model Context Protocol) client configuration
+type MCPConfig struct {
+	Enabled bool               `json:"enabled"` // 是否启用 MCP 工具调用
+	Servers []*MCPServerConfig `json:"servers"` // MCP 服务器列表
+}
+
+// IsEnabled returns whether MCP is enabled
+func (c *MCPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// GetServer returns the server declaration with the given name
+func (c *MCPConfig) GetServer(name string) *MCPServerConfig {
+	if c == nil {
+		return nil
+	}
+	for _, s := range c.Servers {
+		if s != nil && s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// MCPServerConfig holds a single MCP server declaration
+type MCPServerConfig struct {
+	Name      string            `json:"name"`      // 服务器名称（会话中按名称启用）
+	Transport string            `json:"transport"` // 传输方式：stdio / sse / http（为空时根据 command/url 推断）
+	Command   string            `json:"command"`   // stdio 模式下启动的命令
+	Args      []string          `json:"args"`      // 命令参数
+	Env       map[string]string `json:"env"`       // 额外环境变量
+	URL       string            `json:"url"`       // sse / http 模式下的服务器地址
+	Headers   map[string]string `json:"headers"`   // sse / http 模式下附加的请求头
+	AutoStart bool              `json:"autoStart"` // 是否在应用启动时连接
+}
+
+// GetTransport returns the effective transport of the server
+func (c *MCPServerConfig) GetTransport() string {
+	if c.Transport != "" {
+		return c.Transport
+	}
+	if c.Command != "" {
+		return "stdio"
+	}
+	return "http"
+}
+
+// OllamaConfig holds local Ollama inference server configuration
+type OllamaConfig struct {
+	Enabled     bool           `json:"enabled"`     // 是否启用本地 Ollama
+	AutoStart   bool           `json:"autoStart"`   // 是否自动启动 Ollama
+	Host        string         `json:"host"`        // 监听地址（默认 127.0.0.1）
+	Port        int            `json:"port"`        // 监听端口（默认 11434）
+	DownloadURL string         `json:"downloadURL"` // Ollama 下载地址（GitHub Releases）
+	InstallPath string         `json:"installPath"` // Ollama 安装路径
+	ModelsPath  string         `json:"modelsPath"`  // 模型存储路径（默认 {installPath}/models）
+	Restart     *RestartConfig `json:"restart"`     // Ollama 进程退出后的重启策略
+	StopTimeout int            `json:"stopTimeout"` // 停止时等待优雅退出的秒数，超时后强制结束
+	Verify      *VerifyConfig  `json:"verify"`      // 下载文件的完整性校验（默认校验发布的 sha256sum.txt）
+}
+
+// IsEnabled returns whether Ollama is enabled
+func (c *OllamaConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// GetAddress returns the host:port Ollama listens on
+func (c *OllamaConfig) GetAddress() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// ManagedServiceConfig declares an external binary service that wachat downloads and supervises
+// 字符串字段支持占位符：{name} {version} {os} {arch} {ext} {installPath}
+type ManagedServiceConfig struct {
+	Name        string                             `json:"name"`        // 服务名称（唯一）
+	DisplayName string                             `json:"displayName"` // 显示名称（默认同 name）
+	Enabled     bool                               `json:"enabled"`     // 是否启用
+	AutoStart   bool                               `json:"autoStart"`   // 是否在应用启动时自动启动
+	External    bool                               `json:"external"`    // 由外部管理（Docker、远程主机等），只做健康检查，不下载也不启动
+	Version     string                             `json:"version"`     // 固定安装的版本（发布标签，如 v1.2.0；为空或 latest 时安装最新版本）
+	ReleasesURL string                             `json:"releasesURL"` // 查询最新版本的 GitHub releases API 地址（默认根据 downloadURL 推导）
+	DownloadURL string                             `json:"downloadURL"` // 下载地址模板
+	OSMap       map[string]string                  `json:"osMap"`       // GOOS 到下载文件名中系统名称的映射
+	ArchMap     map[string]string                  `json:"archMap"`     // GOARCH 到下载文件名中架构名称的映射
+	Archive     *ArchiveConfig                     `json:"archive"`     // 压缩包格式
+	Binary      string                             `json:"binary"`      // 可执行文件相对安装目录的路径（Windows 自动补 .exe）
+	Args        []string                           `json:"args"`        // 启动参数
+	Env         map[string]string                  `json:"env"`         // 额外环境变量
+	InstallPath string                             `json:"installPath"` // 安装路径（默认 ~/.wachat/services/{name}）
+	WorkDir     string                             `json:"workDir"`     // 工作目录（默认为安装路径）
+	Health      *HealthCheckConfig                 `json:"health"`      // 健康检查
+	DependsOn   []string                           `json:"dependsOn"`   // 依赖的服务名称
+	Platforms   map[string]*ManagedServicePlatform `json:"platforms"`   // 按 GOOS 或 GOOS/GOARCH 覆盖的平台差异
+	Restart     *RestartConfig                     `json:"restart"`     // 进程退出后的重启策略
+	StopTimeout int                                `json:"stopTimeout"` // 停止时等待优雅退出的秒数，超时后强制结束
+	Verify      *VerifyConfig                      `json:"verify"`      // 下载文件的完整性校验
+}
+
+// VerifyConfig describes how a downloaded file is verified before it is installed
+// URL 字段除服务占位符外还支持 {url}（下载地址）、{dir}（下载地址所在目录）、{file}（下载文件名）
+type VerifyConfig struct {
+	SHA256      string          `json:"sha256"`      // 固定的 SHA256（优先于 checksumURL，按平台不同时写在 platforms 中）
+	ChecksumURL string          `json:"checksumURL"` // 发布的校验和文件（sha256sum 格式，如 {dir}/checksums.txt）
+	Required    bool            `json:"required"`    // 无法获取校验和时拒绝安装（默认只记录警告）
+	Minisign    *MinisignConfig `json:"minisign"`    // 可选：minisign 签名校验
+	Cosign      *CosignConfig   `json:"cosign"`      // 可选：cosign 签名校验（需要本机安装 cosign）
+}
+
+// MinisignConfig describes a minisign signature check
+type MinisignConfig struct {
+	PublicKey    string `json:"publicKey"`    // 公钥（minisign.pub 第二行的 base64 内容）
+	SignatureURL string `json:"signatureURL"` // 签名地址（默认 {url}.minisig）
+}
+
+// CosignConfig describes a cosign signature check
+type CosignConfig struct {
+	Key          string `json:"key"`          // 公钥文件路径、URL 或 KMS 地址（cosign --key）
+	SignatureURL string `json:"signatureURL"` // 签名地址（默认 {url}.sig）
+}
+
+// RestartConfig describes what to do when a supervised process exits on its own
+type RestartConfig struct {
+	Policy      string `json:"policy"`      // never / on-failure / always（默认 on-failure）
+	MaxRestarts int    `json:"maxRestarts"` // 最大连续重启次数（默认 5）
+	Backoff     int    `json:"backoff"`     // 首次重启前等待的秒数，之后每次翻倍（默认 1）
+	MaxBackoff  int    `json:"maxBackoff"`  // 最大等待秒数（默认 60）
+}
+
+// applyRestartDefaults fills unset restart fields, creating the config when nil
+func applyRestartDefaults(c *RestartConfig) *RestartConfig {
+	if c == nil {
+		c = &RestartConfig{}
+	}
+	if c.Policy == "" {
+		c.Policy = "on-failure"
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = 5
+	}
+	if c.Backoff == 0 {
+		c.Backoff = 1
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 60
+	}
+	return c
+}
+
+// applyRAGClientDefaults fills in the go-rag client defaults
+func applyRAGClientDefaults(c *RAGClientConfig) *RAGClientConfig {
+	if c == nil {
+		c = &RAGClientConfig{}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 30
+	}
+	if c.HealthTimeout == 0 {
+		c.HealthTimeout = 500
+	}
+	if c.Retries == nil {
+		retries := defaultRAGRetries
+		c.Retries = &retries
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = 200
+	}
+	if c.APIKeyHeader == "" {
+		c.APIKeyHeader = "X-API-Key"
+	}
+	if c.Breaker == nil {
+		c.Breaker = &BreakerConfig{}
+	}
+	if c.Breaker.Failures == 0 {
+		c.Breaker.Failures = 3
+	}
+	if c.Breaker.Cooldown == 0 {
+		c.Breaker.Cooldown = 30
+	}
+	return c
+}
+
+// ArchiveConfig describes the layout of a downloaded archive
+type ArchiveConfig struct {
+	Format          string `json:"format"`          // tar.gz / tgz / zip / binary（为空时根据下载地址推断）
+	StripComponents int    `json:"stripComponents"` // 解压时去掉的路径层级
+	MaxSize         int    `json:"maxSize"`         // 解压后的总大小上限（MB，默认 8192）
+	MaxEntries      int    `json:"maxEntries"`      // 条目数量上限（默认 100000）
+}
+
+// ManagedServicePlatform overrides fields of a managed service on a specific platform
+type ManagedServicePlatform struct {
+	DownloadURL string         `json:"downloadURL"`
+	Archive     *ArchiveConfig `json:"archive"`
+	Binary      string         `json:"binary"`
+	SHA256      string         `json:"sha256"` // 该平台下载文件的固定 SHA256
+}
+
+// HealthCheckConfig describes how to check whether a service is healthy
+type HealthCheckConfig struct {
+	Type    string   `json:"type"`    // tcp / http / command / none（为空时根据 url/address/command 推断）
+	Address string   `json:"address"` // tcp 检查地址（host:port）
+	URL     string   `json:"url"`     // http 检查地址，返回 200 视为健康
+	Command []string `json:"command"` // command 检查命令，退出码为 0 视为健康
+}
+
+// GetType returns the effective health check type
+func (c *HealthCheckConfig) GetType() string {
+	if c == nil {
+		return "none"
+	}
+	switch {
+	case c.Type != "":
+		return c.Type
+	case c.URL != "":
+		return "http"
+	case c.Address != "":
+		return "tcp"
+	case len(c.Command) > 0:
+		return "command"
+	}
+	return "none"
+}
+
+// IsEnabled returns whether the managed service is enabled
+func (c *ManagedServiceConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// GetDisplayName returns the name shown in logs and UI
+func (c *ManagedServiceConfig) GetDisplayName() string {
+	if c.DisplayName != "" {
+		return c.DisplayName
+	}
+	return c.Name
+}
+
+// ForPlatform returns a copy of the service with platform overrides applied
+// 匹配顺序：GOOS/GOARCH 优先于 GOOS
+func (c *ManagedServiceConfig) ForPlatform(goos, goarch string) *ManagedServiceConfig {
+	resolved := *c
+	for _, key := range []string{goos, goos + "/" + goarch} {
+		override := c.Platforms[key]
+		if override == nil {
+			continue
+		}
+		if override.DownloadURL != "" {
+			resolved.DownloadURL = override.DownloadURL
+		}
+		if override.Archive != nil {
+			resolved.Archive = override.Archive
+		}
+		if override.Binary != "" {
+			resolved.Binary = override.Binary
+		}
+		if override.SHA256 != "" {
+			verify := VerifyConfig{}
+			if resolved.Verify != nil {
+				verify = *resolved.Verify
+			}
+			verify.SHA256 = override.SHA256
+			resolved.Verify = &verify
+		}
+	}
+	return &resolved
+}
+
+// Validate checks that required fields are set
+func (c *ManagedServiceConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if c.External {
+		if c.Health.GetType() == "none" {
+			return fmt.Errorf("service %s: external service requires a health check", c.Name)
+		}
+	} else if c.Binary == "" {
+		return fmt.Errorf("service %s: binary is required", c.Name)
+	}
+	if c.Version != "" {
+		if err := ValidateVersion(c.Version); err != nil {
+			return fmt.Errorf("service %s: %w", c.Name, err)
+		}
+	}
+	switch c.Health.GetType() {
+	case "none", "tcp", "http", "command":
+	default:
+		return fmt.Errorf("service %s: unsupported health check type: %s", c.Name, c.Health.Type)
+	}
+	if c.Restart != nil {
+		switch c.Restart.Policy {
+		case "", "never", "on-failure", "always":
+		default:
+			return fmt.Errorf("service %s: unsupported restart policy: %s", c.Name, c.Restart.Policy)
+		}
+	}
+	return nil
+}
+
+// APIServerConfig holds the embedded OpenAI-compatible HTTP server configuration
+type APIServerConfig struct {
+	Enabled bool   `json:"enabled"`             // 是否启用本地 OpenAI 兼容 API（默认 false）
+	Port    int    `json:"port"`                // 监听端口（仅绑定 127.0.0.1，默认 8765）
+	Token   string `json:"token" secret:"true"` // 访问令牌（Authorization: Bearer <token>），为空时不校验
+}
+
+// IsEnabled returns whether the API server is enabled
+func (c *APIServerConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// ServiceLogConfig holds log capture settings shared by all supervised services
+type ServiceLogConfig struct {
+	MaxSize     int `json:"maxSize"`     // 单个日志文件的最大大小（MB，默认 10），超过后轮转
+	MaxBackups  int `json:"maxBackups"`  // 保留的历史日志文件数量（默认 3）
+	BufferLines int `json:"bufferLines"` // 内存中保留的最近日志行数（默认 1000）
+}
+
+// DownloadConfig holds settings of the shared downloader used to install services
+type DownloadConfig struct {
+	Timeout int      `json:"timeout"` // 连接及读取无响应的超时（秒，默认 30），不限制整个下载的时长
+	Retries int      `json:"retries"` // 每个下载源的重试次数（默认 3），重试时从断点继续
+	Proxy   string   `json:"proxy"`   // 代理地址，支持 http://、https://、socks5://（为空时使用 HTTP_PROXY 等环境变量）
+	Mirrors []string `json:"mirrors"` // 镜像地址，按顺序尝试，最后尝试原始地址；含 {url} 时替换为原始地址，否则替换原始地址的协议和主机
+}
+
+// SecretsConfig holds where values referenced as secret://<name> are stored
+type SecretsConfig struct {
+	Backend string `json:"backend"` // auto / keyring / file（默认 auto：系统密钥环不可用时使用加密文件）
+	File    string `json:"file"`    // 加密文件路径（默认 ~/.wachat/secrets.vault），口令来自 WACHAT_VAULT_PASSPHRASE 或界面解锁
+}
+
+// ProfileConfig selects the active profile and holds its options
+type ProfileConfig struct {
+	Name        string `json:"name"`        // 当前配置方案（为空时只使用 config.yaml），方案位于 ~/.wachat/profiles/<name>/
+	Description string `json:"description"` // 方案说明（写在方案自己的 config.yaml 中）
+	OwnDatabase bool   `json:"ownDatabase"` // 使用方案目录下独立的 chat.db（默认共用 ~/.wachat/chat.db）
+}
+
+// HistoryConfig holds how many snapshots of changed config files are kept
+type HistoryConfig struct {
+	MaxVersions int `json:"maxVersions"` // 每个配置文件保留的版本数（默认 50）
+	MaxAge      int `json:"maxAge"`      // 版本保留的天数（默认 90），最新的版本总是保留
+}
+
 // isDevMode checks if running in development mode (wails dev)
 func isDevMode() bool {
 	// Check if go.mod exists in current directory (dev mode indicator)
@@ -165,6 +812,9 @@ func findConfigFile() string {
 
 // Load loads configuration using GoFrame
 func Load(ctx context.Context) (*Config, error) {
+	// Redact secrets from all log output
+	glog.SetDefaultHandler(secret.LogHandler)
+
 	// Find config file
 	configPath = findConfigFile()
 	g.Log().Debugf(ctx, "Loading config from: %s", configPath)
@@ -177,13 +827,13 @@ func Load(ctx context.Context) (*Config, error) {
 		if !isDevMode() {
 			if err := createDefaultConfigFile(ctx, configPath); err != nil {
 				g.Log().Warningf(ctx, "Failed to create default config file: %v, using in-memory defaults", err)
-				return createDefaultConfig(), nil
+				return useDefaultConfig(), nil
 			}
 			g.Log().Infof(ctx, "Created default config file at %s", configPath)
 		} else {
 			// In dev mode, just use in-memory defaults (user should copy config.example.yaml)
 			g.Log().Warningf(ctx, "Dev mode: using in-memory defaults. Please copy config.example.yaml to config.yaml")
-			return createDefaultConfig(), nil
+			return useDefaultConfig(), nil
 		}
 	}
 	//
@@ -192,11 +842,17 @@ func Load(ctx context.Context) (*Config, error) {
 	g.Log().Debugf(ctx, "Loading cfgDir from: %s", cfgDir)
 	//
 	// // Create adapter with custom config directory
-	adapter, err := gcfg.NewAdapterFile(configPath)
+	// ${VAR} interpolation and WACHAT_* overrides are applied here
+	adapter, err := newConfigAdapter(ctx, configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create config adapter: %w", err)
 	}
 
+	// Report problems in the config file, the app still starts so they can be fixed in the editor
+	if err := validateFile(ctx, configPath); err != nil {
+		g.Log().Warningf(ctx, "Config file %s has problems, affected values fall back to defaults:\n%v", configPath, err)
+	}
+
 	// Set adapter for GoFrame global instance
 	// This is important for go-rag to access the config via g.Cfg() and g.DB()
 	g.Cfg().SetAdapter(adapter)
@@ -205,6 +861,24 @@ func Load(ctx context.Context) (*Config, error) {
 	cfg := g.Cfg()
 
 	// Parse configuration
+	config := scanConfig(ctx, cfg)
+
+	// Apply defaults
+	applyDefaults(config)
+
+	// Replace secret://<name> references with the stored values
+	resolveSecrets(ctx, config)
+
+	globalConfig = config
+	setHistoryLimits(config.History)
+
+	// Keep the file as it was found, so later changes can be compared with it
+	snapshotConfigFiles(WithChangeSource(ctx, ChangeFile), config.Profile.Name)
+	return config, nil
+}
+
+// scanConfig scans the sections wachat uses from the GoFrame config (defaults are not applied)
+func scanConfig(ctx context.Context, cfg *gcfg.Config) *Config {
 	config := &Config{}
 
 	// Load AI config
@@ -234,15 +908,82 @@ func Load(ctx context.Context) (*Config, error) {
 		}
 	}
 
-	// Apply defaults
-	applyDefaults(config)
+	// Load MCP config
+	config.MCP = &MCPConfig{}
+	if !cfg.MustGet(ctx, "mcp").IsNil() {
+		if err := cfg.MustGet(ctx, "mcp").Scan(config.MCP); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan mcp config: %v", err)
+		}
+	}
 
-	globalConfig = config
-	return config, nil
+	// Load API server config
+	config.APIServer = &APIServerConfig{}
+	if !cfg.MustGet(ctx, "apiServer").IsNil() {
+		if err := cfg.MustGet(ctx, "apiServer").Scan(config.APIServer); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan apiServer config: %v", err)
+		}
+	}
+
+	// Load Ollama config
+	config.Ollama = &OllamaConfig{}
+	if !cfg.MustGet(ctx, "ollama").IsNil() {
+		if err := cfg.MustGet(ctx, "ollama").Scan(config.Ollama); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan ollama config: %v", err)
+		}
+	}
+
+	// Load managed services
+	if !cfg.MustGet(ctx, "services").IsNil() {
+		if err := cfg.MustGet(ctx, "services").Scan(&config.Services); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan services config: %v", err)
+		}
+	}
+
+	// Load service log settings
+	config.Logs = &ServiceLogConfig{}
+	if !cfg.MustGet(ctx, "serviceLogs").IsNil() {
+		if err := cfg.MustGet(ctx, "serviceLogs").Scan(config.Logs); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan serviceLogs config: %v", err)
+		}
+	}
+
+	// Load download settings
+	config.Download = &DownloadConfig{}
+	if !cfg.MustGet(ctx, "download").IsNil() {
+		if err := cfg.MustGet(ctx, "download").Scan(config.Download); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan download config: %v", err)
+		}
+	}
+
+	// Load secret store settings
+	config.Secrets = &SecretsConfig{}
+	if !cfg.MustGet(ctx, "secrets").IsNil() {
+		if err := cfg.MustGet(ctx, "secrets").Scan(config.Secrets); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan secrets config: %v", err)
+		}
+	}
+
+	// Load profile selection
+	config.Profile = &ProfileConfig{}
+	if !cfg.MustGet(ctx, "profile").IsNil() {
+		if err := cfg.MustGet(ctx, "profile").Scan(config.Profile); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan profile config: %v", err)
+		}
+	}
+
+	// Load config history retention
+	config.History = &HistoryConfig{}
+	if !cfg.MustGet(ctx, "history").IsNil() {
+		if err := cfg.MustGet(ctx, "history").Scan(config.History); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan history config: %v", err)
+		}
+	}
+
+	return config
 }
 
 // loadRAGConfig loads RAG configuration
-// Note: Only load wachat-specific config (enabled, topK, server address)
+// Note: Only load wachat-specific config (enabled, topK, server address, embedding)
 // go-rag server will read its own config from GoFrame global config (g.Cfg())
 func loadRAGConfig(ctx context.Context, cfg *gcfg.Config) *RAGConfig {
 	ragCfg := &RAGConfig{}
@@ -255,13 +996,32 @@ func loadRAGConfig(ctx context.Context, cfg *gcfg.Config) *RAGConfig {
 	}
 
 	// Load server config (for determining if go-rag server should start)
+	// rag.server.url 已在上面扫描到 ragCfg.Server，这里只补充顶级 server 段
 	if !cfg.MustGet(ctx, "server").IsNil() {
-		ragCfg.Server = &ServerConfig{}
+		if ragCfg.Server == nil {
+			ragCfg.Server = &ServerConfig{}
+		}
 		if err := cfg.MustGet(ctx, "server").Scan(ragCfg.Server); err != nil {
 			g.Log().Warningf(ctx, "Warning: failed to scan server config: %v", err)
 		}
 	}
 
+	// qdrant 后端默认与 go-rag 共用 embedding 模型和集合
+	if ragCfg.Embedding == nil && !cfg.MustGet(ctx, "embedding").IsNil() {
+		ragCfg.Embedding = &ModelConfig{}
+		if err := cfg.MustGet(ctx, "embedding").Scan(ragCfg.Embedding); err != nil {
+			g.Log().Warningf(ctx, "Warning: failed to scan embedding config: %v", err)
+		}
+	}
+	if indexName := cfg.MustGet(ctx, "vector.indexName").String(); indexName != "" {
+		if ragCfg.Qdrant == nil {
+			ragCfg.Qdrant = &RAGQdrantConfig{}
+		}
+		if ragCfg.Qdrant.Collection == "" {
+			ragCfg.Qdrant.Collection = indexName
+		}
+	}
+
 	return ragCfg
 }
 
@@ -284,9 +1044,28 @@ func createDefaultConfig() *Config {
 		Qdrant: &QdrantConfig{
 			Enabled: true,
 		},
+		MCP: &MCPConfig{},
+		APIServer: &APIServerConfig{
+			Port: 8765,
+		},
+		Ollama:   &OllamaConfig{},
+		Logs:     &ServiceLogConfig{},
+		Download: &DownloadConfig{},
+		Secrets:  &SecretsConfig{},
+		Profile:  &ProfileConfig{},
+		History:  &HistoryConfig{},
 	}
 }
 
+// useDefaultConfig installs in-memory defaults as the global config
+func useDefaultConfig() *Config {
+	cfg := createDefaultConfig()
+	applyDefaults(cfg)
+	globalConfig = cfg
+	setHistoryLimits(cfg.History)
+	return cfg
+}
+
 // createDefaultConfigFile creates a default config.yaml file at the specified path
 func createDefaultConfigFile(ctx context.Context, configPath string) error {
 	// Ensure parent directory exists
@@ -343,6 +1122,7 @@ func applyDefaults(cfg *Config) {
 	if cfg.Binaries.BinPath == "" {
 		cfg.Binaries.BinPath = "./bin"
 	}
+	cfg.Binaries.Restart = applyRestartDefaults(cfg.Binaries.Restart)
 
 	// RAG defaults
 	if cfg.RAG != nil {
@@ -360,6 +1140,14 @@ func applyDefaults(cfg *Config) {
 				cfg.RAG.InstallPath = "./go-rag"
 			}
 		}
+		cfg.RAG.Restart = applyRestartDefaults(cfg.RAG.Restart)
+		if cfg.RAG.Verify == nil {
+			// go-rag 使用 goreleaser 发布，附带 checksums.txt
+			cfg.RAG.Verify = &VerifyConfig{ChecksumURL: "{dir}/checksums.txt"}
+		}
+		cfg.RAG.Client = applyRAGClientDefaults(cfg.RAG.Client)
+		cfg.RAG.Qdrant = applyRAGQdrantDefaults(cfg.RAG.Qdrant)
+		cfg.RAG.Embedded = applyRAGEmbeddedDefaults(cfg.RAG.Embedded)
 		// Note: Other RAG configs (embedding, rerank, etc.) are managed by go-rag
 		// through GoFrame global config, we don't need to set defaults here
 	}
@@ -383,6 +1171,95 @@ func applyDefaults(cfg *Config) {
 				cfg.Qdrant.InstallPath = "./qdrant"
 			}
 		}
+		cfg.Qdrant.Restart = applyRestartDefaults(cfg.Qdrant.Restart)
+	}
+
+	// Service log defaults
+	if cfg.Logs != nil {
+		if cfg.Logs.MaxSize <= 0 {
+			cfg.Logs.MaxSize = 10
+		}
+		if cfg.Logs.MaxBackups <= 0 {
+			cfg.Logs.MaxBackups = 3
+		}
+		if cfg.Logs.BufferLines <= 0 {
+			cfg.Logs.BufferLines = 1000
+		}
+	}
+
+	// Download defaults
+	if cfg.Download != nil {
+		if cfg.Download.Timeout <= 0 {
+			cfg.Download.Timeout = 30
+		}
+		if cfg.Download.Retries <= 0 {
+			cfg.Download.Retries = 3
+		}
+	}
+
+	// Secret store defaults
+	if cfg.Secrets != nil && cfg.Secrets.Backend == "" {
+		cfg.Secrets.Backend = "auto"
+	}
+
+	// Config history defaults
+	if cfg.History != nil {
+		if cfg.History.MaxVersions == 0 {
+			cfg.History.MaxVersions = 50
+		}
+		if cfg.History.MaxAge == 0 {
+			cfg.History.MaxAge = 90
+		}
+	}
+
+	// API server defaults
+	if cfg.APIServer != nil && cfg.APIServer.Port == 0 {
+		cfg.APIServer.Port = 8765
+	}
+
+	// Ollama defaults
+	if cfg.Ollama != nil {
+		if cfg.Ollama.Host == "" {
+			cfg.Ollama.Host = "127.0.0.1"
+		}
+		if cfg.Ollama.Port == 0 {
+			cfg.Ollama.Port = 11434
+		}
+		if cfg.Ollama.DownloadURL == "" {
+			cfg.Ollama.DownloadURL = "https://github.com/ollama/ollama/releases/latest/download"
+		}
+		if cfg.Ollama.InstallPath == "" {
+			// 默认安装到用户目录 ~/.wachat/ollama
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				cfg.Ollama.InstallPath = filepath.Join(homeDir, ".wachat", "ollama")
+			} else {
+				cfg.Ollama.InstallPath = "./ollama"
+			}
+		}
+		if cfg.Ollama.ModelsPath == "" {
+			cfg.Ollama.ModelsPath = filepath.Join(cfg.Ollama.InstallPath, "models")
+		}
+		cfg.Ollama.Restart = applyRestartDefaults(cfg.Ollama.Restart)
+		if cfg.Ollama.Verify == nil {
+			cfg.Ollama.Verify = &VerifyConfig{ChecksumURL: "{dir}/sha256sum.txt"}
+		}
+	}
+
+	// Managed services defaults
+	for _, svc := range cfg.Services {
+		if svc == nil || svc.Name == "" {
+			continue
+		}
+		svc.Restart = applyRestartDefaults(svc.Restart)
+		if svc.InstallPath != "" {
+			continue
+		}
+		// 默认安装到用户目录 ~/.wachat/services/{name}
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			svc.InstallPath = filepath.Join(homeDir, ".wachat", "services", svc.Name)
+		} else {
+			svc.InstallPath = filepath.Join(".", "services", svc.Name)
+		}
 	}
 }
 
@@ -415,9 +1292,58 @@ func GetQdrantConfig() *QdrantConfig {
 	return cfg.Qdrant
 }
 
-// SetOnConfigChange sets the callback function to be called when config changes
-func SetOnConfigChange(callback func()) {
-	onConfigChange = callback
+// GetMCPConfig returns MCP configuration
+func GetMCPConfig() *MCPConfig {
+	cfg := Get()
+	return cfg.MCP
+}
+
+// GetAPIServerConfig returns API server configuration
+func GetAPIServerConfig() *APIServerConfig {
+	cfg := Get()
+	return cfg.APIServer
+}
+
+// GetServiceLogConfig returns log capture settings of supervised services
+func GetServiceLogConfig() *ServiceLogConfig {
+	cfg := Get()
+	return cfg.Logs
+}
+
+// GetDownloadConfig returns settings of the shared downloader
+func GetDownloadConfig() *DownloadConfig {
+	cfg := Get()
+	return cfg.Download
+}
+
+// GetSecretsConfig returns settings of the secret store
+func GetSecretsConfig() *SecretsConfig {
+	cfg := Get()
+	return cfg.Secrets
+}
+
+// GetProfileConfig returns the active profile selection
+func GetProfileConfig() *ProfileConfig {
+	cfg := Get()
+	return cfg.Profile
+}
+
+// GetHistoryConfig returns retention limits of the config history
+func GetHistoryConfig() *HistoryConfig {
+	cfg := Get()
+	return cfg.History
+}
+
+// GetOllamaConfig returns Ollama configuration
+func GetOllamaConfig() *OllamaConfig {
+	cfg := Get()
+	return cfg.Ollama
+}
+
+// GetServicesConfig returns managed service declarations
+func GetServicesConfig() []*ManagedServiceConfig {
+	cfg := Get()
+	return cfg.Services
 }
 
 // Reload reloads configuration from file
@@ -432,6 +1358,16 @@ func Reload(ctx context.Context) error {
 	}
 	skipReloadMutex.Unlock()
 
+	if err := reload(ctx); err != nil {
+		return err
+	}
+	// Changes not written by wachat itself (e.g. edited by hand) go to the history as well
+	snapshotConfigFiles(ctx, ActiveProfile())
+	return nil
+}
+
+// reload reloads configuration from file unconditionally
+func reload(ctx context.Context) error {
 	configMutex.Lock()
 	defer configMutex.Unlock()
 
@@ -443,8 +1379,13 @@ func Reload(ctx context.Context) error {
 		return fmt.Errorf("config file not found at %s", newConfigPath)
 	}
 
-	// Create new adapter
-	adapter, err := gcfg.NewAdapterFile(newConfigPath)
+	// Keep the last known good config when the file does not pass validation
+	if err := validateFile(ctx, newConfigPath); err != nil {
+		return fmt.Errorf("keeping the current configuration: %w", err)
+	}
+
+	// Create new adapter (${VAR} interpolation and WACHAT_* overrides are applied here)
+	adapter, err := newConfigAdapter(ctx, newConfigPath)
 	if err != nil {
 		return fmt.Errorf("failed to create config adapter: %w", err)
 	}
@@ -456,48 +1397,25 @@ func Reload(ctx context.Context) error {
 	cfg := g.Cfg()
 
 	// Parse new configuration
-	newConfig := &Config{}
-
-	// Load AI config
-	newConfig.AI = &AIConfig{}
-	if !cfg.MustGet(ctx, "ai").IsNil() {
-		if err := cfg.MustGet(ctx, "ai").Scan(newConfig.AI); err != nil {
-			g.Log().Warningf(ctx, "Warning: failed to scan ai config: %v", err)
-		}
-	}
-
-	// Load Binaries config
-	newConfig.Binaries = &BinariesConfig{}
-	if !cfg.MustGet(ctx, "binaries").IsNil() {
-		if err := cfg.MustGet(ctx, "binaries").Scan(newConfig.Binaries); err != nil {
-			g.Log().Warningf(ctx, "Warning: failed to scan binaries config: %v", err)
-		}
-	}
-
-	// Load RAG config
-	newConfig.RAG = loadRAGConfig(ctx, cfg)
-
-	// Load Qdrant config
-	newConfig.Qdrant = &QdrantConfig{}
-	if !cfg.MustGet(ctx, "qdrant").IsNil() {
-		if err := cfg.MustGet(ctx, "qdrant").Scan(newConfig.Qdrant); err != nil {
-			g.Log().Warningf(ctx, "Warning: failed to scan qdrant config: %v", err)
-		}
-	}
+	newConfig := scanConfig(ctx, cfg)
 
 	// Apply defaults
 	applyDefaults(newConfig)
 
+	// Replace secret://<name> references with the stored values
+	resolveSecrets(ctx, newConfig)
+
 	// Replace global config
+	oldConfig := globalConfig
 	globalConfig = newConfig
 	configPath = newConfigPath
+	setHistoryLimits(newConfig.History)
+	watchProfileFile(ctx)
 
 	g.Log().Info(ctx, "Configuration reloaded successfully")
 
-	// Trigger callback if registered
-	if onConfigChange != nil {
-		go onConfigChange()
-	}
+	// Notify subscribers of the sections that changed
+	publishChanges(ctx, diffConfig(ctx, oldConfig, newConfig))
 
 	return nil
 }
@@ -521,18 +1439,24 @@ func WatchConfig(ctx context.Context) error {
 		return fmt.Errorf("failed to watch config file: %w", err)
 	}
 
+	// Watch the active profile's file as well
+	configMutex.RLock()
+	watchProfileFile(ctx)
+	configMutex.RUnlock()
+
 	// Initialize reload channel
 	reloadChan = make(chan struct{}, 1)
 
 	g.Log().Infof(ctx, "Started watching config file: %s", configPath)
 
-	// Start watching in background
+	// Start watching in background (StopWatch clears the globals, the goroutine keeps its own references)
+	pending, w := reloadChan, watcher
 	go func() {
 		// Debounce timer to avoid multiple reloads
 		var debounceTimer *time.Timer
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case event, ok := <-w.Events:
 				if !ok {
 					return
 				}
@@ -547,17 +1471,19 @@ func WatchConfig(ctx context.Context) error {
 					}
 					debounceTimer = time.AfterFunc(500*time.Millisecond, func() {
 						select {
-						case reloadChan <- struct{}{}:
-							if err := Reload(ctx); err != nil {
+						case pending <- struct{}{}:
+							if err := Reload(WithChangeSource(ctx, ChangeFile)); err != nil {
 								g.Log().Errorf(ctx, "Failed to reload config: %v", err)
 							}
+							// Allow the next change to reload (e.g. once an invalid file is fixed)
+							<-pending
 						default:
 							// Reload already pending
 						}
 					})
 				}
 
-			case err, ok := <-watcher.Errors:
+			case err, ok := <-w.Errors:
 				if !ok {
 					return
 				}
@@ -574,6 +1500,7 @@ func StopWatch() {
 	if watcher != nil {
 		watcher.Close()
 		watcher = nil
+		watchedProfile = ""
 	}
 	if reloadChan != nil {
 		close(reloadChan)
@@ -581,188 +1508,257 @@ func StopWatch() {
 	}
 }
 
-// writeYAMLConfig writes RAG settings to config file
-func writeYAMLConfig(ctx context.Context, topK int, defaultKnowledgeBase string) error {
-	// Read current config file
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
+// UpdateRAGSettings updates RAG-specific settings in memory and config file
+func UpdateRAGSettings(ctx context.Context, topK int, defaultKnowledgeBase string) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
 
-	// Parse YAML as generic map
-	var configMap map[string]interface{}
-	if err := yaml.Unmarshal(data, &configMap); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+	if globalConfig == nil || globalConfig.RAG == nil {
+		return fmt.Errorf("RAG config not initialized")
 	}
 
-	// Ensure rag section exists
-	if configMap["rag"] == nil {
-		configMap["rag"] = make(map[string]interface{})
-	}
+	// Update in-memory config first (on a copy, subscribers get the previous section as the old value)
+	oldConfig := *globalConfig
+	rag := *globalConfig.RAG
+	rag.TopK = topK
+	rag.DefaultKnowledgeBase = defaultKnowledgeBase
+	globalConfig.RAG = &rag
 
-	// Update RAG settings
-	ragMap, ok := configMap["rag"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("rag config is not a map")
+	g.Log().Infof(ctx, "Updated RAG settings in memory: topK=%d, defaultKnowledgeBase=%s", topK, defaultKnowledgeBase)
+
+	// Write to config file for persistence (the active profile's file when it overrides rag)
+	file, _ := profileTarget(activeProfileName(), "rag")
+	if err := writeConfigFile(ctx, file,
+		configUpdate{"rag.topK", topK},
+		configUpdate{"rag.defaultKnowledgeBase", defaultKnowledgeBase},
+	); err != nil {
+		g.Log().Warningf(ctx, "Failed to write config file: %v", err)
+		// Continue even if file write fails - at least in-memory config is updated
+	} else {
+		g.Log().Infof(ctx, "Wrote RAG settings to config file: topK=%d, defaultKnowledgeBase=%s", topK, defaultKnowledgeBase)
 	}
 
-	ragMap["topK"] = topK
-	ragMap["defaultKnowledgeBase"] = defaultKnowledgeBase
+	// Notify subscribers of the rag section
+	publishChanges(ctx, diffConfig(ctx, &oldConfig, globalConfig))
 
-	// Marshal back to YAML
-	newData, err := yaml.Marshal(configMap)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+	return nil
+}
+
+// GetRAGSettings returns current RAG settings
+func GetRAGSettings() (topK int, defaultKnowledgeBase string) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	if globalConfig != nil && globalConfig.RAG != nil {
+		return globalConfig.RAG.TopK, globalConfig.RAG.DefaultKnowledgeBase
 	}
+	return 5, "" // default values
+}
 
-	// Set skip flag to avoid reload loop
-	skipReloadMutex.Lock()
-	skipNextReload = true
-	skipReloadMutex.Unlock()
+// UpdateAISettings updates AI-specific settings in memory and config file
+// The API key is kept in the secret store and the config file only references it
+func UpdateAISettings(ctx context.Context, baseURL, apiKey, model string) error {
+	configMutex.RLock()
+	if globalConfig == nil || globalConfig.AI == nil {
+		configMutex.RUnlock()
+		return fmt.Errorf("AI config not initialized")
+	}
+	currentKey := globalConfig.AI.APIKey
+	_, secretPrefix := profileTarget(activeProfileName(), "ai")
+	configMutex.RUnlock()
 
-	// Write to file
-	if err := os.WriteFile(configPath, newData, 0644); err != nil {
-		skipReloadMutex.Lock()
-		skipNextReload = false
-		skipReloadMutex.Unlock()
-		return fmt.Errorf("failed to write config file: %w", err)
+	// The UI only sees the masked key, getting it back means it was not changed
+	if apiKey != "" && apiKey == secret.Mask(currentKey) {
+		apiKey = currentKey
 	}
 
-	g.Log().Infof(ctx, "Wrote RAG settings to config file: topK=%d, defaultKnowledgeBase=%s", topK, defaultKnowledgeBase)
-	return nil
-}
+	// Store a changed key before taking the lock, the keyring may prompt the user
+	// An unchanged key is left as the file has it, its reference stays valid while the vault is locked
+	updates := []configUpdate{{"ai.base_url", baseURL}}
+	if apiKey != currentKey {
+		keyRef, err := storeSecret(ctx, secretPrefix+aiAPIKeySecret, apiKey)
+		if err != nil {
+			g.Log().Warningf(ctx, "Failed to store API key, keeping it in the config file: %v", err)
+			keyRef = apiKey
+		}
+		updates = append(updates, configUpdate{"ai.api_key", keyRef})
+	}
+	updates = append(updates, configUpdate{"ai.model", model})
 
-// UpdateRAGSettings updates RAG-specific settings in memory and config file
-func UpdateRAGSettings(ctx context.Context, topK int, defaultKnowledgeBase string) error {
 	configMutex.Lock()
 	defer configMutex.Unlock()
 
-	if globalConfig == nil || globalConfig.RAG == nil {
-		return fmt.Errorf("RAG config not initialized")
-	}
+	// Update in-memory config first (on a copy, subscribers get the previous section as the old value)
+	oldConfig := *globalConfig
+	ai := *globalConfig.AI
+	ai.BaseURL = baseURL
+	ai.APIKey = apiKey
+	ai.Model = model
+	globalConfig.AI = &ai
 
-	// Update in-memory config first
-	globalConfig.RAG.TopK = topK
-	globalConfig.RAG.DefaultKnowledgeBase = defaultKnowledgeBase
-
-	g.Log().Infof(ctx, "Updated RAG settings in memory: topK=%d, defaultKnowledgeBase=%s", topK, defaultKnowledgeBase)
+	g.Log().Infof(ctx, "Updated AI settings in memory: base_url=%s, model=%s", baseURL, model)
 
-	// Write to config file for persistence
-	if err := writeYAMLConfig(ctx, topK, defaultKnowledgeBase); err != nil {
+	// Write to config file for persistence, the file keeps the secret:// reference of a stored key
+	file, _ := profileTarget(activeProfileName(), "ai")
+	if err := writeConfigFile(ctx, file, updates...); err != nil {
 		g.Log().Warningf(ctx, "Failed to write config file: %v", err)
 		// Continue even if file write fails - at least in-memory config is updated
+	} else {
+		g.Log().Infof(ctx, "Wrote AI settings to config file: base_url=%s, model=%s", baseURL, model)
 	}
 
-	// Trigger config change callback
-	if onConfigChange != nil {
-		go onConfigChange()
-	}
+	// Notify subscribers of the ai section
+	publishChanges(ctx, diffConfig(ctx, &oldConfig, globalConfig))
 
 	return nil
 }
 
-// GetRAGSettings returns current RAG settings
-func GetRAGSettings() (topK int, defaultKnowledgeBase string) {
+// GetAISettings returns current AI settings
+func GetAISettings() (baseURL, apiKey, model string) {
 	configMutex.RLock()
 	defer configMutex.RUnlock()
 
-	if globalConfig != nil && globalConfig.RAG != nil {
-		return globalConfig.RAG.TopK, globalConfig.RAG.DefaultKnowledgeBase
+	if globalConfig != nil && globalConfig.AI != nil {
+		return globalConfig.AI.BaseURL, globalConfig.AI.APIKey, globalConfig.AI.Model
 	}
-	return 5, "" // default values
+	return "https://api.openai.com/v1", "", "gpt-3.5-turbo" // default values
 }
 
-// writeAIConfig writes AI settings to config file
-func writeAIConfig(ctx context.Context, baseURL, apiKey, model string) error {
-	// Read current config file
-	data, err := os.ReadFile(configPath)
+// GetConfigValue returns the raw value at a dot separated path (e.g. "rag.topK")
+func GetConfigValue(ctx context.Context, path string) (interface{}, error) {
+	value, err := g.Cfg().Get(ctx, path)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to get config value: %w", err)
 	}
+	if value == nil || value.IsNil() {
+		return nil, fmt.Errorf("config key %s not found", path)
+	}
+	return value.Val(), nil
+}
 
-	// Parse YAML as generic map
-	var configMap map[string]interface{}
-	if err := yaml.Unmarshal(data, &configMap); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+// UpdateConfigPath sets the value at a dot separated path (e.g. "rag.topK") in config file and reloads
+// Comments, key order and formatting of the file are kept
+func UpdateConfigPath(ctx context.Context, path string, value interface{}) error {
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return fmt.Errorf("invalid config path: %s", path)
+		}
 	}
 
-	// Ensure ai section exists
-	if configMap["ai"] == nil {
-		configMap["ai"] = make(map[string]interface{})
+	// Sections overridden by the active profile are written to the profile's file
+	configMutex.RLock()
+	file, secretPrefix := profileTarget(activeProfileName(), path)
+	configMutex.RUnlock()
+
+	// Secret fields (api_key, token) go to the secret store, the file keeps a reference
+	if s, ok := value.(string); ok && isSecretPath(path) {
+		if secret.IsMasked(s) {
+			return fmt.Errorf("%s is still masked, enter the full value", path)
+		}
+		ref, err := storeSecret(ctx, secretPrefix+path, s)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", path, err)
+		}
+		value = ref
 	}
 
-	// Update AI settings
-	aiMap, ok := configMap["ai"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("ai config is not a map")
+	if err := writeConfigFile(ctx, file, configUpdate{path, value}); err != nil {
+		return err
 	}
+	g.Log().Infof(ctx, "Wrote config value to config file: %s", path)
 
-	aiMap["base_url"] = baseURL
-	aiMap["api_key"] = apiKey
-	aiMap["model"] = model
+	// Reload configuration to apply changes
+	return reload(ctx)
+}
 
-	// Marshal back to YAML
-	newData, err := yaml.Marshal(configMap)
+// writeConfigFile applies the updates to a config file without losing its comments and validates the result before writing
+// It does not reload, callers either reload or update the in-memory config themselves
+func writeConfigFile(ctx context.Context, file string, updates ...configUpdate) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	newData, err := editConfig(data, updates...)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
+	}
+	if err := validateWrite(ctx, file, newData); err != nil {
+		return err
 	}
+	return writeConfigData(ctx, file, newData)
+}
 
-	// Set skip flag to avoid reload loop
-	skipReloadMutex.Lock()
-	skipNextReload = true
-	skipReloadMutex.Unlock()
+// writeConfigData writes a config file without triggering the watcher and saves the change to the history
+func writeConfigData(ctx context.Context, file string, data []byte) error {
+	old, _ := os.ReadFile(file)
+
+	// Set skip flag to avoid reload loop (only when the watcher will see the write)
+	if watcher != nil {
+		skipReloadMutex.Lock()
+		skipNextReload = true
+		skipReloadMutex.Unlock()
+	}
 
 	// Write to file
-	if err := os.WriteFile(configPath, newData, 0644); err != nil {
+	if err := os.WriteFile(file, data, 0644); err != nil {
 		skipReloadMutex.Lock()
 		skipNextReload = false
 		skipReloadMutex.Unlock()
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
-	g.Log().Infof(ctx, "Wrote AI settings to config file: base_url=%s, model=%s", baseURL, model)
+	recordFileVersion(ctx, file, old, data)
 	return nil
 }
 
-// UpdateAISettings updates AI-specific settings in memory and config file
-func UpdateAISettings(ctx context.Context, baseURL, apiKey, model string) error {
+// RegisterAIProvider adds or replaces an AI provider (matched by name) in memory and config file
+func RegisterAIProvider(ctx context.Context, provider *AIProviderConfig) error {
 	configMutex.Lock()
-	defer configMutex.Unlock()
-
 	if globalConfig == nil || globalConfig.AI == nil {
+		configMutex.Unlock()
 		return fmt.Errorf("AI config not initialized")
 	}
 
-	// Update in-memory config first
-	globalConfig.AI.BaseURL = baseURL
-	globalConfig.AI.APIKey = apiKey
-	globalConfig.AI.Model = model
-
-	g.Log().Infof(ctx, "Updated AI settings in memory: base_url=%s, model=%s", baseURL, model)
-
-	// Write to config file for persistence
-	if err := writeAIConfig(ctx, baseURL, apiKey, model); err != nil {
-		g.Log().Warningf(ctx, "Failed to write config file: %v", err)
-		// Continue even if file write fails - at least in-memory config is updated
+	providers := make([]*AIProviderConfig, 0, len(globalConfig.AI.Providers)+1)
+	for _, p := range globalConfig.AI.Providers {
+		if p != nil && p.Name != provider.Name {
+			providers = append(providers, p)
+		}
 	}
-
-	// Trigger config change callback
-	if onConfigChange != nil {
-		go onConfigChange()
+	providers = append(providers, provider)
+	oldConfig := *globalConfig
+	ai := *globalConfig.AI
+	ai.Providers = providers
+	globalConfig.AI = &ai
+	changes := diffConfig(ctx, &oldConfig, globalConfig)
+	_, secretPrefix := profileTarget(activeProfileName(), "ai")
+	configMutex.Unlock()
+	publishChanges(ctx, changes)
+
+	// Convert to plain maps so the YAML keys match the config file format
+	// Keys go to the secret store, or stay as written when the store is not available
+	values := make([]interface{}, 0, len(providers))
+	for _, p := range providers {
+		apiKey := p.APIKey
+		if apiKey != "" && secret.RefOf(apiKey) != "" {
+			apiKey = secret.RefOf(apiKey)
+		} else if p == provider && apiKey != "" {
+			if ref, err := storeSecret(ctx, secretPrefix+"ai.providers."+p.Name+".api_key", apiKey); err == nil {
+				apiKey = ref
+			} else {
+				g.Log().Warningf(ctx, "Failed to store API key of AI provider %s, keeping it in the config file: %v", p.Name, err)
+			}
+		}
+		values = append(values, map[string]interface{}{
+			"name":     p.Name,
+			"base_url": p.BaseURL,
+			"api_key":  apiKey,
+			"models":   p.Models,
+		})
 	}
 
-	return nil
-}
-
-// GetAISettings returns current AI settings
-func GetAISettings() (baseURL, apiKey, model string) {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
-
-	if globalConfig != nil && globalConfig.AI != nil {
-		return globalConfig.AI.BaseURL, globalConfig.AI.APIKey, globalConfig.AI.Model
-	}
-	return "https://api.openai.com/v1", "", "gpt-3.5-turbo" // default values
+	g.Log().Infof(ctx, "Registered AI provider: %s (%s)", provider.Name, provider.BaseURL)
+	return UpdateConfigPath(ctx, "ai.providers", values)
 }
 
 // GetConfigContent reads the entire config file content
@@ -774,25 +1770,21 @@ func GetConfigContent(ctx context.Context) (string, error) {
 	return string(data), nil
 }
 
-// SaveConfigContent saves the entire config file content
+// SaveConfigContent validates and saves the entire config file content
+// Invalid content is not written and the returned ValidationErrors locate each problem
 func SaveConfigContent(ctx context.Context, content string) error {
-	// Set skip flag to avoid reload loop
-	skipReloadMutex.Lock()
-	skipNextReload = true
-	skipReloadMutex.Unlock()
+	if errs := ValidateContent(ctx, content); errs != nil {
+		return errs
+	}
 
-	// Write to file
-	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
-		skipReloadMutex.Lock()
-		skipNextReload = false
-		skipReloadMutex.Unlock()
-		return fmt.Errorf("failed to write config file: %w", err)
+	if err := writeConfigData(ctx, configPath, []byte(content)); err != nil {
+		return err
 	}
 
 	g.Log().Infof(ctx, "Wrote config file successfully")
 
 	// Reload configuration to apply changes
-	if err := Reload(ctx); err != nil {
+	if err := reload(ctx); err != nil {
 		g.Log().Warningf(ctx, "Failed to reload config after save: %v", err)
 	}
 
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/secret"
+)
+
+// loadTestConfig 在临时的用户目录中写入 ~/.wachat/config.yaml 并加载，返回文件路径
+// 密钥使用未解锁的加密文件，测试结束时停止监听并清除全局配置
+func loadTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(envName("secrets.backend"), secret.BackendFile)
+	t.Setenv(secret.PassphraseEnv, "")
+
+	path := filepath.Join(home, ".wachat", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		StopWatch()
+		configMutex.Lock()
+		globalConfig = nil
+		configMutex.Unlock()
+	})
+	if _, err := Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRAGServerURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *ServerConfig
+		wantURL     string
+		wantAddress string
+		wantRemote  bool
+	}{
+		{"no server", nil, "", "", false},
+		{"listen address", &ServerConfig{Address: ":8000"}, "http://localhost:8000", "localhost:8000", false},
+		{"host and port", &ServerConfig{Address: "127.0.0.1:8000"}, "http://127.0.0.1:8000", "127.0.0.1:8000", false},
+		{"local url", &ServerConfig{Address: ":8000", URL: "http://localhost:9000/"}, "http://localhost:9000", "localhost:9000", false},
+		{"remote url", &ServerConfig{URL: "http://10.0.0.5:8000"}, "http://10.0.0.5:8000", "10.0.0.5:8000", true},
+		{"remote https without port", &ServerConfig{URL: "https://rag.example.com"}, "https://rag.example.com", "rag.example.com:443", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RAGConfig{Enabled: true, Server: tt.server}
+			if got := c.GetServerURL(); got != tt.wantURL {
+				t.Errorf("GetServerURL = %q, want %q", got, tt.wantURL)
+			}
+			if got := c.GetServerAddress(); got != tt.wantAddress {
+				t.Errorf("GetServerAddress = %q, want %q", got, tt.wantAddress)
+			}
+			if got := c.IsRemote(); got != tt.wantRemote {
+				t.Errorf("IsRemote = %v, want %v", got, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestQdrantURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		wantURL    string
+		wantRemote bool
+	}{
+		{"", "http://localhost:6333", false},
+		{"http://127.0.0.1:7333/", "http://127.0.0.1:7333", false},
+		{"http://[::1]:6333", "http://[::1]:6333", false},
+		{"http://0.0.0.0:6333", "http://0.0.0.0:6333", false},
+		{"https://qdrant.example.com", "https://qdrant.example.com", true},
+	}
+	for _, tt := range tests {
+		c := &QdrantConfig{Port: 6333, URL: tt.url}
+		if got := c.GetURL(); got != tt.wantURL {
+			t.Errorf("GetURL(%q) = %q, want %q", tt.url, got, tt.wantURL)
+		}
+		if got := c.IsRemote(); got != tt.wantRemote {
+			t.Errorf("IsRemote(%q) = %v, want %v", tt.url, got, tt.wantRemote)
+		}
+	}
+}
+
+func TestRAGClientRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"default", "rag:\n  topK: 5\n", 2},
+		{"no retries", "rag:\n  client:\n    retries: 0\n", 0},
+		{"configured", "rag:\n  client:\n    retries: 4\n", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.content)
+			if got := Get().RAG.Client.GetRetries(); got != tt.want {
+				t.Errorf("retries = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 环境变量同样可以关闭重试
+	t.Setenv(envName("rag.client.retries"), "0")
+	loadTestConfig(t, "rag:\n  topK: 5\n")
+	if got := Get().RAG.Client.GetRetries(); got != 0 {
+		t.Errorf("retries with %s=0 = %d, want 0", envName("rag.client.retries"), got)
+	}
+}
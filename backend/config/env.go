@@ -0,0 +1,424 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gcfg"
+	"github.com/wangle201210/wachat/backend/secret"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置值的优先级（从高到低）：
+//
+//  1. WACHAT_<PATH> 环境变量，如 WACHAT_AI_API_KEY、WACHAT_QDRANT_PORT、WACHAT_RAG_TOPK
+//  2. 当前配置方案（profile）中的值
+//  3. 配置文件中的值，字符串中的 ${VAR}、${VAR:-default}、${VAR-default} 按环境变量展开
+//  4. 内置默认值
+//
+// 展开和覆盖在 GoFrame 读取配置之前完成，go-rag 通过 g.Cfg() 读到的也是生效后的值
+const envPrefix = "WACHAT_"
+
+// 配置值来源
+const (
+	SourceEnv     = "env"     // WACHAT_* 覆盖，或文件中 ${VAR} 引用的环境变量
+	SourceFile    = "file"    // 配置文件中的值（含 ${VAR:-default} 使用的默认值）
+	SourceProfile = "profile" // 当前配置方案中的值
+	SourceDefault = "default" // 配置文件中没有，使用内置默认值
+)
+
+// envAliases 环境变量覆盖写入的位置：rag.server 与 go-rag 的顶级 server 段是同一份配置，
+// 顶级 server 段最后加载，覆盖需要写在这里才能生效
+var envAliases = map[string]string{
+	"rag.server.": "server.",
+}
+
+// interpolationPattern 匹配 $${...}（转义）和 ${NAME}、${NAME:-default}、${NAME-default}
+var interpolationPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?-)([^}]*))?\}`)
+
+// valueSource 配置值的来源
+type valueSource struct {
+	source  string
+	env     string // 使用的环境变量
+	profile string // 提供该值的配置方案
+}
+
+// configSources 最近一次加载时各配置路径的来源（未记录的路径为内置默认值）
+var configSources map[string]valueSource
+
+// EffectiveValue is a config value in effect and where it came from
+type EffectiveValue struct {
+	Path     string      `json:"path"`              // 配置路径，如 ai.api_key、services[0].port
+	Value    interface{} `json:"value"`             // 生效的值（密钥显示为掩码）
+	Source   string      `json:"source"`            // env / profile / file / default
+	Env      string      `json:"env,omitempty"`     // 提供该值的环境变量
+	Profile  string      `json:"profile,omitempty"` // 提供该值的配置方案
+	Override string      `json:"override"`          // 可覆盖该值的 WACHAT_* 环境变量（列表项为空）
+}
+
+// newConfigAdapter 创建配置适配器：读取配置文件，展开 ${VAR} 并应用 WACHAT_* 覆盖后作为配置内容
+// 文件无法解析时退回由 GoFrame 直接读取文件
+func newConfigAdapter(ctx context.Context, path string) (*gcfg.AdapterFile, error) {
+	adapter, err := gcfg.NewAdapterFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, sources, err := loadContent(ctx, path)
+	if err != nil {
+		g.Log().Warningf(ctx, "Failed to apply environment variables to %s: %v", path, err)
+		adapter.RemoveContent(path)
+		configSources = nil
+		return adapter, nil
+	}
+	adapter.SetContent(content, path)
+	configSources = sources
+	return adapter, nil
+}
+
+// loadContent 读取配置文件并返回生效后的内容（JSON）以及各路径的来源
+func loadContent(ctx context.Context, path string) (string, map[string]valueSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	content, sources, warnings, err := resolveContent(data, readProfileFile)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, warning := range warnings {
+		g.Log().Warning(ctx, warning)
+	}
+	return content, sources, nil
+}
+
+// resolveContent 展开 ${VAR}、合并当前配置方案并应用 WACHAT_* 覆盖，返回生效后的内容（JSON）、各路径的来源以及需要提示的问题
+func resolveContent(data []byte, read profileReader) (string, map[string]valueSource, []string, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return "", nil, nil, err
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+
+	sources := make(map[string]valueSource)
+	var warnings []string
+	raw = interpolateValue("", raw, sources, &warnings).(map[string]interface{})
+	mergeProfile(raw, sources, &warnings, read)
+	applyEnvOverrides(raw, sources, &warnings)
+
+	content, err := json.Marshal(raw)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return string(content), sources, warnings, nil
+}
+
+// interpolateValue 递归展开字符串中的 ${VAR}，并记录文件中出现的路径
+func interpolateValue(path string, v interface{}, sources map[string]valueSource, warnings *[]string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = interpolateValue(joinPath(path, key), child, sources, warnings)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = interpolateValue(fmt.Sprintf("%s[%d]", path, i), child, sources, warnings)
+		}
+	case string:
+		expanded, env := interpolate(path, value, warnings)
+		if env != "" {
+			sources[path] = valueSource{source: SourceEnv, env: env}
+		} else {
+			sources[path] = valueSource{source: SourceFile}
+		}
+		return expanded
+	}
+	if path != "" {
+		if _, ok := sources[path]; !ok {
+			sources[path] = valueSource{source: SourceFile}
+		}
+	}
+	return v
+}
+
+// interpolate 展开字符串中的环境变量引用，返回展开结果以及提供了值的第一个环境变量
+// ${NAME:-default}：变量未设置或为空时使用默认值；${NAME-default}：仅未设置时使用默认值；
+// ${NAME}：未设置时为空字符串并记录到 warnings（可为 nil）；$${ 表示字面量 ${
+func interpolate(path, s string, warnings *[]string) (string, string) {
+	if !strings.Contains(s, "${") {
+		return s, ""
+	}
+	usedEnv := ""
+	result := interpolationPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		parts := interpolationPattern.FindStringSubmatch(match)
+		name, op, def := parts[1], parts[2], parts[3]
+		value, set := os.LookupEnv(name)
+		switch {
+		case op == ":-" && value == "":
+			return def
+		case op == "-" && !set:
+			return def
+		case !set:
+			if warnings != nil {
+				*warnings = append(*warnings, fmt.Sprintf("%s: environment variable %s is not set", path, name))
+			}
+			return ""
+		}
+		if usedEnv == "" {
+			usedEnv = name
+		}
+		return value
+	})
+	return result, usedEnv
+}
+
+// keepsReference 判断写入的值是否等于文件中原值（含 ${VAR}）展开后的结果，相等时写入文件应保留原来的引用，
+// 否则界面回传的生效值会把 ${VAR} 替换为环境变量的当前值
+func keepsReference(raw, value string) bool {
+	if !strings.Contains(raw, "${") {
+		return false
+	}
+	expanded, _ := interpolate("", raw, nil)
+	return expanded == value
+}
+
+// envField 可以通过 WACHAT_* 覆盖的配置字段
+type envField struct {
+	path string
+	kind reflect.Kind // String / Int / Float64 / Bool / Slice（[]string，逗号分隔）
+}
+
+// envFields 返回 Config 中所有可覆盖的标量字段（列表中的服务、提供商等以及 map 不支持）
+func envFields() []envField {
+	var fields []envField
+	collectEnvFields(reflect.TypeOf(Config{}), "", &fields)
+	return fields
+}
+
+// envFieldPaths 可以通过 WACHAT_* 覆盖的配置路径
+var envFieldPaths = sync.OnceValue(func() map[string]bool {
+	paths := make(map[string]bool)
+	for _, field := range envFields() {
+		paths[field.path] = true
+	}
+	return paths
+})
+
+// collectEnvFields 按 json 标签收集字段路径
+func collectEnvFields(t reflect.Type, path string, fields *[]envField) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		ft := field.Type
+		switch {
+		case ft.Kind() == reflect.Ptr && isEnvScalar(ft.Elem().Kind()):
+			// *int 等用于区分未设置和零值，覆盖方式与标量相同
+			*fields = append(*fields, envField{path: fieldPath, kind: ft.Elem().Kind()})
+		case isEnvScalar(ft.Kind()):
+			*fields = append(*fields, envField{path: fieldPath, kind: ft.Kind()})
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.String:
+			*fields = append(*fields, envField{path: fieldPath, kind: reflect.Slice})
+		case ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct, ft.Kind() == reflect.Struct:
+			collectEnvFields(ft, fieldPath, fields)
+		}
+	}
+}
+
+// isEnvScalar 是否为可以直接从环境变量解析的标量类型
+func isEnvScalar(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Bool || kind == reflect.Int || kind == reflect.Float64
+}
+
+// envName 返回配置路径对应的环境变量名，如 rag.topK -> WACHAT_RAG_TOPK
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyEnvOverrides 将设置了的 WACHAT_* 环境变量写入配置内容，无法使用的值记录到 warnings 后忽略
+func applyEnvOverrides(raw map[string]interface{}, sources map[string]valueSource, warnings *[]string) {
+	for _, field := range envFields() {
+		name := envName(field.path)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		typed, err := envValue(field.kind, value)
+		if err != nil {
+			*warnings = append(*warnings, fmt.Sprintf("Ignoring %s: %v", name, err))
+			continue
+		}
+
+		target := field.path
+		for prefix, alias := range envAliases {
+			if strings.HasPrefix(target, prefix) {
+				target = alias + strings.TrimPrefix(target, prefix)
+			}
+		}
+		if err := setPath(raw, target, typed); err != nil {
+			*warnings = append(*warnings, fmt.Sprintf("Ignoring %s: %v", name, err))
+			continue
+		}
+		sources[field.path] = valueSource{source: SourceEnv, env: name}
+		if target != field.path {
+			sources[target] = valueSource{source: SourceEnv, env: name}
+		}
+	}
+}
+
+// envValue 将环境变量的值转换为字段的类型
+func envValue(kind reflect.Kind, value string) (interface{}, error) {
+	switch kind {
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		return n, nil
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return f, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	case reflect.Slice:
+		items := []interface{}{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return value, nil
+}
+
+// setPath 在配置内容中设置路径的值，缺少的段自动创建
+func setPath(raw map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	section := raw
+	for _, key := range keys[:len(keys)-1] {
+		if section[key] == nil {
+			section[key] = make(map[string]interface{})
+		}
+		child, ok := section[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not a section in the config file", key)
+		}
+		section = child
+	}
+	section[keys[len(keys)-1]] = value
+	return nil
+}
+
+// sourceOf 返回配置路径的来源
+func sourceOf(path string) valueSource {
+	if src, ok := configSources[path]; ok {
+		return src
+	}
+	for prefix, alias := range envAliases {
+		if strings.HasPrefix(path, prefix) {
+			if src, ok := configSources[alias+strings.TrimPrefix(path, prefix)]; ok {
+				return src
+			}
+		}
+	}
+	return valueSource{source: SourceDefault}
+}
+
+// GetEffectiveConfig returns every config value in effect with its source (file, env or default)
+// Secret values are masked
+func GetEffectiveConfig() []EffectiveValue {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	var values []EffectiveValue
+	if globalConfig != nil {
+		collectEffective(reflect.ValueOf(globalConfig), "", false, true, &values)
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Path < values[j].Path })
+	return values
+}
+
+// collectEffective 遍历配置，列出每个叶子值；overridable 表示路径可以通过 WACHAT_* 覆盖
+func collectEffective(v reflect.Value, path string, tagged, overridable bool, values *[]EffectiveValue) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		collectEffective(v.Elem(), path, tagged, overridable, values)
+		return
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			collectEffective(v.Field(i), joinPath(path, name), field.Tag.Get("secret") == "true", overridable, values)
+		}
+		return
+
+	case reflect.Slice:
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			for i := 0; i < v.Len(); i++ {
+				collectEffective(v.Index(i), fmt.Sprintf("%s[%d]", path, i), tagged, false, values)
+			}
+			return
+		}
+	}
+
+	value := v.Interface()
+	if tagged {
+		value = secret.Mask(v.String())
+	}
+	src := sourceOf(path)
+	entry := EffectiveValue{Path: path, Value: value, Source: src.source, Env: src.env, Profile: src.profile}
+	if overridable && envFieldPaths()[path] {
+		entry.Override = envName(path)
+	}
+	*values = append(*values, entry)
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// noProfiles 测试中不读取方案配置文件
+func noProfiles(name string) ([]byte, error) {
+	return nil, nil
+}
+
+func TestEnvValue(t *testing.T) {
+	tests := []struct {
+		kind    reflect.Kind
+		value   string
+		want    interface{}
+		wantErr string
+	}{
+		{reflect.String, " text ", " text ", ""},
+		{reflect.Int, " 8 ", 8, ""},
+		{reflect.Int, "8.5", nil, "is not an integer"},
+		{reflect.Float64, "0.75", 0.75, ""},
+		{reflect.Float64, " 1e-2 ", 0.01, ""},
+		{reflect.Float64, "high", nil, "is not a number"},
+		{reflect.Bool, "true", true, ""},
+		{reflect.Bool, "yes", nil, "is not a boolean"},
+		{reflect.Slice, "qdrant, rag,,", []interface{}{"qdrant", "rag"}, ""},
+		{reflect.Slice, "", []interface{}{}, ""},
+	}
+	for _, tt := range tests {
+		got, err := envValue(tt.kind, tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("envValue(%s, %q) error = %v, want %q", tt.kind, tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("envValue(%s, %q) = %#v, %v, want %#v", tt.kind, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestEnvFieldPaths(t *testing.T) {
+	paths := envFieldPaths()
+	for _, path := range []string{"ai.api_key", "rag.topK", "qdrant.port", "binaries.startup_order", "mcp.enabled"} {
+		if !paths[path] {
+			t.Errorf("%s cannot be overridden", path)
+		}
+	}
+	// 列表中的项和 map 不支持覆盖
+	for _, path := range []string{"ai.providers", "services", "mcp.servers", "binaries.depends_on"} {
+		if paths[path] {
+			t.Errorf("%s can be overridden", path)
+		}
+	}
+
+	// 浮点字段按类型收集
+	type floatConfig struct {
+		Threshold float64 `json:"threshold"`
+		Nested    *struct {
+			Weight float64 `json:"weight"`
+		} `json:"nested"`
+	}
+	var fields []envField
+	collectEnvFields(reflect.TypeOf(floatConfig{}), "section", &fields)
+	want := []envField{{"section.threshold", reflect.Float64}, {"section.nested.weight", reflect.Float64}}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %+v, want %+v", fields, want)
+	}
+}
+
+func TestResolveContentEnv(t *testing.T) {
+	t.Setenv("WACHAT_RAG_TOPK", "8")
+	t.Setenv("WACHAT_QDRANT_PORT", "not a port")
+	t.Setenv("WACHAT_BINARIES_STARTUP_ORDER", "qdrant,rag")
+	t.Setenv("TEST_AI_BASE_URL", "https://llm.example.com/v1")
+	t.Setenv("TEST_AI_MODEL", "")
+
+	data := []byte(`ai:
+  base_url: ${TEST_AI_BASE_URL}
+  model: ${TEST_AI_MODEL:-gpt-4o}
+  api_key: $${literal}
+rag:
+  topK: 5
+qdrant:
+  port: 6333
+`)
+	content, sources, warnings, err := resolveContent(data, noProfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(content), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AI.BaseURL != "https://llm.example.com/v1" || cfg.AI.Model != "gpt-4o" || cfg.AI.APIKey != "${literal}" {
+		t.Errorf("ai = %+v", cfg.AI)
+	}
+	if cfg.RAG.TopK != 8 || cfg.Qdrant.Port != 6333 || !reflect.DeepEqual(cfg.Binaries.StartupOrder, []string{"qdrant", "rag"}) {
+		t.Errorf("topK = %d, port = %d, startup_order = %v", cfg.RAG.TopK, cfg.Qdrant.Port, cfg.Binaries.StartupOrder)
+	}
+
+	wantSources := map[string]valueSource{
+		"ai.base_url":            {source: SourceEnv, env: "TEST_AI_BASE_URL"},
+		"ai.model":               {source: SourceFile},
+		"rag.topK":               {source: SourceEnv, env: "WACHAT_RAG_TOPK"},
+		"qdrant.port":            {source: SourceFile},
+		"binaries.startup_order": {source: SourceEnv, env: "WACHAT_BINARIES_STARTUP_ORDER"},
+	}
+	for path, want := range wantSources {
+		if got := sources[path]; got != want {
+			t.Errorf("source of %s = %+v, want %+v", path, got, want)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `Ignoring WACHAT_QDRANT_PORT: "not a port" is not an integer`) {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestKeepsReference(t *testing.T) {
+	t.Setenv("TEST_BASE_URL", "https://llm.example.com/v1")
+	tests := []struct {
+		raw, value string
+		want       bool
+	}{
+		{"${TEST_BASE_URL}", "https://llm.example.com/v1", true},
+		{"${TEST_BASE_URL}", "https://other.example.com/v1", false},
+		{"${TEST_UNSET_URL:-https://default.example.com}", "https://default.example.com", true},
+		{"https://llm.example.com/v1", "https://llm.example.com/v1", false},
+		{"${TEST_UNSET_URL}", "", true},
+	}
+	for _, tt := range tests {
+		if got := keepsReference(tt.raw, tt.value); got != tt.want {
+			t.Errorf("keepsReference(%q, %q) = %v, want %v", tt.raw, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 配置变更事件：重新加载或修改配置后，逐个比较配置段，向订阅了变化配置段的回调发送新旧值。
+// 回调在单独的 goroutine 中按变更顺序依次执行（不持有 configMutex，可以调用 Get 等函数）
+//
+//	cancel := config.Subscribe(func(ctx context.Context, change config.ConfigChange) {
+//		aiService.Reconfigure(change.New.(*config.AIConfig))
+//	}, config.SectionAI)
+//	defer cancel()
+//
+// 配置段的值不会被原地修改，旧值在回调执行时仍然有效
+
+// 配置段名称（与配置文件中的键相同），New/Old 的类型见注释
+const (
+	SectionAI        = "ai"          // *AIConfig
+	SectionBinaries  = "binaries"    // *BinariesConfig
+	SectionRAG       = "rag"         // *RAGConfig
+	SectionQdrant    = "qdrant"      // *QdrantConfig
+	SectionMCP       = "mcp"         // *MCPConfig
+	SectionAPIServer = "apiServer"   // *APIServerConfig
+	SectionOllama    = "ollama"      // *OllamaConfig
+	SectionServices  = "services"    // []*ManagedServiceConfig
+	SectionLogs      = "serviceLogs" // *ServiceLogConfig
+	SectionDownload  = "download"    // *DownloadConfig
+	SectionSecrets   = "secrets"     // *SecretsConfig
+	SectionProfile   = "profile"     // *ProfileConfig
+	SectionHistory   = "history"     // *HistoryConfig
+)
+
+// ConfigChange describes a config section whose value changed
+type ConfigChange struct {
+	Section string        `json:"section"` // 配置段名称，如 ai、rag
+	Source  string        `json:"source"`  // 修改来源：ui、file、api、restore
+	Old     interface{}   `json:"-"`       // 修改前的值（首次加载前为 nil）
+	New     interface{}   `json:"-"`       // 修改后的值
+	Fields  []FieldChange `json:"fields"`  // 发生变化的配置项
+}
+
+// FieldChange describes a single changed config value (secrets are masked)
+type FieldChange struct {
+	Path string      `json:"path"` // 配置路径，如 ai.model、services[0].port
+	Old  interface{} `json:"old"`  // 修改前的值（新增时为 nil）
+	New  interface{} `json:"new"`  // 修改后的值（删除时为 nil）
+}
+
+// ChangeHandler is called with the change of a subscribed config section
+type ChangeHandler func(ctx context.Context, change ConfigChange)
+
+// subscription 一个订阅者
+type subscription struct {
+	sections map[string]bool // 为空时订阅所有配置段
+	handler  ChangeHandler
+	mu       sync.Mutex // 回调执行期间持有，取消订阅时等待正在执行的回调结束
+	active   bool
+}
+
+// changeBatch 一次修改产生的所有变更
+type changeBatch struct {
+	ctx     context.Context
+	changes []ConfigChange
+}
+
+var (
+	eventMutex    sync.Mutex
+	subscriptions []*subscription
+	pendingEvents []changeBatch
+	dispatching   bool
+)
+
+// Subscribe registers handler for changes of the given sections (every section when none is given)
+// The returned function cancels the subscription and waits for a running handler to return,
+// so it must not be called from the handler itself
+func Subscribe(handler ChangeHandler, sections ...string) (cancel func()) {
+	sub := &subscription{handler: handler, active: true}
+	if len(sections) > 0 {
+		sub.sections = make(map[string]bool, len(sections))
+		for _, section := range sections {
+			sub.sections[section] = true
+		}
+	}
+
+	eventMutex.Lock()
+	subscriptions = append(subscriptions, sub)
+	eventMutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eventMutex.Lock()
+			for i, s := range subscriptions {
+				if s == sub {
+					subscriptions = append(subscriptions[:i:i], subscriptions[i+1:]...)
+					break
+				}
+			}
+			eventMutex.Unlock()
+
+			sub.mu.Lock()
+			sub.active = false
+			sub.mu.Unlock()
+		})
+	}
+}
+
+// diffConfig 逐个比较配置段，返回发生变化的配置段（调用方需持有 configMutex，以读取配置来源）
+func diffConfig(ctx context.Context, oldConfig, newConfig *Config) []ConfigChange {
+	if newConfig == nil || oldConfig == newConfig {
+		return nil
+	}
+	source := changeSource(ctx)
+	newValue := reflect.ValueOf(newConfig).Elem()
+	t := newValue.Type()
+
+	var changes []ConfigChange
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		newSection := newValue.Field(i)
+		var oldSection reflect.Value
+		if oldConfig != nil {
+			oldSection = reflect.ValueOf(oldConfig).Elem().Field(i)
+			if reflect.DeepEqual(oldSection.Interface(), newSection.Interface()) {
+				continue
+			}
+		}
+
+		change := ConfigChange{Section: name, Source: source, New: newSection.Interface()}
+		if oldSection.IsValid() {
+			change.Old = oldSection.Interface()
+		}
+		change.Fields = diffFields(name, oldSection, newSection)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// diffFields 列出配置段中发生变化的叶子值（密钥显示为掩码）
+func diffFields(section string, oldSection, newSection reflect.Value) []FieldChange {
+	var oldValues, newValues []EffectiveValue
+	if oldSection.IsValid() {
+		collectEffective(oldSection, section, false, false, &oldValues)
+	}
+	collectEffective(newSection, section, false, false, &newValues)
+
+	oldByPath := make(map[string]interface{}, len(oldValues))
+	for _, v := range oldValues {
+		oldByPath[v.Path] = v.Value
+	}
+
+	var fields []FieldChange
+	for _, v := range newValues {
+		old, ok := oldByPath[v.Path]
+		delete(oldByPath, v.Path)
+		if ok && reflect.DeepEqual(old, v.Value) {
+			continue
+		}
+		fields = append(fields, FieldChange{Path: v.Path, Old: old, New: v.Value})
+	}
+	// 已删除的配置项（如移除的列表项），按原顺序列出
+	for _, v := range oldValues {
+		if old, ok := oldByPath[v.Path]; ok {
+			fields = append(fields, FieldChange{Path: v.Path, Old: old})
+		}
+	}
+	return fields
+}
+
+// publishChanges 将变更加入队列，由单独的 goroutine 按顺序通知订阅者
+func publishChanges(ctx context.Context, changes []ConfigChange) {
+	if len(changes) == 0 {
+		return
+	}
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	pendingEvents = append(pendingEvents, changeBatch{ctx: context.WithoutCancel(ctx), changes: changes})
+	if !dispatching {
+		dispatching = true
+		go dispatchChanges()
+	}
+}
+
+// dispatchChanges 依次通知订阅者，直到队列为空
+func dispatchChanges() {
+	for {
+		eventMutex.Lock()
+		if len(pendingEvents) == 0 {
+			dispatching = false
+			eventMutex.Unlock()
+			return
+		}
+		batch := pendingEvents[0]
+		pendingEvents = pendingEvents[1:]
+		subs := make([]*subscription, len(subscriptions))
+		copy(subs, subscriptions)
+		eventMutex.Unlock()
+
+		for _, change := range batch.changes {
+			g.Log().Debugf(batch.ctx, "Config section %s changed (%s)", change.Section, change.Source)
+			for _, sub := range subs {
+				if sub.sections == nil || sub.sections[change.Section] {
+					sub.notify(batch.ctx, change)
+				}
+			}
+		}
+	}
+}
+
+// notify 调用订阅者的回调（已取消的订阅不再调用），回调 panic 不影响其他订阅者
+func (s *subscription) notify(ctx context.Context, change ConfigChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			g.Log().Errorf(ctx, "Config change handler for %s panicked: %v", change.Section, r)
+		}
+	}()
+	s.handler(ctx, change)
+}
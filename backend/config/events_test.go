@@ -0,0 +1,183 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffConfig(t *testing.T) {
+	oldConfig := &Config{
+		AI:       &AIConfig{BaseURL: "https://api.example.com/v1", APIKey: "sk-old-0123456789", Model: "gpt-4o"},
+		RAG:      &RAGConfig{TopK: 5},
+		Services: []*ManagedServiceConfig{{Name: "a", Version: "v1"}, {Name: "b", Version: "v1"}},
+	}
+	newConfig := &Config{
+		AI:       &AIConfig{BaseURL: "https://api.example.com/v1", APIKey: "sk-new-9876543210", Model: "gpt-4o-mini"},
+		RAG:      &RAGConfig{TopK: 5},
+		Services: []*ManagedServiceConfig{{Name: "a", Version: "v2"}},
+		Qdrant:   &QdrantConfig{Port: 6333},
+	}
+	changes := diffConfig(WithChangeSource(context.Background(), ChangeUI), oldConfig, newConfig)
+
+	bySection := make(map[string]ConfigChange)
+	var sections []string
+	for _, change := range changes {
+		bySection[change.Section] = change
+		sections = append(sections, change.Section)
+		if change.Source != ChangeUI {
+			t.Errorf("source of %s = %s, want ui", change.Section, change.Source)
+		}
+	}
+	// 按 Config 的字段顺序列出，未变化的配置段不列出
+	if want := []string{SectionAI, SectionQdrant, SectionServices}; !reflect.DeepEqual(sections, want) {
+		t.Fatalf("changed sections = %v, want %v", sections, want)
+	}
+
+	ai := bySection[SectionAI]
+	if ai.Old != oldConfig.AI || ai.New != newConfig.AI {
+		t.Error("ai change does not carry the old and new sections")
+	}
+	wantAI := []FieldChange{
+		{Path: "ai.api_key", Old: "sk-****6789", New: "sk-****3210"},
+		{Path: "ai.model", Old: "gpt-4o", New: "gpt-4o-mini"},
+	}
+	if !reflect.DeepEqual(ai.Fields, wantAI) {
+		t.Errorf("ai fields = %+v, want %+v", ai.Fields, wantAI)
+	}
+
+	// 新增的配置段没有旧值
+	if qdrant := bySection[SectionQdrant]; qdrant.Old != (*QdrantConfig)(nil) || !containsField(qdrant.Fields, FieldChange{Path: "qdrant.port", New: 6333}) {
+		t.Errorf("qdrant change = %+v", qdrant)
+	}
+
+	// 删除的列表项列在最后
+	services := bySection[SectionServices].Fields
+	if !containsField(services, FieldChange{Path: "services[0].version", Old: "v1", New: "v2"}) {
+		t.Errorf("services fields = %+v, want the changed version", services)
+	}
+	if last := services[len(services)-1]; last.New != nil {
+		t.Errorf("last services field = %+v, want a removed value", last)
+	}
+	if !containsField(services, FieldChange{Path: "services[1].name", Old: "b"}) {
+		t.Errorf("services fields = %+v, want the removed service", services)
+	}
+
+	if got := diffConfig(context.Background(), newConfig, newConfig); got != nil {
+		t.Errorf("diff of the same config = %+v", got)
+	}
+	// 首次加载时所有配置段都有变化
+	if got := diffConfig(context.Background(), nil, newConfig); len(got) != len(jsonFields(reflect.TypeOf(Config{}))) {
+		t.Errorf("diff without an old config has %d sections", len(got))
+	}
+}
+
+// containsField 判断是否包含指定的配置项变化
+func containsField(fields []FieldChange, want FieldChange) bool {
+	for _, field := range fields {
+		if reflect.DeepEqual(field, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// changeRecorder 记录收到的配置段变更
+type changeRecorder struct {
+	mu       sync.Mutex
+	sections []string
+	received chan struct{}
+}
+
+func newChangeRecorder() *changeRecorder {
+	return &changeRecorder{received: make(chan struct{}, 100)}
+}
+
+func (r *changeRecorder) handle(ctx context.Context, change ConfigChange) {
+	r.mu.Lock()
+	r.sections = append(r.sections, change.Section+":"+change.Source)
+	r.mu.Unlock()
+	r.received <- struct{}{}
+}
+
+// wait 等待收到 n 个变更并返回
+func (r *changeRecorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d changes", i, n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sections := r.sections
+	r.sections = nil
+	return sections
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	ai, all := newChangeRecorder(), newChangeRecorder()
+	cancelAI := Subscribe(ai.handle, SectionAI, SectionRAG)
+	defer cancelAI()
+	cancelAll := Subscribe(all.handle)
+	defer cancelAll()
+	// 回调 panic 不影响其他订阅者
+	cancelPanic := Subscribe(func(ctx context.Context, change ConfigChange) { panic("handler failed") }, SectionAI)
+	defer cancelPanic()
+
+	publishChanges(WithChangeSource(ctx, ChangeFile), []ConfigChange{{Section: SectionAI, Source: ChangeFile}, {Section: SectionQdrant, Source: ChangeFile}})
+	publishChanges(ctx, []ConfigChange{{Section: SectionRAG, Source: ChangeAPI}})
+	publishChanges(ctx, nil)
+
+	if got, want := all.wait(t, 3), []string{"ai:file", "qdrant:file", "rag:api"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all sections = %v, want %v", got, want)
+	}
+	if got, want := ai.wait(t, 2), []string{"ai:file", "rag:api"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subscribed sections = %v, want %v", got, want)
+	}
+
+	// 取消订阅后不再收到变更
+	cancelAI()
+	cancelAI()
+	publishChanges(ctx, []ConfigChange{{Section: SectionAI, Source: ChangeAPI}})
+	all.wait(t, 1)
+	select {
+	case <-ai.received:
+		t.Error("received a change after cancelling the subscription")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 取消订阅时等待正在执行的回调结束
+func TestSubscribeCancelWaitsForHandler(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished bool
+	cancel := Subscribe(func(ctx context.Context, change ConfigChange) {
+		close(started)
+		<-release
+		finished = true
+	}, SectionHistory)
+
+	publishChanges(context.Background(), []ConfigChange{{Section: SectionHistory}})
+	<-started
+	cancelled := make(chan struct{})
+	go func() {
+		cancel()
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+		t.Fatal("cancel returned while the handler was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-cancelled
+	if !finished {
+		t.Error("cancel returned before the handler finished")
+	}
+}
@@ -0,0 +1,422 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置历史：每次修改配置文件后保存一份快照，可以查看差异并恢复到任一版本
+//
+//	~/.wachat/history/wachat/<time>_<source>.yaml           wachat 的 config.yaml
+//	~/.wachat/history/profiles/<name>/<time>_<source>.yaml  配置方案的 config.yaml
+//	~/.wachat/history/go-rag/<time>_<source>.yaml           go-rag 的 config.yaml
+//
+// 写入前文件内容与最新的快照不同（如应用未运行时手动修改过）时先以 file 来源保存原内容，
+// 内容与最新的快照相同时不重复保存。超过 history.maxVersions 个或 history.maxAge 天的版本自动删除
+const (
+	HistoryWachat = "wachat" // wachat 的 config.yaml
+	HistoryRAG    = "go-rag" // go-rag 的 config.yaml
+)
+
+// 配置修改的来源
+const (
+	ChangeUI      = "ui"      // 设置界面
+	ChangeFile    = "file"    // 手动编辑配置文件（监听到的修改）
+	ChangeAPI     = "api"     // 命令行及程序内部的调用（默认）
+	ChangeRestore = "restore" // 恢复历史版本
+)
+
+// versionTimeFormat 快照文件名中的时间（按名称排序即按时间排序）
+const versionTimeFormat = "20060102-150405.000000"
+
+// ConfigVersion describes a saved snapshot of a config file
+type ConfigVersion struct {
+	ID      string    `json:"id"`      // 快照 ID（<time>_<source>）
+	Target  string    `json:"target"`  // wachat、profiles/<name> 或 go-rag
+	Time    time.Time `json:"time"`    // 保存时间
+	Source  string    `json:"source"`  // 修改来源：ui、file、api、restore
+	Size    int64     `json:"size"`    // 文件大小（字节）
+	Current bool      `json:"current"` // 与当前文件内容相同
+}
+
+var (
+	historyMutex sync.Mutex
+	// historyLimits 保留限制（加载配置时更新，写入配置时可能已持有 configMutex，因此单独保存）
+	historyLimits = HistoryConfig{MaxVersions: 50, MaxAge: 90}
+	// historyFiles 登记的其他配置文件（如 go-rag 的 config.yaml）
+	historyFiles = make(map[string]func() string)
+)
+
+// changeSourceKey 修改来源在 context 中的键
+type changeSourceKey struct{}
+
+// WithChangeSource returns a context that records config changes made with it as coming from source
+func WithChangeSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, source)
+}
+
+// changeSource 返回 context 中的修改来源，默认为 api
+func changeSource(ctx context.Context) string {
+	if source, ok := ctx.Value(changeSourceKey{}).(string); ok && source != "" {
+		return source
+	}
+	return ChangeAPI
+}
+
+// RegisterHistoryFile registers a config file outside wachat's own (e.g. go-rag's config.yaml) for history and restore
+func RegisterHistoryFile(target string, path func() string) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historyFiles[target] = path
+}
+
+// setHistoryLimits 更新保留限制
+func setHistoryLimits(cfg *HistoryConfig) {
+	if cfg == nil {
+		return
+	}
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historyLimits = *cfg
+}
+
+// historyDir 返回 ~/.wachat/history
+func historyDir() string {
+	return filepath.Join(wachatDir(), "history")
+}
+
+// historyFile 返回目标对应的配置文件
+func historyFile(target string) (string, error) {
+	if target == HistoryWachat {
+		return configPath, nil
+	}
+	if name, ok := strings.CutPrefix(target, "profiles/"); ok {
+		if err := ValidateProfileName(name); err != nil {
+			return "", err
+		}
+		return profileConfigPath(name), nil
+	}
+	historyMutex.Lock()
+	path, ok := historyFiles[target]
+	historyMutex.Unlock()
+	if !ok {
+		return "", fmt.Errorf("unknown config history target %q", target)
+	}
+	return path(), nil
+}
+
+// historyTarget 返回配置文件对应的目标，不记录历史的文件返回空字符串
+func historyTarget(file string) string {
+	if file == configPath {
+		return HistoryWachat
+	}
+	if rel, err := filepath.Rel(ProfilesDir(), file); err == nil {
+		if name, ok := strings.CutSuffix(filepath.ToSlash(rel), "/"+profileConfigFile); ok && ValidateProfileName(name) == nil {
+			return "profiles/" + name
+		}
+	}
+	return ""
+}
+
+// RecordConfigVersion saves a snapshot after a config file changed, old is the content before the change (nil if unknown)
+// Failures are only logged, history never blocks saving the config
+func RecordConfigVersion(ctx context.Context, target string, old, data []byte) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	if old != nil {
+		if err := saveVersion(target, ChangeFile, old); err != nil {
+			g.Log().Warningf(ctx, "Failed to save config history of %s: %v", target, err)
+			return
+		}
+	}
+	if err := saveVersion(target, changeSource(ctx), data); err != nil {
+		g.Log().Warningf(ctx, "Failed to save config history of %s: %v", target, err)
+		return
+	}
+	pruneVersions(ctx, target)
+}
+
+// recordFileVersion 为 wachat 的配置文件（config.yaml 或配置方案）保存快照
+func recordFileVersion(ctx context.Context, file string, old, data []byte) {
+	if target := historyTarget(file); target != "" {
+		RecordConfigVersion(ctx, target, old, data)
+	}
+}
+
+// snapshotConfigFiles 为 config.yaml 和当前配置方案的文件保存快照（内容未变化时跳过）
+func snapshotConfigFiles(ctx context.Context, profile string) {
+	files := []string{configPath}
+	if profile != "" {
+		files = append(files, profileConfigPath(profile))
+	}
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			recordFileVersion(ctx, file, nil, data)
+		}
+	}
+}
+
+// saveVersion 保存快照，与最新的快照内容相同时跳过（调用方需持有 historyMutex）
+func saveVersion(target, source string, data []byte) error {
+	versions, err := listVersions(target)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		if latest, err := os.ReadFile(versionPath(target, versions[0].ID)); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	dir := filepath.Join(historyDir(), filepath.FromSlash(target))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	// 同一微秒内的多次修改顺延，保持文件名唯一且有序
+	now := time.Now()
+	if len(versions) > 0 && !now.After(versions[0].Time) {
+		now = versions[0].Time.Add(time.Microsecond)
+	}
+	id := now.Format(versionTimeFormat) + "_" + source
+	if err := os.WriteFile(versionPath(target, id), data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// pruneVersions 删除超出保留限制的快照，最新的快照总是保留（调用方需持有 historyMutex）
+func pruneVersions(ctx context.Context, target string) {
+	versions, err := listVersions(target)
+	if err != nil {
+		return
+	}
+	maxVersions, maxAge := historyLimits.MaxVersions, historyLimits.MaxAge
+	if maxVersions <= 0 {
+		maxVersions = 50
+	}
+	if maxAge <= 0 {
+		maxAge = 90
+	}
+	cutoff := time.Now().AddDate(0, 0, -maxAge)
+	for i, version := range versions {
+		if i == 0 || i < maxVersions && version.Time.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(versionPath(target, version.ID)); err != nil {
+			g.Log().Warningf(ctx, "Failed to remove config snapshot %s of %s: %v", version.ID, target, err)
+		}
+	}
+}
+
+// versionPath 返回快照文件路径
+func versionPath(target, id string) string {
+	return filepath.Join(historyDir(), filepath.FromSlash(target), id+".yaml")
+}
+
+// listVersions 返回目标的全部快照，最新的在前
+func listVersions(target string) ([]*ConfigVersion, error) {
+	entries, err := os.ReadDir(filepath.Join(historyDir(), filepath.FromSlash(target)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config history: %w", err)
+	}
+
+	versions := make([]*ConfigVersion, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp, source, ok := strings.Cut(id, "_")
+		if !ok {
+			continue
+		}
+		t, err := time.ParseInLocation(versionTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		version := &ConfigVersion{ID: id, Target: target, Time: t, Source: source}
+		if info, err := entry.Info(); err == nil {
+			version.Size = info.Size()
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID > versions[j].ID })
+	return versions, nil
+}
+
+// historyTargets 返回有快照的全部目标
+func historyTargets() []string {
+	var targets []string
+	entries, _ := os.ReadDir(historyDir())
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if entry.Name() != "profiles" {
+			targets = append(targets, entry.Name())
+			continue
+		}
+		profiles, _ := os.ReadDir(filepath.Join(historyDir(), "profiles"))
+		for _, profile := range profiles {
+			if profile.IsDir() && ValidateProfileName(profile.Name()) == nil {
+				targets = append(targets, "profiles/"+profile.Name())
+			}
+		}
+	}
+	return targets
+}
+
+// ListConfigVersions returns the snapshots of a config file newest first ("" lists every target)
+func ListConfigVersions(target string) ([]*ConfigVersion, error) {
+	targets := []string{target}
+	if target == "" {
+		targets = historyTargets()
+	} else if _, err := historyFile(target); err != nil {
+		return nil, err
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	all := make([]*ConfigVersion, 0)
+	for _, target := range targets {
+		versions, err := listVersions(target)
+		if err != nil {
+			return nil, err
+		}
+		// 标记与当前文件内容相同的快照
+		if file, err := historyFile(target); err == nil {
+			if current, err := os.ReadFile(file); err == nil {
+				for _, version := range versions {
+					if data, err := os.ReadFile(versionPath(target, version.ID)); err == nil && bytes.Equal(data, current) {
+						version.Current = true
+					}
+				}
+			}
+		}
+		all = append(all, versions...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.After(all[j].Time) })
+	return all, nil
+}
+
+// GetConfigVersion returns the content of a snapshot ("" for the current file)
+func GetConfigVersion(target, id string) ([]byte, error) {
+	file, err := historyFile(target)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		return data, nil
+	}
+	if strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, fmt.Errorf("invalid config version %q", id)
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	data, err := os.ReadFile(versionPath(target, id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("config version %s of %s not found", id, target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config version: %w", err)
+	}
+	return data, nil
+}
+
+// DiffConfigVersions returns a unified diff between two snapshots of a config file ("" for the current file)
+func DiffConfigVersions(target, from, to string) (string, error) {
+	before, err := GetConfigVersion(target, from)
+	if err != nil {
+		return "", err
+	}
+	after, err := GetConfigVersion(target, to)
+	if err != nil {
+		return "", err
+	}
+	name := func(id string) string {
+		if id == "" {
+			return target + " (current)"
+		}
+		return target + "@" + id
+	}
+	return unifiedDiff(string(before), string(after), name(from), name(to)), nil
+}
+
+// RestoredProfile returns the profile that becomes active when a snapshot is restored
+// Only snapshots of wachat's config.yaml can select another profile, WACHAT_PROFILE_NAME still takes precedence
+func RestoredProfile(target, id string) (string, error) {
+	if target != HistoryWachat {
+		return ActiveProfile(), nil
+	}
+	data, err := GetConfigVersion(target, id)
+	if err != nil {
+		return "", err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return "", fmt.Errorf("failed to parse config version %s: %w", id, err)
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+	// profile.name 可以写成 ${VAR}
+	raw = interpolateValue("", raw, make(map[string]valueSource), nil).(map[string]interface{})
+	return selectedProfile(raw), nil
+}
+
+// RestoreConfigVersion writes a snapshot back to its config file and reloads wachat's config
+// wachat's config is validated first, go-rag needs a restart to pick up its restored config
+func RestoreConfigVersion(ctx context.Context, target, id string) error {
+	if id == "" {
+		return fmt.Errorf("config version is required")
+	}
+	data, err := GetConfigVersion(target, id)
+	if err != nil {
+		return err
+	}
+	file, err := historyFile(target)
+	if err != nil {
+		return err
+	}
+	ctx = WithChangeSource(ctx, ChangeRestore)
+
+	// go-rag 等登记的配置文件直接写回
+	if historyTarget(file) == "" {
+		old, _ := os.ReadFile(file)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		RecordConfigVersion(ctx, target, old, data)
+		g.Log().Infof(ctx, "Restored %s to version %s", target, id)
+		return nil
+	}
+
+	if err := validateWrite(ctx, file, data); err != nil {
+		return err
+	}
+	if err := writeConfigData(ctx, file, data); err != nil {
+		return err
+	}
+	g.Log().Infof(ctx, "Restored %s to version %s", target, id)
+	return reload(ctx)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// versionWith 返回内容包含 text 的最新快照
+func versionWith(t *testing.T, target, text string) string {
+	t.Helper()
+	versions, err := ListConfigVersions(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range versions {
+		data, err := GetConfigVersion(target, version.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), text) {
+			return version.ID
+		}
+	}
+	t.Fatalf("no version of %s contains %q", target, text)
+	return ""
+}
+
+func TestRestoreConfigVersion(t *testing.T) {
+	ctx := context.Background()
+	path := loadTestConfig(t, "ai:\n  model: gpt-4o\n")
+	if _, err := CreateProfile(ctx, "dev", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SwitchProfile(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateConfigPath(ctx, "ai.model", "gpt-4o-mini"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 恢复 config.yaml 的旧版本会选择另一个方案，恢复方案文件的版本不会
+	versions, err := ListConfigVersions(HistoryWachat)
+	if err != nil || len(versions) < 2 {
+		t.Fatalf("versions of config.yaml = %d, %v", len(versions), err)
+	}
+	original := versions[len(versions)-1].ID
+	if name, err := RestoredProfile(HistoryWachat, original); err != nil || name != "" {
+		t.Errorf("RestoredProfile of the original config.yaml = %q, %v, want no profile", name, err)
+	}
+	switched := versionWith(t, HistoryWachat, "name: dev")
+	if name, err := RestoredProfile(HistoryWachat, switched); err != nil || name != "dev" {
+		t.Errorf("RestoredProfile of the switched config.yaml = %q, %v, want dev", name, err)
+	}
+	devVersion := versionWith(t, "profiles/dev", "model: gpt-4o\n")
+	if name, err := RestoredProfile("profiles/dev", devVersion); err != nil || name != "dev" {
+		t.Errorf("RestoredProfile of the profile file = %q, %v, want the active profile", name, err)
+	}
+	if _, err := RestoredProfile(HistoryWachat, "missing"); err == nil {
+		t.Error("RestoredProfile of a missing version succeeded")
+	}
+
+	if err := RestoreConfigVersion(ctx, "profiles/dev", devVersion); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := Get(); ActiveProfile() != "dev" || cfg.AI.Model != "gpt-4o" {
+		t.Errorf("after restoring the profile: profile %q, model %s", ActiveProfile(), cfg.AI.Model)
+	}
+	if err := RestoreConfigVersion(ctx, HistoryWachat, original); err != nil {
+		t.Fatal(err)
+	}
+	if ActiveProfile() != "" {
+		t.Errorf("after restoring config.yaml: profile %q, want none", ActiveProfile())
+	}
+
+	// 无法通过校验的版本不写入
+	if err := os.WriteFile(path, []byte("rag:\n  topK: 500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshotConfigFiles(ctx, "")
+	invalid := versionWith(t, HistoryWachat, "topK: 500")
+	if err := os.WriteFile(path, []byte("ai:\n  model: gpt-4o\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreConfigVersion(ctx, HistoryWachat, invalid); err == nil {
+		t.Error("restoring an invalid version succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "ai:\n  model: gpt-4o\n" {
+		t.Errorf("config.yaml after a failed restore:\n%s", data)
+	}
+}
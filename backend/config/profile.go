@@ -0,0 +1,354 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gfile"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置方案（profile）：~/.wachat/profiles/<name>/config.yaml 中的配置段覆盖 config.yaml 中的同名配置，
+// 映射逐层合并，列表和标量整体替换。config.yaml 中的 profile.name（或 WACHAT_PROFILE_NAME）选择当前方案：
+//
+//	# ~/.wachat/profiles/work/config.yaml
+//	profile:
+//	  description: 公司内部模型和知识库
+//	  ownDatabase: true   # 对话保存在 ~/.wachat/profiles/work/chat.db
+//	ai:
+//	  base_url: https://llm.corp.example.com/v1
+//	rag:
+//	  defaultKnowledgeBase: corp
+//
+// 在设置界面修改方案已覆盖的配置段时写入方案的文件，方案中的密钥以 profiles.<name>. 为前缀保存
+const profileConfigFile = "config.yaml"
+
+// profileNamePattern 方案名称：字母、数字及 _ -（用作目录名）
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// profileSections 新建方案时从 config.yaml 复制的配置段
+var profileSections = []string{"ai", "rag", "qdrant"}
+
+// Profile describes a named set of config overrides
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	OwnDatabase bool   `json:"ownDatabase"` // 使用方案目录下独立的 chat.db
+	Dir         string `json:"dir"`         // 方案目录
+	Active      bool   `json:"active"`      // 是否为当前方案
+}
+
+// wachatDir 返回 ~/.wachat
+func wachatDir() string {
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(homeDir, ".wachat")
+	}
+	return ".wachat"
+}
+
+// ProfilesDir returns the directory holding every profile (~/.wachat/profiles)
+func ProfilesDir() string {
+	return filepath.Join(wachatDir(), "profiles")
+}
+
+// profileConfigPath 返回方案的配置文件路径
+func profileConfigPath(name string) string {
+	return filepath.Join(ProfilesDir(), name, profileConfigFile)
+}
+
+// ValidateProfileName checks that a profile name can be used as a directory name
+func ValidateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '_' and '-'", name)
+	}
+	return nil
+}
+
+// profileReader 读取方案配置文件（校验时可以替换为尚未写入的内容）
+type profileReader func(name string) ([]byte, error)
+
+// readProfileFile 读取方案配置文件
+func readProfileFile(name string) ([]byte, error) {
+	return os.ReadFile(profileConfigPath(name))
+}
+
+// readProfile 读取方案配置文件的原始内容
+func readProfile(name string) (map[string]interface{}, error) {
+	return parseProfile(name, readProfileFile)
+}
+
+// parseProfile 读取并解析方案配置文件
+func parseProfile(name string, read profileReader) (map[string]interface{}, error) {
+	data, err := read(name)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", profileConfigPath(name), err)
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+	return raw, nil
+}
+
+// selectedProfile 返回配置内容（已展开 ${VAR}）选择的方案，WACHAT_PROFILE_NAME 优先
+func selectedProfile(raw map[string]interface{}) string {
+	if name, ok := os.LookupEnv(envName("profile.name")); ok {
+		return name
+	}
+	if section, ok := raw["profile"].(map[string]interface{}); ok {
+		if name, ok := section["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// mergeProfile 将当前方案的配置段合并到配置内容中
+func mergeProfile(raw map[string]interface{}, sources map[string]valueSource, warnings *[]string, read profileReader) {
+	name := selectedProfile(raw)
+	if name == "" {
+		return
+	}
+	if err := ValidateProfileName(name); err != nil {
+		*warnings = append(*warnings, err.Error())
+		return
+	}
+	overlay, err := parseProfile(name, read)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("Ignoring profile %s: %v", name, err))
+		return
+	}
+
+	overlaySources := make(map[string]valueSource)
+	overlay = interpolateValue("", overlay, overlaySources, warnings).(map[string]interface{})
+	for path, src := range overlaySources {
+		if src.source != SourceEnv {
+			src = valueSource{source: SourceProfile, profile: name}
+		}
+		sources[path] = src
+	}
+	mergeMaps(raw, overlay)
+	if err := setPath(raw, "profile.name", name); err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("Ignoring profile %s: %v", name, err))
+	}
+}
+
+// mergeMaps 将 src 逐层合并到 dst：两边都是映射时递归合并，否则替换
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := dst[key].(map[string]interface{}); ok {
+				mergeMaps(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// profileTarget 返回写入配置路径时使用的文件以及方案中密钥名称的前缀：
+// 当前方案覆盖了该配置段时写入方案的文件，否则写入 config.yaml（profile.name 总是写入 config.yaml）
+func profileTarget(profile, path string) (file, secretPrefix string) {
+	if profile == "" || path == "profile.name" {
+		return configPath, ""
+	}
+	section := path
+	for i, c := range path {
+		if c == '.' || c == '[' {
+			section = path[:i]
+			break
+		}
+	}
+	raw, err := readProfile(profile)
+	if err != nil || raw[section] == nil {
+		return configPath, ""
+	}
+	return profileConfigPath(profile), "profiles." + profile + "."
+}
+
+// activeProfileName 返回当前方案名称（调用方需持有 configMutex）
+func activeProfileName() string {
+	if globalConfig == nil || globalConfig.Profile == nil {
+		return ""
+	}
+	return globalConfig.Profile.Name
+}
+
+// ActiveProfile returns the name of the active profile ("" when only config.yaml is used)
+func ActiveProfile() string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return activeProfileName()
+}
+
+// ListProfiles returns every profile under ~/.wachat/profiles sorted by name
+func ListProfiles() ([]*Profile, error) {
+	entries, err := os.ReadDir(ProfilesDir())
+	if os.IsNotExist(err) {
+		return []*Profile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	active := ActiveProfile()
+	profiles := make([]*Profile, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateProfileName(entry.Name()) != nil || !gfile.Exists(profileConfigPath(entry.Name())) {
+			continue
+		}
+		profile := &Profile{
+			Name:   entry.Name(),
+			Dir:    filepath.Join(ProfilesDir(), entry.Name()),
+			Active: entry.Name() == active,
+		}
+		if raw, err := readProfile(entry.Name()); err == nil {
+			if section, ok := raw["profile"].(map[string]interface{}); ok {
+				profile.Description, _ = section["description"].(string)
+				profile.OwnDatabase, _ = section["ownDatabase"].(bool)
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// CreateProfile creates a profile seeded with the ai, rag and qdrant sections of config.yaml
+func CreateProfile(ctx context.Context, name, description string, ownDatabase bool) (*Profile, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return nil, err
+	}
+	path := profileConfigPath(name)
+	if gfile.Exists(path) {
+		return nil, fmt.Errorf("profile %s already exists", name)
+	}
+
+	content := map[string]interface{}{
+		"profile": map[string]interface{}{
+			"description": description,
+			"ownDatabase": ownDatabase,
+		},
+	}
+	// 复制原始内容（保留 ${VAR} 和 secret:// 引用）
+	if data, err := os.ReadFile(configPath); err == nil {
+		var base map[string]interface{}
+		if err := yaml.Unmarshal(data, &base); err == nil {
+			for _, section := range profileSections {
+				if base[section] != nil {
+					content[section] = base[section]
+				}
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal profile: %w", err)
+	}
+	header := fmt.Sprintf("# wachat profile: %s\n# Sections here override the same sections of %s\n", name, configPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	data = append([]byte(header), data...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write profile: %w", err)
+	}
+	recordFileVersion(ctx, path, nil, data)
+
+	g.Log().Infof(ctx, "Created profile %s at %s", name, path)
+	return &Profile{
+		Name:        name,
+		Description: description,
+		OwnDatabase: ownDatabase,
+		Dir:         filepath.Dir(path),
+	}, nil
+}
+
+// CheckProfileSwitch reports whether SwitchProfile can switch to name (the profile exists and isn't fixed by the environment)
+// The merged config is only validated by SwitchProfile itself
+func CheckProfileSwitch(name string) error {
+	if name != "" {
+		if err := ValidateProfileName(name); err != nil {
+			return err
+		}
+		if !gfile.Exists(profileConfigPath(name)) {
+			return fmt.Errorf("profile %s does not exist", name)
+		}
+	}
+	if env := envName("profile.name"); hasEnv(env) {
+		return fmt.Errorf("the profile is fixed by %s", env)
+	}
+	return nil
+}
+
+// SwitchProfile makes a profile active ("" switches back to config.yaml only) and reloads the config
+// The merged config is validated before config.yaml is changed
+func SwitchProfile(ctx context.Context, name string) error {
+	if err := CheckProfileSwitch(name); err != nil {
+		return err
+	}
+	if name == ActiveProfile() {
+		return nil
+	}
+
+	if err := UpdateConfigPath(ctx, "profile.name", name); err != nil {
+		return err
+	}
+	g.Log().Infof(ctx, "Switched to profile %q", name)
+	return nil
+}
+
+// watchedProfile 正在监听的配置方案文件
+var watchedProfile string
+
+// watchProfileFile 监听当前配置方案的文件，切换方案后改为监听新方案的文件（调用方需持有 configMutex）
+func watchProfileFile(ctx context.Context) {
+	if watcher == nil {
+		return
+	}
+	path := ""
+	if name := activeProfileName(); name != "" {
+		path = profileConfigPath(name)
+	}
+	if path == watchedProfile {
+		return
+	}
+	if watchedProfile != "" {
+		watcher.Remove(watchedProfile)
+		watchedProfile = ""
+	}
+	if path == "" {
+		return
+	}
+	if err := watcher.Add(path); err != nil {
+		g.Log().Warningf(ctx, "Failed to watch profile config %s: %v", path, err)
+		return
+	}
+	watchedProfile = path
+}
+
+// hasEnv 判断环境变量是否已设置（包括空值）
+func hasEnv(name string) bool {
+	_, ok := os.LookupEnv(name)
+	return ok
+}
+
+// GetDatabasePath returns the SQLite database of the active profile
+// 方案设置了 ownDatabase 时使用方案目录下的 chat.db，否则使用 ~/.wachat/chat.db
+func GetDatabasePath() string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	if globalConfig != nil && globalConfig.Profile != nil && globalConfig.Profile.Name != "" && globalConfig.Profile.OwnDatabase {
+		return filepath.Join(ProfilesDir(), globalConfig.Profile.Name, "chat.db")
+	}
+	return filepath.Join(wachatDir(), "chat.db")
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeProfile(t *testing.T) {
+	t.Setenv("TEST_PROFILE_URL", "https://llm.env.example.com/v1")
+	base := `profile:
+  name: dev
+ai:
+  base_url: https://api.example.com/v1
+  model: gpt-4o
+  providers:
+    - name: a
+      base_url: https://a.example.com/v1
+    - name: b
+      base_url: https://b.example.com/v1
+rag:
+  topK: 5
+`
+	profiles := map[string]string{
+		"dev": `profile:
+  description: development
+ai:
+  base_url: https://llm.dev.example.com/v1
+  providers:
+    - name: c
+      base_url: https://c.example.com/v1
+rag:
+  topK: 8
+`,
+		"env": "ai:\n  base_url: ${TEST_PROFILE_URL}\n",
+	}
+
+	tests := []struct {
+		name         string
+		content      string
+		env          string // WACHAT_PROFILE_NAME
+		wantBaseURL  string
+		wantTopK     int
+		wantProvider []string
+		wantSources  map[string]valueSource
+		wantWarning  string
+	}{
+		{
+			name:         "maps merged, lists replaced",
+			content:      base,
+			wantBaseURL:  "https://llm.dev.example.com/v1",
+			wantTopK:     8,
+			wantProvider: []string{"c"},
+			wantSources: map[string]valueSource{
+				"ai.base_url":          {source: SourceProfile, profile: "dev"},
+				"ai.providers[0].name": {source: SourceProfile, profile: "dev"},
+				"ai.model":             {source: SourceFile},
+				"profile.description":  {source: SourceProfile, profile: "dev"},
+			},
+		},
+		{
+			name:         "no profile",
+			content:      strings.Replace(base, "name: dev", "name: \"\"", 1),
+			wantBaseURL:  "https://api.example.com/v1",
+			wantTopK:     5,
+			wantProvider: []string{"a", "b"},
+			wantSources:  map[string]valueSource{"ai.base_url": {source: SourceFile}},
+		},
+		{
+			name:         "selected by the environment",
+			content:      base,
+			env:          "env",
+			wantBaseURL:  "https://llm.env.example.com/v1",
+			wantTopK:     5,
+			wantProvider: []string{"a", "b"},
+			wantSources:  map[string]valueSource{"ai.base_url": {source: SourceEnv, env: "TEST_PROFILE_URL"}},
+		},
+		{
+			name:         "missing profile",
+			content:      strings.Replace(base, "name: dev", "name: staging", 1),
+			wantBaseURL:  "https://api.example.com/v1",
+			wantTopK:     5,
+			wantProvider: []string{"a", "b"},
+			wantWarning:  "Ignoring profile staging",
+		},
+		{
+			name:         "invalid name",
+			content:      strings.Replace(base, "name: dev", "name: ../dev", 1),
+			wantBaseURL:  "https://api.example.com/v1",
+			wantTopK:     5,
+			wantProvider: []string{"a", "b"},
+			wantWarning:  `invalid profile name "../dev"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv(envName("profile.name"), tt.env)
+			}
+			content, sources, warnings, err := resolveContent([]byte(tt.content), testProfiles(profiles))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cfg Config
+			if err := json.Unmarshal([]byte(content), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.AI.BaseURL != tt.wantBaseURL || cfg.AI.Model != "gpt-4o" || cfg.RAG.TopK != tt.wantTopK {
+				t.Errorf("base_url = %s, model = %s, topK = %d", cfg.AI.BaseURL, cfg.AI.Model, cfg.RAG.TopK)
+			}
+			var providers []string
+			for _, p := range cfg.AI.Providers {
+				providers = append(providers, p.Name)
+			}
+			if !reflect.DeepEqual(providers, tt.wantProvider) {
+				t.Errorf("providers = %v, want %v", providers, tt.wantProvider)
+			}
+			for path, want := range tt.wantSources {
+				if got := sources[path]; got != want {
+					t.Errorf("source of %s = %+v, want %+v", path, got, want)
+				}
+			}
+			if tt.wantWarning == "" && len(warnings) > 0 || tt.wantWarning != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning)) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestProfileTarget(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	old := configPath
+	configPath = filepath.Join(home, ".wachat", "config.yaml")
+	t.Cleanup(func() { configPath = old })
+
+	devFile := profileConfigPath("dev")
+	if err := os.MkdirAll(filepath.Dir(devFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(devFile, []byte("ai:\n  model: gpt-4o\nmcp:\n  servers: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile, path string
+		wantFile      string
+		wantPrefix    string
+	}{
+		{"", "ai.api_key", configPath, ""},
+		{"dev", "ai.api_key", devFile, "profiles.dev."},
+		{"dev", "ai", devFile, "profiles.dev."},
+		{"dev", "mcp.servers[0].token", devFile, "profiles.dev."},
+		{"dev", "rag.topK", configPath, ""},
+		{"dev", "profile.name", configPath, ""},
+		{"missing", "ai.api_key", configPath, ""},
+	}
+	for _, tt := range tests {
+		file, prefix := profileTarget(tt.profile, tt.path)
+		if file != tt.wantFile || prefix != tt.wantPrefix {
+			t.Errorf("profileTarget(%q, %q) = %s, %q, want %s, %q", tt.profile, tt.path, file, prefix, tt.wantFile, tt.wantPrefix)
+		}
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	ctx := context.Background()
+	path := loadTestConfig(t, "ai:\n  base_url: https://api.example.com/v1\n  model: gpt-4o\nrag:\n  topK: 5\n")
+
+	if _, err := CreateProfile(ctx, "dev", "development", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateProfile(ctx, "dev", "again", false); err == nil {
+		t.Error("creating an existing profile succeeded")
+	}
+	if err := SwitchProfile(ctx, "staging"); err == nil {
+		t.Error("switching to a missing profile succeeded")
+	}
+
+	// 方案复制了 ai、rag 段，修改这些段写入方案的文件，修改其他段写入 config.yaml
+	if err := SwitchProfile(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if ActiveProfile() != "dev" || GetDatabasePath() != filepath.Join(ProfilesDir(), "dev", "chat.db") {
+		t.Errorf("active profile = %q, database = %s", ActiveProfile(), GetDatabasePath())
+	}
+	if err := UpdateConfigPath(ctx, "ai.model", "gpt-4o-mini"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateConfigPath(ctx, "mcp.enabled", true); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := Get(); cfg.AI.Model != "gpt-4o-mini" || !cfg.MCP.Enabled {
+		t.Errorf("model = %s, mcp.enabled = %v", cfg.AI.Model, cfg.MCP.Enabled)
+	}
+	main, _ := os.ReadFile(path)
+	dev, _ := os.ReadFile(profileConfigPath("dev"))
+	if !strings.Contains(string(main), "model: gpt-4o\n") || !strings.Contains(string(main), "mcp:\n  enabled: true") || !strings.Contains(string(main), "name: dev") {
+		t.Errorf("config.yaml:\n%s", main)
+	}
+	if !strings.Contains(string(dev), "model: gpt-4o-mini") || strings.Contains(string(dev), "mcp:") {
+		t.Errorf("profile config:\n%s", dev)
+	}
+
+	profiles, err := ListProfiles()
+	if err != nil || len(profiles) != 1 || !profiles[0].Active || !profiles[0].OwnDatabase || profiles[0].Description != "development" {
+		t.Errorf("profiles = %+v, %v", profiles, err)
+	}
+
+	// 切换回 config.yaml
+	if err := SwitchProfile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := Get(); ActiveProfile() != "" || cfg.AI.Model != "gpt-4o" || GetDatabasePath() != filepath.Join(wachatDir(), "chat.db") {
+		t.Errorf("after switching back: profile %q, model %s, database %s", ActiveProfile(), cfg.AI.Model, GetDatabasePath())
+	}
+
+	// 环境变量固定了方案时不能切换
+	t.Setenv(envName("profile.name"), "dev")
+	if err := CheckProfileSwitch("dev"); err == nil || !strings.Contains(err.Error(), "fixed by WACHAT_PROFILE_NAME") {
+		t.Errorf("CheckProfileSwitch = %v", err)
+	}
+}
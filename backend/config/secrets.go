@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/secret"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeys 配置中保存密钥的字段名（用于 UpdateConfigPath 按路径写入时识别）
+var secretKeys = map[string]bool{
+	"api_key": true,
+	"apiKey":  true,
+	"token":   true,
+}
+
+// aiAPIKeySecret AI 设置的 API Key 在密钥存储中的名称
+const aiAPIKeySecret = "ai.api_key"
+
+// resolveSecrets 选择密钥存储，并将配置中所有 secret://<name> 引用替换为实际的值
+// 无法读取的密钥记录警告后置为空；标记为 secret 的明文字段登记到日志脱敏
+func resolveSecrets(ctx context.Context, cfg *Config) {
+	opts := secret.Options{}
+	if cfg.Secrets != nil {
+		opts.Backend, opts.File = cfg.Secrets.Backend, cfg.Secrets.File
+	}
+	if _, err := secret.Configure(opts); err != nil {
+		g.Log().Warningf(ctx, "Failed to open secret store: %v", err)
+	}
+	resolveValue(ctx, reflect.ValueOf(cfg), "", false)
+}
+
+// resolveValue 递归处理结构体、切片、map 中的字符串
+func resolveValue(ctx context.Context, v reflect.Value, path string, tagged bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			resolveValue(ctx, v.Elem(), path, tagged)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			resolveValue(ctx, v.Field(i), joinPath(path, name), field.Tag.Get("secret") == "true")
+		}
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i), tagged)
+		}
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			value := v.MapIndex(key).String()
+			if resolved, ok := resolveString(ctx, joinPath(path, key.String()), value, tagged); ok {
+				v.SetMapIndex(key, reflect.ValueOf(resolved).Convert(v.Type().Elem()))
+			}
+		}
+
+	case reflect.String:
+		if resolved, ok := resolveString(ctx, path, v.String(), tagged); ok && v.CanSet() {
+			v.SetString(resolved)
+		}
+	}
+}
+
+// resolveString 解析单个值，返回替换后的值以及是否需要替换
+func resolveString(ctx context.Context, path, value string, tagged bool) (string, bool) {
+	if !secret.IsRef(value) {
+		if tagged && secret.Register(value) && sourceOf(path).source == SourceFile {
+			g.Log().Warningf(ctx, "%s is stored in plaintext in the config file, save it again from the settings or with `config set` to move it to the secret store", path)
+		}
+		return value, false
+	}
+
+	resolved, err := secret.Resolve(value)
+	if err != nil {
+		g.Log().Warningf(ctx, "Failed to resolve %s: %v", path, err)
+		return "", true
+	}
+	return resolved, true
+}
+
+// joinPath 拼接配置路径
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// storeSecret 将密钥保存到密钥存储，返回写入配置文件的值（引用或空字符串）
+// 值本身由引用解析而来时（如切换到已配置的 AI 提供商）直接复用原引用
+func storeSecret(ctx context.Context, name, value string) (string, error) {
+	if value == "" {
+		if _, err := secret.Put(name, ""); err != nil {
+			g.Log().Warningf(ctx, "Failed to remove secret %s: %v", name, err)
+		}
+		return "", nil
+	}
+	if secret.IsRef(value) {
+		return value, nil
+	}
+	if ref := secret.RefOf(value); ref != "" {
+		return ref, nil
+	}
+	return secret.Put(name, value)
+}
+
+// isSecretPath 判断配置路径是否指向密钥字段
+func isSecretPath(path string) bool {
+	keys := strings.Split(path, ".")
+	return secretKeys[keys[len(keys)-1]]
+}
+
+// CheckMaskedSecrets rejects config content whose secret fields still hold a masked value
+// 界面回传的掩码无法还原时（多个密钥的掩码相同）保存会用掩码覆盖真实的密钥
+func CheckMaskedSecrets(content string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		// 语法错误由保存时的校验报告
+		return nil
+	}
+	return checkMaskedNode(&doc)
+}
+
+// checkMaskedNode 递归检查映射中的密钥字段
+func checkMaskedNode(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && secretKeys[key.Value] && secret.IsMasked(value.Value) {
+				return fmt.Errorf("%s on line %d is still masked, enter the full value", key.Value, value.Line)
+			}
+		}
+	}
+	for _, child := range node.Content {
+		if err := checkMaskedNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockSecrets unlocks the encrypted secret file and reloads the config so references resolve
+func UnlockSecrets(ctx context.Context, passphrase string) error {
+	if err := secret.Unlock(passphrase); err != nil {
+		return err
+	}
+	return reload(ctx)
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckMaskedSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"plain key", "ai:\n  api_key: sk-0123456789abcdef\n", ""},
+		{"reference", "ai:\n  api_key: secret://ai.api_key\n", ""},
+		{"masked key", "ai:\n  base_url: https://api.example.com\n  api_key: sk-****cdef\n", "api_key on line 3 is still masked"},
+		{"masked token in a list", "mcp:\n  servers:\n    - name: docs\n      token: '********'\n", "token on line 4 is still masked"},
+		{"mask outside a secret field", "ai:\n  model: 'gpt-****'\n", ""},
+		{"invalid yaml", "ai: [\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckMaskedSecrets(tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckMaskedSecrets: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckMaskedSecrets error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,868 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/os/gcfg"
+	"gopkg.in/yaml.v3"
+)
+
+// 校验分两步：
+//
+//  1. 按 Config 的 json 标签检查 YAML 结构：类型、未知字段（拼写错误给出建议）、重复的键
+//  2. 展开 ${VAR}、应用 WACHAT_* 覆盖和默认值后检查取值：范围、必填字段、URL、端口冲突
+//
+// 第一步有错误时不做第二步（类型错误时扫描结果不可靠）
+
+// goRAGSections go-rag 和 GoFrame 使用的顶级配置段，不做字段检查
+var goRAGSections = []string{"server", "database", "logger", "redis", "vector", "es", "embedding", "chat", "rerank", "rewrite", "qa"}
+
+// yamlErrorPattern yaml.v3 语法错误中的行号
+var yamlErrorPattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// ValidationError is a problem found in the config, located in the YAML source when possible
+type ValidationError struct {
+	File    string `json:"file,omitempty"`   // 问题所在的文件（为空表示正在校验的内容，配置方案中的问题为方案的文件）
+	Path    string `json:"path,omitempty"`   // 配置路径，如 rag.topK、services[0].name（语法错误时为空）
+	Line    int    `json:"line,omitempty"`   // 行号（从 1 开始，无法定位时为 0）
+	Column  int    `json:"column,omitempty"` // 列号（从 1 开始，无法定位时为 0）
+	Message string `json:"message"`
+}
+
+// Error formats the error as "line 3, column 5: rag.topK: ..."
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ": ")
+	}
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Column)
+	case e.Line > 0:
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationErrors is returned when the config fails validation
+type ValidationErrors []*ValidationError
+
+// Error lists every problem on its own line
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	if len(e) == 1 {
+		lines = append(lines, "invalid config (1 problem):")
+	} else {
+		lines = append(lines, fmt.Sprintf("invalid config (%d problems):", len(e)))
+	}
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator 收集校验错误，并记录各配置路径在 YAML 中的节点用于定位
+type validator struct {
+	read    profileReader          // 读取配置方案的文件
+	file    string                 // 正在检查的文件（为空表示传入的内容）
+	nodes   map[string]nodeRef     // 配置路径对应的值节点
+	sources map[string]valueSource // 配置路径的来源（用于提示由环境变量设置的值）
+	errors  ValidationErrors
+}
+
+// nodeRef 配置路径在 YAML 中的位置
+type nodeRef struct {
+	file string
+	node *yaml.Node
+}
+
+// ValidateContent checks config file content without applying it
+// The active profile selected by the content is merged in as when loading
+// Returns nil when the content is valid
+func ValidateContent(ctx context.Context, content string) ValidationErrors {
+	return validateContent(ctx, content, readProfileFile)
+}
+
+// validateContent 校验配置内容，配置方案的文件通过 read 读取
+func validateContent(ctx context.Context, content string, read profileReader) ValidationErrors {
+	v := &validator{read: read, nodes: make(map[string]nodeRef)}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return ValidationErrors{syntaxError(err)}
+	}
+	if len(doc.Content) > 0 {
+		root := resolveAlias(doc.Content[0])
+		if root.Kind != yaml.MappingNode && root.Tag != "!!null" {
+			return ValidationErrors{{Line: root.Line, Column: root.Column, Message: "config must be a mapping of sections"}}
+		}
+		v.checkRoot(root)
+	}
+	if len(v.errors) == 0 {
+		v.checkProfile()
+	}
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+
+	// 按加载时的流程得到生效的配置
+	resolved, sources, _, err := resolveContent([]byte(content), read)
+	if err != nil {
+		return ValidationErrors{syntaxError(err)}
+	}
+	v.sources = sources
+	adapter, err := gcfg.NewAdapterContent(resolved)
+	if err != nil {
+		return ValidationErrors{{Message: err.Error()}}
+	}
+	cfg := scanConfig(ctx, gcfg.NewWithAdapter(adapter))
+	applyDefaults(cfg)
+	v.checkConfig(cfg)
+
+	if len(v.errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		if v.errors[i].File != v.errors[j].File {
+			return v.errors[i].File < v.errors[j].File
+		}
+		if v.errors[i].Line != v.errors[j].Line {
+			return v.errors[i].Line < v.errors[j].Line
+		}
+		return v.errors[i].Column < v.errors[j].Column
+	})
+	return v.errors
+}
+
+// validateFile 校验配置文件
+func validateFile(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if errs := ValidateContent(ctx, string(data)); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// validateWrite 校验即将写入 file 的内容：写入配置方案的文件时与 config.yaml 合并后校验
+func validateWrite(ctx context.Context, file string, data []byte) error {
+	content := string(data)
+	read := readProfileFile
+	if file != configPath {
+		main, err := os.ReadFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		content = string(main)
+		read = func(name string) ([]byte, error) {
+			if profileConfigPath(name) == file {
+				return data, nil
+			}
+			return readProfileFile(name)
+		}
+	}
+	if errs := validateContent(ctx, content, read); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// syntaxError 将 YAML 解析错误转换为带行号的校验错误
+func syntaxError(err error) *ValidationError {
+	if m := yamlErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &ValidationError{Line: line, Message: m[2]}
+	}
+	return &ValidationError{Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+// resolveAlias 返回锚点引用（*name）指向的节点
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// checkProfile 检查当前配置方案的文件（同样的结构检查，方案中出现的路径以方案文件中的位置为准）
+func (v *validator) checkProfile() {
+	name := ""
+	if env := envName("profile.name"); hasEnv(env) {
+		name = os.Getenv(env)
+	} else if ref, ok := v.nodes["profile.name"]; ok && ref.node.Tag != "!!null" {
+		name, _ = interpolate("profile.name", ref.node.Value, nil)
+	}
+	if name == "" {
+		return
+	}
+	if err := ValidateProfileName(name); err != nil {
+		v.errorf("profile.name", "%v", err)
+		return
+	}
+	path := profileConfigPath(name)
+	data, err := v.read(name)
+	if err != nil {
+		v.errorf("profile.name", "profile %q does not exist (%s)", name, path)
+		return
+	}
+
+	v.file = path
+	defer func() { v.file = "" }()
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		syntax := syntaxError(err)
+		syntax.File = path
+		v.errors = append(v.errors, syntax)
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := resolveAlias(doc.Content[0])
+	if root.Kind != yaml.MappingNode && root.Tag != "!!null" {
+		v.addf("", root, "profile config must be a mapping of sections")
+		return
+	}
+	v.checkRoot(root)
+}
+
+// addf 在节点位置记录错误
+func (v *validator) addf(path string, node *yaml.Node, format string, args ...interface{}) {
+	v.addAt(path, nodeRef{file: v.file, node: node}, format, args...)
+}
+
+// addAt 在指定文件的节点位置记录错误
+func (v *validator) addAt(path string, ref nodeRef, format string, args ...interface{}) {
+	err := &ValidationError{File: ref.file, Path: path, Message: fmt.Sprintf(format, args...)}
+	if ref.node != nil {
+		err.Line, err.Column = ref.node.Line, ref.node.Column
+	}
+	v.errors = append(v.errors, err)
+}
+
+// errorf 记录取值错误：定位到路径或最近的上级节点，值来自环境变量时附上变量名
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if src, ok := v.sources[path]; ok && src.source == SourceEnv {
+		message += fmt.Sprintf(" (set by %s)", src.env)
+	}
+	v.addAt(path, v.locate(path), "%s", message)
+}
+
+// locate 返回路径或最近的上级路径对应的节点
+func (v *validator) locate(path string) nodeRef {
+	for path != "" {
+		if ref, ok := v.nodes[path]; ok {
+			return ref
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return nodeRef{}
+}
+
+// pathOf 返回候选路径中在文件里出现的第一个（都未出现时返回第一个）
+func (v *validator) pathOf(paths ...string) string {
+	for _, path := range paths {
+		if _, ok := v.nodes[path]; ok {
+			return path
+		}
+	}
+	return paths[0]
+}
+
+// checkRoot 检查顶级配置段：wachat 的配置段检查全部字段，go-rag 的配置段只检查 wachat 读取的字段
+func (v *validator) checkRoot(root *yaml.Node) {
+	fields := jsonFields(reflect.TypeOf(Config{}))
+	known := make([]string, 0, len(fields)+len(goRAGSections))
+	for name := range fields {
+		known = append(known, name)
+	}
+	known = append(known, goRAGSections...)
+
+	v.eachKey("", root, func(key string, keyNode, value *yaml.Node) {
+		if field, ok := fields[key]; ok {
+			v.checkValue(key, value, field.Type)
+			return
+		}
+		switch {
+		case key == "server":
+			// go-rag（GoFrame ghttp）的 server 段还有其他字段，这里只检查 address 和 url
+			v.nodes[key] = nodeRef{file: v.file, node: value}
+			if value.Kind == yaml.MappingNode {
+				v.eachKey(key, value, func(sub string, _, subValue *yaml.Node) {
+					if sub == "address" || sub == "url" {
+						v.checkValue(joinPath(key, sub), subValue, reflect.TypeOf(""))
+					}
+				})
+			}
+		case containsString(goRAGSections, key):
+		default:
+			// 其他程序可能也读取这个文件，只报告疑似拼写错误的配置段
+			if suggestion := suggest(key, known); suggestion != "" {
+				v.addf(key, keyNode, "unknown section %q (did you mean %q?)", key, suggestion)
+			}
+		}
+	})
+}
+
+// eachKey 遍历映射节点的键值，报告重复的键（<< 合并键跳过）
+func (v *validator) eachKey(path string, node *yaml.Node, fn func(key string, keyNode, value *yaml.Node)) {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], resolveAlias(node.Content[i+1])
+		key := keyNode.Value
+		if key == "<<" {
+			continue
+		}
+		if seen[key] {
+			v.addf(joinPath(path, key), keyNode, "duplicate key %q", key)
+			continue
+		}
+		seen[key] = true
+		fn(key, keyNode, value)
+	}
+}
+
+// checkValue 按字段类型检查节点
+func (v *validator) checkValue(path string, node *yaml.Node, t reflect.Type) {
+	node = resolveAlias(node)
+	v.nodes[path] = nodeRef{file: v.file, node: node}
+	if node.Tag == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.addf(path, node, "expected a section, got %s", describe(node))
+			return
+		}
+		fields := jsonFields(t)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		v.eachKey(path, node, func(key string, keyNode, value *yaml.Node) {
+			field, ok := fields[key]
+			if !ok {
+				if suggestion := suggest(key, names); suggestion != "" {
+					v.addf(joinPath(path, key), keyNode, "unknown field %q (did you mean %q?)", key, suggestion)
+				} else {
+					v.addf(joinPath(path, key), keyNode, "unknown field %q", key)
+				}
+				return
+			}
+			v.checkValue(joinPath(path, key), value, field.Type)
+		})
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.addf(path, node, "expected a mapping, got %s", describe(node))
+			return
+		}
+		v.eachKey(path, node, func(key string, _, value *yaml.Node) {
+			v.checkValue(joinPath(path, key), value, t.Elem())
+		})
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.addf(path, node, "expected a list, got %s", describe(node))
+			return
+		}
+		for i, item := range node.Content {
+			v.checkValue(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(path, node, "expected a string, got %s", describe(node))
+		}
+
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(path, node, "expected an integer, got %s", describe(node))
+			return
+		}
+		if node.Tag == "!!int" {
+			return
+		}
+		value, _ := interpolate(path, node.Value, nil)
+		if _, err := strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			v.addf(path, node, "expected an integer, got %s", describe(node))
+		}
+
+	case reflect.Float64:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(path, node, "expected a number, got %s", describe(node))
+			return
+		}
+		if node.Tag == "!!float" || node.Tag == "!!int" {
+			return
+		}
+		value, _ := interpolate(path, node.Value, nil)
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			v.addf(path, node, "expected a number, got %s", describe(node))
+		}
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(path, node, "expected true or false, got %s", describe(node))
+			return
+		}
+		if node.Tag == "!!bool" {
+			return
+		}
+		value, _ := interpolate(path, node.Value, nil)
+		if !isBool(value) {
+			v.addf(path, node, "expected true or false, got %s", describe(node))
+		}
+	}
+}
+
+// jsonFields 返回结构体按 json 标签索引的字段
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// describe 描述节点的类型和值，用于错误信息
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a section"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch node.Tag {
+	case "!!int":
+		return "integer " + node.Value
+	case "!!float":
+		return "number " + node.Value
+	case "!!bool":
+		return "boolean " + node.Value
+	}
+	return strconv.Quote(node.Value)
+}
+
+// isBool 判断字符串是否为布尔值（兼容 YAML 1.1 的 yes/no/on/off）
+func isBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "no", "on", "off":
+		return true
+	}
+	_, err := strconv.ParseBool(strings.TrimSpace(s))
+	return err == nil
+}
+
+// suggest 返回与 key 最接近的名称：大小写不同，或编辑距离不超过 2（较短的名称要求更接近）
+func suggest(key string, names []string) string {
+	best, bestDistance := "", 3
+	if len(key) <= 4 {
+		bestDistance = 2
+	}
+	for _, name := range names {
+		if strings.EqualFold(key, name) {
+			return name
+		}
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDistance || (d == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance 计算两个字符串的编辑距离
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// containsString 判断列表中是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfig 检查生效配置的取值
+func (v *validator) checkConfig(cfg *Config) {
+	// AI
+	v.checkURL("ai.base_url", cfg.AI.BaseURL, true)
+	if strings.TrimSpace(cfg.AI.Model) == "" {
+		v.errorf("ai.model", "model is required")
+	}
+	providers := make(map[string]bool)
+	for i, p := range cfg.AI.Providers {
+		path := fmt.Sprintf("ai.providers[%d]", i)
+		if p == nil {
+			continue
+		}
+		if p.Name == "" {
+			v.errorf(path+".name", "provider name is required")
+		} else if providers[p.Name] {
+			v.errorf(path+".name", "duplicate provider name %q", p.Name)
+		}
+		providers[p.Name] = true
+		v.checkURL(path+".base_url", p.BaseURL, true)
+	}
+
+	// Binaries
+	v.checkRestart("binaries.restart", cfg.Binaries.Restart)
+	v.checkNonNegative("binaries.stop_timeout", cfg.Binaries.StopTimeout)
+
+	// RAG
+	if cfg.RAG.TopK < 1 || cfg.RAG.TopK > 100 {
+		v.errorf("rag.topK", "must be between 1 and 100, got %d", cfg.RAG.TopK)
+	}
+	if cfg.RAG.Server != nil {
+		if strings.Contains(cfg.RAG.Server.Address, "://") {
+			v.checkURL(v.pathOf("server.address", "rag.server.address"), cfg.RAG.Server.Address, false)
+		} else if cfg.RAG.Server.Address != "" {
+			v.checkListenAddress(v.pathOf("server.address", "rag.server.address"), cfg.RAG.Server.Address)
+		}
+		v.checkURL(v.pathOf("rag.server.url", "server.url"), cfg.RAG.Server.URL, false)
+	}
+	v.checkURL("rag.downloadURL", cfg.RAG.DownloadURL, false)
+	v.checkVersion("rag.version", cfg.RAG.Version)
+	v.checkRestart("rag.restart", cfg.RAG.Restart)
+	v.checkNonNegative("rag.stopTimeout", cfg.RAG.StopTimeout)
+	if c := cfg.RAG.Client; c != nil {
+		v.checkNonNegative("rag.client.timeout", c.Timeout)
+		v.checkNonNegative("rag.client.healthTimeout", c.HealthTimeout)
+		if c.Retries != nil {
+			v.checkNonNegative("rag.client.retries", *c.Retries)
+		}
+		v.checkNonNegative("rag.client.retryBackoff", c.RetryBackoff)
+		if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+			v.errorf("rag.client.tls", "certFile and keyFile must be set together")
+		}
+		if c.Breaker != nil {
+			v.checkNonNegative("rag.client.breaker.failures", c.Breaker.Failures)
+			v.checkNonNegative("rag.client.breaker.cooldown", c.Breaker.Cooldown)
+		}
+	}
+
+	switch cfg.RAG.GetBackend() {
+	case RAGBackendGoRAG:
+	case RAGBackendQdrant:
+		if cfg.RAG.Enabled {
+			v.checkRAGQdrant(cfg.RAG)
+		}
+	case RAGBackendEmbedded:
+		if cfg.RAG.Enabled {
+			v.checkRAGEmbedded(cfg.RAG)
+		}
+	default:
+		v.errorf("rag.backend", "unknown backend %q (expected %s, %s or %s)", cfg.RAG.Backend, RAGBackendGoRAG, RAGBackendQdrant, RAGBackendEmbedded)
+	}
+
+	// Qdrant
+	v.checkPort("qdrant.port", cfg.Qdrant.Port)
+	v.checkPort("qdrant.grpcPort", cfg.Qdrant.GrpcPort)
+	v.checkURL("qdrant.url", cfg.Qdrant.URL, false)
+	v.checkURL("qdrant.downloadURL", cfg.Qdrant.DownloadURL, false)
+	v.checkVersion("qdrant.version", cfg.Qdrant.Version)
+	v.checkRestart("qdrant.restart", cfg.Qdrant.Restart)
+	v.checkNonNegative("qdrant.stopTimeout", cfg.Qdrant.StopTimeout)
+
+	// Ollama
+	v.checkPort("ollama.port", cfg.Ollama.Port)
+	v.checkURL("ollama.downloadURL", cfg.Ollama.DownloadURL, false)
+	v.checkRestart("ollama.restart", cfg.Ollama.Restart)
+	v.checkNonNegative("ollama.stopTimeout", cfg.Ollama.StopTimeout)
+
+	// API server
+	v.checkPort("apiServer.port", cfg.APIServer.Port)
+
+	// MCP
+	servers := make(map[string]bool)
+	for i, s := range cfg.MCP.Servers {
+		path := fmt.Sprintf("mcp.servers[%d]", i)
+		if s == nil {
+			continue
+		}
+		if s.Name == "" {
+			v.errorf(path+".name", "server name is required")
+		} else if servers[s.Name] {
+			v.errorf(path+".name", "duplicate server name %q", s.Name)
+		} else if strings.Contains(s.Name, "__") {
+			// 工具全名为 {server}__{tool}，服务器名中的 __ 无法区分
+			v.errorf(path+".name", "server name %q must not contain \"__\"", s.Name)
+		}
+		servers[s.Name] = true
+		switch s.GetTransport() {
+		case "stdio":
+			if s.Command == "" {
+				v.errorf(path+".command", "command is required for stdio transport")
+			}
+		case "sse", "http":
+			if s.URL == "" {
+				v.errorf(path+".url", "url is required for %s transport", s.GetTransport())
+			} else {
+				v.checkURL(path+".url", s.URL, true)
+			}
+		default:
+			v.errorf(path+".transport", "unsupported transport %q (use stdio, sse or http)", s.Transport)
+		}
+	}
+
+	// Managed services
+	services := make(map[string]bool)
+	for i, svc := range cfg.Services {
+		path := fmt.Sprintf("services[%d]", i)
+		if svc == nil {
+			continue
+		}
+		if err := svc.Validate(); err != nil {
+			v.errorf(path, "%v", err)
+		}
+		if svc.Name != "" && services[svc.Name] {
+			v.errorf(path+".name", "duplicate service name %q", svc.Name)
+		}
+		services[svc.Name] = true
+		if svc.Health != nil && svc.Health.URL != "" && !strings.Contains(svc.Health.URL, "{") {
+			v.checkURL(path+".health.url", svc.Health.URL, true)
+		}
+		v.checkNonNegative(path+".stopTimeout", svc.StopTimeout)
+	}
+
+	// Download
+	if cfg.Download.Proxy != "" {
+		u, err := url.Parse(cfg.Download.Proxy)
+		if err != nil || u.Host == "" {
+			v.errorf("download.proxy", "invalid proxy URL %q", cfg.Download.Proxy)
+		} else if !containsString([]string{"http", "https", "socks5"}, u.Scheme) {
+			v.errorf("download.proxy", "unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+		}
+	}
+	for i, mirror := range cfg.Download.Mirrors {
+		if !strings.Contains(mirror, "{url}") {
+			v.checkURL(fmt.Sprintf("download.mirrors[%d]", i), mirror, true)
+		}
+	}
+
+	// Secrets
+	switch cfg.Secrets.Backend {
+	case "auto", "keyring", "file":
+	default:
+		v.errorf("secrets.backend", "unsupported backend %q (use auto, keyring or file)", cfg.Secrets.Backend)
+	}
+
+	// History
+	v.checkNonNegative("history.maxVersions", cfg.History.MaxVersions)
+	v.checkNonNegative("history.maxAge", cfg.History.MaxAge)
+
+	v.checkPortConflicts(cfg)
+}
+
+// checkURL 检查 http(s) 地址
+func (v *validator) checkURL(path, value string, required bool) {
+	if value == "" {
+		if required {
+			v.errorf(path, "URL is required")
+		}
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.errorf(path, "invalid URL %q", value)
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		v.errorf(path, "invalid URL %q: must start with http:// or https://", value)
+		return
+	}
+	if u.Host == "" {
+		v.errorf(path, "invalid URL %q: missing host", value)
+	}
+}
+
+// checkVersion 检查固定安装的版本，版本号用作安装目录名
+func (v *validator) checkVersion(path, version string) {
+	if version == "" {
+		return
+	}
+	if err := ValidateVersion(version); err != nil {
+		v.errorf(path, "%v", err)
+	}
+}
+
+// checkPort 检查端口范围
+func (v *validator) checkPort(path string, port int) {
+	if port < 1 || port > 65535 {
+		v.errorf(path, "port must be between 1 and 65535, got %d", port)
+	}
+}
+
+// checkRAGEmbedding 检查 qdrant 和 embedded 检索后端需要的 embeddings 接口
+func (v *validator) checkRAGEmbedding(c *RAGConfig) {
+	embedding := c.Embedding
+	if embedding == nil {
+		embedding = &ModelConfig{}
+	}
+	v.checkURL(v.pathOf("rag.embedding.baseURL", "embedding.baseURL"), embedding.BaseURL, true)
+	if strings.TrimSpace(embedding.Model) == "" {
+		v.errorf(v.pathOf("rag.embedding.model", "embedding.model"), "model is required by the %s backend", c.GetBackend())
+	}
+}
+
+// checkRAGQdrant 检查 qdrant 检索后端需要的 embeddings 接口和集合
+func (v *validator) checkRAGQdrant(c *RAGConfig) {
+	v.checkRAGEmbedding(c)
+	if c.Qdrant == nil || c.Qdrant.Collection == "" {
+		v.errorf("rag.qdrant.collection", "collection is required by the qdrant backend")
+		return
+	}
+	v.checkURL("rag.qdrant.url", c.Qdrant.URL, false)
+	if t := c.Qdrant.TLS; t != nil && (t.CertFile == "") != (t.KeyFile == "") {
+		v.errorf("rag.qdrant.tls", "certFile and keyFile must be set together")
+	}
+	if c.Qdrant.ScoreThreshold < 0 {
+		v.errorf("rag.qdrant.scoreThreshold", "must not be negative, got %v", c.Qdrant.ScoreThreshold)
+	}
+}
+
+// checkRAGEmbedded 检查内置向量库的切分和检索设置
+func (v *validator) checkRAGEmbedded(c *RAGConfig) {
+	v.checkRAGEmbedding(c)
+	e := c.Embedded
+	if e == nil {
+		return
+	}
+	v.checkNonNegative("rag.embedded.chunkSize", e.ChunkSize)
+	v.checkNonNegative("rag.embedded.chunkOverlap", e.ChunkOverlap)
+	v.checkNonNegative("rag.embedded.batchSize", e.BatchSize)
+	if e.ChunkSize > 0 && e.ChunkOverlap >= e.ChunkSize {
+		v.errorf("rag.embedded.chunkOverlap", "must be less than chunkSize (%d), got %d", e.ChunkSize, e.ChunkOverlap)
+	}
+	if e.ScoreThreshold < 0 {
+		v.errorf("rag.embedded.scoreThreshold", "must not be negative, got %v", e.ScoreThreshold)
+	}
+}
+
+// checkListenAddress 检查监听地址（如 :8000、127.0.0.1:8000）
+func (v *validator) checkListenAddress(path, address string) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		v.errorf(path, "invalid address %q: expected host:port or :port", address)
+		return
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		v.errorf(path, "invalid address %q: port must be between 1 and 65535", address)
+	}
+}
+
+// checkNonNegative 检查不能为负数的值
+func (v *validator) checkNonNegative(path string, value int) {
+	if value < 0 {
+		v.errorf(path, "must not be negative, got %d", value)
+	}
+}
+
+// checkRestart 检查重启策略
+func (v *validator) checkRestart(path string, c *RestartConfig) {
+	if c == nil {
+		return
+	}
+	switch c.Policy {
+	case "never", "on-failure", "always":
+	default:
+		v.errorf(path+".policy", "unsupported restart policy %q (use never, on-failure or always)", c.Policy)
+	}
+	v.checkNonNegative(path+".maxRestarts", c.MaxRestarts)
+	v.checkNonNegative(path+".backoff", c.Backoff)
+	v.checkNonNegative(path+".maxBackoff", c.MaxBackoff)
+}
+
+// checkPortConflicts 检查本机启动的服务（go-rag、Qdrant、Ollama、本地 API）是否使用了相同的端口
+func (v *validator) checkPortConflicts(cfg *Config) {
+	type listener struct {
+		path string
+		name string
+		port int
+	}
+	var listeners []listener
+	if cfg.RAG.IsEnabled() && cfg.RAG.IsServerEnabled() && !cfg.RAG.IsRemote() {
+		if _, port, err := net.SplitHostPort(cfg.RAG.GetServerAddress()); err == nil {
+			if n, err := strconv.Atoi(port); err == nil {
+				path := v.pathOf("server.address", "rag.server.address", "rag.server.url", "server.url")
+				listeners = append(listeners, listener{path, "go-rag", n})
+			}
+		}
+	}
+	if cfg.Qdrant.IsEnabled() && !cfg.Qdrant.IsRemote() {
+		listeners = append(listeners,
+			listener{"qdrant.port", "Qdrant HTTP", cfg.Qdrant.Port},
+			listener{"qdrant.grpcPort", "Qdrant gRPC", cfg.Qdrant.GrpcPort})
+	}
+	if cfg.Ollama.IsEnabled() {
+		listeners = append(listeners, listener{"ollama.port", "Ollama", cfg.Ollama.Port})
+	}
+	if cfg.APIServer.IsEnabled() {
+		listeners = append(listeners, listener{"apiServer.port", "the local API server", cfg.APIServer.Port})
+	}
+
+	used := make(map[int]listener)
+	for _, l := range listeners {
+		if l.port <= 0 {
+			continue
+		}
+		if other, ok := used[l.port]; ok {
+			v.errorf(l.path, "port %d is already used by %s (%s)", l.port, other.name, other.path)
+			continue
+		}
+		used[l.port] = l
+	}
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wantError 期望的校验错误，message 为错误信息的一部分
+type wantError struct {
+	file         string
+	path         string
+	line, column int
+	message      string
+}
+
+// testProfiles 返回从内存读取方案文件的 profileReader
+func testProfiles(files map[string]string) profileReader {
+	return func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(data), nil
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	t.Setenv("TEST_TOPK", "200")
+	devFile := profileConfigPath("dev")
+
+	tests := []struct {
+		name     string
+		content  string
+		profiles map[string]string
+		want     []wantError
+	}{
+		{name: "valid", content: "ai:\n  model: gpt-4o\nrag:\n  topK: 5\nqdrant:\n  version: v1.12.0\n"},
+		{name: "empty", content: ""},
+		{name: "other program's section", content: "myapp:\n  anything: 1\n"},
+		{
+			name:    "syntax error",
+			content: "rag:\n  topK: 5\n bad\n",
+			want:    []wantError{{line: 2, message: "did not find expected key"}},
+		},
+		{
+			name:    "unknown field with suggestion",
+			content: "rag:\n  topk: 5\n",
+			want:    []wantError{{path: "rag.topk", line: 2, column: 3, message: `unknown field "topk" (did you mean "topK"?)`}},
+		},
+		{
+			name:    "unknown field",
+			content: "ai:\n  colour: red\n",
+			want:    []wantError{{path: "ai.colour", line: 2, column: 3, message: `unknown field "colour"`}},
+		},
+		{
+			name:    "unknown section with suggestion",
+			content: "qdrnt:\n  port: 6333\n",
+			want:    []wantError{{path: "qdrnt", line: 1, column: 1, message: `unknown section "qdrnt" (did you mean "qdrant"?)`}},
+		},
+		{
+			name:    "duplicate key",
+			content: "rag:\n  topK: 5\n  topK: 6\n",
+			want:    []wantError{{path: "rag.topK", line: 3, column: 3, message: `duplicate key "topK"`}},
+		},
+		{
+			name:    "wrong type",
+			content: "qdrant:\n  port: abc\n",
+			want:    []wantError{{path: "qdrant.port", line: 2, column: 9, message: `expected an integer, got "abc"`}},
+		},
+		{
+			name:    "out of range",
+			content: "rag:\n  topK: 500\n",
+			want:    []wantError{{path: "rag.topK", line: 2, column: 9, message: "must be between 1 and 100, got 500"}},
+		},
+		{
+			name:    "value from the environment",
+			content: "rag:\n  topK: ${TEST_TOPK}\n",
+			want:    []wantError{{path: "rag.topK", line: 2, column: 9, message: "got 200 (set by TEST_TOPK)"}},
+		},
+		{
+			name:    "port conflict",
+			content: "qdrant:\n  enabled: true\n  port: 11434\nollama:\n  enabled: true\n  port: 11434\n",
+			want:    []wantError{{path: "ollama.port", line: 6, column: 9, message: "port 11434 is already used by Qdrant HTTP (qdrant.port)"}},
+		},
+		{
+			name:    "invalid versions",
+			content: "rag:\n  version: ..\nqdrant:\n  version: ../../bin\n",
+			want: []wantError{
+				{path: "rag.version", line: 2, column: 12, message: `invalid version ".."`},
+				{path: "qdrant.version", line: 4, column: 12, message: `invalid version "../../bin"`},
+			},
+		},
+		{
+			name:    "MCP server name with the tool separator",
+			content: "mcp:\n  servers:\n    - name: docs__v2\n      command: docs-mcp\n",
+			want:    []wantError{{path: "mcp.servers[0].name", line: 3, column: 13, message: `must not contain "__"`}},
+		},
+		{
+			name:     "value in the profile",
+			content:  "profile:\n  name: dev\nrag:\n  topK: 5\n",
+			profiles: map[string]string{"dev": "# dev\nrag:\n  topK: 500\n"},
+			want:     []wantError{{file: devFile, path: "rag.topK", line: 3, column: 9, message: "must be between 1 and 100"}},
+		},
+		{
+			name:     "unknown field in the profile",
+			content:  "profile:\n  name: dev\n",
+			profiles: map[string]string{"dev": "rag:\n  topk: 5\n"},
+			want:     []wantError{{file: devFile, path: "rag.topk", line: 2, column: 3, message: `did you mean "topK"?`}},
+		},
+		{
+			name:    "missing profile",
+			content: "profile:\n  name: staging\n",
+			want:    []wantError{{path: "profile.name", line: 2, column: 9, message: `profile "staging" does not exist`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateContent(context.Background(), tt.content, testProfiles(tt.profiles))
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(tt.want), errs)
+			}
+			for i, want := range tt.want {
+				got := errs[i]
+				if got.File != want.file || got.Path != want.path || got.Line != want.line || got.Column != want.column {
+					t.Errorf("error %d at %s %s %d:%d, want %s %s %d:%d", i, got.File, got.Path, got.Line, got.Column,
+						want.file, want.path, want.line, want.column)
+				}
+				if !strings.Contains(got.Message, want.message) {
+					t.Errorf("error %d = %q, want %q", i, got.Message, want.message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorString(t *testing.T) {
+	errs := ValidationErrors{
+		{Path: "rag.topK", Line: 2, Column: 9, Message: "must be between 1 and 100, got 500"},
+		{File: "/home/u/.wachat/profiles/dev/config.yaml", Line: 3, Message: "could not find expected ':'"},
+	}
+	want := "invalid config (2 problems):\n" +
+		"  line 2, column 9: rag.topK: must be between 1 and 100, got 500\n" +
+		"  /home/u/.wachat/profiles/dev/config.yaml: line 3: could not find expected ':'"
+	if got := errs.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"topK", "enabled", "server", "qdrant"}
+	tests := map[string]string{
+		"topk":    "topK",
+		"enabeld": "enabled",
+		"servr":   "server",
+		"colour":  "",
+		"x":       "",
+	}
+	for key, want := range tests {
+		if got := suggest(key, names); got != want {
+			t.Errorf("suggest(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// 监听到的修改无法通过校验时保留上一次有效的配置，修复后照常生效
+func TestReloadKeepsLastGoodConfig(t *testing.T) {
+	path := loadTestConfig(t, "rag:\n  topK: 7\n")
+	if err := WatchConfig(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("rag:\n  topK: 500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 等待监听触发的重新加载（去抖 500ms）完成
+	time.Sleep(time.Second)
+	if got := Get().RAG.TopK; got != 7 {
+		t.Fatalf("topK after an invalid change = %d, want the last good value 7", got)
+	}
+	err := Reload(context.Background())
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || !strings.Contains(err.Error(), "keeping the current configuration") {
+		t.Fatalf("Reload error = %v, want the validation errors", err)
+	}
+	if errs[0].Path != "rag.topK" || errs[0].Line != 2 {
+		t.Errorf("validation error = %+v", errs[0])
+	}
+
+	if err := os.WriteFile(path, []byte("rag:\n  topK: 9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 等到重新加载（包括写入历史）结束
+	deadline := time.Now().Add(5 * time.Second)
+	for Get().RAG.TopK != 9 || len(reloadChan) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("topK after fixing the file = %d, want 9", Get().RAG.TopK)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// versionPattern 服务版本号：发布标签中的字母、数字及 . _ + -（用作版本目录名）
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+
+// ValidateVersion checks that a service version (a pinned version or a release tag) can be used as a directory name
+// 版本号来自配置、发布接口或离线安装包，拼接到安装路径前必须校验，"." 和 ".." 会指向安装目录本身或其上级
+func ValidateVersion(version string) error {
+	if !versionPattern.MatchString(version) || version == "." || version == ".." {
+		return fmt.Errorf("invalid version %q: use letters, digits, '.', '_', '+' and '-'", version)
+	}
+	return nil
+}
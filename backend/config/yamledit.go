@@ -0,0 +1,679 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 按路径修改配置文件而不丢失注释、键顺序和格式：根据 yaml.Node 记录的位置只改动原文中受影响的行
+//
+//   - 标量改为标量时只替换值本身的文本，行尾注释保持原来的列
+//   - 块格式的映射和列表逐项合并：已有的项递归修改，新增的项插入到最后一项之后，缺少的项删除
+//   - 其他情况（类型变化、流式集合 [] {}、空值）只重新生成这一项，行尾注释保留在原来的列
+//   - 文件中没有的顶级配置段追加到文件末尾
+
+// configUpdate 对配置文件中一个路径（如 rag.topK）的修改
+type configUpdate struct {
+	path  string
+	value interface{}
+}
+
+// commentPadding 匹配值之后、行尾注释之前的空白
+var commentPadding = regexp.MustCompile(`^( +)#`)
+
+// editConfig 依次应用修改并返回新的文件内容
+func editConfig(data []byte, updates ...configUpdate) ([]byte, error) {
+	// 按 LF 处理，最后恢复 CRLF
+	crlf := bytes.Contains(data, []byte("\r\n"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	for _, update := range updates {
+		var err error
+		if text, err = setConfigPath(text, update.path, update.value); err != nil {
+			return nil, err
+		}
+	}
+
+	if crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return []byte(text), nil
+}
+
+// setConfigPath 将 path 的值设置为 value
+func setConfigPath(text, path string, value interface{}) (string, error) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return "", fmt.Errorf("invalid config path: %s", path)
+		}
+	}
+
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 || isNull(doc.Content[0]) {
+		return appendSection(text, keys, &valueNode)
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+		return "", fmt.Errorf("config file is not a map")
+	}
+
+	e := &yamlEditor{lines: strings.Split(text, "\n"), indent: detectIndent(text)}
+	for _, entry := range e.mappingEntries(root, len(e.lines)) {
+		if entry.key.Value == keys[0] {
+			if err := e.setPath(entry, keys[0], keys[1:], &valueNode); err != nil {
+				return "", err
+			}
+			return e.apply(), nil
+		}
+	}
+	return appendSection(text, keys, &valueNode)
+}
+
+// yamlEditor 记录对原文各行的修改，最后一次性应用
+type yamlEditor struct {
+	lines  []string
+	edits  []lineEdit
+	indent int
+}
+
+// lineEdit 用 lines 替换原文的 [start, end) 行（start == end 时为插入）
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// yamlEntry 映射中的一项（key: value）或列表中的一项（- value）
+type yamlEntry struct {
+	key    *yaml.Node // 列表项为 nil
+	value  *yaml.Node
+	start  int // 所在行（从 0 开始）
+	column int // 键或 - 所在的列（按字符计）
+	limit  int // 这一项最多延伸到的行（不含）：下一项或上一级的结束
+}
+
+// apply 从后往前应用修改，返回新的内容
+func (e *yamlEditor) apply() string {
+	sort.SliceStable(e.edits, func(i, j int) bool {
+		if e.edits[i].start != e.edits[j].start {
+			return e.edits[i].start > e.edits[j].start
+		}
+		// 同一行先替换后插入，插入的内容位于替换的内容之前
+		return e.edits[i].end > e.edits[j].end
+	})
+	lines := e.lines
+	for _, edit := range e.edits {
+		out := make([]string, 0, len(lines)-(edit.end-edit.start)+len(edit.lines))
+		out = append(out, lines[:edit.start]...)
+		out = append(out, edit.lines...)
+		out = append(out, lines[edit.end:]...)
+		lines = out
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setPath 在 entry 的值下设置 keys 的值，path 为 entry 的路径
+func (e *yamlEditor) setPath(entry yamlEntry, path string, keys []string, value *yaml.Node) error {
+	if len(keys) == 0 {
+		return e.replace(entry, value)
+	}
+
+	node := entry.value
+	if node.Kind == yaml.MappingNode && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0 {
+		entries := e.mappingEntries(node, entry.limit)
+		for _, child := range entries {
+			if child.key.Value == keys[0] {
+				return e.setPath(child, path+"."+keys[0], keys[1:], value)
+			}
+		}
+		// 插入到最后一项之后
+		last := entries[len(entries)-1]
+		lines, err := e.render(nestedMapping(keys, value), "", entries[0].column)
+		if err != nil {
+			return err
+		}
+		e.insert(e.entryEnd(last), lines)
+		return nil
+	}
+
+	// 空值或流式映射：修改节点后重新生成这一项
+	if isNull(node) || node.Kind == yaml.MappingNode {
+		modified, err := setNode(node, path, keys, value)
+		if err != nil {
+			return err
+		}
+		return e.replaceEntry(entry, modified)
+	}
+	return fmt.Errorf("%s config is not a map", path)
+}
+
+// replace 用 value 替换 entry 的值，尽量只修改变化的部分
+func (e *yamlEditor) replace(entry yamlEntry, value *yaml.Node) error {
+	old := entry.value
+	switch {
+	case old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode:
+		// 值仍是 ${VAR} 展开后的结果时保留引用
+		if keepsReference(old.Value, value.Value) || e.spliceScalar(old, value) {
+			return nil
+		}
+	case old.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+		if merged, err := e.mergeMapping(entry, value); merged || err != nil {
+			return err
+		}
+	case old.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+		if merged, err := e.mergeSequence(entry, value); merged || err != nil {
+			return err
+		}
+	}
+	return e.replaceEntry(entry, value)
+}
+
+// mergeMapping 逐键合并块格式的映射，无法合并时不做修改并返回 false，编码失败时返回错误
+func (e *yamlEditor) mergeMapping(entry yamlEntry, value *yaml.Node) (bool, error) {
+	old := entry.value
+	if old.Style&yaml.FlowStyle != 0 || len(old.Content) == 0 || len(value.Content) == 0 {
+		return false, nil
+	}
+	saved := len(e.edits)
+	entries := e.mappingEntries(old, entry.limit)
+	for _, child := range entries {
+		if j := mappingIndex(value, child.key.Value); j >= 0 {
+			if err := e.replace(child, value.Content[j+1]); err != nil {
+				e.edits = e.edits[:saved]
+				return false, err
+			}
+		} else if child.key.Value != "<<" && !e.delete(child) {
+			e.edits = e.edits[:saved]
+			return false, nil
+		}
+	}
+
+	added := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for j := 0; j+1 < len(value.Content); j += 2 {
+		if mappingIndex(old, value.Content[j].Value) < 0 {
+			added.Content = append(added.Content, value.Content[j], value.Content[j+1])
+		}
+	}
+	if len(added.Content) > 0 {
+		lines, err := e.render(added, "", entries[0].column)
+		if err != nil {
+			e.edits = e.edits[:saved]
+			return false, err
+		}
+		e.insert(e.entryEnd(entries[len(entries)-1]), lines)
+	}
+	return true, nil
+}
+
+// mergeSequence 合并块格式的列表，无法合并时不做修改并返回 false，编码失败时返回错误
+// 各项都有 name 时按名称对应（顺序不变时），否则按下标对应；多出的项追加到末尾
+func (e *yamlEditor) mergeSequence(entry yamlEntry, value *yaml.Node) (bool, error) {
+	old := entry.value
+	if old.Style&yaml.FlowStyle != 0 || len(old.Content) == 0 || len(value.Content) == 0 {
+		return false, nil
+	}
+	entries := e.sequenceEntries(old, entry.limit)
+	if entries == nil {
+		return false, nil
+	}
+	matches := matchItems(old.Content, value.Content)
+	saved := len(e.edits)
+	used := make(map[int]bool)
+	for i, child := range entries {
+		if j := matches[i]; j >= 0 {
+			if err := e.replace(child, value.Content[j]); err != nil {
+				e.edits = e.edits[:saved]
+				return false, err
+			}
+			used[j] = true
+		} else if !e.delete(child) {
+			e.edits = e.edits[:saved]
+			return false, nil
+		}
+	}
+
+	var rest []*yaml.Node
+	for j, item := range value.Content {
+		if !used[j] {
+			rest = append(rest, item)
+		}
+	}
+	if len(rest) > 0 {
+		added := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: rest}
+		lines, err := e.render(added, "", entries[0].column)
+		if err != nil {
+			e.edits = e.edits[:saved]
+			return false, err
+		}
+		e.insert(e.entryEnd(entries[len(entries)-1]), lines)
+	}
+	return true, nil
+}
+
+// matchItems 返回旧列表各项对应的新列表下标（-1 为删除）
+// 对应的项保持原位，其余新项追加到末尾，结果与新列表的顺序不一致时改为按下标对应
+func matchItems(old, value []*yaml.Node) []int {
+	if matches := matchByName(old, value); matches != nil {
+		return matches
+	}
+	matches := make([]int, len(old))
+	for i := range old {
+		matches[i] = -1
+		if i < len(value) {
+			matches[i] = i
+		}
+	}
+	return matches
+}
+
+// matchByName 按 name 对应列表项，无法对应时返回 nil
+func matchByName(old, value []*yaml.Node) []int {
+	oldNames, newNames := itemNames(old), itemNames(value)
+	if oldNames == nil || newNames == nil {
+		return nil
+	}
+	index := make(map[string]int)
+	for j, name := range newNames {
+		index[name] = j
+	}
+
+	matches := make([]int, len(old))
+	matched := make(map[int]bool)
+	last := -1
+	for i, name := range oldNames {
+		j, ok := index[name]
+		if !ok {
+			matches[i] = -1
+			continue
+		}
+		if j < last {
+			return nil
+		}
+		matches[i], last = j, j
+		matched[j] = true
+	}
+	for j := range value {
+		if !matched[j] && j < last {
+			return nil
+		}
+	}
+	return matches
+}
+
+// itemNames 返回列表各项（映射）的 name，有一项没有或重复时返回 nil
+func itemNames(items []*yaml.Node) []string {
+	names := make([]string, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		if item.Kind != yaml.MappingNode {
+			return nil
+		}
+		j := mappingIndex(item, "name")
+		if j < 0 || item.Content[j+1].Kind != yaml.ScalarNode || seen[item.Content[j+1].Value] {
+			return nil
+		}
+		names[i] = item.Content[j+1].Value
+		seen[names[i]] = true
+	}
+	return names
+}
+
+// replaceEntry 重新生成整项，保留行首（如列表项的 "- "）和行尾注释
+func (e *yamlEditor) replaceEntry(entry yamlEntry, value *yaml.Node) error {
+	line := e.lines[entry.start]
+	offset := runeOffset(line, entry.column)
+	if offset < 0 {
+		offset = 0
+	}
+
+	// 行尾注释（值或键在这一行上的注释）
+	comment := ""
+	for _, node := range []*yaml.Node{entry.value, entry.key} {
+		if node != nil && node.LineComment != "" && node.Line-1 == entry.start {
+			if i := strings.LastIndex(line, node.LineComment); i > offset {
+				comment = line[i:]
+			}
+			break
+		}
+	}
+
+	// 修改过的原节点（如流式映射）仍带有行尾注释，由上面取出的原文注释代替，避免重复
+	copied := *value
+	copied.LineComment = ""
+	value = &copied
+
+	var node *yaml.Node
+	value.Anchor = entry.value.Anchor
+	if entry.key != nil {
+		key := *entry.key
+		key.HeadComment, key.LineComment, key.FootComment = "", "", ""
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{&key, value}}
+	} else {
+		node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}}
+	}
+	lines, err := e.render(node, line[:offset], entry.column)
+	if err != nil {
+		return err
+	}
+	if comment != "" {
+		width := utf8.RuneCountInString(line[:strings.LastIndex(line, comment)]) - utf8.RuneCountInString(lines[0])
+		if width < 1 {
+			width = 1
+		}
+		lines[0] += strings.Repeat(" ", width) + comment
+	}
+	e.edits = append(e.edits, lineEdit{start: entry.start, end: e.entryEnd(entry), lines: lines})
+	return nil
+}
+
+// delete 删除整项，这一行上还有其他内容（如列表项 "- " 后的第一个键）时返回 false
+func (e *yamlEditor) delete(entry yamlEntry) bool {
+	line := e.lines[entry.start]
+	offset := runeOffset(line, entry.column)
+	if offset < 0 || strings.TrimSpace(line[:offset]) != "" {
+		return false
+	}
+	e.edits = append(e.edits, lineEdit{start: entry.start, end: e.entryEnd(entry)})
+	return true
+}
+
+// insert 在第 at 行之前插入
+func (e *yamlEditor) insert(at int, lines []string) {
+	e.edits = append(e.edits, lineEdit{start: at, end: at, lines: lines})
+}
+
+// entryEnd 返回这一项的结束行（不含），末尾的空行和注释（通常属于下一项）不算在内
+func (e *yamlEditor) entryEnd(entry yamlEntry) int {
+	end := entry.limit
+	if end > len(e.lines) {
+		end = len(e.lines)
+	}
+	for end > entry.start+1 && isBlankOrComment(e.lines[end-1]) {
+		end--
+	}
+	return end
+}
+
+// mappingEntries 返回块格式映射的各项
+func (e *yamlEditor) mappingEntries(mapping *yaml.Node, limit int) []yamlEntry {
+	entries := make([]yamlEntry, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		entry := yamlEntry{
+			key:    mapping.Content[i],
+			value:  mapping.Content[i+1],
+			start:  mapping.Content[i].Line - 1,
+			column: mapping.Content[i].Column - 1,
+			limit:  limit,
+		}
+		if i+2 < len(mapping.Content) {
+			entry.limit = mapping.Content[i+2].Line - 1
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// sequenceEntries 返回块格式列表的各项，找不到某一项的 "- " 时返回 nil
+func (e *yamlEditor) sequenceEntries(sequence *yaml.Node, limit int) []yamlEntry {
+	entries := make([]yamlEntry, 0, len(sequence.Content))
+	for i, item := range sequence.Content {
+		start := item.Line - 1
+		if start < 0 || start >= len(e.lines) {
+			return nil
+		}
+		// "- " 与值在同一行
+		line := []rune(e.lines[start])
+		column := item.Column - 2
+		for column >= 0 && column < len(line) && line[column] == ' ' {
+			column--
+		}
+		if column < 0 || column >= len(line) || line[column] != '-' {
+			return nil
+		}
+		entry := yamlEntry{value: item, start: start, column: column, limit: limit}
+		if i+1 < len(sequence.Content) {
+			entry.limit = sequence.Content[i+1].Line - 1
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// render 将节点编码为行：第一行以 prefix 开头，其余各行缩进 column 列
+func (e *yamlEditor) render(node *yaml.Node, prefix string, column int) ([]string, error) {
+	lines, err := renderNode(node, e.indent)
+	if err != nil {
+		return nil, err
+	}
+	padding := strings.Repeat(" ", column)
+	for i, line := range lines {
+		switch {
+		case i == 0 && prefix != "":
+			lines[i] = prefix + line
+		case line != "":
+			lines[i] = padding + line
+		}
+	}
+	return lines, nil
+}
+
+// spliceScalar 在原文中替换单行标量的文本，无法安全替换时返回 false
+func (e *yamlEditor) spliceScalar(old, value *yaml.Node) bool {
+	// 空值（如只写了 key:）在原文中没有可替换的文本
+	if old.Anchor != "" || old.Line < 1 || old.Line > len(e.lines) || old.Value == "" && old.Style == 0 {
+		return false
+	}
+	if old.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) != 0 {
+		return false
+	}
+
+	line := e.lines[old.Line-1]
+	start := runeOffset(line, old.Column-1)
+	if start < 0 {
+		return false
+	}
+	end := scalarEnd(line, start, old)
+	if end < 0 {
+		return false
+	}
+
+	replacement := &yaml.Node{Kind: yaml.ScalarNode, Tag: value.Tag, Value: value.Value, Style: scalarStyle(old, value)}
+	out, err := yaml.Marshal(replacement)
+	if err != nil {
+		return false
+	}
+	rendered := strings.TrimSuffix(string(out), "\n")
+	if strings.Contains(rendered, "\n") {
+		return false
+	}
+
+	// 行尾注释保持原来的列
+	rest := line[end:]
+	if m := commentPadding.FindStringSubmatch(rest); m != nil {
+		width := len(m[1]) + utf8.RuneCountInString(line[start:end]) - utf8.RuneCountInString(rendered)
+		if width < 1 {
+			width = 1
+		}
+		rest = strings.Repeat(" ", width) + rest[len(m[1]):]
+	}
+	e.edits = append(e.edits, lineEdit{start: old.Line - 1, end: old.Line, lines: []string{line[:start] + rendered + rest}})
+	return true
+}
+
+// scalarEnd 返回单行标量在行中的结束位置，文本与节点的值不一致（如跨行、流式集合中的值）时返回 -1
+func scalarEnd(line string, start int, node *yaml.Node) int {
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return -1
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+		return -1
+	}
+
+	end := len(line)
+	if i := strings.Index(line[start:], " #"); i >= 0 {
+		end = start + i
+	}
+	end = start + len(strings.TrimRight(line[start:end], " \t"))
+	if line[start:end] != node.Value {
+		return -1
+	}
+	return end
+}
+
+// scalarStyle 字符串保留原来的引号风格，其他类型使用默认风格
+func scalarStyle(old, value *yaml.Node) yaml.Style {
+	if value.Tag == "!!str" && old.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 && !strings.Contains(value.Value, "\n") {
+		return old.Style
+	}
+	return value.Style
+}
+
+// setNode 在 node（路径为 path）下设置 keys 的值（缺少的映射自动创建），返回修改后的节点
+func setNode(node *yaml.Node, path string, keys []string, value *yaml.Node) (*yaml.Node, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	if isNull(node) {
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s config is not a map", path)
+	}
+	// 空的 {} 改为块格式
+	if len(node.Content) == 0 {
+		node.Style &^= yaml.FlowStyle
+	}
+
+	index := mappingIndex(node, keys[0])
+	if index < 0 {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[0]},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+		index = len(node.Content) - 2
+	}
+	child, err := setNode(node.Content[index+1], path+"."+keys[0], keys[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	node.Content[index+1] = child
+	return node, nil
+}
+
+// nestedMapping 将 keys 和值组成嵌套的映射，如 a.b = v 组成 {a: {b: v}}
+func nestedMapping(keys []string, value *yaml.Node) *yaml.Node {
+	node := value
+	for i := len(keys) - 1; i >= 0; i-- {
+		node = &yaml.Node{
+			Kind:    yaml.MappingNode,
+			Tag:     "!!map",
+			Content: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[i]}, node},
+		}
+	}
+	return node
+}
+
+// mappingIndex 返回映射中键的下标，没有时返回 -1
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// isNull 判断节点是否为空值（如只写了 rag:）
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// appendSection 在文件末尾追加新的顶级配置段
+func appendSection(text string, keys []string, value *yaml.Node) (string, error) {
+	lines, err := renderNode(nestedMapping(keys, value), detectIndent(text))
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimRight(text, "\n")
+	if strings.TrimSpace(text) != "" {
+		text += "\n\n"
+	}
+	return text + strings.Join(lines, "\n") + "\n", nil
+}
+
+// renderNode 将节点编码为行
+func renderNode(node *yaml.Node, indent int) ([]string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"), nil
+}
+
+// runeOffset 将字符列（yaml 的列按字符计）转换为字节偏移
+func runeOffset(line string, column int) int {
+	for offset := range line {
+		if column == 0 {
+			return offset
+		}
+		column--
+	}
+	if column == 0 {
+		return len(line)
+	}
+	return -1
+}
+
+// isBlankOrComment 判断是否为空行或注释行
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// detectIndent 返回文件使用的缩进宽度（第一个缩进的行），默认 2
+func detectIndent(text string) int {
+	for _, line := range strings.Split(text, "\n") {
+		if isBlankOrComment(line) {
+			continue
+		}
+		if width := len(line) - len(strings.TrimLeft(line, " ")); width > 0 {
+			return width
+		}
+	}
+	return 2
+}
@@ -0,0 +1,489 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readExample 读取仓库根目录的 config.example.yaml
+func readExample(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// decodeYAML 解析为通用的值，用于比较内容
+func decodeYAML(t *testing.T, text string) map[string]interface{} {
+	t.Helper()
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(text), &raw); err != nil {
+		t.Fatalf("result is not valid YAML: %v\n%s", err, text)
+	}
+	return raw
+}
+
+// normalize 将 Go 值转换为解析 YAML 得到的形式（如 []string -> []interface{}）
+func normalize(t *testing.T, value interface{}) interface{} {
+	t.Helper()
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// keyPaths 按文档顺序列出所有映射键的路径
+func keyPaths(t *testing.T, text string) []string {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := joinPath(path, node.Content[i].Value)
+				paths = append(paths, key)
+				walk(node.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+	walk(&doc, "")
+	return paths
+}
+
+// commentLines 列出所有注释（整行注释和行尾注释），用于确认注释没有丢失或改变顺序
+func commentLines(text string) []string {
+	var comments []string
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] == ' ') {
+			comments = append(comments, strings.TrimSpace(line[i:]))
+		}
+	}
+	return comments
+}
+
+// isSubsequence 判断 sub 的各项是否按顺序出现在 seq 中
+func isSubsequence(sub, seq []string) bool {
+	i := 0
+	for _, s := range seq {
+		if i < len(sub) && sub[i] == s {
+			i++
+		}
+	}
+	return i == len(sub)
+}
+
+// removedLines 返回原文中在结果里不再出现的行
+func removedLines(before, after string) []string {
+	count := make(map[string]int)
+	for _, line := range strings.Split(after, "\n") {
+		count[line]++
+	}
+	var removed []string
+	for _, line := range strings.Split(before, "\n") {
+		if count[line] > 0 {
+			count[line]--
+		} else {
+			removed = append(removed, line)
+		}
+	}
+	return removed
+}
+
+// applyPath 在解析后的内容中设置路径的值，得到期望的结果
+func applyPath(raw map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	section := raw
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := section[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			section[key] = child
+		}
+		section = child
+	}
+	section[keys[len(keys)-1]] = value
+}
+
+func TestEditConfigExample(t *testing.T) {
+	example := readExample(t)
+
+	tests := []struct {
+		name      string
+		updates   []configUpdate
+		removed   int      // 最多改动的原有行数
+		dropped   bool     // 删除了原有的键（连同行尾注释）
+		wantLines []string // 结果中必须出现的行
+	}{
+		{
+			name:      "int scalar keeps the comment column",
+			updates:   []configUpdate{{"rag.topK", 8}},
+			removed:   1,
+			wantLines: []string{"  topK: 8                             # Number of documents to retrieve"},
+		},
+		{
+			name:      "quoted string keeps its quotes",
+			updates:   []configUpdate{{"ai.model", "gpt-4o"}},
+			removed:   1,
+			wantLines: []string{`  model: "gpt-4o"`},
+		},
+		{
+			name:      "longer value shifts the comment by as little as needed",
+			updates:   []configUpdate{{"qdrant.installPath", "/opt/wachat/qdrant/releases/current"}},
+			removed:   1,
+			wantLines: []string{`  installPath: "/opt/wachat/qdrant/releases/current" # Install path (empty for default: ~/.wachat/qdrant)`},
+		},
+		{
+			name:      "bool scalar",
+			updates:   []configUpdate{{"qdrant.autoStart", true}},
+			removed:   1,
+			wantLines: []string{"  autoStart: true                     # Auto-start Qdrant service on app startup (default: false)"},
+		},
+		{
+			name:    "flow map becomes a block map",
+			updates: []configUpdate{{"binaries.depends_on", map[string]interface{}{"wailsproject": []string{"qdrant"}}}},
+			removed: 1,
+			wantLines: []string{
+				"  depends_on:                         # Binaries start after their dependencies are healthy",
+				"    wailsproject:",
+				"      - qdrant",
+			},
+		},
+		{
+			name:      "flow sequence becomes a block sequence",
+			updates:   []configUpdate{{"binaries.startup_order", []string{"qdrant", "wailsproject"}}},
+			removed:   1,
+			wantLines: []string{"  startup_order:", "    - qdrant", "    - wailsproject", "    # - qdrant"},
+		},
+		{
+			name:      "block map merges key by key",
+			updates:   []configUpdate{{"qdrant", map[string]interface{}{"enabled": false, "port": 7000}}},
+			removed:   8,
+			dropped:   true,
+			wantLines: []string{"  enabled: false                      # Enable Qdrant (set to true if using Qdrant as vector storage)", "  port: 7000                          # HTTP port for Qdrant"},
+		},
+		{
+			name:      "new key in an existing section",
+			updates:   []configUpdate{{"rag.backend", "qdrant"}},
+			wantLines: []string{"  backend: qdrant"},
+		},
+		{
+			name:      "new nested section",
+			updates:   []configUpdate{{"rag.qdrant.collection", "docs"}},
+			wantLines: []string{"  qdrant:", "    collection: docs"},
+		},
+		{
+			name:      "new top-level section",
+			updates:   []configUpdate{{"newSection.enabled", true}},
+			wantLines: []string{"newSection:", "  enabled: true"},
+		},
+		{
+			name:    "several updates at once",
+			updates: []configUpdate{{"rag.topK", 3}, {"ollama.port", 11435}, {"mcp.enabled", true}},
+			removed: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := editConfig([]byte(example), tt.updates...)
+			if err != nil {
+				t.Fatalf("editConfig: %v", err)
+			}
+			result := string(out)
+
+			want := decodeYAML(t, example)
+			for _, update := range tt.updates {
+				applyPath(want, update.path, normalize(t, update.value))
+			}
+			if got := decodeYAML(t, result); !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded result differs from the expected config\n%s", result)
+			}
+
+			if !tt.dropped && !isSubsequence(commentLines(example), commentLines(result)) {
+				t.Errorf("comments were lost or reordered\n%s", result)
+			}
+			if !isSubsequence(filterPaths(keyPaths(t, example), tt.updates), keyPaths(t, result)) {
+				t.Errorf("key order changed\n%s", result)
+			}
+			if removed := removedLines(example, result); len(removed) > tt.removed {
+				t.Errorf("%d lines changed, want at most %d: %q", len(removed), tt.removed, removed)
+			}
+			lines := strings.Split(result, "\n")
+			for _, line := range tt.wantLines {
+				if !contains(lines, line) {
+					t.Errorf("result has no line %q", line)
+				}
+			}
+		})
+	}
+}
+
+// filterPaths 去掉被修改的路径下原有的键（合并映射时缺少的键会被删除）
+func filterPaths(paths []string, updates []configUpdate) []string {
+	var kept []string
+	for _, path := range paths {
+		replaced := false
+		for _, update := range updates {
+			if _, ok := update.value.(map[string]interface{}); ok && strings.HasPrefix(path, update.path+".") {
+				replaced = true
+			}
+		}
+		if !replaced {
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEditConfigFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		updates []configUpdate
+		want    string
+	}{
+		{
+			name: "sequence matched by name",
+			input: `services:
+  - name: a   # first
+    port: 1
+  - name: b   # second
+    port: 2
+`,
+			updates: []configUpdate{{"services", []map[string]interface{}{
+				{"name": "a", "port": 1},
+				{"name": "b", "port": 3},
+				{"name": "c", "port": 4},
+			}}},
+			want: `services:
+  - name: a   # first
+    port: 1
+  - name: b   # second
+    port: 3
+  - name: c
+    port: 4
+`,
+		},
+		{
+			name: "sequence item removed by name",
+			input: `services:
+  # the first service
+  - name: a
+    port: 1
+  # the second service
+  - name: b
+    port: 2
+`,
+			updates: []configUpdate{{"services", []map[string]interface{}{{"name": "b", "port": 2}}}},
+			want: `services:
+  # the first service
+  # the second service
+  - name: b
+    port: 2
+`,
+		},
+		{
+			name: "sequence without names matched by index",
+			input: `download:
+  mirrors:
+    - https://x.example   # primary
+    - https://y.example   # backup
+`,
+			updates: []configUpdate{{"download.mirrors", []string{"https://x.example", "https://z.example", "https://w.example"}}},
+			want: `download:
+  mirrors:
+    - https://x.example   # primary
+    - https://z.example   # backup
+    - https://w.example
+`,
+		},
+		{
+			name: "reordered names fall back to the index",
+			input: `servers:
+  - name: a
+    port: 1
+  - name: b
+    port: 2
+`,
+			updates: []configUpdate{{"servers", []map[string]interface{}{{"name": "b", "port": 2}, {"name": "a", "port": 1}}}},
+			want: `servers:
+  - name: b
+    port: 2
+  - name: a
+    port: 1
+`,
+		},
+		{
+			name:    "flow map keeps its style and comment",
+			input:   "mcp:\n  env: {A: 1}   # variables\n  enabled: true\n",
+			updates: []configUpdate{{"mcp.env.B", 2}},
+			want:    "mcp:\n  env: {A: 1, B: 2} # variables\n  enabled: true\n",
+		},
+		{
+			name:    "flow sequence item",
+			input:   "tags: [a, b]  # list\nnext: 1\n",
+			updates: []configUpdate{{"tags", []string{"a", "c"}}},
+			want:    "tags:         # list\n  - a\n  - c\nnext: 1\n",
+		},
+		{
+			name:    "empty value becomes a section",
+			input:   "rag:\n# trailing comment\nother: 1\n",
+			updates: []configUpdate{{"rag.topK", 3}},
+			want:    "rag:\n  topK: 3\n# trailing comment\nother: 1\n",
+		},
+		{
+			name:    "four-space indentation",
+			input:   "rag:\n    topK: 5\n",
+			updates: []configUpdate{{"rag.server.address", ":8000"}},
+			want:    "rag:\n    topK: 5\n    server:\n        address: :8000\n",
+		},
+		{
+			name:    "CRLF line endings",
+			input:   "# header\r\nrag:\r\n  topK: 5   # docs\r\n  enabled: true\r\n",
+			updates: []configUpdate{{"rag.topK", 10}, {"rag.backend", "embedded"}, {"qdrant.port", 7000}},
+			want:    "# header\r\nrag:\r\n  topK: 10  # docs\r\n  enabled: true\r\n  backend: embedded\r\n\r\nqdrant:\r\n  port: 7000\r\n",
+		},
+		{
+			name:    "empty file",
+			input:   "",
+			updates: []configUpdate{{"rag.topK", 3}},
+			want:    "rag:\n  topK: 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := editConfig([]byte(tt.input), tt.updates...)
+			if err != nil {
+				t.Fatalf("editConfig: %v", err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("result:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		update configUpdate
+	}{
+		{"empty key", "rag:\n  topK: 5\n", configUpdate{"rag..topK", 1}},
+		{"scalar is not a map", "rag: 5\n", configUpdate{"rag.topK", 1}},
+		{"flow root", "{rag: 1}\n", configUpdate{"rag", 2}},
+		{"invalid YAML", "rag: [\n", configUpdate{"rag.topK", 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out, err := editConfig([]byte(tt.input), tt.update); err == nil {
+				t.Fatalf("editConfig succeeded:\n%s", out)
+			}
+		})
+	}
+}
+
+// 重新生成的项无法编码时必须返回错误，否则 UpdateConfigPath 会在没有写入的情况下报告成功
+func TestEditorRenderError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		keys  []string
+		value *yaml.Node
+	}{
+		{"flow map", "binaries:\n  depends_on: {}   # deps\n", []string{"depends_on"}, &yaml.Node{Kind: yaml.AliasNode}},
+		{"empty value", "binaries:\n  depends_on:\n", []string{"depends_on", "qdrant"}, &yaml.Node{Kind: yaml.AliasNode}},
+		{"sequence item", "binaries:\n  startup_order:\n    - qdrant\n", []string{"startup_order"},
+			&yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{{Kind: yaml.AliasNode}}}},
+		{"mapping value", "binaries:\n  depends_on:\n    a: b\n", []string{"depends_on"},
+			&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: "a"}, {Kind: yaml.AliasNode}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &doc); err != nil {
+				t.Fatal(err)
+			}
+			e := &yamlEditor{lines: strings.Split(tt.input, "\n"), indent: 2}
+			entry := e.mappingEntries(doc.Content[0], len(e.lines))[0]
+			if err := e.setPath(entry, "binaries", tt.keys, tt.value); err == nil {
+				t.Fatalf("setPath succeeded, result:\n%s", e.apply())
+			}
+			if len(e.edits) != 0 {
+				t.Fatalf("failed edit left %d pending changes", len(e.edits))
+			}
+		})
+	}
+}
+
+// 界面回传的是 ${VAR} 展开后的值，值未改变时文件中保留引用
+func TestEditConfigKeepsReference(t *testing.T) {
+	t.Setenv("TEST_AI_BASE_URL", "https://llm.example.com/v1")
+	t.Setenv("TEST_QDRANT_PORT", "7333")
+	input := `ai:
+  base_url: ${TEST_AI_BASE_URL}   # from the environment
+  model: gpt-4o
+  providers:
+    - name: local
+      base_url: "${TEST_LOCAL_URL:-http://localhost:11434/v1}"
+qdrant:
+  port: ${TEST_QDRANT_PORT}
+`
+	out, err := editConfig([]byte(input),
+		configUpdate{"ai.base_url", "https://llm.example.com/v1"},
+		configUpdate{"ai.model", "gpt-4o-mini"},
+		configUpdate{"ai.providers", []map[string]interface{}{{"name": "local", "base_url": "http://localhost:11434/v1"}}},
+		configUpdate{"qdrant.port", 7333},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(input, "model: gpt-4o\n", "model: gpt-4o-mini\n", 1)
+	if string(out) != want {
+		t.Errorf("result:\n%s\nwant:\n%s", out, want)
+	}
+
+	// 值改变时替换引用
+	out, err = editConfig([]byte(input), configUpdate{"ai.base_url", "https://other.example.com/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "  base_url: https://other.example.com/v1 # from the environment\n") {
+		t.Errorf("changed value was not written:\n%s", out)
+	}
+}
@@ -16,22 +16,14 @@ type Database struct {
 	DB *gorm.DB
 }
 
-// NewDatabase creates database connection and runs migrations
-func NewDatabase() (*Database, error) {
-	// Get user home dir
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-
+// NewDatabase opens the SQLite database at path (creating its directory) and runs migrations
+func NewDatabase(dbPath string) (*Database, error) {
 	// Create data directory
-	dataDir := filepath.Join(homeDir, ".wachat")
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, err
 	}
 
 	// Open database
-	dbPath := filepath.Join(dataDir, "chat.db")
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
@@ -46,3 +38,12 @@ func NewDatabase() (*Database, error) {
 
 	return &Database{DB: db}, nil
 }
+
+// Close closes the underlying connection
+func (d *Database) Close() error {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
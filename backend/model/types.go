@@ -8,19 +8,21 @@ import (
 
 // Conversation represents a chat conversation
 type Conversation struct {
-	ID        string            `json:"id"`
-	Title     string            `json:"title"`
-	Messages  []*schema.Message `json:"messages"`
-	CreatedAt time.Time         `json:"createdAt"`
-	UpdatedAt time.Time         `json:"updatedAt"`
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Messages   []*schema.Message `json:"messages"`
+	MCPServers []string          `json:"mcpServers"` // 会话启用的 MCP 服务器
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
 }
 
 // DBConversation represents conversation table in database
 type DBConversation struct {
-	ID        string `gorm:"primaryKey"`
-	Title     string
-	CreatedAt int64
-	UpdatedAt int64
+	ID         string `gorm:"primaryKey"`
+	Title      string
+	MCPServers string // comma separated MCP server names
+	CreatedAt  int64
+	UpdatedAt  int64
 }
 
 // DBMessage represents message table in database
@@ -0,0 +1,171 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// indexAccount 钥匙串中保存密钥名称列表的条目（security 命令无法按服务列出条目）
+const indexAccount = "__index__"
+
+// keychain 通过 security 命令访问 macOS 登录钥匙串，
+// 条目的服务名为 wachat，账户名为密钥名称
+type keychain struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newKeyring 查找 security 命令
+func newKeyring() (Store, error) {
+	path, err := exec.LookPath("security")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return &keychain{path: path}, nil
+}
+
+// Name 返回存储后端的名称
+func (k *keychain) Name() string {
+	return "keychain"
+}
+
+// Get 读取密钥
+func (k *keychain) Get(name string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.get(name)
+}
+
+// Set 保存密钥
+func (k *keychain) Set(name, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.set(name, value); err != nil {
+		return err
+	}
+	return k.updateIndex(name, true)
+}
+
+// Delete 删除密钥
+func (k *keychain) Delete(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.delete(name); err != nil {
+		return err
+	}
+	return k.updateIndex(name, false)
+}
+
+// List 返回全部密钥名称
+func (k *keychain) List() ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.index()
+}
+
+// get 读取条目
+func (k *keychain) get(account string) (string, error) {
+	out, err := k.run("", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	if err != nil {
+		if isNotFound(err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+// set 写入条目：通过 security -i 从标准输入传入命令，避免密钥出现在进程参数中
+func (k *keychain) set(account, value string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(keyringService), quote(account), quote(value))
+	_, err := k.run(command, "-i")
+	return err
+}
+
+// delete 删除条目
+func (k *keychain) delete(account string) error {
+	if _, err := k.run("", "delete-generic-password", "-s", keyringService, "-a", account); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// index 读取密钥名称列表
+func (k *keychain) index() ([]string, error) {
+	data, err := k.get(indexAccount)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(data), &names); err != nil {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// updateIndex 在名称列表中添加或移除名称
+func (k *keychain) updateIndex(name string, add bool) error {
+	names, err := k.index()
+	if err != nil {
+		return err
+	}
+	updated := make([]string, 0, len(names)+1)
+	for _, n := range names {
+		if n != name {
+			updated = append(updated, n)
+		}
+	}
+	if add {
+		updated = append(updated, name)
+	}
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return k.set(indexAccount, string(data))
+}
+
+// keychainError security 命令的错误
+type keychainError struct {
+	code   int
+	output string
+}
+
+func (e *keychainError) Error() string {
+	return fmt.Sprintf("security exited with %d: %s", e.code, e.output)
+}
+
+// isNotFound 判断是否为条目不存在（errSecItemNotFound，退出码 44）
+func isNotFound(err error) bool {
+	kerr, ok := err.(*keychainError)
+	return ok && kerr.code == 44
+}
+
+// run 执行 security 命令
+func (k *keychain) run(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(k.path, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", &keychainError{code: exitErr.ExitCode(), output: strings.TrimSpace(stderr.String())}
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// quote 按 security -i 的命令行语法为参数加引号
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
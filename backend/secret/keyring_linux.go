@@ -0,0 +1,247 @@
+package secret
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// freedesktop Secret Service（GNOME Keyring、KWallet 等实现）
+const (
+	ssDest              = "org.freedesktop.secrets"
+	ssPath              = "/org/freedesktop/secrets"
+	ssServiceIface      = "org.freedesktop.Secret.Service"
+	ssCollectionIface   = "org.freedesktop.Secret.Collection"
+	ssItemIface         = "org.freedesktop.Secret.Item"
+	ssPromptIface       = "org.freedesktop.Secret.Prompt"
+	ssDefaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssPromptTimeout     = 2 * time.Minute
+)
+
+// ssSecret Secret Service 的 Secret 结构 (oayays)
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretService 通过 D-Bus 访问 Secret Service，密钥保存在默认集合中，
+// 以属性 service=wachat、name=<名称> 标识
+type secretService struct {
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// newKeyring 连接会话总线上的 Secret Service（不会自动启动会话总线）
+func newKeyring() (Store, error) {
+	conn, err := dbus.SessionBusPrivateNoAutoStartup()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if !nameAvailable(conn, ssDest) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s is not running", ErrUnavailable, ssDest)
+	}
+
+	s := &secretService{conn: conn}
+	if err := s.openSession(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return s, nil
+}
+
+// nameAvailable 检查服务是否已运行或可按需启动
+func nameAvailable(conn *dbus.Conn, name string) bool {
+	var owned bool
+	if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, name).Store(&owned); err == nil && owned {
+		return true
+	}
+	var activatable []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return false
+	}
+	for _, n := range activatable {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Name 返回存储后端的名称
+func (s *secretService) Name() string {
+	return "secret-service"
+}
+
+// openSession 打开明文传输的会话（会话总线只在本机用户内可见）
+func (s *secretService) openSession() error {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.conn.Object(ssDest, ssPath).Call(ssServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return fmt.Errorf("failed to open secret service session: %w", err)
+	}
+	s.session = session
+	return nil
+}
+
+// Get 读取密钥
+func (s *secretService) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(map[string]string{"service": keyringService, "name": name})
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", ErrNotFound
+	}
+	if err := s.unlock(items[0]); err != nil {
+		return "", err
+	}
+	var secret ssSecret
+	if err := s.conn.Object(ssDest, items[0]).Call(ssItemIface+".GetSecret", 0, s.session).Store(&secret); err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return string(secret.Value), nil
+}
+
+// Set 保存密钥
+func (s *secretService) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.unlock(ssDefaultCollection); err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(keyringService + ": " + name),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(map[string]string{"service": keyringService, "name": name}),
+	}
+	secret := ssSecret{Session: s.session, Value: []byte(value), ContentType: "text/plain"}
+
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(ssDest, ssDefaultCollection).Call(ssCollectionIface+".CreateItem", 0, props, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to save secret: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// Delete 删除密钥
+func (s *secretService) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(map[string]string{"service": keyringService, "name": name})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(ssDest, item).Call(ssItemIface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete secret: %w", err)
+		}
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List 返回全部密钥名称
+func (s *secretService) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(map[string]string{"service": keyringService})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		v, err := s.conn.Object(ssDest, item).GetProperty(ssItemIface + ".Attributes")
+		if err != nil {
+			continue
+		}
+		if attrs, ok := v.Value().(map[string]string); ok && attrs["name"] != "" {
+			names = append(names, attrs["name"])
+		}
+	}
+	return names, nil
+}
+
+// search 按属性查找默认集合中的条目
+func (s *secretService) search(attrs map[string]string) ([]dbus.ObjectPath, error) {
+	var items []dbus.ObjectPath
+	if err := s.conn.Object(ssDest, ssDefaultCollection).Call(ssCollectionIface+".SearchItems", 0, attrs).Store(&items); err != nil {
+		return nil, fmt.Errorf("failed to search secrets: %w", err)
+	}
+	return items, nil
+}
+
+// unlock 解锁集合或条目，需要用户确认时等待提示完成
+func (s *secretService) unlock(path dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.conn.Object(ssDest, ssPath).Call(ssServiceIface+".Unlock", 0, []dbus.ObjectPath{path}).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// prompt 显示 Secret Service 的确认提示并等待完成（"/" 表示无需提示）
+func (s *secretService) prompt(path dbus.ObjectPath) error {
+	if path == "" || path == "/" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(ssPromptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(ssDest, path).Call(ssPromptIface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("failed to show keyring prompt: %w", err)
+	}
+
+	timeout := time.After(ssPromptTimeout)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || sig.Name != ssPromptIface+".Completed" {
+				continue
+			}
+			if len(sig.Body) > 0 {
+				if dismissed, ok := sig.Body[0].(bool); ok && dismissed {
+					return fmt.Errorf("keyring prompt was dismissed")
+				}
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("keyring prompt timed out")
+		}
+	}
+}
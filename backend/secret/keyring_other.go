@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package secret
+
+// newKeyring 当前平台不支持系统密钥环，使用加密文件
+func newKeyring() (Store, error) {
+	return nil, ErrUnavailable
+}
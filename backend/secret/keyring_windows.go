@@ -0,0 +1,163 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Windows 凭据管理器 API
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32         = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW    = advapi32.NewProc("CredReadW")
+	procCredWriteW   = advapi32.NewProc("CredWriteW")
+	procCredDeleteW  = advapi32.NewProc("CredDeleteW")
+	procCredEnumW    = advapi32.NewProc("CredEnumerateW")
+	procCredFree     = advapi32.NewProc("CredFree")
+	credTargetPrefix = keyringService + ":"
+)
+
+// credential CREDENTIALW 结构
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credManager 通过凭据管理器保存密钥，目标名为 wachat:<名称>
+type credManager struct{}
+
+// newKeyring 检查凭据管理器 API 是否可用
+func newKeyring() (Store, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return credManager{}, nil
+}
+
+// Name 返回存储后端的名称
+func (credManager) Name() string {
+	return "credential-manager"
+}
+
+// Get 读取密钥
+func (credManager) Get(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	r, _, callErr := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if errors.Is(callErr, errorNotFound) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("CredRead: %w", callErr)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// Set 保存密钥
+func (credManager) Set(name, value string) error {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(keyringService)
+	if err != nil {
+		return err
+	}
+	blob := []byte(value)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	r, _, callErr := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return fmt.Errorf("CredWrite: %w", callErr)
+	}
+	return nil
+}
+
+// Delete 删除密钥
+func (credManager) Delete(name string) error {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return err
+	}
+	r, _, callErr := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if r == 0 && !errors.Is(callErr, errorNotFound) {
+		return fmt.Errorf("CredDelete: %w", callErr)
+	}
+	return nil
+}
+
+// List 返回全部密钥名称
+func (credManager) List() ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(credTargetPrefix + "*")
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	var creds **credential
+	r, _, callErr := procCredEnumW.Call(uintptr(unsafe.Pointer(filter)), 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds)))
+	if r == 0 {
+		if errors.Is(callErr, errorNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("CredEnumerate: %w", callErr)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+
+	names := make([]string, 0, count)
+	for _, cred := range unsafe.Slice(creds, count) {
+		if cred.Type != credTypeGeneric {
+			continue
+		}
+		target := utf16PtrToString(cred.TargetName)
+		if name, ok := strings.CutPrefix(target, credTargetPrefix); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// utf16PtrToString 转换以 0 结尾的 UTF-16 字符串
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/v2/os/glog"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// minRedactLength 参与脱敏的最短密钥长度，过短的值（如 Ollama 的占位 Key）会误伤普通文本
+const minRedactLength = 8
+
+// maskChars 掩码中间的占位符
+const maskChars = "****"
+
+var (
+	knownMu  sync.RWMutex
+	known    = make(map[string]string) // 密钥值 -> 引用（明文配置的值为空字符串）
+	replacer *strings.Replacer
+)
+
+// Register 登记需要在日志中脱敏的密钥值（如仍以明文写在配置中的 Key），
+// 值过短（多为占位符）时不登记并返回 false
+func Register(value string) bool {
+	return register(value, "")
+}
+
+// register 登记密钥值及其引用
+func register(value, ref string) bool {
+	if len(value) < minRedactLength {
+		return false
+	}
+	knownMu.Lock()
+	defer knownMu.Unlock()
+	if old, ok := known[value]; ok && (ref == "" || old == ref) {
+		return true
+	}
+	known[value] = ref
+	replacer = nil
+	return true
+}
+
+// RefOf 返回密钥值对应的引用（值不是从引用解析得到时返回空字符串）
+func RefOf(value string) string {
+	knownMu.RLock()
+	defer knownMu.RUnlock()
+	return known[value]
+}
+
+// Mask 返回掩码后的值，只保留前 3 位和后 4 位
+func Mask(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case len(value) < 12:
+		return strings.Repeat("*", 8)
+	default:
+		return value[:3] + maskChars + value[len(value)-4:]
+	}
+}
+
+// IsMasked 判断值是否为 Mask 的结果（界面回传未修改的掩码）
+func IsMasked(value string) bool {
+	return value != "" && (strings.Contains(value, maskChars) || strings.Trim(value, "*") == "")
+}
+
+// Redact 将文本中已登记的密钥替换为掩码
+func Redact(text string) string {
+	if text == "" {
+		return text
+	}
+	r := redactor()
+	if r == nil {
+		return text
+	}
+	return r.Replace(text)
+}
+
+// redactor 返回脱敏替换器，较长的密钥优先匹配
+func redactor() *strings.Replacer {
+	knownMu.RLock()
+	r, n := replacer, len(known)
+	knownMu.RUnlock()
+	if r != nil || n == 0 {
+		return r
+	}
+
+	knownMu.Lock()
+	defer knownMu.Unlock()
+	if replacer == nil && len(known) > 0 {
+		values := make([]string, 0, len(known))
+		for value := range known {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+		pairs := make([]string, 0, len(values)*2)
+		for _, value := range values {
+			pairs = append(pairs, value, Mask(value))
+		}
+		replacer = strings.NewReplacer(pairs...)
+	}
+	return replacer
+}
+
+// MaskText 将文本（如配置文件内容）中已登记的密钥替换为掩码，用于返回给界面
+func MaskText(text string) string {
+	return Redact(text)
+}
+
+// UnmaskText 将界面回传文本中的掩码还原为原来的密钥，
+// 多个密钥的掩码相同时无法区分，保留掩码
+func UnmaskText(text string) string {
+	if !strings.Contains(text, "*") {
+		return text
+	}
+	knownMu.RLock()
+	masks := make(map[string]string, len(known))
+	for value := range known {
+		mask := Mask(value)
+		if _, dup := masks[mask]; dup {
+			masks[mask] = ""
+			continue
+		}
+		masks[mask] = value
+	}
+	knownMu.RUnlock()
+
+	pairs := make([]string, 0, len(masks)*2)
+	for mask, value := range masks {
+		if value != "" {
+			pairs = append(pairs, mask, value)
+		}
+	}
+	if len(pairs) == 0 {
+		return text
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// LogHandler 日志脱敏处理器，替换日志内容和堆栈中已登记的密钥
+func LogHandler(ctx context.Context, in *glog.HandlerInput) {
+	if redactor() != nil {
+		in.Content = Redact(in.Content)
+		in.Stack = Redact(in.Stack)
+		for i, v := range in.Values {
+			s := gconv.String(v)
+			if redacted := Redact(s); redacted != s {
+				in.Values[i] = redacted
+			}
+		}
+	}
+	in.Next(ctx)
+}
@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"", ""},
+		{"short", "********"},
+		{"elevenchars", "********"},
+		{"sk-0123456789abcdef", "sk-****cdef"},
+	}
+	for _, tt := range tests {
+		got := Mask(tt.value)
+		if got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if tt.value != "" && !IsMasked(got) {
+			t.Errorf("IsMasked(%q) = false", got)
+		}
+	}
+	for _, value := range []string{"", "sk-0123456789abcdef", "secret://ai.api_key", "a*b"} {
+		if IsMasked(value) {
+			t.Errorf("IsMasked(%q) = true", value)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	if Register("short") {
+		t.Error("registered a value shorter than the minimum length")
+	}
+	Register("redact-key-0123456789")
+	Register("redact-key-0123456789-long")
+
+	text := "key=redact-key-0123456789-long other=redact-key-0123456789 short"
+	// 较长的密钥优先匹配，不会只替换其前缀
+	want := "key=" + Mask("redact-key-0123456789-long") + " other=" + Mask("redact-key-0123456789") + " short"
+	if got := Redact(text); got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+	if got := MaskText(text); got != want {
+		t.Errorf("MaskText = %q, want %q", got, want)
+	}
+	if got := UnmaskText(want); got != text {
+		t.Errorf("UnmaskText = %q, want %q", got, text)
+	}
+}
+
+func TestUnmaskTextCollision(t *testing.T) {
+	// 两个密钥的前 3 位和后 4 位相同，掩码无法区分
+	first, second := "col-first-value-wxyz", "col-second-value-wxyz"
+	Register(first)
+	Register(second)
+	unique := "uniq-0123456789-abcd"
+	Register(unique)
+	if Mask(first) != Mask(second) {
+		t.Fatal("test keys do not collide")
+	}
+
+	text := "a: " + Mask(first) + "\nb: " + Mask(unique) + "\n"
+	got := UnmaskText(text)
+	if want := "a: " + Mask(first) + "\nb: " + unique + "\n"; got != want {
+		t.Errorf("UnmaskText = %q, want %q", got, want)
+	}
+	if strings.Contains(got, first) || strings.Contains(got, second) {
+		t.Error("a colliding mask was restored to one of the keys")
+	}
+	if !IsMasked(Mask(first)) {
+		t.Error("the remaining mask is not reported as masked")
+	}
+
+	if got := UnmaskText("no masks here"); got != "no masks here" {
+		t.Errorf("UnmaskText without masks = %q", got)
+	}
+}
@@ -0,0 +1,257 @@
+// Package secret 保存 API Key、令牌等敏感配置
+//
+// 配置文件中以 secret://<name> 引用密钥，实际的值保存在系统密钥环
+// （Linux Secret Service、macOS 钥匙串、Windows 凭据管理器），
+// 系统密钥环不可用时（如无桌面环境的 Linux）保存在用口令加密的文件中。
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RefPrefix 配置中引用密钥的前缀
+const RefPrefix = "secret://"
+
+// PassphraseEnv 加密文件的口令（无界面环境下使用）
+const PassphraseEnv = "WACHAT_VAULT_PASSPHRASE"
+
+// 存储后端
+const (
+	BackendAuto    = "auto"    // 优先使用系统密钥环，不可用时使用加密文件
+	BackendKeyring = "keyring" // 只使用系统密钥环
+	BackendFile    = "file"    // 只使用加密文件
+)
+
+// keyringService 系统密钥环中的服务名
+const keyringService = "wachat"
+
+var (
+	// ErrNotFound 密钥不存在
+	ErrNotFound = errors.New("secret not found")
+	// ErrLocked 加密文件尚未解锁
+	ErrLocked = errors.New("secret vault is locked, set " + PassphraseEnv + " or unlock it with a passphrase")
+	// ErrUnavailable 系统密钥环不可用
+	ErrUnavailable = errors.New("system keyring is not available")
+)
+
+// namePattern 密钥名称：字母、数字及 . _ -
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Store 密钥存储
+type Store interface {
+	// Name 返回存储后端的名称
+	Name() string
+	// Get 读取密钥，不存在时返回 ErrNotFound
+	Get(name string) (string, error)
+	// Set 保存密钥（已存在时覆盖）
+	Set(name, value string) error
+	// Delete 删除密钥，不存在时不报错
+	Delete(name string) error
+	// List 返回全部密钥名称
+	List() ([]string, error)
+}
+
+// Options 存储配置
+type Options struct {
+	Backend    string // auto / keyring / file（默认 auto）
+	File       string // 加密文件路径（默认 ~/.wachat/secrets.vault）
+	Passphrase string // 加密文件的口令（默认读取 WACHAT_VAULT_PASSPHRASE）
+}
+
+// Status 存储状态
+type Status struct {
+	Backend string   `json:"backend"`         // 使用中的后端
+	File    string   `json:"file,omitempty"`  // 加密文件路径（仅 file 后端）
+	Locked  bool     `json:"locked"`          // 加密文件是否尚未解锁
+	Names   []string `json:"names,omitempty"` // 已保存的密钥名称
+	Error   string   `json:"error,omitempty"` // 读取失败的原因
+}
+
+var (
+	storeMu      sync.RWMutex
+	defaultStore Store
+	storeOptions Options
+)
+
+// Configure 按配置选择存储后端，配置未变化时沿用当前的存储
+func Configure(opts Options) (Store, error) {
+	opts = normalizeOptions(opts)
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if defaultStore != nil && opts == storeOptions {
+		return defaultStore, nil
+	}
+
+	// 加密文件口令错误时仍使用未解锁的 Vault，避免每次读取密钥都重新派生密钥
+	store, err := openStore(opts)
+	if store == nil {
+		return nil, err
+	}
+	defaultStore, storeOptions = store, opts
+	return store, err
+}
+
+// Default 返回当前的存储，尚未配置时使用默认配置
+func Default() (Store, error) {
+	storeMu.RLock()
+	store := defaultStore
+	storeMu.RUnlock()
+	if store != nil {
+		return store, nil
+	}
+	if store, err := Configure(Options{}); store == nil {
+		return nil, err
+	}
+	return Default()
+}
+
+// normalizeOptions 填充默认值
+func normalizeOptions(opts Options) Options {
+	if opts.Backend == "" {
+		opts.Backend = BackendAuto
+	}
+	if opts.File == "" {
+		opts.File = defaultVaultPath()
+	}
+	if opts.Passphrase == "" {
+		opts.Passphrase = os.Getenv(PassphraseEnv)
+	}
+	return opts
+}
+
+// openStore 打开存储后端，加密文件解锁失败时返回未解锁的 Vault 和错误
+func openStore(opts Options) (Store, error) {
+	switch opts.Backend {
+	case BackendKeyring:
+		return newKeyring()
+	case BackendFile:
+		return OpenVault(opts.File, opts.Passphrase)
+	case BackendAuto:
+		if store, err := newKeyring(); err == nil {
+			return store, nil
+		}
+		return OpenVault(opts.File, opts.Passphrase)
+	default:
+		return nil, fmt.Errorf("unsupported secrets backend: %s", opts.Backend)
+	}
+}
+
+// defaultVaultPath 返回默认的加密文件路径
+func defaultVaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "secrets.vault"
+	}
+	return filepath.Join(home, ".wachat", "secrets.vault")
+}
+
+// Unlock 用口令解锁加密文件（系统密钥环无需解锁）
+func Unlock(passphrase string) error {
+	store, err := Default()
+	if err != nil {
+		return err
+	}
+	vault, ok := store.(*Vault)
+	if !ok {
+		return fmt.Errorf("%s does not need to be unlocked", store.Name())
+	}
+	return vault.Unlock(passphrase)
+}
+
+// GetStatus 返回当前存储的状态
+func GetStatus() *Status {
+	store, err := Default()
+	if err != nil {
+		return &Status{Error: err.Error()}
+	}
+	status := &Status{Backend: store.Name()}
+	if vault, ok := store.(*Vault); ok {
+		status.File = vault.Path()
+		status.Locked = vault.Locked()
+	}
+	names, err := store.List()
+	if err != nil {
+		if !errors.Is(err, ErrLocked) {
+			status.Error = err.Error()
+		}
+		return status
+	}
+	sort.Strings(names)
+	status.Names = names
+	return status
+}
+
+// IsRef 判断配置值是否为密钥引用
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Ref 返回密钥引用
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// RefName 返回引用的密钥名称
+func RefName(ref string) string {
+	return strings.TrimPrefix(ref, RefPrefix)
+}
+
+// ValidateName 检查密钥名称
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Resolve 解析配置值：密钥引用返回密钥的值并登记用于日志脱敏，其他值原样返回
+func Resolve(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	name := RefName(value)
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	store, err := Default()
+	if err != nil {
+		return "", err
+	}
+	resolved, err := store.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from %s: %w", value, store.Name(), err)
+	}
+	register(resolved, value)
+	return resolved, nil
+}
+
+// Put 保存密钥并返回写入配置的引用，value 为空时删除密钥并返回空字符串
+func Put(name, value string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	store, err := Default()
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		if err := store.Delete(name); err != nil {
+			return "", fmt.Errorf("failed to delete %s from %s: %w", name, store.Name(), err)
+		}
+		return "", nil
+	}
+	if err := store.Set(name, value); err != nil {
+		return "", fmt.Errorf("failed to save %s to %s: %w", name, store.Name(), err)
+	}
+	ref := Ref(name)
+	register(value, ref)
+	return ref, nil
+}
@@ -0,0 +1,272 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密文件格式
+const (
+	vaultFormatVersion = 1
+	vaultKDF           = "scrypt"
+	vaultAAD           = "wachat-vault-v1"
+)
+
+// scrypt 参数（约 64MB 内存，解锁耗时在 100ms 量级）
+const (
+	scryptN      = 1 << 16
+	scryptR      = 8
+	scryptP      = 1
+	vaultKeySize = 32
+	vaultSaltLen = 16
+)
+
+// ErrBadPassphrase 口令错误或文件已损坏
+var ErrBadPassphrase = errors.New("wrong passphrase or corrupted secret vault")
+
+// vaultFile 加密文件内容：全部密钥序列化为 JSON 后用 AES-256-GCM 加密，密钥由口令经 scrypt 派生
+type vaultFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Vault 用口令加密的密钥文件，用于没有系统密钥环的环境
+type Vault struct {
+	path string
+
+	mu      sync.Mutex
+	key     []byte            // 由口令派生的密钥，为空表示未解锁
+	header  vaultFile         // 文件头（KDF 参数和盐）
+	secrets map[string]string // 解密后的密钥
+}
+
+// OpenVault 打开加密文件，passphrase 为空时返回未解锁的 Vault
+// 解锁失败时同样返回未解锁的 Vault 以及错误，之后可以用正确的口令 Unlock
+func OpenVault(path, passphrase string) (*Vault, error) {
+	v := &Vault{path: path}
+	if passphrase == "" {
+		return v, nil
+	}
+	return v, v.Unlock(passphrase)
+}
+
+// Name 返回存储后端的名称
+func (v *Vault) Name() string {
+	return "file"
+}
+
+// Path 返回加密文件路径
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Locked 返回是否尚未解锁
+func (v *Vault) Locked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.key == nil
+}
+
+// Unlock 用口令解锁：文件存在时解密验证口令，不存在时以该口令创建新文件
+func (v *Vault) Unlock(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	data, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, vaultSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		header := vaultFile{Version: vaultFormatVersion, KDF: vaultKDF, N: scryptN, R: scryptR, P: scryptP, Salt: salt}
+		key, err := deriveKey(passphrase, header)
+		if err != nil {
+			return err
+		}
+		v.key, v.header, v.secrets = key, header, make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secret vault: %w", err)
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid secret vault %s: %w", v.path, err)
+	}
+	if file.Version != vaultFormatVersion || file.KDF != vaultKDF {
+		return fmt.Errorf("unsupported secret vault format: version %d, kdf %s", file.Version, file.KDF)
+	}
+	key, err := deriveKey(passphrase, file)
+	if err != nil {
+		return err
+	}
+	secrets, err := decryptSecrets(key, file)
+	if err != nil {
+		return err
+	}
+	v.key, v.header, v.secrets = key, file, secrets
+	return nil
+}
+
+// Get 读取密钥
+func (v *Vault) Get(name string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return "", ErrLocked
+	}
+	value, ok := v.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set 保存密钥
+func (v *Vault) Set(name, value string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return ErrLocked
+	}
+	old, existed := v.secrets[name]
+	v.secrets[name] = value
+	if err := v.save(); err != nil {
+		if existed {
+			v.secrets[name] = old
+		} else {
+			delete(v.secrets, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete 删除密钥
+func (v *Vault) Delete(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return ErrLocked
+	}
+	old, existed := v.secrets[name]
+	if !existed {
+		return nil
+	}
+	delete(v.secrets, name)
+	if err := v.save(); err != nil {
+		v.secrets[name] = old
+		return err
+	}
+	return nil
+}
+
+// List 返回全部密钥名称
+func (v *Vault) List() ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return nil, ErrLocked
+	}
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// save 加密写入文件（每次使用新的 nonce，先写临时文件再重命名），调用方需持有锁
+func (v *Vault) save() error {
+	plaintext, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	file := v.header
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plaintext, []byte(vaultAAD))
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secret vault directory: %w", err)
+	}
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret vault: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write secret vault: %w", err)
+	}
+	return nil
+}
+
+// deriveKey 由口令派生加密密钥
+func deriveKey(passphrase string, file vaultFile) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), file.Salt, file.N, file.R, file.P, vaultKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive vault key: %w", err)
+	}
+	return key, nil
+}
+
+// decryptSecrets 解密文件中的密钥
+func decryptSecrets(key []byte, file vaultFile) (map[string]string, error) {
+	secrets := make(map[string]string)
+	if len(file.Data) == 0 {
+		return secrets, nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, []byte(vaultAAD))
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return secrets, nil
+}
+
+// newGCM 创建 AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
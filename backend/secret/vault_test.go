@@ -0,0 +1,160 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets", "secrets.vault")
+
+	v, err := OpenVault(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Locked() || v.Name() != "file" || v.Path() != path {
+		t.Fatalf("new vault: locked %v, name %s, path %s", v.Locked(), v.Name(), v.Path())
+	}
+	// 未解锁时所有操作返回 ErrLocked
+	if _, err := v.Get("a"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Get on a locked vault = %v", err)
+	}
+	if err := v.Set("a", "1"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Set on a locked vault = %v", err)
+	}
+	if err := v.Delete("a"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Delete on a locked vault = %v", err)
+	}
+	if _, err := v.List(); !errors.Is(err, ErrLocked) {
+		t.Errorf("List on a locked vault = %v", err)
+	}
+	if err := v.Unlock(""); err == nil {
+		t.Error("unlocking with an empty passphrase succeeded")
+	}
+
+	// 文件不存在时以该口令创建
+	if err := v.Unlock("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"ai.api_key": "sk-test-0123456789", "token": "tok-9876543210"} {
+		if err := v.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Delete("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Delete("missing"); err != nil {
+		t.Errorf("deleting a missing secret: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-test") || strings.Contains(string(data), "ai.api_key") {
+		t.Error("vault file contains a secret in plaintext")
+	}
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Errorf("vault file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// 用同一口令重新打开后读取
+	reopened, err := OpenVault(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := reopened.Get("ai.api_key"); err != nil || value != "sk-test-0123456789" {
+		t.Errorf("Get after reopening = %q, %v", value, err)
+	}
+	if _, err := reopened.Get("token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted secret = %v, want ErrNotFound", err)
+	}
+	if names, err := reopened.List(); err != nil || !reflect.DeepEqual(names, []string{"ai.api_key"}) {
+		t.Errorf("List = %v, %v", names, err)
+	}
+
+	// 口令错误时返回未解锁的 Vault，之后可以用正确的口令解锁
+	wrong, err := OpenVault(path, "wrong")
+	if !errors.Is(err, ErrBadPassphrase) || !wrong.Locked() {
+		t.Fatalf("wrong passphrase = %v, locked %v, want ErrBadPassphrase", err, wrong.Locked())
+	}
+	if err := wrong.Unlock("correct horse"); err != nil || wrong.Locked() {
+		t.Errorf("Unlock after a wrong passphrase = %v", err)
+	}
+}
+
+func TestVaultCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenVault(path, "pw"); err == nil || !strings.Contains(err.Error(), "invalid secret vault") {
+		t.Errorf("opening a corrupted vault = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":2,"kdf":"scrypt"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenVault(path, "pw"); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("opening a vault of another version = %v", err)
+	}
+}
+
+func TestPutResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	t.Cleanup(func() {
+		storeMu.Lock()
+		defaultStore, storeOptions = nil, Options{}
+		storeMu.Unlock()
+	})
+
+	// 口令未设置时存储处于锁定状态
+	t.Setenv(PassphraseEnv, "")
+	if _, err := Configure(Options{Backend: BackendFile, File: path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Put("ai.api_key", "sk-locked-0123456789"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Put on a locked vault = %v, want ErrLocked", err)
+	}
+	if _, err := Resolve(Ref("ai.api_key")); !errors.Is(err, ErrLocked) {
+		t.Errorf("Resolve on a locked vault = %v, want ErrLocked", err)
+	}
+	if status := GetStatus(); status.Backend != "file" || !status.Locked || status.File != path || status.Error != "" {
+		t.Errorf("locked status = %+v", status)
+	}
+
+	if err := Unlock("pw"); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := Put("ai.api_key", "sk-put-0123456789")
+	if err != nil || ref != "secret://ai.api_key" {
+		t.Fatalf("Put = %q, %v", ref, err)
+	}
+	if RefOf("sk-put-0123456789") != ref {
+		t.Error("stored value is not registered with its reference")
+	}
+	if value, err := Resolve(ref); err != nil || value != "sk-put-0123456789" {
+		t.Errorf("Resolve = %q, %v", value, err)
+	}
+	if value, err := Resolve("plain"); err != nil || value != "plain" {
+		t.Errorf("Resolve of a plain value = %q, %v", value, err)
+	}
+	if _, err := Resolve("secret://../x"); err == nil {
+		t.Error("resolving an invalid name succeeded")
+	}
+	if status := GetStatus(); status.Locked || !reflect.DeepEqual(status.Names, []string{"ai.api_key"}) {
+		t.Errorf("unlocked status = %+v", status)
+	}
+
+	// 空值删除密钥
+	if ref, err := Put("ai.api_key", ""); err != nil || ref != "" {
+		t.Errorf("Put of an empty value = %q, %v", ref, err)
+	}
+	if _, err := Resolve("secret://ai.api_key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve after deleting = %v, want ErrNotFound", err)
+	}
+}
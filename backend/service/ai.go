@@ -4,27 +4,82 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/wangle201210/wachat/backend/config"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 )
 
+// maxToolRounds 单次回复中最多允许的工具调用轮数
+const maxToolRounds = 8
+
 // RAGService interface for any RAG implementation
 type RAGService interface {
 	IsEnabled() bool
 	RetrieveWithContext(ctx context.Context, query string) (string, error)
 	RetrieveDocuments(ctx context.Context, query string) ([]*schema.Document, error)
+	RetrieveFromKnowledgeBases(ctx context.Context, query string, knowledgeBases []string) ([]*schema.Document, error)
+}
+
+// ToolProvider interface for external tool sources (e.g. MCP servers)
+type ToolProvider interface {
+	ListTools(ctx context.Context, servers []string) ([]*schema.ToolInfo, error)
+	// CallTool calls a tool by its full name, only tools of the given servers may be called
+	CallTool(ctx context.Context, servers []string, name, arguments string) (string, error)
+}
+
+// StreamOption configures a single StreamResponse call
+type StreamOption func(*streamOptions)
+
+type streamOptions struct {
+	ctx            context.Context
+	mcpServers     []string
+	knowledgeBases []string
+	model          string
+}
+
+// WithMCPServers exposes the tools of the given MCP servers to the model
+func WithMCPServers(servers ...string) StreamOption {
+	return func(o *streamOptions) {
+		o.mcpServers = servers
+	}
+}
+
+// WithKnowledgeBases retrieves RAG context from the given knowledge bases
+// instead of the configured default knowledge base
+func WithKnowledgeBases(knowledgeBases ...string) StreamOption {
+	return func(o *streamOptions) {
+		o.knowledgeBases = knowledgeBases
+	}
+}
+
+// WithContext runs the call (retrieval, tool calls and model requests) under ctx,
+// so that cancelling ctx (e.g. an HTTP client disconnecting) stops the turn
+func WithContext(ctx context.Context) StreamOption {
+	return func(o *streamOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithModel overrides the configured model for a single call
+func WithModel(name string) StreamOption {
+	return func(o *streamOptions) {
+		o.model = name
+	}
 }
 
 // AIService handles AI interactions using eino ChatModel
 type AIService struct {
-	chatModel  *openai.ChatModel
-	ctx        context.Context
-	config     *config.AIConfig
-	ragService RAGService
+	ctx          context.Context
+	mu           sync.Mutex // 保护 config 和 chatModel（配置变更时替换）
+	config       *config.AIConfig
+	chatModel    *openai.ChatModel
+	ragService   RAGService
+	toolProvider ToolProvider
 }
 
 // NewAIService creates AI service with eino ChatModel and optional RAG
@@ -36,10 +91,34 @@ func NewAIService(cfg *config.AIConfig, ragService RAGService) *AIService {
 	}
 }
 
-// initChatModel lazy initializes the ChatModel
-func (a *AIService) initChatModel() error {
+// SetToolProvider sets the provider used for tool calling
+func (a *AIService) SetToolProvider(provider ToolProvider) {
+	a.toolProvider = provider
+}
+
+// Reconfigure switches to a new AI config, the chat model is recreated on the next request
+// Responses already streaming keep using the previous model
+func (a *AIService) Reconfigure(cfg *config.AIConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config = cfg
+	a.chatModel = nil
+	g.Log().Infof(a.ctx, "AI config changed: base_url=%s, model=%s", cfg.BaseURL, cfg.Model)
+}
+
+// Model returns the configured default model
+func (a *AIService) Model() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config.Model
+}
+
+// initChatModel lazy initializes the ChatModel and returns it
+func (a *AIService) initChatModel() (*openai.ChatModel, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.chatModel != nil {
-		return nil
+		return a.chatModel, nil
 	}
 
 	cfg := &openai.ChatModelConfig{
@@ -48,26 +127,33 @@ func (a *AIService) initChatModel() error {
 		Model:   a.config.Model,
 	}
 
-	g.Log().Infof(a.ctx, "AI Config: %+v", cfg)
+	g.Log().Infof(a.ctx, "AI Config: base_url=%s, model=%s", cfg.BaseURL, cfg.Model)
 
 	cm, err := openai.NewChatModel(a.ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create chat model: %w", err)
+		return nil, fmt.Errorf("failed to create chat model: %w", err)
 	}
 
 	a.chatModel = cm
-	return nil
+	return cm, nil
 }
 
 // StreamResponse streams AI response using eino with optional RAG enhancement
 // Returns the retrieved documents that were used to enhance the response
-func (a *AIService) StreamResponse(messages []*schema.Message, responseChan chan<- string, enableRAG bool) ([]*schema.Document, error) {
+func (a *AIService) StreamResponse(messages []*schema.Message, responseChan chan<- string, enableRAG bool, opts ...StreamOption) ([]*schema.Document, error) {
 	defer close(responseChan)
 
-	if err := a.initChatModel(); err != nil {
+	chatModel, err := a.initChatModel()
+	if err != nil {
 		return nil, err
 	}
 
+	options := &streamOptions{ctx: a.ctx}
+	for _, opt := range opts {
+		opt(options)
+	}
+	ctx := options.ctx
+
 	// 增强：如果启用了 RAG，检索相关文档并添加到上下文
 	var retrievedDocs []*schema.Document
 	enhancedMessages := messages
@@ -76,7 +162,13 @@ func (a *AIService) StreamResponse(messages []*schema.Message, responseChan chan
 		lastMsg := messages[len(messages)-1]
 		if lastMsg.Role == schema.User {
 			// 检索文档（只检索一次）
-			docs, err := a.ragService.RetrieveDocuments(a.ctx, lastMsg.Content)
+			var docs []*schema.Document
+			var err error
+			if len(options.knowledgeBases) > 0 {
+				docs, err = a.ragService.RetrieveFromKnowledgeBases(ctx, lastMsg.Content, options.knowledgeBases)
+			} else {
+				docs, err = a.ragService.RetrieveDocuments(ctx, lastMsg.Content)
+			}
 			if err == nil && len(docs) > 0 {
 				retrievedDocs = docs
 
@@ -95,14 +187,70 @@ func (a *AIService) StreamResponse(messages []*schema.Message, responseChan chan
 				enhancedMessages = append(enhancedMessages, systemMsg)
 				enhancedMessages = append(enhancedMessages, messages...)
 
-				g.Log().Infof(a.ctx, "RAG: Retrieved %d documents for context,contextStr: %s", len(docs), contextStr)
+				g.Log().Infof(ctx, "RAG: Retrieved %d documents for context,contextStr: %s", len(docs), contextStr)
 			}
 		}
 	}
 
-	streamResult, err := a.chatModel.Stream(a.ctx, enhancedMessages)
+	// 工具：加载会话启用的 MCP 服务器工具
+	var tools []*schema.ToolInfo
+	if len(options.mcpServers) > 0 && a.toolProvider != nil {
+		tools, err = a.toolProvider.ListTools(ctx, options.mcpServers)
+		if err != nil {
+			g.Log().Warningf(ctx, "Failed to list tools: %v", err)
+		}
+	}
+
+	var modelOpts []model.Option
+	if options.model != "" {
+		modelOpts = append(modelOpts, model.WithModel(options.model))
+	}
+
+	if len(tools) == 0 {
+		return retrievedDocs, a.streamOnce(ctx, chatModel, enhancedMessages, responseChan, nil, modelOpts...)
+	}
+
+	// 复制一份消息，工具调用过程中追加的消息不影响调用方
+	conversation := make([]*schema.Message, len(enhancedMessages))
+	copy(conversation, enhancedMessages)
+
+	for round := 0; round < maxToolRounds; round++ {
+		var chunks []*schema.Message
+		err := a.streamOnce(ctx, chatModel, conversation, responseChan, func(chunk *schema.Message) {
+			chunks = append(chunks, chunk)
+		}, append(modelOpts, model.WithTools(tools))...)
+		if err != nil {
+			return retrievedDocs, err
+		}
+
+		msg, err := schema.ConcatMessages(chunks)
+		if err != nil {
+			return retrievedDocs, fmt.Errorf("failed to concat stream chunks: %w", err)
+		}
+		if len(msg.ToolCalls) == 0 {
+			return retrievedDocs, nil
+		}
+
+		conversation = append(conversation, msg)
+		for _, toolCall := range msg.ToolCalls {
+			result, err := a.toolProvider.CallTool(ctx, options.mcpServers, toolCall.Function.Name, toolCall.Function.Arguments)
+			if err != nil {
+				g.Log().Warningf(ctx, "Tool %s failed: %v", toolCall.Function.Name, err)
+				result = fmt.Sprintf("tool error: %v", err)
+			}
+			conversation = append(conversation, schema.ToolMessage(result, toolCall.ID, schema.WithToolName(toolCall.Function.Name)))
+		}
+	}
+
+	// 超出工具调用轮数，不再提供工具，让模型直接给出回答
+	return retrievedDocs, a.streamOnce(ctx, chatModel, conversation, responseChan, nil, modelOpts...)
+}
+
+// streamOnce streams a single model turn, forwarding content chunks to responseChan
+func (a *AIService) streamOnce(ctx context.Context, chatModel *openai.ChatModel, messages []*schema.Message, responseChan chan<- string, onChunk func(*schema.Message), opts ...model.Option) error {
+	streamResult, err := chatModel.Stream(ctx, messages, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("stream error: %w", err)
+		return fmt.Errorf("stream error: %w", err)
 	}
 	defer streamResult.Close()
 
@@ -112,12 +260,15 @@ func (a *AIService) StreamResponse(messages []*schema.Message, responseChan chan
 			break
 		}
 		if err != nil {
-			return retrievedDocs, err
+			return err
+		}
+		if onChunk != nil {
+			onChunk(chunk)
 		}
 		if chunk.Content != "" {
 			responseChan <- chunk.Content
 		}
 	}
 
-	return retrievedDocs, nil
+	return nil
 }
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// maxRequestBodySize 请求体的大小上限
+const maxRequestBodySize = 4 << 20
+
+// APIServerService 本地 OpenAI 兼容 HTTP API
+// 提供 /v1/chat/completions（支持 SSE 流式）和 /v1/models，请求统一经过 AIService.StreamResponse
+type APIServerService struct {
+	ctx         context.Context
+	config      atomic.Pointer[config.APIServerConfig]
+	aiService   *AIService
+	chatService *ChatService
+	mu          sync.Mutex
+	server      *http.Server
+}
+
+// NewAPIServerService 创建本地 API 服务
+func NewAPIServerService(ctx context.Context, cfg *config.APIServerConfig, aiService *AIService, chatService *ChatService) *APIServerService {
+	s := &APIServerService{
+		ctx:         ctx,
+		aiService:   aiService,
+		chatService: chatService,
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// Reconfigure 使用新的 API 服务配置（配置变更后调用），token 立即生效，
+// 端口变化且服务正在运行时返回 true，由调用方重启
+func (s *APIServerService) Reconfigure(cfg *config.APIServerConfig) (restart bool) {
+	prev := s.config.Swap(cfg)
+	return prev.Port != cfg.Port && s.IsRunning()
+}
+
+// openAIChatRequest /v1/chat/completions 请求体
+type openAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+	// Wachat wachat 扩展字段
+	Wachat *wachatExtension `json:"wachat,omitempty"`
+}
+
+// wachatExtension 请求中的 wachat 扩展字段
+type wachatExtension struct {
+	KnowledgeBases []string `json:"knowledge_bases"` // 检索的知识库（为空时使用默认知识库）
+	DisableRAG     bool     `json:"disable_rag"`     // 关闭 RAG 增强
+	MCPServers     []string `json:"mcp_servers"`     // 启用的 MCP 服务器
+	Persist        bool     `json:"persist"`         // 是否保存为 wachat 会话
+	ConversationID string   `json:"conversation_id"` // 追加到已有会话（需要 persist）
+	Title          string   `json:"title"`           // 新建会话的标题
+}
+
+// openAIChatMessage OpenAI 消息格式，content 可以是字符串或内容片段数组
+type openAIChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text 提取消息的文本内容
+func (m *openAIChatMessage) text() string {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err == nil {
+		texts := make([]string, 0, len(parts))
+		for _, part := range parts {
+			if part.Type == "text" {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// IsRunning 检查 API 服务是否在运行
+func (s *APIServerService) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.server != nil
+}
+
+// Address 返回监听地址（只绑定本机）
+func (s *APIServerService) Address() string {
+	return fmt.Sprintf("127.0.0.1:%d", s.config.Load().Port)
+}
+
+// Start 启动 API 服务
+func (s *APIServerService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return fmt.Errorf("API server is already running")
+	}
+
+	listener, err := net.Listen("tcp", s.Address())
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Address(), err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", s.withAuth(s.handleModels))
+	mux.HandleFunc("/v1/chat/completions", s.withAuth(s.handleChatCompletions))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.server = server
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			g.Log().Errorf(s.ctx, "API server error: %v", err)
+		}
+	}()
+
+	g.Log().Infof(s.ctx, "OpenAI-compatible API server listening on http://%s/v1", s.Address())
+	return nil
+}
+
+// Stop 停止 API 服务
+func (s *APIServerService) Stop() error {
+	s.mu.Lock()
+	server := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return fmt.Errorf("API server is not running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop API server: %w", err)
+	}
+
+	g.Log().Info(s.ctx, "API server stopped")
+	return nil
+}
+
+// GetStatus 获取 API 服务状态
+func (s *APIServerService) GetStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": s.config.Load().IsEnabled(),
+		"running": s.IsRunning(),
+		"url":     fmt.Sprintf("http://%s/v1", s.Address()),
+	}
+}
+
+// withAuth 拒绝浏览器发起的请求并校验 Bearer token（未配置 token 时放行）
+// 浏览器请求都带 Origin 头，拒绝后用户打开的网页无法通过 127.0.0.1 调用模型和 MCP 工具；
+// POST 还必须是 application/json，跨域的 JSON 请求需要预检，而本服务不响应预检
+func (s *APIServerService) withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", "requests from browsers are not allowed")
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+				writeOpenAIError(w, http.StatusUnsupportedMediaType, "invalid_request_error", "Content-Type must be application/json")
+				return
+			}
+		}
+		if expected := s.config.Load().Token; expected != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+				writeOpenAIError(w, http.StatusUnauthorized, "invalid_api_key", "invalid or missing token")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// handleModels GET /v1/models
+func (s *APIServerService) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{
+			{
+				"id":       s.aiService.Model(),
+				"object":   "model",
+				"created":  0,
+				"owned_by": "wachat",
+			},
+		},
+	})
+}
+
+// handleChatCompletions POST /v1/chat/completions
+func (s *APIServerService) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+
+	var req openAIChatRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeOpenAIError(w, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+
+	messages := make([]*schema.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, &schema.Message{
+			Role:    schema.RoleType(msg.Role),
+			Content: msg.text(),
+		})
+	}
+
+	ext := req.Wachat
+	if ext == nil {
+		ext = &wachatExtension{}
+	}
+
+	modelName := s.aiService.Model()
+	var opts []StreamOption
+	if req.Model != "" && req.Model != modelName {
+		modelName = req.Model
+		opts = append(opts, WithModel(req.Model))
+	}
+	if len(ext.KnowledgeBases) > 0 {
+		opts = append(opts, WithKnowledgeBases(ext.KnowledgeBases...))
+	}
+	if len(ext.MCPServers) > 0 {
+		opts = append(opts, WithMCPServers(ext.MCPServers...))
+	}
+	// 客户端断开时取消检索、工具调用和模型请求
+	opts = append(opts, WithContext(r.Context()))
+
+	// 持久化：先确定会话，保证响应中能返回会话 ID
+	conversationID := ""
+	if ext.Persist {
+		id, err := s.prepareConversation(ext, messages)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		conversationID = id
+		w.Header().Set("X-Wachat-Conversation-Id", conversationID)
+	}
+
+	completionID := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+
+	responseChan := make(chan string)
+	type streamResult struct {
+		docs []*schema.Document
+		err  error
+	}
+	resultChan := make(chan streamResult, 1)
+	go func() {
+		docs, err := s.aiService.StreamResponse(messages, responseChan, !ext.DisableRAG, opts...)
+		resultChan <- streamResult{docs: docs, err: err}
+	}()
+
+	var content strings.Builder
+	if req.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		flusher, _ := w.(http.Flusher)
+
+		clientGone := false
+		writeChunk := func(delta map[string]interface{}, finishReason interface{}) {
+			if clientGone {
+				return
+			}
+			chunk := map[string]interface{}{
+				"id":      completionID,
+				"object":  "chat.completion.chunk",
+				"created": created,
+				"model":   modelName,
+				"choices": []map[string]interface{}{
+					{"index": 0, "delta": delta, "finish_reason": finishReason},
+				},
+			}
+			data, _ := json.Marshal(chunk)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				// 客户端断开后继续消费 responseChan，避免阻塞生成协程
+				clientGone = true
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		writeChunk(map[string]interface{}{"role": "assistant", "content": ""}, nil)
+		for chunk := range responseChan {
+			content.WriteString(chunk)
+			writeChunk(map[string]interface{}{"content": chunk}, nil)
+		}
+		result := <-resultChan
+		if result.err != nil {
+			g.Log().Warningf(s.ctx, "API server: stream error: %v", result.err)
+			if !clientGone {
+				data, _ := json.Marshal(map[string]interface{}{
+					"error": map[string]string{"type": "server_error", "message": result.err.Error()},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		} else {
+			writeChunk(map[string]interface{}{}, "stop")
+		}
+		if !clientGone {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		s.persistReply(conversationID, content.String(), result.err)
+		return
+	}
+
+	for chunk := range responseChan {
+		content.WriteString(chunk)
+	}
+	result := <-resultChan
+	s.persistReply(conversationID, content.String(), result.err)
+	if result.err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "server_error", result.err.Error())
+		return
+	}
+
+	resp := map[string]interface{}{
+		"id":      completionID,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   modelName,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": content.String()},
+				"finish_reason": "stop",
+			},
+		},
+	}
+	wachat := map[string]interface{}{}
+	if conversationID != "" {
+		wachat["conversation_id"] = conversationID
+	}
+	if len(result.docs) > 0 {
+		wachat["rag_documents"] = result.docs
+	}
+	if len(wachat) > 0 {
+		resp["wachat"] = wachat
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// prepareConversation 创建或校验会话，并保存最后一条用户消息
+func (s *APIServerService) prepareConversation(ext *wachatExtension, messages []*schema.Message) (string, error) {
+	conversationID := ext.ConversationID
+	if conversationID != "" {
+		if _, err := s.chatService.GetConversation(conversationID); err != nil {
+			return "", fmt.Errorf("conversation %s not found", conversationID)
+		}
+	} else {
+		title := ext.Title
+		if title == "" {
+			title = "API 会话"
+		}
+		conv, err := s.chatService.CreateConversation(title)
+		if err != nil {
+			return "", fmt.Errorf("failed to create conversation: %w", err)
+		}
+		conversationID = conv.ID
+	}
+
+	lastMsg := messages[len(messages)-1]
+	if lastMsg.Role == schema.User {
+		if err := s.chatService.SaveMessage(conversationID, lastMsg); err != nil {
+			return "", fmt.Errorf("failed to save user message: %w", err)
+		}
+	}
+	return conversationID, nil
+}
+
+// persistReply 保存助手回复到会话
+func (s *APIServerService) persistReply(conversationID, content string, streamErr error) {
+	if conversationID == "" || (content == "" && streamErr != nil) {
+		return
+	}
+	if err := s.chatService.SaveMessage(conversationID, &schema.Message{
+		Role:    schema.Assistant,
+		Content: content,
+	}); err != nil {
+		g.Log().Warningf(s.ctx, "API server: failed to save assistant message: %v", err)
+	}
+}
+
+// writeJSON 写 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeOpenAIError 写 OpenAI 格式的错误响应
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
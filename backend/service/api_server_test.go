@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+func TestAPIServerWithAuth(t *testing.T) {
+	s := &APIServerService{}
+	s.config.Store(&config.APIServerConfig{Port: 8765})
+	handler := s.withAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		origin      string
+		token       string
+		auth        string
+		want        int
+	}{
+		{"json post", http.MethodPost, "application/json", "", "", "", http.StatusOK},
+		{"json with charset", http.MethodPost, "application/json; charset=utf-8", "", "", "", http.StatusOK},
+		{"get models", http.MethodGet, "", "", "", "", http.StatusOK},
+		{"text/plain post from a web page", http.MethodPost, "text/plain", "", "", "", http.StatusUnsupportedMediaType},
+		{"form post", http.MethodPost, "application/x-www-form-urlencoded", "", "", "", http.StatusUnsupportedMediaType},
+		{"browser origin", http.MethodPost, "application/json", "https://evil.example", "", "", http.StatusForbidden},
+		{"browser origin on get", http.MethodGet, "", "null", "", "", http.StatusForbidden},
+		{"missing token", http.MethodPost, "application/json", "", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "application/json", "", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"valid token", http.MethodPost, "application/json", "", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.Store(&config.APIServerConfig{Port: 8765, Token: tt.token})
+			req := httptest.NewRequest(tt.method, "/v1/chat/completions", strings.NewReader(`{}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIServerRequestBodyLimit(t *testing.T) {
+	s := &APIServerService{}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"too large", `{"messages":[{"role":"user","content":"` + strings.Repeat("x", maxRequestBodySize) + `"}]}`, http.StatusRequestEntityTooLarge},
+		{"invalid json", `{"messages":`, http.StatusBadRequest},
+		{"no messages", `{"messages":[]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			s.handleChatCompletions(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// 解压限制的默认值
+const (
+	defaultExtractMaxSize    = 8 << 30 // 解压后的总大小上限（Ollama 带有较大的 CUDA 运行库）
+	defaultExtractMaxEntries = 100000  // 条目数量上限
+	maxSymlinkTargetLength   = 4096    // zip 中符号链接目标的最大长度
+)
+
+// extractOptions 解压选项
+type extractOptions struct {
+	stripComponents int   // 去掉的前导目录层数（类似 tar --strip-components）
+	maxSize         int64 // 解压后的总大小上限
+	maxEntries      int   // 条目数量上限
+}
+
+// newExtractOptions 根据 archive 配置生成解压选项，未配置的限制使用默认值
+func newExtractOptions(cfg *config.ArchiveConfig) extractOptions {
+	opts := extractOptions{
+		maxSize:    defaultExtractMaxSize,
+		maxEntries: defaultExtractMaxEntries,
+	}
+	if cfg != nil {
+		opts.stripComponents = cfg.StripComponents
+		if cfg.MaxSize > 0 {
+			opts.maxSize = int64(cfg.MaxSize) << 20
+		}
+		if cfg.MaxEntries > 0 {
+			opts.maxEntries = cfg.MaxEntries
+		}
+	}
+	return opts
+}
+
+// extractTarGz 解压 tar.gz 文件，所有条目限制在 destPath 内
+func extractTarGz(archivePath, destPath string, opts extractOptions) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	x, err := newExtractor(destPath, opts)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.count(); err != nil {
+			return err
+		}
+
+		// 去掉前导目录
+		// 例如 strip=1：go-rag/go-rag -> go-rag
+		//              go-rag/static/index.html -> static/index.html
+		rel, err := x.entryPath(header.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(rel)
+		case tar.TypeReg:
+			err = x.writeFile(rel, tr, os.FileMode(header.Mode))
+		case tar.TypeSymlink:
+			err = x.symlink(rel, header.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(rel, header.Linkname)
+		default:
+			// 设备文件、FIFO 等不需要也不应该出现在安装包中
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractZip 解压 zip 文件，所有条目限制在 destPath 内
+func extractZip(archivePath, destPath string, opts extractOptions) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	x, err := newExtractor(destPath, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		if err := x.count(); err != nil {
+			return err
+		}
+		rel, err := x.entryPath(file.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+
+		switch mode := file.Mode(); {
+		case mode.IsDir():
+			err = x.mkdir(rel)
+		case mode&os.ModeSymlink != 0:
+			var target string
+			if target, err = readZipEntry(file, maxSymlinkTargetLength); err == nil {
+				err = x.symlink(rel, target)
+			}
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = file.Open(); err == nil {
+				err = x.writeFile(rel, rc, mode)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readZipEntry 读取 zip 中的小条目（符号链接的内容即链接目标）
+func readZipEntry(file *zip.File, limit int64) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > limit {
+		return "", fmt.Errorf("symlink target of %s is too long", file.Name)
+	}
+	return string(data), nil
+}
+
+// extractor 安全解压：拒绝绝对路径和 ../ 等指向目标目录之外的条目，
+// 符号链接和硬链接只能指向目标目录内，不经过已解压的符号链接写入文件，并限制总大小和条目数量
+type extractor struct {
+	dest    string
+	opts    extractOptions
+	size    int64
+	entries int
+}
+
+// newExtractor 创建解压器并确保目标目录存在
+func newExtractor(destPath string, opts extractOptions) (*extractor, error) {
+	dest, err := filepath.Abs(destPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	if opts.maxSize <= 0 {
+		opts.maxSize = defaultExtractMaxSize
+	}
+	if opts.maxEntries <= 0 {
+		opts.maxEntries = defaultExtractMaxEntries
+	}
+	return &extractor{dest: dest, opts: opts}, nil
+}
+
+// count 统计条目数量，超过上限时返回错误
+func (x *extractor) count() error {
+	x.entries++
+	if x.entries > x.opts.maxEntries {
+		return fmt.Errorf("archive has more than %d entries", x.opts.maxEntries)
+	}
+	return nil
+}
+
+// entryPath 校验条目名称并去掉前导目录，返回相对目标目录的路径（空串表示跳过该条目）
+func (x *extractor) entryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+
+	parts := strings.Split(clean, "/")
+	if len(parts) <= x.opts.stripComponents {
+		return "", nil
+	}
+	rel := filepath.FromSlash(strings.Join(parts[x.opts.stripComponents:], "/"))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	return rel, nil
+}
+
+// checkParents 确认路径的各级父目录都不是符号链接，避免经由链接写到目标目录之外
+func (x *extractor) checkParents(rel string) error {
+	dir := x.dest
+	parent := filepath.Dir(rel)
+	if parent == "." {
+		return nil
+	}
+	for _, part := range strings.Split(parent, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("unsafe path in archive: %s goes through a symlink", filepath.ToSlash(rel))
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid path in archive: %s is not a directory", filepath.ToSlash(filepath.Dir(rel)))
+		}
+	}
+	return nil
+}
+
+// prepare 创建父目录并移除已存在的同名文件或链接，返回目标的绝对路径
+func (x *extractor) prepare(rel string) (string, error) {
+	if err := x.checkParents(rel); err != nil {
+		return "", err
+	}
+	target := filepath.Join(x.dest, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		if err := os.Remove(target); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// mkdir 创建目录
+func (x *extractor) mkdir(rel string) error {
+	target, err := x.prepare(rel)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// writeFile 写入普通文件，只保留权限位（去掉 setuid 等），超过总大小上限时返回错误
+func (x *extractor) writeFile(rel string, r io.Reader, mode os.FileMode) error {
+	target, err := x.prepare(rel)
+	if err != nil {
+		return err
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+
+	// O_EXCL：目标已在 prepare 中移除，不会跟随任何链接
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, x.opts.maxSize-x.size+1))
+	x.size += n
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if x.size > x.opts.maxSize {
+		out.Close()
+		return fmt.Errorf("archive exceeds the size limit of %d MB", x.opts.maxSize>>20)
+	}
+	return out.Close()
+}
+
+// symlink 创建符号链接，链接目标必须是目标目录内的相对路径
+func (x *extractor) symlink(rel, linkname string) error {
+	linkname = filepath.FromSlash(strings.ReplaceAll(linkname, "\\", "/"))
+	if !safeLinkTarget(rel, linkname) {
+		return fmt.Errorf("unsafe symlink in archive: %s -> %s", filepath.ToSlash(rel), filepath.ToSlash(linkname))
+	}
+	target, err := x.prepare(rel)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		// Windows 没有权限创建符号链接时复制链接指向的文件
+		source := filepath.Join(filepath.Dir(target), linkname)
+		if info, statErr := os.Lstat(source); runtime.GOOS == "windows" && statErr == nil && info.Mode().IsRegular() {
+			return copyFile(source, target, info.Mode().Perm())
+		}
+		return err
+	}
+	return nil
+}
+
+// safeLinkTarget 判断链接目标是否留在目标目录内：必须是相对路径，".." 只能出现在开头，且不超过链接所在目录的层数。
+// 中间的 ".." 会在符号链接解析后的位置上回退（如 l2 -> . 之后的 l1 -> l2/.. 指向目标目录的上一级），
+// 按字面清理路径无法发现，而且经过的符号链接可能在之后的条目中才创建，因此一律拒绝。
+// 链接所在目录不会是符号链接（checkParents），其余符号链接同样满足这些条件，所以逐级解析后仍在目标目录内
+func safeLinkTarget(rel, linkname string) bool {
+	if linkname == "" || filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return false
+	}
+	depth := 0
+	if dir := filepath.Dir(rel); dir != "." {
+		depth = len(strings.Split(dir, string(filepath.Separator)))
+	}
+	descended := false
+	for _, part := range strings.Split(linkname, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+		case "..":
+			if descended || depth == 0 {
+				return false
+			}
+			depth--
+		default:
+			descended = true
+		}
+	}
+	return filepath.IsLocal(filepath.Join(filepath.Dir(rel), linkname))
+}
+
+// hardlink 处理硬链接：复制归档中已解压的文件（只允许指向目标目录内的普通文件）
+func (x *extractor) hardlink(rel, linkname string) error {
+	sourceRel, err := x.entryPath(linkname)
+	if err != nil || sourceRel == "" {
+		return fmt.Errorf("unsafe hardlink in archive: %s -> %s", filepath.ToSlash(rel), linkname)
+	}
+	if err := x.checkParents(sourceRel); err != nil {
+		return err
+	}
+	source := filepath.Join(x.dest, sourceRel)
+	info, err := os.Lstat(source)
+	if err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("invalid hardlink in archive: %s -> %s", filepath.ToSlash(rel), linkname)
+	}
+
+	x.size += info.Size()
+	if x.size > x.opts.maxSize {
+		return fmt.Errorf("archive exceeds the size limit of %d MB", x.opts.maxSize>>20)
+	}
+	target, err := x.prepare(rel)
+	if err != nil {
+		return err
+	}
+	return copyFile(source, target, info.Mode().Perm())
+}
+
+// localArchiveFormat 根据文件扩展名判断本地安装包的格式，非归档文件视为单个二进制
+func localArchiveFormat(path string) string {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	}
+	return "binary"
+}
+
+// copyFile 复制文件（目标文件已存在时覆盖）
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
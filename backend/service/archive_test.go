@@ -0,0 +1,306 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// archiveEntry 测试归档中的一个条目
+type archiveEntry struct {
+	name string
+	body string
+	link string // 符号链接或硬链接的目标
+	kind byte   // tar.TypeReg、TypeDir、TypeSymlink 或 TypeLink
+}
+
+func entryFile(name, body string) archiveEntry {
+	return archiveEntry{name: name, body: body, kind: tar.TypeReg}
+}
+
+func entryDir(name string) archiveEntry {
+	return archiveEntry{name: name, kind: tar.TypeDir}
+}
+
+func entrySymlink(name, link string) archiveEntry {
+	return archiveEntry{name: name, link: link, kind: tar.TypeSymlink}
+}
+
+func entryHardlink(name, link string) archiveEntry {
+	return archiveEntry{name: name, link: link, kind: tar.TypeLink}
+}
+
+// writeTarGz 生成 tar.gz 归档
+func writeTarGz(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.kind, Mode: 0755}
+		if e.kind == tar.TypeReg {
+			header.Mode = 0644
+			header.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeZip 生成 zip 归档（zip 没有硬链接）
+func writeZip(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch e.kind {
+		case tar.TypeDir:
+			header.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			header.SetMode(os.ModeSymlink | 0777)
+			body = e.link
+		case tar.TypeLink:
+			t.Fatalf("zip has no hardlinks: %s", e.name)
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		opts    extractOptions
+		noZip   bool              // 含硬链接，只测试 tar.gz
+		links   bool              // 含符号链接（Windows 上可能没有权限创建）
+		wantErr string            // 为空时期望解压成功
+		want    map[string]string // 解压成功后期望的文件内容（相对目标目录）
+	}{
+		{
+			name:    "regular files and directories",
+			entries: []archiveEntry{entryDir("bin/"), entryFile("bin/app", "binary"), entryFile("static/index.html", "<html>")},
+			want:    map[string]string{"bin/app": "binary", "static/index.html": "<html>"},
+		},
+		{
+			name:    "strip components",
+			entries: []archiveEntry{entryDir("go-rag/"), entryFile("go-rag/go-rag", "binary"), entryFile("go-rag/static/app.js", "js")},
+			opts:    extractOptions{stripComponents: 1},
+			want:    map[string]string{"go-rag": "binary", "static/app.js": "js"},
+		},
+		{
+			name:    "parent directory entry",
+			entries: []archiveEntry{entryFile("../evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "parent directory inside the path",
+			entries: []archiveEntry{entryFile("bin/../../evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{entryFile("/tmp/evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "windows drive path",
+			entries: []archiveEntry{entryFile("C:/evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "windows separators",
+			entries: []archiveEntry{entryFile("..\\evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "relative symlink inside dest",
+			entries: []archiveEntry{entryFile("lib/libfoo.so.1", "lib"), entrySymlink("lib/libfoo.so", "libfoo.so.1"), entrySymlink("bin/foo", "../lib/libfoo.so")},
+			links:   true,
+			want:    map[string]string{"lib/libfoo.so": "lib", "bin/foo": "lib"},
+		},
+		{
+			name:    "symlink to dest itself",
+			entries: []archiveEntry{entrySymlink("self", "."), entryFile("a", "a")},
+			links:   true,
+			want:    map[string]string{"self/a": "a"},
+		},
+		{
+			name:    "absolute symlink",
+			entries: []archiveEntry{entrySymlink("evil", "/etc/passwd")},
+			links:   true,
+			wantErr: "unsafe symlink",
+		},
+		{
+			name:    "symlink out of dest",
+			entries: []archiveEntry{entrySymlink("bin/evil", "../../outside")},
+			links:   true,
+			wantErr: "unsafe symlink",
+		},
+		{
+			name:    "chained symlinks",
+			entries: []archiveEntry{entrySymlink("l2", "."), entrySymlink("l1", "l2/.."), entryFile("l1/outside", "x")},
+			links:   true,
+			wantErr: "unsafe symlink",
+		},
+		{
+			name:    "chained symlink created afterwards",
+			entries: []archiveEntry{entrySymlink("l1", "l2/.."), entrySymlink("l2", "."), entryFile("l1/outside", "x")},
+			links:   true,
+			wantErr: "unsafe symlink",
+		},
+		{
+			name:    "chained symlink in a subdirectory",
+			entries: []archiveEntry{entrySymlink("a/l2", "."), entrySymlink("a/l1", "l2/../.."), entryFile("a/l1/outside", "x")},
+			links:   true,
+			wantErr: "unsafe symlink",
+		},
+		{
+			name:    "write through symlink",
+			entries: []archiveEntry{entryDir("sub/"), entrySymlink("link", "sub"), entryFile("link/file", "x")},
+			links:   true,
+			wantErr: "goes through a symlink",
+		},
+		{
+			name:    "hardlink inside dest",
+			entries: []archiveEntry{entryFile("bin/app", "binary"), entryHardlink("bin/app2", "bin/app")},
+			noZip:   true,
+			want:    map[string]string{"bin/app": "binary", "bin/app2": "binary"},
+		},
+		{
+			name:    "hardlink out of dest",
+			entries: []archiveEntry{entryHardlink("passwd", "../../etc/passwd")},
+			noZip:   true,
+			wantErr: "unsafe hardlink",
+		},
+		{
+			name:    "absolute hardlink",
+			entries: []archiveEntry{entryHardlink("passwd", "/etc/passwd")},
+			noZip:   true,
+			wantErr: "unsafe hardlink",
+		},
+		{
+			name:    "hardlink to symlink",
+			entries: []archiveEntry{entrySymlink("self", "."), entryHardlink("copy", "self")},
+			noZip:   true,
+			links:   true,
+			wantErr: "invalid hardlink",
+		},
+		{
+			name:    "hardlink through symlink",
+			entries: []archiveEntry{entryDir("sub/"), entryFile("sub/a", "a"), entrySymlink("link", "sub"), entryHardlink("copy", "link/a")},
+			noZip:   true,
+			links:   true,
+			wantErr: "goes through a symlink",
+		},
+		{
+			name:    "size bomb",
+			entries: []archiveEntry{entryFile("a", strings.Repeat("x", 600)), entryFile("b", strings.Repeat("x", 600))},
+			opts:    extractOptions{maxSize: 1000},
+			wantErr: "size limit",
+		},
+		{
+			name:    "size bomb with hardlinks",
+			entries: []archiveEntry{entryFile("a", strings.Repeat("x", 600)), entryHardlink("b", "a")},
+			opts:    extractOptions{maxSize: 1000},
+			noZip:   true,
+			wantErr: "size limit",
+		},
+		{
+			name:    "entry count bomb",
+			entries: []archiveEntry{entryFile("a", ""), entryFile("b", ""), entryFile("c", ""), entryFile("d", "")},
+			opts:    extractOptions{maxEntries: 3},
+			wantErr: "more than 3 entries",
+		},
+	}
+
+	formats := []struct {
+		name    string
+		write   func(*testing.T, string, []archiveEntry)
+		extract func(string, string, extractOptions) error
+	}{
+		{"tar.gz", writeTarGz, extractTarGz},
+		{"zip", writeZip, extractZip},
+	}
+
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				if tt.noZip && format.name == "zip" {
+					t.Skip("zip has no hardlinks")
+				}
+				if tt.links && runtime.GOOS == "windows" {
+					t.Skip("symlinks need extra privileges on Windows")
+				}
+
+				root := t.TempDir()
+				archive := filepath.Join(root, "archive")
+				dest := filepath.Join(root, "dest")
+				format.write(t, archive, tt.entries)
+
+				err := format.extract(archive, dest, tt.opts)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("extract error = %v, want %q", err, tt.wantErr)
+					}
+				} else if err != nil {
+					t.Fatalf("extract: %v", err)
+				}
+
+				// 任何情况下都不能在目标目录之外留下文件
+				names, err := os.ReadDir(root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range names {
+					if entry.Name() != "archive" && entry.Name() != "dest" {
+						t.Errorf("file written outside dest: %s", entry.Name())
+					}
+				}
+
+				for rel, want := range tt.want {
+					got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+					if err != nil {
+						t.Errorf("read %s: %v", rel, err)
+					} else if string(got) != want {
+						t.Errorf("%s = %q, want %q", rel, got, want)
+					}
+				}
+			})
+		}
+	}
+}
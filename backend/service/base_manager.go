@@ -2,38 +2,156 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
 )
 
+// 重启相关常量
+const (
+	maxRestartHistory = 20          // 保留的重启记录条数
+	restartResetAfter = time.Minute // 进程稳定运行超过该时长后重置连续重启计数
+	crashLogLines     = 20          // 崩溃事件中附带的最近日志行数
+)
+
+// 停止相关常量
+const (
+	defaultStopTimeout = 10 * time.Second       // 默认优雅退出宽限期
+	stopPollInterval   = 200 * time.Millisecond // 宽限期内检查进程是否退出的间隔
+	killWaitTimeout    = 5 * time.Second        // 强制结束后等待进程退出的时间
+	outputWaitDelay    = 2 * time.Second        // 进程退出后等待输出读取完毕的时间
+)
+
+// 进程停止方式
+const (
+	StopGraceful = "graceful" // 收到终止信号后自行退出
+	StopKilled   = "killed"   // 超过宽限期被强制结束
+)
+
+// ServiceEventCallback 服务事件回调函数（service:crashed / service:restarted）
+type ServiceEventCallback func(event string, data map[string]interface{})
+
+// RestartPolicy 进程意外退出后的重启策略
+type RestartPolicy struct {
+	Policy      string        `json:"policy"`      // never / on-failure / always
+	MaxRestarts int           `json:"maxRestarts"` // 最大连续重启次数
+	Backoff     time.Duration `json:"backoff"`     // 首次重启前的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration `json:"maxBackoff"`  // 最大等待时间
+}
+
+// RestartPolicyFromConfig 将配置转换为重启策略，配置为空时不重启
+func RestartPolicyFromConfig(cfg *config.RestartConfig) RestartPolicy {
+	if cfg == nil {
+		return RestartPolicy{Policy: "never"}
+	}
+	return RestartPolicy{
+		Policy:      cfg.Policy,
+		MaxRestarts: cfg.MaxRestarts,
+		Backoff:     time.Duration(cfg.Backoff) * time.Second,
+		MaxBackoff:  time.Duration(cfg.MaxBackoff) * time.Second,
+	}
+}
+
+// RestartEvent 一次意外退出的记录
+type RestartEvent struct {
+	Time      time.Time `json:"time"`
+	ExitCode  int       `json:"exitCode"`
+	Error     string    `json:"error,omitempty"`
+	Attempt   int       `json:"attempt"`   // 连续重启次数（0 表示未重启）
+	Restarted bool      `json:"restarted"` // 是否已成功重启
+}
+
 // BaseServiceManager 提供通用的服务管理功能
 type BaseServiceManager struct {
-	ctx         context.Context
-	serviceName string
-	cmd         *exec.Cmd
-	isRunning   bool
-	callback    ProgressCallback
-	done        chan struct{}
+	ctx           context.Context
+	serviceName   string
+	mu            sync.Mutex
+	cmd           *exec.Cmd
+	isRunning     bool
+	stopping      bool // 由 StopProcess 主动停止，退出时不触发重启
+	startedAt     time.Time
+	callback      ProgressCallback
+	eventCallback ServiceEventCallback
+	done          chan struct{}
+
+	restartPolicy  RestartPolicy
+	restartCount   int
+	restartHistory []RestartEvent
+	restartCancel  chan struct{} // 关闭以取消等待中的重启
+
+	stopTimeout time.Duration // 优雅退出宽限期
+	lastStop    string        // 最近一次停止的方式（graceful / killed）
+	pidFile     string        // PID 文件路径，为空时不写入
+	logs        *ServiceLog   // 进程输出日志，为空时不捕获
 }
 
 // NewBaseServiceManager 创建基础服务管理器
 func NewBaseServiceManager(ctx context.Context, serviceName string) *BaseServiceManager {
 	return &BaseServiceManager{
-		ctx:         ctx,
-		serviceName: serviceName,
+		ctx:           ctx,
+		serviceName:   serviceName,
+		restartPolicy: RestartPolicy{Policy: "never"},
+		stopTimeout:   defaultStopTimeout,
 	}
 }
 
+// ServiceName 返回服务显示名称
+func (b *BaseServiceManager) ServiceName() string {
+	return b.serviceName
+}
+
 // SetProgressCallback 设置进度回调函数
 func (b *BaseServiceManager) SetProgressCallback(callback ProgressCallback) {
 	b.callback = callback
 }
 
+// SetEventCallback 设置服务事件回调函数
+func (b *BaseServiceManager) SetEventCallback(callback ServiceEventCallback) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.eventCallback = callback
+}
+
+// SetRestartPolicy 设置进程意外退出后的重启策略
+func (b *BaseServiceManager) SetRestartPolicy(policy RestartPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.restartPolicy = policy
+}
+
+// SetStopTimeout 设置停止时等待优雅退出的宽限期（秒），0 表示使用默认值
+func (b *BaseServiceManager) SetStopTimeout(seconds int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if seconds <= 0 {
+		b.stopTimeout = defaultStopTimeout
+		return
+	}
+	b.stopTimeout = time.Duration(seconds) * time.Second
+}
+
+// SetLog 设置进程输出日志，未指定 Stdout/Stderr 的进程输出会写入该日志
+func (b *BaseServiceManager) SetLog(logs *ServiceLog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logs = logs
+}
+
+// Logs 返回进程输出日志（未设置时为 nil）
+func (b *BaseServiceManager) Logs() *ServiceLog {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logs
+}
+
 // NotifyProgress 通知进度
 func (b *BaseServiceManager) NotifyProgress(downloaded, total int64, percent float64, status string) {
 	if b.callback != nil {
@@ -43,9 +161,18 @@ func (b *BaseServiceManager) NotifyProgress(downloaded, total int64, percent flo
 
 // IsRunning 检查服务是否正在运行
 func (b *BaseServiceManager) IsRunning() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	return b.isRunning && b.cmd != nil && b.cmd.Process != nil
 }
 
+// RestartPending 检查是否有等待中的自动重启
+func (b *BaseServiceManager) RestartPending() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.restartCancel != nil
+}
+
 // CheckTCPHealth 检查 TCP 端口健康状态
 func (b *BaseServiceManager) CheckTCPHealth(address string) error {
 	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
@@ -58,7 +185,8 @@ func (b *BaseServiceManager) CheckTCPHealth(address string) error {
 
 // CheckHTTPHealth 检查 HTTP 端点健康状态
 func (b *BaseServiceManager) CheckHTTPHealth(url string) error {
-	resp, err := http.Get(url)
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(url)
 	if err != nil {
 		return fmt.Errorf("health check failed: %w", err)
 	}
@@ -92,70 +220,381 @@ func (b *BaseServiceManager) WaitForHealth(timeout time.Duration, healthChecker
 	}
 }
 
-// StartProcess 启动进程（通用方法）
+// StartProcess 启动进程（通用方法），手动启动会重置连续重启计数
 func (b *BaseServiceManager) StartProcess(cmd *exec.Cmd, processName string) error {
-	b.cmd = cmd
-	b.done = make(chan struct{})
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cancelPendingRestart()
+	b.restartCount = 0
+	return b.startLocked(cmd, processName)
+}
 
+// startLocked 启动进程并在后台等待其退出（调用方需持有锁）
+func (b *BaseServiceManager) startLocked(cmd *exec.Cmd, processName string) error {
+	// 独立进程组：停止时信号会送达子进程派生的所有进程
+	setProcessGroup(cmd)
+	logs := b.logs
+	if logs != nil {
+		if cmd.Stdout == nil {
+			cmd.Stdout = logs.Writer(LogStreamStdout)
+		}
+		if cmd.Stderr == nil {
+			cmd.Stderr = logs.Writer(LogStreamStderr)
+		}
+	}
+	// 子进程派生的进程可能继承输出管道，限制进程退出后等待输出的时间
+	if cmd.WaitDelay == 0 {
+		cmd.WaitDelay = outputWaitDelay
+	}
 	if err := cmd.Start(); err != nil {
+		if logs != nil {
+			logs.Systemf("failed to start %s: %v", processName, err)
+		}
 		return fmt.Errorf("failed to start %s: %w", processName, err)
 	}
+	if logs != nil {
+		logs.Systemf("%s started (PID: %d)", processName, cmd.Process.Pid)
+	}
 
+	done := make(chan struct{})
+	b.cmd = cmd
+	b.done = done
 	b.isRunning = true
+	b.stopping = false
+	b.startedAt = time.Now()
 	g.Log().Infof(b.ctx, "%s started successfully (PID: %d)", processName, cmd.Process.Pid)
 
+	pidFile := b.pidFile
+	if pidFile != "" {
+		if err := writePIDFile(pidFile, cmd); err != nil {
+			g.Log().Warningf(b.ctx, "Failed to write pid file for %s: %v", processName, err)
+		}
+	}
+
 	// 在后台等待进程结束
 	go func(name string, process *exec.Cmd) {
-		if err := process.Wait(); err != nil {
+		err := process.Wait()
+
+		b.mu.Lock()
+		stopping := b.stopping
+		if b.cmd == process {
+			b.isRunning = false
+		}
+		b.mu.Unlock()
+		if pidFile != "" {
+			os.Remove(pidFile)
+		}
+		close(done)
+
+		// 进程组组长退出后，回收其遗留的子进程
+		reapProcessGroup(process.Process)
+
+		if logs != nil {
+			if err != nil {
+				logs.Systemf("%s exited: %v", name, err)
+			} else {
+				logs.Systemf("%s exited", name)
+			}
+		}
+
+		if stopping {
+			g.Log().Infof(context.Background(), "%s process stopped", name)
+			return
+		}
+		if err != nil {
 			g.Log().Warningf(context.Background(), "%s process exited with error: %v", name, err)
 		} else {
 			g.Log().Infof(context.Background(), "%s process exited normally", name)
 		}
-		b.isRunning = false
-		close(b.done)
+		b.handleExit(process, err, name)
 	}(processName, cmd)
 
 	return nil
 }
 
-// StopProcess 停止进程（通用方法）
+// handleExit 处理进程的意外退出：记录历史、通知前端，并按策略决定是否重启
+func (b *BaseServiceManager) handleExit(process *exec.Cmd, exitErr error, processName string) {
+	b.mu.Lock()
+
+	exitCode := -1
+	if process.ProcessState != nil {
+		exitCode = process.ProcessState.ExitCode()
+	}
+
+	// 稳定运行一段时间后视为恢复，重新计算连续重启次数
+	if time.Since(b.startedAt) > restartResetAfter {
+		b.restartCount = 0
+	}
+
+	policy := b.restartPolicy
+	shouldRestart := policy.Policy == "always" || (policy.Policy == "on-failure" && exitErr != nil)
+	if shouldRestart && b.restartCount >= policy.MaxRestarts {
+		g.Log().Warningf(b.ctx, "%s exited %d times in a row, giving up restarting", processName, b.restartCount)
+		shouldRestart = false
+	}
+
+	event := RestartEvent{
+		Time:     time.Now(),
+		ExitCode: exitCode,
+	}
+	if exitErr != nil {
+		event.Error = exitErr.Error()
+	}
+	if shouldRestart {
+		b.restartCount++
+		event.Attempt = b.restartCount
+	}
+	b.recordRestart(event)
+
+	backoff := restartBackoff(policy, b.restartCount)
+	var cancel chan struct{}
+	if shouldRestart {
+		cancel = make(chan struct{})
+		b.restartCancel = cancel
+	}
+	attempt := b.restartCount
+	b.mu.Unlock()
+
+	data := map[string]interface{}{
+		"service":     b.serviceName,
+		"exitCode":    exitCode,
+		"willRestart": shouldRestart,
+		"attempt":     attempt,
+	}
+	if exitErr != nil {
+		data["error"] = exitErr.Error()
+	}
+	if shouldRestart {
+		data["backoff"] = backoff.String()
+	}
+	if logs := b.Logs(); logs != nil {
+		data["logs"] = logs.TailText(crashLogLines)
+	}
+	b.emitEvent("service:crashed", data)
+
+	if !shouldRestart {
+		return
+	}
+
+	g.Log().Infof(b.ctx, "Restarting %s in %s (attempt %d/%d)", processName, backoff, attempt, policy.MaxRestarts)
+	select {
+	case <-time.After(backoff):
+	case <-cancel:
+		g.Log().Infof(b.ctx, "Pending restart of %s cancelled", processName)
+		return
+	}
+
+	b.mu.Lock()
+	if b.restartCancel != cancel {
+		// 等待期间已被手动启动或停止
+		b.mu.Unlock()
+		return
+	}
+	b.restartCancel = nil
+	err := b.startLocked(cloneCommand(process), processName)
+	pid := 0
+	if err == nil {
+		b.markRestarted()
+		pid = b.cmd.Process.Pid
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		g.Log().Errorf(b.ctx, "Failed to restart %s: %v", processName, err)
+		b.emitEvent("service:crashed", map[string]interface{}{
+			"service":     b.serviceName,
+			"exitCode":    -1,
+			"error":       err.Error(),
+			"willRestart": false,
+			"attempt":     attempt,
+		})
+		return
+	}
+
+	b.emitEvent("service:restarted", map[string]interface{}{
+		"service": b.serviceName,
+		"attempt": attempt,
+		"pid":     pid,
+	})
+}
+
+// recordRestart 追加一条重启记录（调用方需持有锁）
+func (b *BaseServiceManager) recordRestart(event RestartEvent) {
+	b.restartHistory = append(b.restartHistory, event)
+	if len(b.restartHistory) > maxRestartHistory {
+		b.restartHistory = b.restartHistory[len(b.restartHistory)-maxRestartHistory:]
+	}
+}
+
+// markRestarted 将最近一条记录标记为已重启（调用方需持有锁）
+func (b *BaseServiceManager) markRestarted() {
+	if n := len(b.restartHistory); n > 0 {
+		b.restartHistory[n-1].Restarted = true
+	}
+}
+
+// cancelPendingRestart 取消等待中的重启（调用方需持有锁）
+func (b *BaseServiceManager) cancelPendingRestart() {
+	if b.restartCancel != nil {
+		close(b.restartCancel)
+		b.restartCancel = nil
+	}
+}
+
+// emitEvent 通知服务事件
+func (b *BaseServiceManager) emitEvent(event string, data map[string]interface{}) {
+	b.mu.Lock()
+	callback := b.eventCallback
+	b.mu.Unlock()
+
+	if callback != nil {
+		callback(event, data)
+	}
+}
+
+// restartBackoff 计算第 attempt 次重启前的等待时间（指数退避）
+func restartBackoff(policy RestartPolicy, attempt int) time.Duration {
+	backoff := policy.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// cloneCommand 基于已退出的命令构建一个相同配置的新命令（exec.Cmd 不能重复启动）
+func cloneCommand(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
+	clone.Dir = cmd.Dir
+	clone.Env = cmd.Env
+	clone.Stdin = cmd.Stdin
+	clone.Stdout = cmd.Stdout
+	clone.Stderr = cmd.Stderr
+	clone.SysProcAttr = cmd.SysProcAttr
+	return clone
+}
+
+// StopProcess 停止进程（通用方法），同时取消等待中的重启
+// 先发送终止信号并在宽限期内等待进程自行退出，超时后强制结束整个进程组
 func (b *BaseServiceManager) StopProcess(serviceName string) error {
+	b.mu.Lock()
+	hadPendingRestart := b.restartCancel != nil
+	b.cancelPendingRestart()
+
 	if !b.isRunning || b.cmd == nil || b.cmd.Process == nil {
+		b.mu.Unlock()
+		if hadPendingRestart {
+			g.Log().Infof(b.ctx, "%s stopped (pending restart cancelled)", serviceName)
+			return nil
+		}
 		return fmt.Errorf("%s is not running", serviceName)
 	}
 
-	g.Log().Infof(b.ctx, "Stopping %s...", serviceName)
+	b.stopping = true
+	cmd := b.cmd
+	done := b.done
+	timeout := b.stopTimeout
+	b.mu.Unlock()
 
-	if err := b.cmd.Process.Kill(); err != nil {
-		return fmt.Errorf("failed to stop %s: %w", serviceName, err)
+	method, err := stopGracefully(b.ctx, serviceName, cmd.Process, done, timeout)
+
+	b.mu.Lock()
+	b.isRunning = false
+	b.cmd = nil
+	b.lastStop = method
+	b.mu.Unlock()
+
+	if err != nil {
+		return err
 	}
+	b.emitEvent("service:stopped", map[string]interface{}{
+		"service": b.serviceName,
+		"method":  method,
+	})
+	return nil
+}
 
-	// 等待进程结束（最多 5 秒）
+// stopGracefully 发送终止信号并轮询等待进程退出，超过宽限期后强制结束，返回实际采用的停止方式
+func stopGracefully(ctx context.Context, serviceName string, process *os.Process, done <-chan struct{}, timeout time.Duration) (string, error) {
+	g.Log().Infof(ctx, "Stopping %s (grace period %s)...", serviceName, timeout)
+
+	// 进程可能已经自行退出（如 stdio 的 MCP 服务器在标准输入关闭后退出）
 	select {
-	case <-b.done:
-		g.Log().Infof(b.ctx, "%s stopped successfully", serviceName)
-	case <-time.After(5 * time.Second):
-		g.Log().Warningf(b.ctx, "%s did not stop gracefully within timeout", serviceName)
-		b.isRunning = false
+	case <-done:
+		g.Log().Infof(ctx, "%s stopped gracefully", serviceName)
+		return StopGraceful, nil
+	default:
 	}
 
-	b.cmd = nil
-	return nil
+	if err := terminateProcess(process); errors.Is(err, os.ErrProcessDone) {
+		<-done
+		g.Log().Infof(ctx, "%s stopped gracefully", serviceName)
+		return StopGraceful, nil
+	} else if err != nil {
+		g.Log().Warningf(ctx, "Failed to send terminate signal to %s: %v, killing it", serviceName, err)
+	} else {
+		ticker := time.NewTicker(stopPollInterval)
+		defer ticker.Stop()
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			select {
+			case <-done:
+				g.Log().Infof(ctx, "%s stopped gracefully", serviceName)
+				return StopGraceful, nil
+			case <-ticker.C:
+			}
+		}
+		g.Log().Warningf(ctx, "%s did not exit within %s, killing it", serviceName, timeout)
+	}
+
+	if err := killProcessGroup(process); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return StopKilled, fmt.Errorf("failed to stop %s: %w", serviceName, err)
+	}
+	select {
+	case <-done:
+		g.Log().Infof(ctx, "%s killed", serviceName)
+	case <-time.After(killWaitTimeout):
+		g.Log().Warningf(ctx, "%s did not exit after being killed", serviceName)
+	}
+	return StopKilled, nil
 }
 
 // GetStatus 获取服务状态（通用方法）
 func (b *BaseServiceManager) GetStatus(isInstalled bool, healthChecker func() error) map[string]interface{} {
+	running := b.IsRunning()
 	status := map[string]interface{}{
 		"installed": isInstalled,
-		"running":   b.IsRunning(),
+		"running":   running,
 		"healthy":   false,
 	}
 
-	if b.IsRunning() && healthChecker != nil {
+	if running && healthChecker != nil {
 		if err := healthChecker(); err == nil {
 			status["healthy"] = true
 		}
 	}
 
+	b.mu.Lock()
+	history := make([]RestartEvent, len(b.restartHistory))
+	copy(history, b.restartHistory)
+	status["restartPolicy"] = b.restartPolicy.Policy
+	status["restarts"] = b.restartCount
+	status["restartPending"] = b.restartCancel != nil
+	status["restartHistory"] = history
+	status["stopTimeout"] = int(b.stopTimeout / time.Second)
+	if b.logs != nil {
+		status["logPath"] = b.logs.Path()
+	}
+	if b.lastStop != "" {
+		status["lastStop"] = b.lastStop
+	}
+	b.mu.Unlock()
+
 	return status
 }
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// serviceEvent 测试中收到的服务事件
+type serviceEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// newTestBaseManager 创建记录服务事件的管理器
+func newTestBaseManager(t *testing.T, policy RestartPolicy) (*BaseServiceManager, <-chan serviceEvent) {
+	t.Helper()
+	b := NewBaseServiceManager(context.Background(), "test")
+	b.SetRestartPolicy(policy)
+	events := make(chan serviceEvent, 16)
+	b.SetEventCallback(func(event string, data map[string]interface{}) {
+		events <- serviceEvent{name: event, data: data}
+	})
+	return b, events
+}
+
+// shellCommand 返回执行 script 的命令，没有 sh 时跳过测试
+func shellCommand(t *testing.T, script string) *exec.Cmd {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	return exec.Command(sh, "-c", script)
+}
+
+// nextEvent 等待下一个服务事件
+func nextEvent(t *testing.T, events <-chan serviceEvent) serviceEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for a service event")
+		return serviceEvent{}
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	policy := RestartPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := restartBackoff(policy, tt.attempt); got != tt.want {
+			t.Errorf("restartBackoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+	if got := restartBackoff(RestartPolicy{}, 1); got != time.Second {
+		t.Errorf("restartBackoff without a backoff = %s, want 1s", got)
+	}
+}
+
+func TestRestartPolicyFromConfig(t *testing.T) {
+	if got := RestartPolicyFromConfig(nil); got.Policy != "never" {
+		t.Errorf("policy without config = %+v, want never", got)
+	}
+	got := RestartPolicyFromConfig(&config.RestartConfig{Policy: "always", MaxRestarts: 3, Backoff: 2, MaxBackoff: 30})
+	want := RestartPolicy{Policy: "always", MaxRestarts: 3, Backoff: 2 * time.Second, MaxBackoff: 30 * time.Second}
+	if got != want {
+		t.Errorf("policy = %+v, want %+v", got, want)
+	}
+}
+
+func TestProcessRestartOnFailure(t *testing.T) {
+	b, events := newTestBaseManager(t, RestartPolicy{Policy: "on-failure", MaxRestarts: 2, Backoff: 10 * time.Millisecond})
+	if err := b.StartProcess(shellCommand(t, "exit 3"), "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两次重启后放弃
+	for attempt := 1; attempt <= 2; attempt++ {
+		crashed := nextEvent(t, events)
+		if crashed.name != "service:crashed" || crashed.data["exitCode"] != 3 || crashed.data["willRestart"] != true || crashed.data["attempt"] != attempt {
+			t.Fatalf("event %d = %+v, want a crash that restarts", attempt, crashed)
+		}
+		if restarted := nextEvent(t, events); restarted.name != "service:restarted" || restarted.data["attempt"] != attempt {
+			t.Fatalf("event after crash %d = %+v, want service:restarted", attempt, restarted)
+		}
+	}
+	last := nextEvent(t, events)
+	if last.name != "service:crashed" || last.data["willRestart"] != false {
+		t.Fatalf("last event = %+v, want a crash without restart", last)
+	}
+
+	status := b.GetStatus(true, nil)
+	history := status["restartHistory"].([]RestartEvent)
+	if status["restarts"] != 2 || status["restartPending"] != false || len(history) != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	if !history[0].Restarted || !history[1].Restarted || history[2].Restarted || history[2].Attempt != 0 {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestProcessRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		script      string
+		wantRestart bool
+	}{
+		{"on-failure", "exit 0", false},
+		{"on-failure", "exit 1", true},
+		{"always", "exit 0", true},
+		{"never", "exit 1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.script, func(t *testing.T) {
+			// 退避足够长，重启停留在等待状态
+			b, events := newTestBaseManager(t, RestartPolicy{Policy: tt.policy, MaxRestarts: 1, Backoff: time.Hour})
+			if err := b.StartProcess(shellCommand(t, tt.script), "test"); err != nil {
+				t.Fatal(err)
+			}
+			crashed := nextEvent(t, events)
+			if crashed.name != "service:crashed" || crashed.data["willRestart"] != tt.wantRestart {
+				t.Fatalf("event = %+v, want willRestart %v", crashed, tt.wantRestart)
+			}
+			if b.RestartPending() != tt.wantRestart {
+				t.Errorf("RestartPending = %v, want %v", b.RestartPending(), tt.wantRestart)
+			}
+
+			// 停止会取消等待中的重启
+			err := b.StopProcess("test")
+			if tt.wantRestart && err != nil {
+				t.Errorf("StopProcess with a pending restart: %v", err)
+			}
+			if !tt.wantRestart && err == nil {
+				t.Error("StopProcess of an exited process succeeded")
+			}
+			if b.RestartPending() || b.IsRunning() {
+				t.Error("service still pending or running after stop")
+			}
+		})
+	}
+}
@@ -10,15 +10,19 @@ import (
 	"path/filepath"
 
 	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
 )
 
 // BinaryManager manages binaries lifecycle (embedded or local)
+// Each binary is a node in the ServiceOrchestrator graph; startup_order only lists which
+// binaries to run and breaks ties between binaries without dependencies
 type BinaryManager struct {
 	useEmbedded bool
 	binaries    embed.FS
 	binPath     string
-	processes   []*exec.Cmd
-	execOrder   []string
+	names       []string
+	dependsOn   map[string][]string
+	processes   map[string]*binaryProcess
 	cacheDir    string
 }
 
@@ -28,6 +32,9 @@ type BinariesConfig interface {
 	IsUseEmbedded() bool
 	GetBinPath() string
 	GetStartupOrder() []string
+	GetDependsOn() map[string][]string
+	GetRestart() *config.RestartConfig
+	GetStopTimeout() int
 }
 
 // NewBinaryManagerFromConfig creates a binary manager from config
@@ -52,6 +59,11 @@ func NewBinaryManagerFromConfig(cfg BinariesConfig, binaries embed.FS) (*BinaryM
 	if err != nil {
 		return nil, err
 	}
+	bm.dependsOn = cfg.GetDependsOn()
+	for _, process := range bm.processes {
+		process.SetRestartPolicy(RestartPolicyFromConfig(cfg.GetRestart()))
+		process.SetStopTimeout(cfg.GetStopTimeout())
+	}
 
 	// Log initialization mode
 	ctx := context.Background()
@@ -67,7 +79,7 @@ func NewBinaryManagerFromConfig(cfg BinariesConfig, binaries embed.FS) (*BinaryM
 // NewBinaryManager creates a new binary manager
 // If useEmbedded is true, binaries will be extracted from embed.FS
 // If useEmbedded is false, binaries will be loaded from binPath directory
-func NewBinaryManager(useEmbedded bool, binaries embed.FS, binPath string, execOrder []string) (*BinaryManager, error) {
+func NewBinaryManager(useEmbedded bool, binaries embed.FS, binPath string, names []string) (*BinaryManager, error) {
 	var cacheDir string
 
 	if useEmbedded {
@@ -96,38 +108,38 @@ func NewBinaryManager(useEmbedded bool, binaries embed.FS, binPath string, execO
 		g.Log().Infof(context.Background(), "Using local bin directory: %s", binPath)
 	}
 
-	return &BinaryManager{
+	bm := &BinaryManager{
 		useEmbedded: useEmbedded,
 		binaries:    binaries,
 		binPath:     binPath,
-		processes:   make([]*exec.Cmd, 0),
-		execOrder:   execOrder,
+		names:       names,
+		processes:   make(map[string]*binaryProcess),
 		cacheDir:    cacheDir,
-	}, nil
-}
-
-// StartAll starts all binaries in the specified order
-func (bm *BinaryManager) StartAll(ctx context.Context) error {
-	successCount := 0
-	for _, binaryName := range bm.execOrder {
-		if err := bm.startBinary(ctx, binaryName); err != nil {
-			g.Log().Warningf(ctx, "Failed to start %s: %v", binaryName, err)
-			// Continue with next binary instead of stopping
-			continue
+	}
+	for _, name := range names {
+		process := &binaryProcess{
+			BaseServiceManager: NewBaseServiceManager(context.Background(), name),
+			bm:                 bm,
+			name:               name,
 		}
-		successCount++
+		process.SetLog(NewServiceLog(name, filepath.Join(cacheDir, "logs", name+".log")))
+		bm.processes[name] = process
 	}
+	return bm, nil
+}
 
-	if successCount == 0 {
-		return fmt.Errorf("failed to start any binaries")
+// RegisterWith registers every binary with the orchestrator so they start with the other services
+func (bm *BinaryManager) RegisterWith(o *ServiceOrchestrator) {
+	ctx := context.Background()
+	for _, name := range bm.names {
+		if err := o.Register(name, bm.processes[name], bm.dependsOn[name], true); err != nil {
+			g.Log().Warningf(ctx, "Failed to register binary %s: %v", name, err)
+		}
 	}
-
-	g.Log().Infof(ctx, "Started %d/%d binaries successfully", successCount, len(bm.execOrder))
-	return nil
 }
 
-// startBinary extracts (if embedded) and starts a single binary
-func (bm *BinaryManager) startBinary(ctx context.Context, name string) error {
+// prepareBinary extracts (if embedded) a binary and returns its executable path
+func (bm *BinaryManager) prepareBinary(ctx context.Context, name string) (string, error) {
 	var executablePath string
 
 	if bm.useEmbedded {
@@ -135,13 +147,13 @@ func (bm *BinaryManager) startBinary(ctx context.Context, name string) error {
 		binaryPath := filepath.Join("bin", name)
 		data, err := fs.ReadFile(bm.binaries, binaryPath)
 		if err != nil {
-			return fmt.Errorf("failed to read embedded binary %s: %w", name, err)
+			return "", fmt.Errorf("failed to read embedded binary %s: %w", name, err)
 		}
 
 		// Extract to cache directory
 		executablePath = filepath.Join(bm.cacheDir, name)
 		if err := os.WriteFile(executablePath, data, 0755); err != nil {
-			return fmt.Errorf("failed to write binary %s: %w", name, err)
+			return "", fmt.Errorf("failed to write binary %s: %w", name, err)
 		}
 		g.Log().Infof(ctx, "Extracted %s to %s", name, executablePath)
 	} else {
@@ -150,7 +162,7 @@ func (bm *BinaryManager) startBinary(ctx context.Context, name string) error {
 
 		// Check if binary exists
 		if _, err := os.Stat(executablePath); err != nil {
-			return fmt.Errorf("binary %s not found at %s: %w", name, executablePath, err)
+			return "", fmt.Errorf("binary %s not found at %s: %w", name, executablePath, err)
 		}
 
 		// Ensure executable permission
@@ -161,42 +173,73 @@ func (bm *BinaryManager) startBinary(ctx context.Context, name string) error {
 		g.Log().Infof(ctx, "Using local binary: %s", executablePath)
 	}
 
-	// Run binary in background
-	cmd := exec.CommandContext(ctx, executablePath)
-	cmd.Dir = bm.cacheDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	return executablePath, nil
+}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start %s: %w", name, err)
+// Cleanup gracefully stops all managed processes that are still running
+func (bm *BinaryManager) Cleanup() {
+	ctx := context.Background()
+	// 按启动顺序的逆序停止，依赖方先退出
+	for i := len(bm.names) - 1; i >= 0; i-- {
+		name := bm.names[i]
+		process := bm.processes[name]
+		if !process.IsRunning() {
+			continue
+		}
+		if err := process.Stop(); err != nil {
+			g.Log().Warningf(ctx, "Failed to stop %s: %v", name, err)
+		}
 	}
+}
 
-	g.Log().Infof(ctx, "%s started successfully (PID: %d)", name, cmd.Process.Pid)
+// binaryProcess is a single binary run by BinaryManager
+type binaryProcess struct {
+	*BaseServiceManager
+	bm   *BinaryManager
+	name string
+}
 
-	// Save process reference
-	bm.processes = append(bm.processes, cmd)
+// IsInstalled reports whether the binary is available (embedded or in the local directory)
+func (p *binaryProcess) IsInstalled() bool {
+	if p.bm.useEmbedded {
+		_, err := fs.Stat(p.bm.binaries, filepath.ToSlash(filepath.Join("bin", p.name)))
+		return err == nil
+	}
+	_, err := os.Stat(filepath.Join(p.bm.cacheDir, p.name))
+	return err == nil
+}
 
-	// Wait for process in a goroutine
-	go func(processName string, process *exec.Cmd) {
-		if err := process.Wait(); err != nil {
-			g.Log().Warningf(context.Background(), "%s exited with error: %v", processName, err)
-		} else {
-			g.Log().Infof(context.Background(), "%s exited successfully", processName)
-		}
-	}(name, cmd)
+// Start extracts (if embedded) and starts the binary in background
+func (p *binaryProcess) Start() error {
+	if p.IsRunning() {
+		return fmt.Errorf("%s is already running", p.name)
+	}
 
-	return nil
+	executablePath, err := p.bm.prepareBinary(p.ctx, p.name)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executablePath)
+	cmd.Dir = p.bm.cacheDir
+
+	return p.StartProcess(cmd, p.name)
 }
 
-// Cleanup terminates all managed processes
-func (bm *BinaryManager) Cleanup() {
-	ctx := context.Background()
-	for i, cmd := range bm.processes {
-		if cmd.Process != nil {
-			g.Log().Infof(ctx, "Terminating process %d (PID: %d)", i, cmd.Process.Pid)
-			if err := cmd.Process.Kill(); err != nil {
-				g.Log().Warningf(ctx, "Failed to kill process %d: %v", i, err)
-			}
-		}
+// Stop stops the binary
+func (p *binaryProcess) Stop() error {
+	return p.StopProcess(p.name)
+}
+
+// CheckHealth treats a running process as healthy
+func (p *binaryProcess) CheckHealth() error {
+	if !p.IsRunning() {
+		return fmt.Errorf("%s is not running", p.name)
 	}
+	return nil
+}
+
+// GetStatus returns the binary status
+func (p *binaryProcess) GetStatus() map[string]interface{} {
+	return p.BaseServiceManager.GetStatus(p.IsInstalled(), p.CheckHealth)
 }
@@ -0,0 +1,489 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 离线安装包结构（tar.gz）：
+//
+//	manifest.json                               清单
+//	config.yaml                                 wachat 的配置（可选）
+//	services/<name>/<version>/...               各服务当前版本的安装文件
+//	services/<name>/config/<file>               服务自身的配置文件（如 go-rag 的 config.yaml）
+const (
+	bundleManifestName  = "manifest.json"
+	bundleConfigName    = "config.yaml"
+	bundleServicesDir   = "services"
+	bundleFormatVersion = 1
+)
+
+// BundleManifest 离线安装包清单
+type BundleManifest struct {
+	Format   int              `json:"format"`
+	Created  time.Time        `json:"created"`
+	OS       string           `json:"os"`
+	Arch     string           `json:"arch"`
+	Config   bool             `json:"config"` // 是否包含 wachat 的 config.yaml
+	Services []*BundleService `json:"services"`
+}
+
+// BundleService 安装包中的一个服务
+type BundleService struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	SHA256  string   `json:"sha256,omitempty"`  // 原始安装包的 SHA256（来自安装记录）
+	Digest  string   `json:"digest,omitempty"`  // 包中版本目录的摘要（见 bundleDigest），导入时校验
+	Configs []string `json:"configs,omitempty"` // 服务自身的配置文件
+}
+
+// bundleable 可以导出到离线安装包的服务
+type bundleable interface {
+	exportBundle(tw *tar.Writer) (*BundleService, error)
+	importBundle(root string, entry *BundleService) error
+}
+
+// ExportBundle 将已安装服务的当前版本、配置文件和清单打包为 tar.gz，
+// 可在其他同平台的机器上通过 ImportBundle 离线安装；wachatConfig 为空时不包含 wachat 配置
+func (o *ServiceOrchestrator) ExportBundle(bundlePath string, wachatConfig []byte) (*BundleManifest, error) {
+	tmpPath := bundlePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	manifest := &BundleManifest{
+		Format:  bundleFormatVersion,
+		Created: time.Now(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+	if len(wachatConfig) > 0 {
+		if err := addBytesToTar(tw, bundleConfigName, wachatConfig); err != nil {
+			return nil, err
+		}
+		manifest.Config = true
+	}
+
+	o.mu.Lock()
+	nodes := make([]*serviceNode, 0, len(o.order))
+	for _, name := range o.order {
+		nodes = append(nodes, o.nodes[name])
+	}
+	o.mu.Unlock()
+
+	for _, node := range nodes {
+		svc, ok := node.service.(bundleable)
+		if !ok {
+			continue
+		}
+		entry, err := svc.exportBundle(tw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", node.name, err)
+		}
+		if entry != nil {
+			manifest.Services = append(manifest.Services, entry)
+		}
+	}
+	if len(manifest.Services) == 0 {
+		return nil, fmt.Errorf("no installed services to export")
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addBytesToTar(tw, bundleManifestName, data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, bundlePath); err != nil {
+		return nil, err
+	}
+
+	g.Log().Infof(o.ctx, "Exported %d services to %s", len(manifest.Services), bundlePath)
+	return manifest, nil
+}
+
+// ImportBundle 导入离线安装包：各服务安装为新版本并切换（原版本保留用于回滚），
+// 返回清单以及包中的 wachat 配置（未包含时为 nil），是否应用配置由调用方决定
+func (o *ServiceOrchestrator) ImportBundle(bundlePath string) (*BundleManifest, []byte, error) {
+	root, err := os.MkdirTemp("", "wachat-bundle-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(root)
+
+	if err := extractTarGz(bundlePath, root, newExtractOptions(nil)); err != nil {
+		return nil, nil, fmt.Errorf("failed to extract bundle: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, bundleManifestName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a wachat bundle: %w", err)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if manifest.Format > bundleFormatVersion {
+		return nil, nil, fmt.Errorf("bundle format %d is newer than supported (%d)", manifest.Format, bundleFormatVersion)
+	}
+	if manifest.OS != runtime.GOOS || manifest.Arch != runtime.GOARCH {
+		return nil, nil, fmt.Errorf("bundle was built for %s/%s, this machine is %s/%s", manifest.OS, manifest.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	for _, entry := range manifest.Services {
+		node, err := o.Get(entry.Name)
+		if err != nil {
+			g.Log().Warningf(o.ctx, "Skipping %s from bundle: %v", entry.Name, err)
+			continue
+		}
+		svc, ok := node.(bundleable)
+		if !ok {
+			g.Log().Warningf(o.ctx, "Skipping %s from bundle: service cannot be installed from a bundle", entry.Name)
+			continue
+		}
+		if err := svc.importBundle(root, entry); err != nil {
+			return &manifest, nil, fmt.Errorf("failed to import %s: %w", entry.Name, err)
+		}
+	}
+
+	var wachatConfig []byte
+	if manifest.Config {
+		if wachatConfig, err = os.ReadFile(filepath.Join(root, bundleConfigName)); err != nil {
+			return &manifest, nil, fmt.Errorf("failed to read bundled config: %w", err)
+		}
+	}
+	return &manifest, wachatConfig, nil
+}
+
+// exportBundle 将当前版本和服务配置文件写入安装包，未安装或外部服务返回 nil
+func (m *ManagedService) exportBundle(tw *tar.Writer) (*BundleService, error) {
+	if m.Spec().External || !m.IsInstalled() {
+		return nil, nil
+	}
+
+	entry := &BundleService{Name: m.Spec().Name, Version: m.CurrentVersion()}
+	if record := m.InstallRecord(); record != nil {
+		entry.SHA256 = record.SHA256
+	}
+	if entry.Version != "" {
+		dir, err := m.versionDir(entry.Version)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Digest, err = dirDigest(dir); err != nil {
+			return nil, err
+		}
+		if err := addDirToTar(tw, dir, path.Join(bundleServicesDir, entry.Name, entry.Version)); err != nil {
+			return nil, err
+		}
+	} else {
+		// 旧版安装布局：安装目录中还有数据和日志，只导出二进制文件
+		binaryPath := m.getBinaryPath()
+		sum, err := fileSHA256(binaryPath)
+		if err != nil {
+			return nil, err
+		}
+		entry.Version = "local-" + sum[:12]
+		rel, err := filepath.Rel(m.Spec().InstallPath, binaryPath)
+		if err != nil {
+			return nil, err
+		}
+		digest := newBundleDigest()
+		if err := digest.addFile(filepath.ToSlash(rel), binaryPath); err != nil {
+			return nil, err
+		}
+		entry.Digest = digest.sum()
+		if err := addFileToTar(tw, binaryPath, path.Join(bundleServicesDir, entry.Name, entry.Version, filepath.ToSlash(rel))); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range m.configFiles {
+		file := filepath.Join(m.Spec().InstallPath, name)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if err := addFileToTar(tw, file, path.Join(bundleServicesDir, entry.Name, "config", name)); err != nil {
+			return nil, err
+		}
+		entry.Configs = append(entry.Configs, name)
+	}
+	return entry, nil
+}
+
+// importBundle 从解压后的安装包安装服务：校验后文件复制到版本目录再切换版本，
+// 服务配置文件只在安装目录中不存在时复制，不覆盖本机的修改
+func (m *ManagedService) importBundle(root string, entry *BundleService) error {
+	if m.Spec().External {
+		return fmt.Errorf("%s is managed externally", m.serviceName)
+	}
+	// 清单中的版本号用于拼接路径，在访问文件系统之前校验
+	dir, err := m.versionDir(entry.Version)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(root, bundleServicesDir, m.Spec().Name, entry.Version)
+	if err := m.verifyBundleEntry(src, entry); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Spec().InstallPath, 0755); err != nil {
+		return fmt.Errorf("failed to create install directory: %w", err)
+	}
+	for _, name := range entry.Configs {
+		if !slices.Contains(m.configFiles, name) {
+			g.Log().Warningf(m.ctx, "Skipping unexpected config file %q of %s in bundle", name, m.serviceName)
+			continue
+		}
+		target := filepath.Join(m.Spec().InstallPath, name)
+		if _, err := os.Stat(target); err == nil {
+			g.Log().Infof(m.ctx, "Keeping existing %s of %s", name, m.serviceName)
+			continue
+		}
+		if err := copyFile(filepath.Join(root, bundleServicesDir, m.Spec().Name, "config", name), target, 0644); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+
+	if entry.Version == m.CurrentVersion() {
+		g.Log().Infof(m.ctx, "%s %s is already installed", m.serviceName, entry.Version)
+		return nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clean version directory: %w", err)
+	}
+	if err := copyDir(src, dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if _, err := os.Stat(m.binaryPathIn(dir)); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("bundle does not contain the %s binary", m.serviceName)
+	}
+
+	g.Log().Infof(m.ctx, "%s %s imported from bundle", m.serviceName, entry.Version)
+	return m.switchVersion(entry.Version)
+}
+
+// verifyBundleEntry 校验包中的版本目录：内容与清单中的摘要一致，
+// 原始安装包的 SHA256 与配置中固定的值一致（离线导入无法获取发布的校验和）
+func (m *ManagedService) verifyBundleEntry(src string, entry *BundleService) error {
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("bundle does not contain %s %s", m.serviceName, entry.Version)
+	}
+	if entry.Digest == "" {
+		return fmt.Errorf("bundle has no digest for %s %s", m.serviceName, entry.Version)
+	}
+	digest, err := dirDigest(src)
+	if err != nil {
+		return err
+	}
+	if digest != entry.Digest {
+		return fmt.Errorf("digest mismatch for %s %s in bundle: expected %s, got %s", m.serviceName, entry.Version, entry.Digest, digest)
+	}
+
+	cfg := m.Spec().Verify
+	if cfg == nil {
+		return nil
+	}
+	expected := strings.ToLower(strings.TrimSpace(cfg.SHA256))
+	switch {
+	case expected != "" && expected != strings.ToLower(entry.SHA256):
+		return fmt.Errorf("checksum mismatch for %s %s in bundle: expected %s, got %q", m.serviceName, entry.Version, expected, entry.SHA256)
+	case expected == "" && cfg.Required:
+		return fmt.Errorf("%s requires a verified download, set verify.sha256 to import it from a bundle", m.serviceName)
+	}
+	return nil
+}
+
+// bundleDigest 版本目录的摘要：按路径顺序记录每个文件的 SHA256 和符号链接的目标
+type bundleDigest struct {
+	h hash.Hash
+}
+
+func newBundleDigest() *bundleDigest {
+	return &bundleDigest{h: sha256.New()}
+}
+
+// addFile 记录文件（rel 为 / 分隔的相对路径）
+func (d *bundleDigest) addFile(rel, file string) error {
+	sum, err := fileSHA256(file)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.h, "file %q %s\n", rel, sum)
+	return nil
+}
+
+// addSymlink 记录符号链接
+func (d *bundleDigest) addSymlink(rel, linkname string) {
+	fmt.Fprintf(d.h, "symlink %q %q\n", rel, filepath.ToSlash(linkname))
+}
+
+func (d *bundleDigest) sum() string {
+	return hex.EncodeToString(d.h.Sum(nil))
+}
+
+// dirDigest 计算目录的摘要（WalkDir 按路径顺序遍历，导出和导入的结果一致）
+func dirDigest(dir string) (string, error) {
+	digest := newBundleDigest()
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			linkname, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			digest.addSymlink(filepath.ToSlash(rel), linkname)
+		case d.Type().IsRegular():
+			return digest.addFile(filepath.ToSlash(rel), file)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", dir, err)
+	}
+	return digest.sum(), nil
+}
+
+// addDirToTar 将目录中的文件和符号链接以 prefix 为前缀写入 tar
+func addDirToTar(tw *tar.Writer, dir, prefix string) error {
+	return filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			// 如 Ollama 的 lib 目录中 libxxx.so -> libxxx.so.1
+			linkname, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return tw.WriteHeader(&tar.Header{
+				Name:     name,
+				Linkname: filepath.ToSlash(linkname),
+				Mode:     0777,
+				Typeflag: tar.TypeSymlink,
+			})
+		case d.Type().IsRegular():
+			return addFileToTar(tw, file, name)
+		}
+		return nil
+	})
+}
+
+// addFileToTar 将单个文件写入 tar（保留权限）
+func addFileToTar(tw *tar.Writer, file, name string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// addBytesToTar 将内存中的内容写入 tar
+func addBytesToTar(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// copyDir 递归复制目录（保留文件权限和符号链接）
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			linkname, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkname, target)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(file, target, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// writeTestBundleVersion 在解压后的安装包目录中放入服务的一个版本，返回清单条目
+func writeTestBundleVersion(t *testing.T, m *ManagedService, root, version string) *BundleService {
+	t.Helper()
+	src := filepath.Join(root, bundleServicesDir, m.Spec().Name, version)
+	binary := m.binaryPathIn(src)
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte("binary "+version), 0755); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := dirDigest(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BundleService{Name: m.Spec().Name, Version: version, Digest: digest}
+}
+
+func TestBundleExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := newTestManagedService(t, nil)
+	source.SetConfigFiles("config.yaml")
+	installTestVersion(t, source, "v1")
+	if err := source.activate("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source.Spec().InstallPath, "config.yaml"), []byte("port: 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewServiceOrchestrator(ctx)
+	if err := exporter.Register("app", source, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	manifest, err := exporter.ExportBundle(bundle, []byte("ai: {}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Services) != 1 || manifest.Services[0].Version != "v1" || manifest.Services[0].Digest == "" {
+		t.Fatalf("manifest services = %+v, want app v1 with a digest", manifest.Services)
+	}
+
+	target := newTestManagedService(t, nil)
+	target.SetConfigFiles("config.yaml")
+	importer := NewServiceOrchestrator(ctx)
+	if err := importer.Register("app", target, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	_, wachatConfig, err := importer.ImportBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(wachatConfig) != "ai: {}" {
+		t.Errorf("wachat config = %q", wachatConfig)
+	}
+	if target.CurrentVersion() != "v1" || !target.IsInstalled() {
+		t.Errorf("current version = %q, installed = %v, want v1 installed", target.CurrentVersion(), target.IsInstalled())
+	}
+	if data, err := os.ReadFile(filepath.Join(target.Spec().InstallPath, "config.yaml")); err != nil || string(data) != "port: 1" {
+		t.Errorf("service config = %q, %v", data, err)
+	}
+}
+
+func TestImportBundleRejectsUnsafeVersion(t *testing.T) {
+	m := newTestManagedService(t, nil)
+	installTestVersion(t, m, "v0")
+	if err := m.activate("v0"); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(m.Spec().InstallPath, "data.db")
+	if err := os.WriteFile(data, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	writeTestBundleVersion(t, m, root, "v1")
+	for _, version := range []string{"..", "", ".", "a/b", "../../outside"} {
+		err := m.importBundle(root, &BundleService{Name: "app", Version: version})
+		if err == nil || !strings.Contains(err.Error(), "invalid version") {
+			t.Errorf("importBundle(%q) = %v, want invalid version", version, err)
+		}
+	}
+	if _, err := os.Stat(data); err != nil {
+		t.Errorf("data removed: %v", err)
+	}
+	if got := m.InstalledVersions(); len(got) != 1 || got[0] != "v0" || m.CurrentVersion() != "v0" {
+		t.Errorf("versions = %v, current %s, want only v0", got, m.CurrentVersion())
+	}
+}
+
+func TestImportBundleVerifies(t *testing.T) {
+	const pinned = "0000000000000000000000000000000000000000000000000000000000000001"
+	tests := []struct {
+		name    string
+		verify  *config.VerifyConfig
+		modify  func(root string, entry *BundleService)
+		wantErr string
+	}{
+		{
+			name: "intact",
+		},
+		{
+			name: "modified file",
+			modify: func(root string, entry *BundleService) {
+				os.WriteFile(filepath.Join(root, bundleServicesDir, "app", "v1", "bin", "extra"), []byte("x"), 0644)
+			},
+			wantErr: "digest mismatch",
+		},
+		{
+			name:    "no digest",
+			modify:  func(root string, entry *BundleService) { entry.Digest = "" },
+			wantErr: "no digest",
+		},
+		{
+			name:    "missing version",
+			modify:  func(root string, entry *BundleService) { entry.Version = "v2" },
+			wantErr: "does not contain",
+		},
+		{
+			name:    "pinned checksum mismatch",
+			verify:  &config.VerifyConfig{SHA256: pinned},
+			modify:  func(root string, entry *BundleService) { entry.SHA256 = strings.Repeat("f", 64) },
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:   "pinned checksum",
+			verify: &config.VerifyConfig{SHA256: pinned},
+			modify: func(root string, entry *BundleService) { entry.SHA256 = pinned },
+		},
+		{
+			name:    "verification required",
+			verify:  &config.VerifyConfig{Required: true},
+			wantErr: "requires a verified download",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManagedService(t, &config.ManagedServiceConfig{Verify: tt.verify})
+			root := t.TempDir()
+			entry := writeTestBundleVersion(t, m, root, "v1")
+			if tt.modify != nil {
+				tt.modify(root, entry)
+			}
+			err := m.importBundle(root, entry)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("importBundle: %v", err)
+				}
+				if m.CurrentVersion() != "v1" {
+					t.Errorf("current version = %q, want v1", m.CurrentVersion())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("importBundle error = %v, want %q", err, tt.wantErr)
+			}
+			if m.CurrentVersion() != "" || len(m.InstalledVersions()) != 0 {
+				t.Errorf("rejected bundle was installed: current %q, versions %v", m.CurrentVersion(), m.InstalledVersions())
+			}
+		})
+	}
+}
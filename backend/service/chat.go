@@ -89,11 +89,12 @@ func (c *ChatService) GetConversation(id string) (*model.Conversation, error) {
 	}
 
 	return &model.Conversation{
-		ID:        dbConv.ID,
-		Title:     dbConv.Title,
-		Messages:  messages,
-		CreatedAt: time.Unix(dbConv.CreatedAt, 0),
-		UpdatedAt: time.Unix(dbConv.UpdatedAt, 0),
+		ID:         dbConv.ID,
+		Title:      dbConv.Title,
+		Messages:   messages,
+		MCPServers: splitMCPServers(dbConv.MCPServers),
+		CreatedAt:  time.Unix(dbConv.CreatedAt, 0),
+		UpdatedAt:  time.Unix(dbConv.UpdatedAt, 0),
 	}, nil
 }
 
@@ -107,11 +108,12 @@ func (c *ChatService) ListConversations() ([]*model.Conversation, error) {
 	convs := make([]*model.Conversation, 0, len(dbConvs))
 	for _, dbConv := range dbConvs {
 		convs = append(convs, &model.Conversation{
-			ID:        dbConv.ID,
-			Title:     dbConv.Title,
-			Messages:  make([]*schema.Message, 0), // Don't load messages for list view
-			CreatedAt: time.Unix(dbConv.CreatedAt, 0),
-			UpdatedAt: time.Unix(dbConv.UpdatedAt, 0),
+			ID:         dbConv.ID,
+			Title:      dbConv.Title,
+			Messages:   make([]*schema.Message, 0), // Don't load messages for list view
+			MCPServers: splitMCPServers(dbConv.MCPServers),
+			CreatedAt:  time.Unix(dbConv.CreatedAt, 0),
+			UpdatedAt:  time.Unix(dbConv.UpdatedAt, 0),
 		})
 	}
 	return convs, nil
@@ -134,6 +136,29 @@ func (c *ChatService) UpdateConversationTitle(id, title string) error {
 	return c.convRepo.Update(dbConv)
 }
 
+// UpdateConversationMCPServers sets the MCP servers enabled for a conversation
+func (c *ChatService) UpdateConversationMCPServers(id string, servers []string) error {
+	dbConv, err := c.convRepo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	dbConv.MCPServers = strings.Join(servers, ",")
+	dbConv.UpdatedAt = time.Now().Unix()
+	return c.convRepo.Update(dbConv)
+}
+
+// splitMCPServers parses the comma separated MCP server list stored in database
+func splitMCPServers(value string) []string {
+	servers := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			servers = append(servers, name)
+		}
+	}
+	return servers
+}
+
 // SaveMessage saves a message to database
 func (c *ChatService) SaveMessage(conversationID string, msg *schema.Message) error {
 	dbMsg := &model.DBMessage{
@@ -287,7 +312,7 @@ func (c *ChatService) SendMessageStream(conversationID, content string, eventCal
 	assistantContent := ""
 
 	go func() {
-		docs, err := c.aiService.StreamResponse(conv.Messages, responseChan, true)
+		docs, err := c.aiService.StreamResponse(conv.Messages, responseChan, true, WithMCPServers(conv.MCPServers...))
 		resultChan <- streamResult{docs: docs, err: err}
 	}()
 
@@ -333,15 +358,17 @@ func (c *ChatService) SendMessageStream(conversationID, content string, eventCal
 			streamEndData["ragDocuments"] = result.docs
 		}
 
-		eventCallback("stream:end", streamEndData)
-
-		// Check for streaming error
+		// Report a streaming error before stream:end, so that listeners which stop at stream:end
+		// (e.g. the CLI) see it; the partial answer is still saved and delivered with stream:end
 		if result.err != nil {
+			streamEndData["error"] = result.err.Error()
 			eventCallback("stream:error", map[string]interface{}{
 				"conversationId": conversationID,
 				"error":          result.err.Error(),
 			})
 		}
+
+		eventCallback("stream:end", streamEndData)
 	}()
 
 	return nil
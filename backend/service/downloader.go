@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// 下载相关默认值
+const (
+	defaultDownloadTimeout = 30 * time.Second
+	defaultDownloadRetries = 3
+	maxRetryBackoff        = 30 * time.Second
+	partFileSuffix         = ".part"
+	partInfoSuffix         = ".json" // 记录 .part 文件来源的附属文件（name.part.json）
+)
+
+// ErrDownloadCanceled 下载被取消
+var ErrDownloadCanceled = errors.New("download canceled")
+
+var (
+	downloaderMu      sync.RWMutex
+	defaultDownloader = NewDownloader(nil)
+)
+
+// SetDownloadConfig 应用共享下载器的超时、重试、代理和镜像设置
+func SetDownloadConfig(cfg *config.DownloadConfig) {
+	downloaderMu.Lock()
+	defer downloaderMu.Unlock()
+	defaultDownloader = NewDownloader(cfg)
+}
+
+// sharedDownloader 返回所有服务共用的下载器
+func sharedDownloader() *Downloader {
+	downloaderMu.RLock()
+	defer downloaderMu.RUnlock()
+	return defaultDownloader
+}
+
+// Downloader 下载器：先写入 .part 文件，中断后通过 HTTP Range 断点续传，
+// 失败时按指数退避重试，并按顺序尝试镜像地址
+type Downloader struct {
+	timeout time.Duration
+	retries int
+	mirrors []string
+	client  *http.Client
+}
+
+// NewDownloader 根据配置创建下载器，cfg 为 nil 时使用默认设置
+func NewDownloader(cfg *config.DownloadConfig) *Downloader {
+	d := &Downloader{
+		timeout: defaultDownloadTimeout,
+		retries: defaultDownloadRetries,
+	}
+	proxy := http.ProxyFromEnvironment
+	if cfg != nil {
+		if cfg.Timeout > 0 {
+			d.timeout = time.Duration(cfg.Timeout) * time.Second
+		}
+		if cfg.Retries > 0 {
+			d.retries = cfg.Retries
+		}
+		d.mirrors = cfg.Mirrors
+		if cfg.Proxy != "" {
+			if proxyURL, err := url.Parse(cfg.Proxy); err == nil && proxyURL.Host != "" {
+				proxy = http.ProxyURL(proxyURL)
+			} else {
+				g.Log().Warningf(context.Background(), "Invalid download proxy %q, using environment settings", cfg.Proxy)
+			}
+		}
+	}
+
+	// 不设置 Client.Timeout：它会限制整个下载的时长，大文件在慢速网络下无法完成
+	// 超时只作用于连接、等待响应头以及读取时长时间没有数据
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.DialContext = (&net.Dialer{Timeout: d.timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = d.timeout
+	transport.ResponseHeaderTimeout = d.timeout
+	d.client = &http.Client{Transport: transport}
+	return d
+}
+
+// Client 返回使用代理设置的 HTTP 客户端
+func (d *Downloader) Client() *http.Client {
+	return d.client
+}
+
+// Download 下载文件到 destFile，依次尝试镜像地址和原始地址，通过 notify 报告进度
+// 取消时保留 .part 文件，下次下载同一文件时从断点继续
+func (d *Downloader) Download(ctx context.Context, rawURL, destFile string, notify ProgressCallback) error {
+	var errs []string
+	for _, source := range d.sources(rawURL) {
+		err := d.downloadFrom(ctx, source, destFile, notify)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ErrDownloadCanceled
+		}
+		g.Log().Warningf(ctx, "Download from %s failed: %v", source, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+	}
+	return fmt.Errorf("failed to download: %s", strings.Join(errs, "; "))
+}
+
+// Fetch 下载小文件到内存（最多 limit 字节），依次尝试镜像地址和原始地址
+func (d *Downloader) Fetch(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	var lastErr error
+	for _, source := range d.sources(rawURL) {
+		data, err := d.fetch(ctx, source, limit)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetch 从单个地址下载小文件
+func (d *Downloader) fetch(ctx context.Context, source string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// sources 返回按顺序尝试的下载地址：镜像在前，原始地址最后
+func (d *Downloader) sources(rawURL string) []string {
+	sources := make([]string, 0, len(d.mirrors)+1)
+	for _, mirror := range d.mirrors {
+		if source := mirrorURL(mirror, rawURL); source != "" && source != rawURL {
+			sources = append(sources, source)
+		}
+	}
+	return append(sources, rawURL)
+}
+
+// mirrorURL 生成镜像地址：含 {url} 时替换为原始地址（代理型镜像），
+// 否则用镜像的协议、主机和路径前缀替换原始地址的协议和主机
+func mirrorURL(mirror, rawURL string) string {
+	mirror = strings.TrimSpace(mirror)
+	if mirror == "" {
+		return ""
+	}
+	if strings.Contains(mirror, "{url}") {
+		return strings.ReplaceAll(mirror, "{url}", rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(mirror, "/") + u.RequestURI()
+}
+
+// downloadFrom 从单个地址下载，可重试的错误按指数退避重试，每次重试从断点继续
+func (d *Downloader) downloadFrom(ctx context.Context, source, destFile string, notify ProgressCallback) error {
+	partFile := destFile + partFileSuffix
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Second << (attempt - 1)
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+			notify(0, -1, 0, fmt.Sprintf("下载中断，%d 秒后重试（%d/%d）...", int(backoff.Seconds()), attempt, d.retries))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		err = d.fetchPart(ctx, source, partFile, notify)
+		if err == nil {
+			os.Remove(partFile + partInfoSuffix)
+			return os.Rename(partFile, destFile)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return err
+		}
+		g.Log().Warningf(ctx, "Download attempt %d of %s failed: %v", attempt+1, source, err)
+	}
+	return err
+}
+
+// permanentError 重试也无法成功的错误（如 404），直接换下一个下载源
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// partInfo .part 文件的来源，续传时用于确认服务端文件没有变化
+type partInfo struct {
+	Source    string `json:"source"`              // 下载地址
+	Validator string `json:"validator,omitempty"` // 首次响应的强 ETag 或 Last-Modified
+}
+
+// readPartInfo 读取 .part 文件的来源记录
+func readPartInfo(partFile string) (*partInfo, error) {
+	data, err := os.ReadFile(partFile + partInfoSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var info partInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// writePartInfo 记录 .part 文件的来源
+func writePartInfo(partFile string, info *partInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partFile+partInfoSuffix, data, 0644)
+}
+
+// removePart 丢弃已下载的部分及其来源记录
+func removePart(partFile string) {
+	os.Remove(partFile)
+	os.Remove(partFile + partInfoSuffix)
+}
+
+// responseValidator 返回可用于 If-Range 的校验值：强 ETag 优先，否则 Last-Modified
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// fetchPart 下载到 .part 文件，已有同一来源的部分内容时请求剩余部分
+// 续传请求带上 If-Range，服务端文件已变化时返回完整内容
+func (d *Downloader) fetchPart(ctx context.Context, source, partFile string, notify ProgressCallback) error {
+	var offset int64
+	var validator string
+	if stat, err := os.Stat(partFile); err == nil && stat.Size() > 0 {
+		// 镜像与原始地址的文件不一定相同，只从同一来源续传
+		if info, err := readPartInfo(partFile); err == nil && info.Source == source {
+			offset = stat.Size()
+			validator = info.Validator
+		} else {
+			g.Log().Infof(ctx, "Discarding partial download that did not come from %s", source)
+			removePart(partFile)
+		}
+	}
+
+	// 读取时长时间没有数据视为连接中断
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stalled atomic.Bool
+	timer := time.AfterFunc(d.timeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	total := int64(-1)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp) == offset:
+		flags |= os.O_APPEND
+		total = contentRangeTotal(resp)
+		g.Log().Infof(ctx, "Resuming download of %s at %d bytes", source, offset)
+	case resp.StatusCode == http.StatusOK:
+		// 服务端不支持断点续传或文件已变化，从头下载
+		flags |= os.O_TRUNC
+		offset = 0
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+		if err := writePartInfo(partFile, &partInfo{Source: source, Validator: responseValidator(resp)}); err != nil {
+			return &permanentError{fmt.Errorf("failed to create file: %w", err)}
+		}
+	case resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// 断点与服务端文件不一致，丢弃已下载的部分后重试
+		removePart(partFile)
+		return fmt.Errorf("cannot resume download: %s", resp.Status)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("download failed with status: %s", resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("download failed with status: %s", resp.Status)}
+	}
+
+	out, err := os.OpenFile(partFile, flags, 0644)
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create file: %w", err)}
+	}
+	defer out.Close()
+
+	downloaded := offset
+	notify(downloaded, total, percentOf(downloaded, total), "正在下载...")
+	buf := make([]byte, 32*1024) // 32KB buffer
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			timer.Reset(d.timeout)
+			if _, err := out.Write(buf[:n]); err != nil {
+				return &permanentError{fmt.Errorf("failed to write file: %w", err)}
+			}
+			downloaded += int64(n)
+			notify(downloaded, total, percentOf(downloaded, total), "正在下载...")
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if stalled.Load() {
+				return fmt.Errorf("no data received for %s", d.timeout)
+			}
+			return fmt.Errorf("failed to read response: %w", readErr)
+		}
+	}
+
+	if total >= 0 && downloaded != total {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", downloaded, total)
+	}
+	return out.Close()
+}
+
+// percentOf 计算下载百分比，总大小未知（-1）时返回 0
+func percentOf(downloaded, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(downloaded) / float64(total) * 100
+}
+
+// contentRangeStart 解析 Content-Range: bytes start-end/total 中的 start
+func contentRangeStart(resp *http.Response) int64 {
+	rangeSpec, _, _ := strings.Cut(strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes "), "/")
+	start, _, _ := strings.Cut(rangeSpec, "-")
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// contentRangeTotal 解析 Content-Range 中的文件总大小，未知（*）时返回 -1
+func contentRangeTotal(resp *http.Response) int64 {
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
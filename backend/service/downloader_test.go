@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// testRelease 下载测试使用的文件内容
+var testRelease = bytes.Repeat([]byte("0123456789"), 1000)
+
+// rangeRequest 服务端收到的断点续传请求头
+type rangeRequest struct {
+	Range, IfRange string
+}
+
+// newReleaseServer 提供支持 Range 和 If-Range 的文件，记录每次请求的断点续传请求头
+func newReleaseServer(t *testing.T, etag string, content []byte) (*httptest.Server, func() []rangeRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []rangeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, rangeRequest{r.Header.Get("Range"), r.Header.Get("If-Range")})
+		mu.Unlock()
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "app.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []rangeRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]rangeRequest(nil), requests...)
+	}
+}
+
+// writeTestPart 模拟中断的下载：写入 .part 文件及其来源记录
+func writeTestPart(t *testing.T, dest string, data []byte, info *partInfo) {
+	t.Helper()
+	partFile := dest + partFileSuffix
+	if err := os.WriteFile(partFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		if err := writePartInfo(partFile, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkDownloaded 检查下载结果，且 .part 文件及来源记录已清理
+func checkDownloaded(t *testing.T, dest string, want []byte) {
+	t.Helper()
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("downloaded %d bytes, want %d bytes of the release", len(data), len(want))
+	}
+	for _, leftover := range []string{dest + partFileSuffix, dest + partFileSuffix + partInfoSuffix} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", filepath.Base(leftover))
+		}
+	}
+}
+
+func noProgress(downloaded, total int64, percent float64, status string) {}
+
+func TestMirrorURL(t *testing.T) {
+	rawURL := "https://github.com/owner/repo/releases/download/v1/app.tar.gz?x=1"
+	tests := []struct {
+		mirror, want string
+	}{
+		{"https://mirror.example.com", "https://mirror.example.com/owner/repo/releases/download/v1/app.tar.gz?x=1"},
+		{"https://mirror.example.com/gh/", "https://mirror.example.com/gh/owner/repo/releases/download/v1/app.tar.gz?x=1"},
+		{"https://proxy.example.com/{url}", "https://proxy.example.com/" + rawURL},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := mirrorURL(tt.mirror, rawURL); got != tt.want {
+			t.Errorf("mirrorURL(%q) = %q, want %q", tt.mirror, got, tt.want)
+		}
+	}
+
+	d := NewDownloader(&config.DownloadConfig{Mirrors: []string{"https://m1.example.com", "", "https://github.com"}})
+	want := []string{"https://m1.example.com/owner/repo/releases/download/v1/app.tar.gz?x=1", rawURL}
+	if got := d.sources(rawURL); !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	const etag = `"v1"`
+	server, requests := newReleaseServer(t, etag, testRelease)
+	source := server.URL + "/app.tar.gz"
+	d := NewDownloader(&config.DownloadConfig{Timeout: 5, Retries: 1})
+
+	tests := []struct {
+		name        string
+		part        []byte
+		info        *partInfo
+		wantRequest rangeRequest
+		wantStart   int64 // 第一次进度回调中已下载的字节数
+	}{
+		{
+			name:        "fresh download",
+			wantRequest: rangeRequest{},
+		},
+		{
+			name:        "resume",
+			part:        testRelease[:4000],
+			info:        &partInfo{Source: source, Validator: etag},
+			wantRequest: rangeRequest{Range: "bytes=4000-", IfRange: etag},
+			wantStart:   4000,
+		},
+		{
+			name:        "file changed on the server",
+			part:        bytes.Repeat([]byte("x"), 4000),
+			info:        &partInfo{Source: source, Validator: `"v0"`},
+			wantRequest: rangeRequest{Range: "bytes=4000-", IfRange: `"v0"`},
+		},
+		{
+			name:        "part from another source",
+			part:        bytes.Repeat([]byte("x"), 4000),
+			info:        &partInfo{Source: "https://mirror.example.com/app.tar.gz", Validator: etag},
+			wantRequest: rangeRequest{},
+		},
+		{
+			name:        "part without a source record",
+			part:        bytes.Repeat([]byte("x"), 4000),
+			wantRequest: rangeRequest{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(requests())
+			dest := filepath.Join(t.TempDir(), "app.tar.gz")
+			if tt.part != nil {
+				writeTestPart(t, dest, tt.part, tt.info)
+			}
+			var progress []int64
+			err := d.Download(context.Background(), source, dest, func(downloaded, total int64, percent float64, status string) {
+				progress = append(progress, downloaded)
+				if total != int64(len(testRelease)) {
+					t.Errorf("total = %d, want %d", total, len(testRelease))
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDownloaded(t, dest, testRelease)
+			if got := requests()[before:]; len(got) != 1 || got[0] != tt.wantRequest {
+				t.Errorf("requests = %+v, want %+v", got, tt.wantRequest)
+			}
+			if len(progress) == 0 || progress[0] != tt.wantStart || progress[len(progress)-1] != int64(len(testRelease)) {
+				t.Errorf("progress from %v, want to start at %d", progress[:1], tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	const etag = `"v1"`
+	server, requests := newReleaseServer(t, etag, testRelease)
+	source := server.URL + "/app.tar.gz"
+	d := NewDownloader(&config.DownloadConfig{Timeout: 5, Retries: 1})
+
+	// 断点超出服务端文件大小：丢弃 .part 后重新下载
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	writeTestPart(t, dest, bytes.Repeat([]byte("x"), len(testRelease)+10), &partInfo{Source: source, Validator: etag})
+	if err := d.Download(context.Background(), source, dest, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, testRelease)
+	want := []rangeRequest{{Range: "bytes=10010-", IfRange: etag}, {}}
+	if got := requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %+v, want %+v", got, want)
+	}
+}
+
+func TestDownloadWithoutRangeSupport(t *testing.T) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Write(testRelease)
+	}))
+	defer server.Close()
+	source := server.URL + "/app.tar.gz"
+
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	writeTestPart(t, dest, bytes.Repeat([]byte("x"), 4000), &partInfo{Source: source})
+	if err := NewDownloader(nil).Download(context.Background(), source, dest, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	// 服务端忽略 Range 返回 200 时从头写入
+	checkDownloaded(t, dest, testRelease)
+	if len(ranges) != 1 || ranges[0] != "bytes=4000-" {
+		t.Errorf("ranges = %v", ranges)
+	}
+}
+
+func TestDownloadMirrorFallback(t *testing.T) {
+	origin, _ := newReleaseServer(t, `"v1"`, testRelease)
+	var mirrorRequests int
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorRequests++
+		http.NotFound(w, r)
+	}))
+	defer mirror.Close()
+
+	// 镜像返回 404 时不重试，直接换原始地址；镜像留下的 .part 不用于原始地址的续传
+	d := NewDownloader(&config.DownloadConfig{Timeout: 5, Retries: 2, Mirrors: []string{mirror.URL}})
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	writeTestPart(t, dest, bytes.Repeat([]byte("x"), 4000), &partInfo{Source: mirror.URL + "/app.tar.gz"})
+	if err := d.Download(context.Background(), origin.URL+"/app.tar.gz", dest, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, testRelease)
+	if mirrorRequests != 1 {
+		t.Errorf("mirror requests = %d, want 1", mirrorRequests)
+	}
+
+	// 所有下载源都失败时返回每个下载源的错误
+	err := d.Download(context.Background(), mirror.URL+"/missing", filepath.Join(t.TempDir(), "missing"), noProgress)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("error = %v, want the 404 of every source", err)
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// 发送一半后断开
+			w.Header().Set("Content-Length", "10000")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write(testRelease[:5000])
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "app.tar.gz", time.Time{}, bytes.NewReader(testRelease))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	var statuses []string
+	err := NewDownloader(&config.DownloadConfig{Timeout: 5, Retries: 1}).Download(context.Background(), server.URL+"/app.tar.gz", dest,
+		func(downloaded, total int64, percent float64, status string) {
+			if total < 0 {
+				statuses = append(statuses, status)
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, testRelease)
+	if attempts != 2 || len(statuses) != 1 {
+		t.Errorf("attempts = %d, retry notices = %v, want one retry", attempts, statuses)
+	}
+}
+
+func TestDownloadCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10000")
+		w.Write(testRelease[:5000])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	err := NewDownloader(nil).Download(ctx, server.URL+"/app.tar.gz", dest, func(downloaded, total int64, percent float64, status string) {
+		if downloaded >= 5000 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, ErrDownloadCanceled) {
+		t.Fatalf("error = %v, want ErrDownloadCanceled", err)
+	}
+	// 取消时保留 .part 及其来源记录，下次从断点继续
+	if info, err := os.Stat(dest + partFileSuffix); err != nil || info.Size() != 5000 {
+		t.Errorf("part file = %v, %v, want 5000 bytes", info, err)
+	}
+	if info, err := readPartInfo(dest + partFileSuffix); err != nil || info.Source != server.URL+"/app.tar.gz" {
+		t.Errorf("part info = %+v, %v", info, err)
+	}
+}
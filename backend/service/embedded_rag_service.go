@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+	"github.com/wangle201210/wachat/backend/vectorstore"
+)
+
+// 内置向量库检索结果中附加的元数据
+const (
+	embeddedKnowledgeField = "_knowledge_name" // 知识库名称（与 go-rag 的 payload 字段同名）
+	embeddedDocumentID     = "_document_id"
+	embeddedDocumentName   = "_document_name"
+)
+
+// EmbeddedRAGService 使用进程内向量库的 RAG 检索后端（rag.backend: embedded），不需要运行 go-rag 和 Qdrant
+// 文档通过 Ingest 切分、计算向量后写入 rag.embedded.dir，查询向量由 OpenAI 兼容的 embeddings 接口计算
+type EmbeddedRAGService struct {
+	ctx       context.Context
+	mu        sync.RWMutex // 保护以下字段（配置变更时替换）
+	config    *config.RAGConfig
+	store     *vectorstore.Store // 未启用时为 nil
+	embedding *embeddingClient   // 未启用时为 nil
+}
+
+// EmbeddedSearchRequest describes a search of the embedded backend
+type EmbeddedSearchRequest struct {
+	Query          string                 `json:"query"`
+	KnowledgeBases []string               `json:"knowledgeBases"` // 为空时检索全部知识库
+	Filter         map[string]interface{} `json:"filter"`         // 元数据过滤（与 rag.embedded.filter 同时生效，同名字段以此为准）
+	TopK           int                    `json:"topK"`           // 为 0 时使用 rag.topK
+	ScoreThreshold float64                `json:"scoreThreshold"` // 为 0 时使用 rag.embedded.scoreThreshold
+}
+
+// IngestRequest describes a document to add to the embedded vector store
+type IngestRequest struct {
+	KnowledgeBase string                 `json:"knowledgeBase"`
+	Name          string                 `json:"name"`       // 文件名或标题
+	Text          string                 `json:"text"`       // 正文，按 rag.embedded.chunkSize 切分
+	Metadata      map[string]interface{} `json:"metadata"`   // 文档的元数据，可用于检索过滤
+	DocumentID    string                 `json:"documentId"` // 不为空时替换该文档（字母、数字及 _ -）
+}
+
+// NewEmbeddedRAGService 创建使用内置向量库的 RAG 服务
+func NewEmbeddedRAGService(ctx context.Context, cfg *config.RAGConfig) *EmbeddedRAGService {
+	s := &EmbeddedRAGService{ctx: ctx}
+	s.Reconfigure(cfg)
+	return s
+}
+
+// Reconfigure 使用新的 RAG 配置（配置变更后调用），向量库目录不变时沿用已加载的向量库
+func (s *EmbeddedRAGService) Reconfigure(cfg *config.RAGConfig) {
+	var store *vectorstore.Store
+	var embedding *embeddingClient
+	if cfg != nil && cfg.Enabled && cfg.GetBackend() == config.RAGBackendEmbedded {
+		var err error
+		store, embedding, err = s.open(cfg)
+		if err != nil {
+			g.Log().Errorf(s.ctx, "RAG service: failed to configure the embedded backend: %v", err)
+			store, embedding = nil, nil
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = cfg
+	s.store = store
+	s.embedding = embedding
+}
+
+// open 打开向量库（目录不变时复用）并创建 embeddings 客户端
+func (s *EmbeddedRAGService) open(cfg *config.RAGConfig) (*vectorstore.Store, *embeddingClient, error) {
+	if cfg.Embedded == nil || cfg.Embedded.Dir == "" {
+		return nil, nil, fmt.Errorf("rag.embedded.dir is not configured")
+	}
+	embedding, err := newEmbeddingClient(cfg.Embedding, cfg.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.RLock()
+	store := s.store
+	s.mu.RUnlock()
+	if store != nil && store.Dir() == cfg.Embedded.Dir {
+		return store, embedding, nil
+	}
+
+	store, err = vectorstore.Open(cfg.Embedded.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, problem := range store.Problems() {
+		g.Log().Warningf(s.ctx, "RAG service: skipped vector store segment %s", problem)
+	}
+	stats := store.Stats()
+	g.Log().Infof(s.ctx, "RAG service will use the embedded vector store at %s (%d documents, %d chunks)", store.Dir(), stats.Documents, stats.Chunks)
+	return store, embedding, nil
+}
+
+// current 返回当前的配置、向量库和 embeddings 客户端，未启用时后两者为 nil
+func (s *EmbeddedRAGService) current() (*config.RAGConfig, *vectorstore.Store, *embeddingClient) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config, s.store, s.embedding
+}
+
+// enabled 返回当前的配置、向量库和 embeddings 客户端，未启用时返回错误
+func (s *EmbeddedRAGService) enabled() (*config.RAGConfig, *vectorstore.Store, *embeddingClient, error) {
+	cfg, store, embedding := s.current()
+	if store == nil {
+		return nil, nil, nil, fmt.Errorf("embedded vector store is not enabled (set rag.enabled: true and rag.backend: embedded)")
+	}
+	return cfg, store, embedding, nil
+}
+
+// IsEnabled 检查 RAG 服务是否启用（rag.backend 为 embedded 且配置有效）
+func (s *EmbeddedRAGService) IsEnabled() bool {
+	_, store, _ := s.current()
+	return store != nil
+}
+
+// CheckHealth 检查 embeddings 接口是否可达（向量库在进程内，不会不可用）
+func (s *EmbeddedRAGService) CheckHealth() error {
+	_, _, embedding, err := s.enabled()
+	if err != nil {
+		return err
+	}
+	return embedding.client.checkHealth(false)
+}
+
+// isHealthy 对话前的检查：向量库在进程内，不再另外连接 embeddings 接口，
+// 接口是否可用由计算查询向量的请求本身判断（熔断期间直接失败，失败计入熔断）
+func (s *EmbeddedRAGService) isHealthy() bool {
+	_, store, _ := s.current()
+	return store != nil
+}
+
+// Stats 返回向量库的统计信息
+func (s *EmbeddedRAGService) Stats() (vectorstore.Stats, error) {
+	_, store, _, err := s.enabled()
+	if err != nil {
+		return vectorstore.Stats{}, err
+	}
+	return store.Stats(), nil
+}
+
+// Ingest 切分文本、计算向量并写入向量库，返回保存的文档
+func (s *EmbeddedRAGService) Ingest(ctx context.Context, req IngestRequest) (*vectorstore.Document, error) {
+	cfg, store, embedding, err := s.enabled()
+	if err != nil {
+		return nil, err
+	}
+	req.KnowledgeBase = strings.TrimSpace(req.KnowledgeBase)
+	if req.KnowledgeBase == "" {
+		return nil, fmt.Errorf("knowledge base is required")
+	}
+
+	chunks := vectorstore.SplitText(req.Text, cfg.Embedded.ChunkSize, cfg.Embedded.ChunkOverlap)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("document %q has no text", req.Name)
+	}
+
+	batch := cfg.Embedded.BatchSize
+	if batch <= 0 {
+		batch = len(chunks)
+	}
+	records := make([]vectorstore.Record, len(chunks))
+	vectors := make([][]float32, 0, len(chunks))
+	for from := 0; from < len(chunks); from += batch {
+		to := min(from+batch, len(chunks))
+		embedded, err := embedding.embed(ctx, chunks[from:to])
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunks %d-%d of %q: %w", from+1, to, req.Name, err)
+		}
+		vectors = append(vectors, embedded...)
+	}
+	for i, chunk := range chunks {
+		records[i] = vectorstore.Record{Content: chunk}
+	}
+
+	doc, err := store.Add(vectorstore.Document{
+		ID:            req.DocumentID,
+		KnowledgeBase: req.KnowledgeBase,
+		Name:          req.Name,
+		Metadata:      req.Metadata,
+	}, records, vectors)
+	if err != nil {
+		return nil, err
+	}
+	g.Log().Infof(ctx, "Ingested %q into knowledge base %s (%d chunks)", doc.Name, doc.KnowledgeBase, doc.Chunks)
+	return doc, nil
+}
+
+// IngestFile 读取 UTF-8 文本文件（txt、md 等）并写入知识库，文件路径记录在元数据 source 中
+func (s *EmbeddedRAGService) IngestFile(ctx context.Context, knowledgeBase, path string, metadata map[string]interface{}) (*vectorstore.Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%s is not a UTF-8 text file", path)
+	}
+	meta := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		meta[k] = v
+	}
+	if _, ok := meta["source"]; !ok {
+		meta["source"] = path
+	}
+	return s.Ingest(ctx, IngestRequest{
+		KnowledgeBase: knowledgeBase,
+		Name:          filepath.Base(path),
+		Text:          string(data),
+		Metadata:      meta,
+	})
+}
+
+// Documents 返回知识库中的文档（为空时返回全部）
+func (s *EmbeddedRAGService) Documents(knowledgeBase string) ([]vectorstore.Document, error) {
+	_, store, _, err := s.enabled()
+	if err != nil {
+		return nil, err
+	}
+	return store.Documents(knowledgeBase), nil
+}
+
+// DeleteDocument 删除文档
+func (s *EmbeddedRAGService) DeleteDocument(id string) error {
+	_, store, _, err := s.enabled()
+	if err != nil {
+		return err
+	}
+	return store.Delete(id)
+}
+
+// DeleteKnowledgeBase 删除知识库中的全部文档，返回删除的文档数量
+func (s *EmbeddedRAGService) DeleteKnowledgeBase(knowledgeBase string) (int, error) {
+	_, store, _, err := s.enabled()
+	if err != nil {
+		return 0, err
+	}
+	return store.DeleteKnowledgeBase(knowledgeBase)
+}
+
+// KnowledgeBases 返回向量库中的知识库名称
+func (s *EmbeddedRAGService) KnowledgeBases() ([]string, error) {
+	_, store, _, err := s.enabled()
+	if err != nil {
+		return nil, err
+	}
+	return store.KnowledgeBases(), nil
+}
+
+// Search 计算查询向量并在向量库中检索，返回按相似度排序的文档
+func (s *EmbeddedRAGService) Search(ctx context.Context, req EmbeddedSearchRequest) ([]*schema.Document, error) {
+	cfg, store, embedding, err := s.enabled()
+	if err != nil {
+		return nil, err
+	}
+
+	topK := req.TopK
+	if topK == 0 {
+		topK = cfg.TopK
+	}
+	threshold := req.ScoreThreshold
+	if threshold == 0 {
+		threshold = cfg.Embedded.ScoreThreshold
+	}
+	var filter map[string]any
+	if len(cfg.Embedded.Filter) > 0 || len(req.Filter) > 0 {
+		filter = make(map[string]any, len(cfg.Embedded.Filter)+len(req.Filter))
+		for k, v := range cfg.Embedded.Filter {
+			filter[k] = v
+		}
+		for k, v := range req.Filter {
+			filter[k] = v
+		}
+	}
+
+	vector, err := embedding.embedQuery(ctx, req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	results, err := store.Search(vector, vectorstore.SearchOptions{
+		KnowledgeBases: req.KnowledgeBases,
+		Filter:         filter,
+		TopK:           topK,
+		ScoreThreshold: threshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*schema.Document, 0, len(results))
+	for _, result := range results {
+		doc := &schema.Document{
+			ID:       result.ID,
+			Content:  result.Content,
+			MetaData: result.Metadata,
+		}
+		doc.MetaData[embeddedKnowledgeField] = result.KnowledgeBase
+		doc.MetaData[embeddedDocumentID] = result.DocumentID
+		doc.MetaData[embeddedDocumentName] = result.DocumentName
+		doc.WithScore(result.Score)
+		docs = append(docs, doc)
+	}
+	g.Log().Debugf(ctx, "Retrieved %d documents from the embedded vector store", len(docs))
+	return docs, nil
+}
+
+// RetrieveDocuments 从默认知识库检索文档（未设置默认知识库时检索全部）
+// 检索失败返回空列表，不影响对话
+func (s *EmbeddedRAGService) RetrieveDocuments(ctx context.Context, query string) ([]*schema.Document, error) {
+	if !s.isHealthy() {
+		g.Log().Debug(ctx, "RAG service is not healthy, skipping retrieval")
+		return nil, nil
+	}
+
+	cfg, _, _ := s.current()
+	req := EmbeddedSearchRequest{Query: query}
+	if cfg.DefaultKnowledgeBase != "" {
+		req.KnowledgeBases = []string{cfg.DefaultKnowledgeBase}
+	}
+	docs, err := s.Search(ctx, req)
+	if err != nil {
+		logRetrievalError(ctx, err, "Failed to retrieve documents")
+		return nil, nil
+	}
+	return docs, nil
+}
+
+// RetrieveFromKnowledgeBases 从指定的多个知识库检索文档（一次查询），最多返回 topK 条
+func (s *EmbeddedRAGService) RetrieveFromKnowledgeBases(ctx context.Context, query string, knowledgeBases []string) ([]*schema.Document, error) {
+	if !s.isHealthy() {
+		g.Log().Debug(ctx, "RAG service is not healthy, skipping retrieval")
+		return nil, nil
+	}
+
+	docs, err := s.Search(ctx, EmbeddedSearchRequest{Query: query, KnowledgeBases: knowledgeBases})
+	if err != nil {
+		logRetrievalError(ctx, err, fmt.Sprintf("Failed to retrieve documents from %v", knowledgeBases))
+		return nil, nil
+	}
+	return docs, nil
+}
+
+// logRetrievalError 记录对话前检索的失败，熔断期间（embeddings 接口不可用）每轮对话都会失败，只记录调试日志
+func logRetrievalError(ctx context.Context, err error, message string) {
+	if errors.Is(err, ErrRAGUnavailable) {
+		g.Log().Debugf(ctx, "%s: %v", message, err)
+		return
+	}
+	g.Log().Warningf(ctx, "%s: %v", message, err)
+}
+
+// RetrieveWithContext 检索文档并返回上下文信息
+func (s *EmbeddedRAGService) RetrieveWithContext(ctx context.Context, query string) (string, error) {
+	docs, err := s.RetrieveDocuments(ctx, query)
+	if err != nil || len(docs) == 0 {
+		return "", nil
+	}
+	contextStr := buildRAGContext(docs)
+	g.Log().Debugf(ctx, "Generated context: %s", contextStr)
+	return contextStr, nil
+}
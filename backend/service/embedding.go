@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// embeddingClient 调用 OpenAI 兼容的 embeddings 接口（POST {baseURL}/embeddings）计算文本向量
+type embeddingClient struct {
+	model  string
+	client *ragClient
+}
+
+// embeddingRequest embeddings 接口的请求
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingResponse embeddings 接口的响应（按 index 对应输入）
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// newEmbeddingClient 创建 embeddings 客户端，超时、重试和熔断使用 rag.client 的设置（不使用其中的 TLS 和认证，它们属于 go-rag）
+func newEmbeddingClient(model *config.ModelConfig, clientCfg *config.RAGClientConfig) (*embeddingClient, error) {
+	if model == nil || model.BaseURL == "" || model.Model == "" {
+		return nil, fmt.Errorf("embedding baseURL and model are required")
+	}
+	settings := config.RAGClientConfig{}
+	if clientCfg != nil {
+		settings = *clientCfg
+	}
+	settings.TLS = nil
+
+	header := make(http.Header)
+	if model.APIKey != "" {
+		header.Set("Authorization", "Bearer "+model.APIKey)
+	}
+	client, err := newHTTPClient("embedding", model.BaseURL, config.URLAddress(model.BaseURL), header, &settings)
+	if err != nil {
+		return nil, err
+	}
+	return &embeddingClient{model: model.Model, client: client}, nil
+}
+
+// embed 计算多段文本的向量，结果与输入顺序一致
+func (e *embeddingClient) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+	data, err := e.client.do(ctx, http.MethodPost, "/embeddings", body, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp embeddingResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d inputs", len(resp.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) || len(item.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding API returned an invalid vector at index %d", item.Index)
+		}
+		if vectors[item.Index] != nil {
+			return nil, fmt.Errorf("embedding API returned index %d more than once", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// embedQuery 计算单个查询的向量
+func (e *embeddingClient) embedQuery(ctx context.Context, query string) ([]float32, error) {
+	vectors, err := e.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
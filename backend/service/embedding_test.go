@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+func TestEmbed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     [][]float32
+		wantErr  string
+	}{
+		{
+			name:     "ordered by index",
+			response: `{"data":[{"index":1,"embedding":[2]},{"index":0,"embedding":[1]}]}`,
+			want:     [][]float32{{1}, {2}},
+		},
+		{
+			name:     "missing vector",
+			response: `{"data":[{"index":0,"embedding":[1]}]}`,
+			wantErr:  "returned 1 vectors for 2 inputs",
+		},
+		{
+			name:     "duplicate index",
+			response: `{"data":[{"index":0,"embedding":[1]},{"index":0,"embedding":[2]}]}`,
+			wantErr:  "returned index 0 more than once",
+		},
+		{
+			name:     "index out of range",
+			response: `{"data":[{"index":0,"embedding":[1]},{"index":2,"embedding":[2]}]}`,
+			wantErr:  "invalid vector at index 2",
+		},
+		{
+			name:     "empty vector",
+			response: `{"data":[{"index":0,"embedding":[1]},{"index":1,"embedding":[]}]}`,
+			wantErr:  "invalid vector at index 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+			client, err := newEmbeddingClient(&config.ModelConfig{BaseURL: server.URL, Model: "test"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := client.embed(context.Background(), []string{"a", "b"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("embed error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("embed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,676 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// ManagedService 根据声明式配置管理一个外部二进制服务的下载、启动、停止和健康检查
+// go-rag、Qdrant、Ollama 以及 config.yaml 中 services 声明的服务都基于它实现
+type ManagedService struct {
+	*BaseServiceManager
+	spec           atomic.Pointer[config.ManagedServiceConfig] // 配置变更时整体替换
+	healthChecker  func() error
+	external       bool               // 已接管外部启动的实例（不由 wachat 启动，也不会被停止）
+	lastUpdate     *UpdateInfo        // 最近一次检查更新的结果
+	cancelDownload context.CancelFunc // 正在进行的下载，用于取消
+	onInstalled    func(dir string)
+	configFiles    []string // 服务自身的配置文件（相对安装目录），导出离线安装包时一并打包
+}
+
+// NewManagedService 创建声明式服务管理器（平台差异在创建时解析）
+func NewManagedService(ctx context.Context, spec *config.ManagedServiceConfig) *ManagedService {
+	m := &ManagedService{
+		BaseServiceManager: NewBaseServiceManager(ctx, spec.GetDisplayName()),
+	}
+	resolved := spec.ForPlatform(runtime.GOOS, runtime.GOARCH)
+	m.spec.Store(resolved)
+	m.SetRestartPolicy(RestartPolicyFromConfig(spec.Restart))
+	m.SetStopTimeout(spec.StopTimeout)
+	if !resolved.External {
+		m.SetPIDFile(filepath.Join(resolved.InstallPath, resolved.Name+".pid"))
+		m.SetLog(NewServiceLog(resolved.Name, filepath.Join(resolved.InstallPath, resolved.Name+".log")))
+	}
+	return m
+}
+
+// Name 返回服务名称
+func (m *ManagedService) Name() string {
+	return m.Spec().Name
+}
+
+// Spec 返回解析平台差异后的服务声明
+func (m *ManagedService) Spec() *config.ManagedServiceConfig {
+	return m.spec.Load()
+}
+
+// Reconfigure 使用新的服务声明（配置变更后调用），重启策略和停止宽限期立即生效，
+// 影响进程的字段（版本、可执行文件、参数、环境变量、健康检查等）变化且服务正在运行时返回 true，
+// 由调用方通过编排器按依赖顺序重启。日志和 PID 文件仍使用创建时的安装路径
+func (m *ManagedService) Reconfigure(spec *config.ManagedServiceConfig) (restart bool) {
+	next := spec.ForPlatform(runtime.GOOS, runtime.GOARCH)
+	prev := m.spec.Swap(next)
+	m.SetRestartPolicy(RestartPolicyFromConfig(spec.Restart))
+	m.SetStopTimeout(spec.StopTimeout)
+
+	if !processChanged(prev, next) || !isActive(m) {
+		return false
+	}
+	g.Log().Infof(m.ctx, "Configuration of %s changed, it needs a restart", m.serviceName)
+	return true
+}
+
+// processChanged 比较两份服务声明中影响运行中进程的字段
+func processChanged(a, b *config.ManagedServiceConfig) bool {
+	process := func(c *config.ManagedServiceConfig) []interface{} {
+		return []interface{}{c.External, c.Version, c.OSMap, c.ArchMap, c.Binary, c.Args, c.Env, c.InstallPath, c.WorkDir, c.Health}
+	}
+	return !reflect.DeepEqual(process(a), process(b))
+}
+
+// SetHealthChecker 设置自定义健康检查，覆盖声明中的 health 配置
+func (m *ManagedService) SetHealthChecker(checker func() error) {
+	m.healthChecker = checker
+}
+
+// IsExternal 检查服务是否由外部管理（声明为 external 或已接管外部实例）
+func (m *ManagedService) IsExternal() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.external
+}
+
+// IsRunning 检查服务是否正在运行（包括已接管的外部实例）
+func (m *ManagedService) IsRunning() bool {
+	return m.BaseServiceManager.IsRunning() || m.IsExternal()
+}
+
+// IsInstalled 检查服务是否已安装（外部服务无需安装）
+func (m *ManagedService) IsInstalled() bool {
+	if m.Spec().External {
+		return true
+	}
+	_, err := os.Stat(m.getBinaryPath())
+	return err == nil
+}
+
+// CheckHealth 按声明的方式检查服务是否健康
+func (m *ManagedService) CheckHealth() error {
+	if m.healthChecker != nil {
+		return m.healthChecker()
+	}
+
+	health := m.Spec().Health
+	switch health.GetType() {
+	case "tcp":
+		return m.CheckTCPHealth(m.expand(health.Address))
+	case "http":
+		return m.CheckHTTPHealth(m.expand(health.URL))
+	case "command":
+		return m.checkCommandHealth(health.Command)
+	default:
+		// 没有健康检查时以进程存活为准
+		if !m.IsRunning() {
+			return fmt.Errorf("%s is not running", m.serviceName)
+		}
+		return nil
+	}
+}
+
+// checkCommandHealth 执行健康检查命令，退出码为 0 视为健康
+func (m *ManagedService) checkCommandHealth(command []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("health check command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = m.expand(arg)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = m.Spec().InstallPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("health check command failed: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// WaitForHealth 等待服务健康（最多等待指定超时时间）
+func (m *ManagedService) WaitForHealth(timeout time.Duration) error {
+	return m.BaseServiceManager.WaitForHealth(timeout, m.CheckHealth)
+}
+
+// SetConfigFiles 声明服务自身的配置文件（相对安装目录），导出离线安装包时一并打包
+func (m *ManagedService) SetConfigFiles(files ...string) {
+	m.configFiles = files
+}
+
+// SetInstallHook 设置安装完成后的回调（参数为新版本的安装目录）
+func (m *ManagedService) SetInstallHook(hook func(dir string)) {
+	m.onInstalled = hook
+}
+
+// Download 下载并安装服务：配置固定版本时安装该版本，否则安装最新发布的版本
+// 每个版本安装到独立目录，切换后保留上一个版本用于回滚
+func (m *ManagedService) Download() error {
+	name := m.serviceName
+	m.NotifyProgress(0, 0, 0, fmt.Sprintf("准备下载 %s...", name))
+
+	if m.Spec().External {
+		return fmt.Errorf("%s is managed externally, nothing to download", name)
+	}
+	if m.Spec().DownloadURL == "" {
+		return fmt.Errorf("%s has no download URL configured", name)
+	}
+
+	version := m.targetVersion()
+	if err := m.install(version); err != nil {
+		return err
+	}
+	return m.switchVersion(version)
+}
+
+// CancelDownload 取消正在进行的下载，已下载的部分保留，下次下载时继续
+func (m *ManagedService) CancelDownload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancelDownload == nil {
+		return fmt.Errorf("%s is not downloading", m.serviceName)
+	}
+	m.cancelDownload()
+	return nil
+}
+
+// install 下载、校验并解压指定版本到版本目录（不切换当前版本）
+func (m *ManagedService) install(version string) error {
+	name := m.serviceName
+	if err := config.ValidateVersion(version); err != nil {
+		return fmt.Errorf("cannot install %s: %w", name, err)
+	}
+	if version == m.CurrentVersion() && m.BaseServiceManager.IsRunning() {
+		return fmt.Errorf("%s %s is running, stop it before reinstalling", name, version)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.mu.Lock()
+	if m.cancelDownload != nil {
+		m.mu.Unlock()
+		cancel()
+		return fmt.Errorf("%s is already downloading", name)
+	}
+	m.cancelDownload = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.cancelDownload = nil
+		m.mu.Unlock()
+		cancel()
+	}()
+
+	downloadURL := m.versionedDownloadURL(version)
+	g.Log().Infof(m.ctx, "Downloading %s %s from: %s", name, version, downloadURL)
+
+	installPath := m.Spec().InstallPath
+	if err := os.MkdirAll(installPath, 0755); err != nil {
+		return fmt.Errorf("failed to create install directory: %w", err)
+	}
+
+	format := m.archiveFormat()
+	ext := format
+	if format == "binary" {
+		ext = "bin"
+	}
+	// 文件名带版本号，中断后只会续传同一版本的 .part 文件
+	tmpFile := filepath.Join(installPath, m.Spec().Name+"-"+version+"-download."+ext)
+	defer os.Remove(tmpFile)
+
+	m.NotifyProgress(0, 0, 0, "正在连接...")
+	if err := sharedDownloader().Download(ctx, downloadURL, tmpFile, m.NotifyProgress); err != nil {
+		if errors.Is(err, ErrDownloadCanceled) {
+			m.NotifyProgress(0, 0, 0, "下载已取消")
+			return fmt.Errorf("download of %s canceled", name)
+		}
+		return err
+	}
+
+	// 校验通过前不解压、不覆盖已安装的文件，失败时删除下载的文件
+	m.NotifyProgress(0, 0, 100, "正在校验...")
+	record, err := m.verifyDownload(tmpFile, downloadURL)
+	if err != nil {
+		os.Remove(tmpFile)
+		g.Log().Errorf(m.ctx, "%s: %v, downloaded file deleted", name, err)
+		return fmt.Errorf("%w (downloaded file deleted)", err)
+	}
+	record.Version = version
+
+	if err := m.unpack(tmpFile, format, version, record); err != nil {
+		return err
+	}
+
+	m.NotifyProgress(0, 0, 100, "下载完成")
+	g.Log().Infof(m.ctx, "%s %s downloaded successfully", name, version)
+	return nil
+}
+
+// InstallFromArchive 从本地文件离线安装（无法访问网络的环境）
+// 文件可以是发布的 tar.gz / zip 安装包或单个可执行文件；版本号无法从文件得知，
+// 以 local-<SHA256 前 12 位> 命名，安装后切换为当前版本，原版本保留用于回滚
+func (m *ManagedService) InstallFromArchive(archivePath string) error {
+	name := m.serviceName
+	if m.Spec().External {
+		return fmt.Errorf("%s is managed externally, nothing to install", name)
+	}
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", archivePath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", archivePath)
+	}
+
+	m.NotifyProgress(0, 0, 100, "正在校验...")
+	sum, err := fileSHA256(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", filepath.Base(archivePath), err)
+	}
+	record := &InstallRecord{
+		File:   filepath.Base(archivePath),
+		URL:    "file://" + filepath.ToSlash(archivePath),
+		SHA256: sum,
+		Source: "local",
+		Time:   time.Now(),
+	}
+
+	// 离线安装无法获取发布的校验和，只校验配置中固定的 SHA256
+	if cfg := m.Spec().Verify; cfg != nil {
+		expected := strings.ToLower(strings.TrimSpace(cfg.SHA256))
+		switch {
+		case expected != "" && expected != sum:
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", record.File, expected, sum)
+		case expected != "":
+			record.Verified = true
+			record.Source = "pinned"
+		case cfg.Required:
+			return fmt.Errorf("%s requires a verified download, set verify.sha256 to install from a local file", name)
+		}
+	}
+
+	version := "local-" + sum[:12]
+	record.Version = version
+	if version == m.CurrentVersion() {
+		return fmt.Errorf("%s is already installed from %s", name, record.File)
+	}
+	if err := m.unpack(archivePath, localArchiveFormat(archivePath), version, record); err != nil {
+		return err
+	}
+	m.NotifyProgress(0, 0, 100, "安装完成")
+	g.Log().Infof(m.ctx, "%s installed from %s as %s", name, archivePath, version)
+	return m.switchVersion(version)
+}
+
+// unpack 将安装包解压（或单个二进制复制）到版本目录，写入安装记录
+func (m *ManagedService) unpack(file, format, version string, record *InstallRecord) error {
+	dir, err := m.versionDir(version)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clean version directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %w", err)
+	}
+	binaryPath := m.binaryPathIn(dir)
+
+	if format == "binary" {
+		// 单文件二进制直接复制到目标位置
+		if err := os.MkdirAll(filepath.Dir(binaryPath), 0755); err != nil {
+			return fmt.Errorf("failed to create binary directory: %w", err)
+		}
+		if err := copyFile(file, binaryPath, 0755); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to install binary: %w", err)
+		}
+	} else {
+		m.NotifyProgress(0, 0, 100, "正在解压...")
+		opts := newExtractOptions(m.Spec().Archive)
+		if format == "zip" {
+			err = extractZip(file, dir, opts)
+		} else {
+			err = extractTarGz(file, dir, opts)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to extract: %w", err)
+		}
+	}
+
+	// 设置可执行权限（Unix 系统）
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(binaryPath, 0755); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to set executable permission: %w", err)
+		}
+	}
+
+	if err := writeInstallRecord(dir, m.Spec().Name, record); err != nil {
+		g.Log().Warningf(m.ctx, "Failed to write install record for %s: %v", m.serviceName, err)
+	}
+	if m.onInstalled != nil {
+		m.onInstalled(dir)
+	}
+	return nil
+}
+
+// Start 启动服务
+// 配置的地址上已有健康的实例（手动启动、Docker 或远程主机）时直接接管，不再启动新进程
+func (m *ManagedService) Start() error {
+	name := m.serviceName
+	if m.IsRunning() {
+		return fmt.Errorf("%s is already running", name)
+	}
+
+	// 清理上次崩溃遗留的进程，避免端口冲突
+	if err := m.CleanupOrphan(); err != nil {
+		g.Log().Warningf(m.ctx, "Failed to clean up orphaned %s: %v", name, err)
+	}
+
+	if m.CheckHealth() == nil {
+		m.mu.Lock()
+		m.external = true
+		m.mu.Unlock()
+		g.Log().Infof(m.ctx, "%s is already running outside wachat, using the external instance", name)
+		return nil
+	}
+	if m.Spec().External {
+		return fmt.Errorf("%s is managed externally and is not reachable", name)
+	}
+
+	if !m.IsInstalled() {
+		return fmt.Errorf("%s is not installed, please download first", name)
+	}
+
+	binaryPath := m.getBinaryPath()
+	g.Log().Infof(m.ctx, "Starting %s from: %s", name, binaryPath)
+
+	spec := m.Spec()
+	args := make([]string, len(spec.Args))
+	for i, arg := range spec.Args {
+		args[i] = m.expand(arg)
+	}
+
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Dir = spec.InstallPath
+	if spec.WorkDir != "" {
+		cmd.Dir = m.expand(spec.WorkDir)
+	}
+	cmd.Env = append(os.Environ(), m.environ()...)
+
+	// 输出由 BaseServiceManager 写入服务日志
+	if err := m.StartProcess(cmd, name); err != nil {
+		return err
+	}
+
+	g.Log().Infof(m.ctx, "%s logs: %s", name, m.Logs().Path())
+	return nil
+}
+
+// Stop 停止服务，外部实例只解除接管，不会被停止
+func (m *ManagedService) Stop() error {
+	m.mu.Lock()
+	external := m.external
+	m.external = false
+	m.mu.Unlock()
+
+	if external {
+		g.Log().Infof(m.ctx, "%s is managed externally, leaving it running", m.serviceName)
+		return nil
+	}
+	return m.StopProcess(m.serviceName)
+}
+
+// GetStatus 获取服务状态
+// 未由 wachat 启动但健康检查通过时，报告为外部运行；已接管的外部实例不再健康时解除接管
+func (m *ManagedService) GetStatus() map[string]interface{} {
+	status := m.BaseServiceManager.GetStatus(m.IsInstalled(), m.CheckHealth)
+	if record := m.InstallRecord(); record != nil {
+		status["sha256"] = record.SHA256
+		status["verified"] = record.Verified
+	}
+	status["version"] = m.CurrentVersion()
+	status["previousVersion"] = m.PreviousVersion()
+	status["versions"] = m.InstalledVersions()
+	status["pinnedVersion"] = m.pinnedVersion()
+	m.mu.Lock()
+	if m.lastUpdate != nil {
+		status["availableVersion"] = m.lastUpdate.Latest
+		status["updateAvailable"] = m.lastUpdate.UpdateAvailable
+	}
+	m.mu.Unlock()
+	status["external"] = false
+	if running, _ := status["running"].(bool); !running {
+		if m.CheckHealth() == nil {
+			status["running"] = true
+			status["healthy"] = true
+			status["external"] = true
+		} else {
+			m.mu.Lock()
+			m.external = false
+			m.mu.Unlock()
+		}
+	}
+	return status
+}
+
+// environ 返回声明的环境变量（按键排序，便于日志比对）
+func (m *ManagedService) environ() []string {
+	declared := m.Spec().Env
+	keys := make([]string, 0, len(declared))
+	for k := range declared {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+m.expand(declared[k]))
+	}
+	return env
+}
+
+// expand 替换字符串中的占位符
+func (m *ManagedService) expand(s string) string {
+	spec := m.Spec()
+	osName := runtime.GOOS
+	if mapped, ok := spec.OSMap[osName]; ok {
+		osName = mapped
+	}
+	arch := runtime.GOARCH
+	if mapped, ok := spec.ArchMap[arch]; ok {
+		arch = mapped
+	}
+
+	return strings.NewReplacer(
+		"{name}", spec.Name,
+		"{version}", spec.Version,
+		"{os}", osName,
+		"{arch}", arch,
+		"{ext}", m.archiveFormat(),
+		"{installPath}", spec.InstallPath,
+	).Replace(s)
+}
+
+// archiveFormat 返回下载文件的格式
+// 未声明时根据下载地址推断，地址使用 {ext} 占位符时 Windows 默认 zip，其他系统默认 tar.gz
+func (m *ManagedService) archiveFormat() string {
+	spec := m.Spec()
+	if spec.Archive != nil && spec.Archive.Format != "" {
+		return spec.Archive.Format
+	}
+
+	url := spec.DownloadURL
+	switch {
+	case strings.HasSuffix(url, ".tar.gz"):
+		return "tar.gz"
+	case strings.HasSuffix(url, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(url, ".zip"):
+		return "zip"
+	case strings.Contains(url, "{ext}"):
+		if runtime.GOOS == "windows" {
+			return "zip"
+		}
+		return "tar.gz"
+	}
+	return "binary"
+}
+
+// getBinaryPath 获取当前版本的二进制文件路径
+func (m *ManagedService) getBinaryPath() string {
+	return m.binaryPathIn(m.binaryDir())
+}
+
+// binaryPathIn 获取二进制文件在指定安装目录中的路径
+func (m *ManagedService) binaryPathIn(dir string) string {
+	binaryPath := m.expand(m.Spec().Binary)
+	if runtime.GOOS == "windows" && filepath.Ext(binaryPath) == "" {
+		binaryPath += ".exe"
+	}
+	if filepath.IsAbs(binaryPath) {
+		return binaryPath
+	}
+	return filepath.Join(dir, binaryPath)
+}
+
+// ServiceProgressCallback 带服务名称的下载进度回调函数
+type ServiceProgressCallback func(name string, downloaded, total int64, percent float64, status string)
+
+// ManagedServiceRegistry 管理 config.yaml 中 services 声明的服务
+// 启动和停止由 ServiceOrchestrator 按 dependsOn 编排
+type ManagedServiceRegistry struct {
+	ctx      context.Context
+	services map[string]*ManagedService
+	order    []string
+}
+
+// NewManagedServiceRegistry 根据配置创建服务注册表（只注册启用且声明有效的服务）
+func NewManagedServiceRegistry(ctx context.Context, specs []*config.ManagedServiceConfig) *ManagedServiceRegistry {
+	r := &ManagedServiceRegistry{
+		ctx:      ctx,
+		services: make(map[string]*ManagedService),
+	}
+
+	for _, spec := range specs {
+		if !spec.IsEnabled() {
+			continue
+		}
+		if err := spec.Validate(); err != nil {
+			g.Log().Warningf(ctx, "Skipping managed service: %v", err)
+			continue
+		}
+		if _, exists := r.services[spec.Name]; exists {
+			g.Log().Warningf(ctx, "Skipping duplicate managed service: %s", spec.Name)
+			continue
+		}
+		r.services[spec.Name] = NewManagedService(ctx, spec)
+		r.order = append(r.order, spec.Name)
+	}
+
+	return r
+}
+
+// Reconfigure 按新的 services 配置更新已注册的服务（配置变更后调用），
+// 返回需要重启的服务以及已被移除或禁用的服务；新增的服务在重新启动 wachat 后生效
+func (r *ManagedServiceRegistry) Reconfigure(specs []*config.ManagedServiceConfig) (restart, removed map[string]bool) {
+	restart = make(map[string]bool)
+	removed = make(map[string]bool, len(r.order))
+	for _, name := range r.order {
+		removed[name] = true
+	}
+
+	for _, spec := range specs {
+		if !spec.IsEnabled() || spec.Validate() != nil {
+			continue
+		}
+		svc, exists := r.services[spec.Name]
+		if !exists {
+			g.Log().Infof(r.ctx, "Managed service %s takes effect after restarting wachat", spec.Name)
+			continue
+		}
+		if !removed[spec.Name] {
+			// 重复的声明，与创建时一样只使用第一个
+			continue
+		}
+		delete(removed, spec.Name)
+		if svc.Reconfigure(spec) {
+			restart[spec.Name] = true
+		}
+	}
+	return restart, removed
+}
+
+// Get 返回指定名称的服务
+func (r *ManagedServiceRegistry) Get(name string) (*ManagedService, error) {
+	svc, ok := r.services[name]
+	if !ok {
+		return nil, fmt.Errorf("managed service not found: %s", name)
+	}
+	return svc, nil
+}
+
+// RegisterWith 将所有服务注册到编排器
+func (r *ManagedServiceRegistry) RegisterWith(o *ServiceOrchestrator) {
+	for _, name := range r.order {
+		svc := r.services[name]
+		if err := o.Register(name, svc, svc.Spec().DependsOn, svc.Spec().AutoStart); err != nil {
+			g.Log().Warningf(r.ctx, "Skipping managed service: %v", err)
+		}
+	}
+}
+
+// Names 返回按声明顺序排列的服务名称
+func (r *ManagedServiceRegistry) Names() []string {
+	return append([]string(nil), r.order...)
+}
+
+// SetProgressCallback 为所有服务设置下载进度回调
+func (r *ManagedServiceRegistry) SetProgressCallback(callback ServiceProgressCallback) {
+	for name, svc := range r.services {
+		name := name
+		svc.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
+			callback(name, downloaded, total, percent, status)
+		})
+	}
+}
+
+// List 返回所有服务的状态
+func (r *ManagedServiceRegistry) List() []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(r.order))
+	for _, name := range r.order {
+		svc := r.services[name]
+		status := svc.GetStatus()
+		status["name"] = name
+		status["displayName"] = svc.Spec().GetDisplayName()
+		status["autoStart"] = svc.Spec().AutoStart
+		status["dependsOn"] = svc.Spec().DependsOn
+		result = append(result, status)
+	}
+	return result
+}
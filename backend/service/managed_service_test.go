@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// newTestManagedService 创建安装在临时目录中的服务（默认名称 app，可执行文件 bin/app）
+func newTestManagedService(t *testing.T, spec *config.ManagedServiceConfig) *ManagedService {
+	t.Helper()
+	if spec == nil {
+		spec = &config.ManagedServiceConfig{}
+	}
+	if spec.Name == "" {
+		spec.Name = "app"
+	}
+	if spec.Binary == "" {
+		spec.Binary = "bin/app"
+	}
+	if spec.InstallPath == "" {
+		spec.InstallPath = t.TempDir()
+	}
+	spec.Enabled = true
+	return NewManagedService(context.Background(), spec)
+}
+
+func TestManagedServiceConfigForPlatform(t *testing.T) {
+	spec := &config.ManagedServiceConfig{
+		Name:        "app",
+		DownloadURL: "https://example.com/app.tar.gz",
+		Binary:      "app",
+		Platforms: map[string]*config.ManagedServicePlatform{
+			"windows":       {Binary: "app.exe", DownloadURL: "https://example.com/app.zip"},
+			"windows/arm64": {DownloadURL: "https://example.com/app-arm64.zip"},
+			"linux":         {Archive: &config.ArchiveConfig{StripComponents: 1}},
+		},
+	}
+
+	tests := []struct {
+		goos, goarch string
+		url, binary  string
+		strip        int
+	}{
+		{"darwin", "arm64", "https://example.com/app.tar.gz", "app", 0},
+		{"linux", "amd64", "https://example.com/app.tar.gz", "app", 1},
+		{"windows", "amd64", "https://example.com/app.zip", "app.exe", 0},
+		{"windows", "arm64", "https://example.com/app-arm64.zip", "app.exe", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			resolved := spec.ForPlatform(tt.goos, tt.goarch)
+			if resolved.DownloadURL != tt.url || resolved.Binary != tt.binary {
+				t.Errorf("url, binary = %s, %s, want %s, %s", resolved.DownloadURL, resolved.Binary, tt.url, tt.binary)
+			}
+			strip := 0
+			if resolved.Archive != nil {
+				strip = resolved.Archive.StripComponents
+			}
+			if strip != tt.strip {
+				t.Errorf("stripComponents = %d, want %d", strip, tt.strip)
+			}
+		})
+	}
+	// 平台覆盖不修改原来的声明
+	if spec.Binary != "app" || spec.DownloadURL != "https://example.com/app.tar.gz" {
+		t.Errorf("ForPlatform modified the spec: %+v", spec)
+	}
+}
+
+func TestManagedServiceConfigForPlatformSHA256(t *testing.T) {
+	required := &config.VerifyConfig{Required: true, ChecksumURL: "{dir}/checksums.txt"}
+	spec := &config.ManagedServiceConfig{
+		Name:   "app",
+		Binary: "app",
+		Verify: required,
+		Platforms: map[string]*config.ManagedServicePlatform{
+			"linux/amd64": {SHA256: "abc"},
+		},
+	}
+
+	resolved := spec.ForPlatform("linux", "amd64")
+	if resolved.Verify == nil || resolved.Verify.SHA256 != "abc" || !resolved.Verify.Required || resolved.Verify.ChecksumURL != required.ChecksumURL {
+		t.Errorf("linux/amd64 verify = %+v, want the pinned sha256 on top of the shared settings", resolved.Verify)
+	}
+	if required.SHA256 != "" {
+		t.Error("ForPlatform modified the shared verify config")
+	}
+	if resolved := spec.ForPlatform("darwin", "arm64"); resolved.Verify != required {
+		t.Errorf("darwin/arm64 verify = %+v, want the shared config", resolved.Verify)
+	}
+
+	// 只有平台固定了 sha256 时也会创建校验配置
+	spec.Verify = nil
+	if resolved := spec.ForPlatform("linux", "amd64"); resolved.Verify == nil || resolved.Verify.SHA256 != "abc" {
+		t.Errorf("verify without shared config = %+v", resolved.Verify)
+	}
+}
+
+func TestManagedServiceExpand(t *testing.T) {
+	m := newTestManagedService(t, &config.ManagedServiceConfig{
+		Version:     "v1.2.0",
+		DownloadURL: "https://example.com/{name}-{os}-{arch}.{ext}",
+		OSMap:       map[string]string{runtime.GOOS: "myos"},
+		ArchMap:     map[string]string{runtime.GOARCH: "myarch"},
+	})
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+
+	got := m.expand("{installPath}/{name}/{version}/{os}-{arch}.{ext}")
+	want := m.Spec().InstallPath + "/app/v1.2.0/myos-myarch." + ext
+	if got != want {
+		t.Errorf("expand = %q, want %q", got, want)
+	}
+	if got := m.expand("no placeholders"); got != "no placeholders" {
+		t.Errorf("expand = %q", got)
+	}
+}
+
+func TestManagedServiceArchiveFormat(t *testing.T) {
+	braced := "tar.gz"
+	if runtime.GOOS == "windows" {
+		braced = "zip"
+	}
+	tests := []struct {
+		url     string
+		archive *config.ArchiveConfig
+		want    string
+	}{
+		{"https://example.com/app.tar.gz", nil, "tar.gz"},
+		{"https://example.com/app.tgz", nil, "tgz"},
+		{"https://example.com/app.zip", nil, "zip"},
+		{"https://example.com/app-{os}.{ext}", nil, braced},
+		{"https://example.com/app", nil, "binary"},
+		{"https://example.com/download?id=1", &config.ArchiveConfig{Format: "zip"}, "zip"},
+	}
+	for _, tt := range tests {
+		m := newTestManagedService(t, &config.ManagedServiceConfig{DownloadURL: tt.url, Archive: tt.archive})
+		if got := m.archiveFormat(); got != tt.want {
+			t.Errorf("archiveFormat(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestManagedServiceBinaryPath(t *testing.T) {
+	m := newTestManagedService(t, &config.ManagedServiceConfig{Binary: "bin/{name}"})
+	want := filepath.Join("dir", "bin", "app")
+	abs := filepath.Join(t.TempDir(), "app")
+	if runtime.GOOS == "windows" {
+		want += ".exe"
+		abs += ".exe"
+	}
+	if got := m.binaryPathIn("dir"); got != want {
+		t.Errorf("binaryPathIn = %s, want %s", got, want)
+	}
+
+	m = newTestManagedService(t, &config.ManagedServiceConfig{Binary: abs})
+	if got := m.binaryPathIn("dir"); got != abs {
+		t.Errorf("binaryPathIn with an absolute binary = %s, want %s", got, abs)
+	}
+	if m.IsInstalled() {
+		t.Error("IsInstalled = true before installing")
+	}
+}
+
+func TestManagedServiceEnviron(t *testing.T) {
+	m := newTestManagedService(t, &config.ManagedServiceConfig{
+		Env: map[string]string{"B": "{name}", "A": "{installPath}/data"},
+	})
+	want := []string{"A=" + m.Spec().InstallPath + "/data", "B=app"}
+	if got := m.environ(); !reflect.DeepEqual(got, want) {
+		t.Errorf("environ = %v, want %v", got, want)
+	}
+}
+
+func TestManagedServiceConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    config.ManagedServiceConfig
+		wantErr bool
+	}{
+		{"valid", config.ManagedServiceConfig{Name: "app", Binary: "app"}, false},
+		{"no name", config.ManagedServiceConfig{Binary: "app"}, true},
+		{"no binary", config.ManagedServiceConfig{Name: "app"}, true},
+		{"unknown health check", config.ManagedServiceConfig{Name: "app", Binary: "app", Health: &config.HealthCheckConfig{Type: "grpc"}}, true},
+		{"external", config.ManagedServiceConfig{Name: "app", External: true, Health: &config.HealthCheckConfig{URL: "http://localhost:1"}}, false},
+		{"external without health check", config.ManagedServiceConfig{Name: "app", External: true}, true},
+		{"restart policy", config.ManagedServiceConfig{Name: "app", Binary: "app", Restart: &config.RestartConfig{Policy: "always"}}, false},
+		{"unknown restart policy", config.ManagedServiceConfig{Name: "app", Binary: "app", Restart: &config.RestartConfig{Policy: "sometimes"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagedServiceRegistry(t *testing.T) {
+	dir := t.TempDir()
+	spec := func(name string, enabled bool, binary string) *config.ManagedServiceConfig {
+		return &config.ManagedServiceConfig{Name: name, Enabled: enabled, Binary: binary, InstallPath: filepath.Join(dir, name)}
+	}
+	r := NewManagedServiceRegistry(context.Background(), []*config.ManagedServiceConfig{
+		spec("b", true, "b"),
+		spec("disabled", false, "x"),
+		spec("invalid", true, ""),
+		spec("a", true, "a"),
+		spec("b", true, "other"),
+	})
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Names = %v, want [b a]", got)
+	}
+	if svc, err := r.Get("b"); err != nil || svc.Spec().Binary != "b" {
+		t.Errorf("Get(b) = %v, %v, want the first declaration", svc, err)
+	}
+	if _, err := r.Get("disabled"); err == nil {
+		t.Error("disabled service was registered")
+	}
+}
+
+func TestManagedServiceAdoptExternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// 配置的地址上已有健康实例时直接接管，未安装也可以启动
+	m := newTestManagedService(t, &config.ManagedServiceConfig{Health: &config.HealthCheckConfig{URL: server.URL}})
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsRunning() || !m.IsExternal() {
+		t.Error("healthy instance was not adopted")
+	}
+	if status := m.GetStatus(); status["external"] != true || status["healthy"] != true {
+		t.Errorf("status = %+v, want a healthy external instance", status)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsExternal() {
+		t.Error("still adopted after Stop")
+	}
+	// 未接管时仍报告为外部运行
+	if status := m.GetStatus(); status["running"] != true || status["external"] != true {
+		t.Errorf("status after Stop = %+v, want running externally", status)
+	}
+
+	// 声明为 external 的服务不可达时不会在本地启动
+	server.Close()
+	external := newTestManagedService(t, &config.ManagedServiceConfig{External: true, Health: &config.HealthCheckConfig{URL: server.URL}})
+	if !external.IsInstalled() {
+		t.Error("external service reports not installed")
+	}
+	if err := external.Start(); err == nil {
+		t.Error("starting an unreachable external service succeeded")
+	}
+	if err := external.Download(); err == nil {
+		t.Error("downloading an external service succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(external.Spec().InstallPath, "app.pid")); !os.IsNotExist(err) {
+		t.Error("external service wrote a pid file")
+	}
+}
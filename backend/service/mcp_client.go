@@ -0,0 +1,649 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// mcpProtocolVersion 客户端声明的 MCP 协议版本
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpRequestTimeout 单次 JSON-RPC 请求的默认超时时间
+const mcpRequestTimeout = 60 * time.Second
+
+// mcpMessage JSON-RPC 2.0 消息（请求、通知、响应共用）
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+// mcpError JSON-RPC 错误对象
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mcpError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// MCPTool MCP 服务器声明的工具
+type MCPTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// mcpToolCallResult tools/call 的返回结果
+type mcpToolCallResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// mcpTransport MCP 底层传输（stdio / SSE / streamable HTTP）
+// 收到的消息统一交给 MCPServerClient.dispatch 处理
+type mcpTransport interface {
+	send(ctx context.Context, data []byte) error
+	close() error
+}
+
+// MCPServerClient 单个 MCP 服务器的客户端
+// stdio 服务器的进程由内嵌的 BaseServiceManager 负责启动和停止
+type MCPServerClient struct {
+	*BaseServiceManager
+	config    *config.MCPServerConfig
+	transport mcpTransport
+	nextID    atomic.Int64
+	connectMu sync.Mutex // 串行化 Connect，避免并发的对话同时启动两个 stdio 进程
+	mu        sync.Mutex
+	pending   map[int64]chan *mcpMessage
+	tools     []MCPTool
+	connected bool
+}
+
+// NewMCPServerClient 创建 MCP 服务器客户端
+func NewMCPServerClient(ctx context.Context, cfg *config.MCPServerConfig) *MCPServerClient {
+	return &MCPServerClient{
+		BaseServiceManager: NewBaseServiceManager(ctx, "MCP:"+cfg.Name),
+		config:             cfg,
+		pending:            make(map[int64]chan *mcpMessage),
+	}
+}
+
+// Name 返回服务器名称
+func (c *MCPServerClient) Name() string {
+	return c.config.Name
+}
+
+// IsConnected 检查是否已完成握手
+func (c *MCPServerClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return false
+	}
+	// stdio 进程退出后视为断开
+	if c.config.GetTransport() == "stdio" && !c.IsRunning() {
+		return false
+	}
+	return true
+}
+
+// Connect 建立连接、完成 initialize 握手并拉取工具列表
+func (c *MCPServerClient) Connect(ctx context.Context) error {
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	if c.IsConnected() {
+		return nil
+	}
+
+	// 关闭上一次连接遗留的传输（如 stdio 进程已退出）
+	c.mu.Lock()
+	stale := c.transport
+	c.transport = nil
+	c.mu.Unlock()
+	if stale != nil {
+		stale.close()
+	}
+
+	var transport mcpTransport
+	var err error
+	switch c.config.GetTransport() {
+	case "stdio":
+		transport, err = c.startStdio()
+	case "sse":
+		transport, err = newMCPSSETransport(ctx, c.config, c.dispatch)
+	case "http":
+		transport = newMCPHTTPTransport(c.config, c.dispatch)
+	default:
+		err = fmt.Errorf("unsupported MCP transport: %s", c.config.Transport)
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.transport = transport
+	c.mu.Unlock()
+
+	initParams := map[string]interface{}{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo": map[string]string{
+			"name":    "wachat",
+			"version": "0.1.0",
+		},
+	}
+	if _, err := c.call(ctx, "initialize", initParams); err != nil {
+		c.Close()
+		return fmt.Errorf("failed to initialize MCP server %s: %w", c.config.Name, err)
+	}
+	if err := c.notify(ctx, "notifications/initialized"); err != nil {
+		c.Close()
+		return fmt.Errorf("failed to initialize MCP server %s: %w", c.config.Name, err)
+	}
+
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+
+	if _, err := c.RefreshTools(ctx); err != nil {
+		g.Log().Warningf(c.ctx, "Failed to list tools of MCP server %s: %v", c.config.Name, err)
+	}
+
+	g.Log().Infof(c.ctx, "MCP server %s connected (%s)", c.config.Name, c.config.GetTransport())
+	return nil
+}
+
+// startStdio 启动 stdio MCP 服务器进程
+// 使用 os.Pipe 而非 StdoutPipe，避免 BaseServiceManager 的 Wait 提前关闭读端
+func (c *MCPServerClient) startStdio() (mcpTransport, error) {
+	if c.config.Command == "" {
+		return nil, fmt.Errorf("MCP server %s: command is required for stdio transport", c.config.Name)
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	cmd := exec.Command(c.config.Command, c.config.Args...)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range c.config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	err = c.StartProcess(cmd, "MCP server "+c.config.Name)
+	// 子进程已继承这两端，父进程关闭自己的副本
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+
+	t := &mcpStdioTransport{stdin: stdinW, stdout: stdoutR}
+	go t.readLoop(c.dispatch, c.failPending)
+	return t, nil
+}
+
+// Close 断开连接（stdio 服务器会停止进程）
+func (c *MCPServerClient) Close() error {
+	c.mu.Lock()
+	c.connected = false
+	transport := c.transport
+	c.transport = nil
+	c.mu.Unlock()
+
+	if transport != nil {
+		transport.close()
+	}
+	c.failPending(fmt.Errorf("MCP server %s disconnected", c.config.Name))
+
+	if c.IsRunning() {
+		return c.StopProcess("MCP server " + c.config.Name)
+	}
+	return nil
+}
+
+// Tools 返回缓存的工具列表
+func (c *MCPServerClient) Tools() []MCPTool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tools
+}
+
+// RefreshTools 重新拉取工具列表（支持分页）
+func (c *MCPServerClient) RefreshTools(ctx context.Context) ([]MCPTool, error) {
+	var tools []MCPTool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.call(ctx, "tools/list", params)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Tools      []MCPTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode tools/list result: %w", err)
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	c.mu.Lock()
+	c.tools = tools
+	c.mu.Unlock()
+	return tools, nil
+}
+
+// CallTool 调用工具，返回拼接后的文本结果
+func (c *MCPServerClient) CallTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	raw, err := c.call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": arguments,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result mcpToolCallResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("failed to decode tools/call result: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(content.Text)
+		}
+	}
+	if result.IsError {
+		return "", fmt.Errorf("tool %s returned error: %s", name, sb.String())
+	}
+	return sb.String(), nil
+}
+
+// call 发送 JSON-RPC 请求并等待响应
+func (c *MCPServerClient) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := c.nextID.Add(1)
+	respChan := make(chan *mcpMessage, 1)
+
+	c.mu.Lock()
+	transport := c.transport
+	c.pending[id] = respChan
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if transport == nil {
+		return nil, fmt.Errorf("MCP server %s is not connected", c.config.Name)
+	}
+
+	data, err := json.Marshal(&mcpMessage{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpRequestTimeout)
+	defer cancel()
+
+	if err := transport.send(ctx, data); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp == nil {
+			return nil, fmt.Errorf("MCP server %s disconnected", c.config.Name)
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// notify 发送 JSON-RPC 通知（无响应）
+func (c *MCPServerClient) notify(ctx context.Context, method string) error {
+	c.mu.Lock()
+	transport := c.transport
+	c.mu.Unlock()
+	if transport == nil {
+		return fmt.Errorf("MCP server %s is not connected", c.config.Name)
+	}
+
+	data, err := json.Marshal(&mcpMessage{JSONRPC: "2.0", Method: method})
+	if err != nil {
+		return err
+	}
+	return transport.send(ctx, data)
+}
+
+// dispatch 将收到的响应分发给等待中的请求，忽略服务端通知
+func (c *MCPServerClient) dispatch(data []byte) {
+	var msg mcpMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		g.Log().Debugf(c.ctx, "MCP server %s: ignoring invalid message: %s", c.config.Name, string(data))
+		return
+	}
+	if msg.ID == nil || msg.Method != "" {
+		return
+	}
+
+	c.mu.Lock()
+	respChan, ok := c.pending[*msg.ID]
+	c.mu.Unlock()
+	if ok {
+		respChan <- &msg
+	}
+}
+
+// failPending 让所有等待中的请求立即失败
+func (c *MCPServerClient) failPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, respChan := range c.pending {
+		select {
+		case respChan <- nil:
+		default:
+		}
+		delete(c.pending, id)
+	}
+	if err != nil {
+		c.connected = false
+	}
+}
+
+// mcpStdioTransport 按行分隔的 JSON-RPC over stdio
+type mcpStdioTransport struct {
+	mu     sync.Mutex
+	stdin  *os.File
+	stdout *os.File
+}
+
+func (t *mcpStdioTransport) send(ctx context.Context, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *mcpStdioTransport) close() error {
+	t.stdin.Close()
+	return t.stdout.Close()
+}
+
+func (t *mcpStdioTransport) readLoop(dispatch func([]byte), onClose func(error)) {
+	reader := bufio.NewReaderSize(t.stdout, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			dispatch(line)
+		}
+		if err != nil {
+			onClose(err)
+			return
+		}
+	}
+}
+
+// mcpHTTPTransport MCP streamable HTTP 传输
+// 每条消息 POST 到同一地址，响应可能是 JSON 或 SSE 流
+type mcpHTTPTransport struct {
+	config     *config.MCPServerConfig
+	httpClient *http.Client
+	dispatch   func([]byte)
+	sessionID  atomic.Value
+}
+
+func newMCPHTTPTransport(cfg *config.MCPServerConfig, dispatch func([]byte)) *mcpHTTPTransport {
+	return &mcpHTTPTransport{
+		config:     cfg,
+		httpClient: &http.Client{},
+		dispatch:   dispatch,
+	}
+}
+
+func (t *mcpHTTPTransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.config.Headers {
+		req.Header.Set(k, v)
+	}
+	if sid, ok := t.sessionID.Load().(string); ok && sid != "" {
+		req.Header.Set("Mcp-Session-Id", sid)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.sessionID.Store(sid)
+	}
+
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("MCP server returned %s: %s", resp.Status, string(body))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readSSE(resp.Body, func(event, data string) {
+			if event == "" || event == "message" {
+				t.dispatch([]byte(data))
+			}
+		})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		t.dispatch(body)
+	}
+	return nil
+}
+
+func (t *mcpHTTPTransport) close() error {
+	return nil
+}
+
+// mcpSSETransport 旧版 MCP SSE 传输
+// GET 建立事件流，服务器通过 endpoint 事件告知消息 POST 地址
+type mcpSSETransport struct {
+	config     *config.MCPServerConfig
+	httpClient *http.Client
+	endpoint   string
+	cancel     context.CancelFunc
+}
+
+func newMCPSSETransport(ctx context.Context, cfg *config.MCPServerConfig, dispatch func([]byte)) (*mcpSSETransport, error) {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect to MCP server %s: %w", cfg.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("MCP server %s returned %s", cfg.Name, resp.Status)
+	}
+
+	t := &mcpSSETransport{
+		config:     cfg,
+		httpClient: httpClient,
+		cancel:     cancel,
+	}
+
+	endpointChan := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				select {
+				case endpointChan <- data:
+				default:
+				}
+			case "", "message":
+				dispatch([]byte(data))
+			}
+		})
+	}()
+
+	select {
+	case endpoint := <-endpointChan:
+		base, err := url.Parse(cfg.URL)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		ref, err := url.Parse(endpoint)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid MCP endpoint %q: %w", endpoint, err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+	case <-time.After(30 * time.Second):
+		cancel()
+		return nil, fmt.Errorf("timeout waiting for MCP endpoint event from %s", cfg.Name)
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	return t, nil
+}
+
+func (t *mcpSSETransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("MCP server returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *mcpSSETransport) close() error {
+	t.cancel()
+	return nil
+}
+
+// readSSE 解析 text/event-stream，每个事件回调一次
+func readSSE(r io.Reader, onEvent func(event, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				onEvent(event, strings.Join(data, "\n"))
+			}
+			event = ""
+			data = nil
+		case strings.HasPrefix(line, ":"):
+			// 注释行
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		onEvent(event, strings.Join(data, "\n"))
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// buildMCPEcho 编译 testdata/mcpecho，返回可执行文件路径
+func buildMCPEcho(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "mcpecho")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	goBin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if out, err := exec.Command(goBin, "build", "-o", bin, "./testdata/mcpecho").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build mcpecho: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestMCPClientStdio(t *testing.T) {
+	bin := buildMCPEcho(t)
+	ctx := context.Background()
+	client := NewMCPServerClient(ctx, &config.MCPServerConfig{Name: "echo", Command: bin})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Close()
+
+	if !client.IsConnected() {
+		t.Fatal("client is not connected after Connect")
+	}
+	var names []string
+	for _, tool := range client.Tools() {
+		names = append(names, tool.Name)
+	}
+	if len(names) != 2 || names[0] != "echo" || names[1] != "add" {
+		t.Fatalf("tools = %v, want [echo add]", names)
+	}
+
+	tests := []struct {
+		tool, args, want string
+		wantErr          bool
+	}{
+		{"echo", `{"text":"hello"}`, "hello", false},
+		{"add", `{"a":1.5,"b":2}`, "3.5", false},
+		{"add", ``, "0", false},
+		{"missing", `{}`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := client.CallTool(ctx, tt.tool, []byte(tt.args))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CallTool(%s, %s) error = %v, wantErr %v", tt.tool, tt.args, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CallTool(%s, %s) = %q, want %q", tt.tool, tt.args, got, tt.want)
+		}
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if client.IsConnected() || client.IsRunning() {
+		t.Fatal("client still connected or running after Close")
+	}
+	if _, err := client.CallTool(ctx, "echo", []byte(`{"text":"x"}`)); err == nil {
+		t.Fatal("CallTool after Close succeeded")
+	}
+}
+
+func TestMCPClientConcurrentConnect(t *testing.T) {
+	bin := buildMCPEcho(t)
+	starts := filepath.Join(t.TempDir(), "starts")
+	ctx := context.Background()
+	client := NewMCPServerClient(ctx, &config.MCPServerConfig{
+		Name:    "echo",
+		Command: bin,
+		Env:     map[string]string{"MCPECHO_STARTS": starts},
+	})
+	defer client.Close()
+
+	// 并发的对话同时连接时只能启动一个进程，其余调用复用已建立的连接
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.Connect(ctx)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Connect: %v", err)
+		}
+	}
+	if got, err := client.CallTool(ctx, "echo", []byte(`{"text":"once"}`)); err != nil || got != "once" {
+		t.Fatalf("CallTool = %q, %v", got, err)
+	}
+	data, err := os.ReadFile(starts)
+	if err != nil {
+		t.Fatalf("read start log: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 1 {
+		t.Fatalf("mcpecho started %d times, want 1", n)
+	}
+}
+
+func TestMCPManagerCallToolAllowedServers(t *testing.T) {
+	bin := buildMCPEcho(t)
+	ctx := context.Background()
+	m := NewMCPManagerService(ctx, &config.MCPConfig{
+		Enabled: true,
+		Servers: []*config.MCPServerConfig{
+			{Name: "echo", Command: bin},
+			{Name: "other", Command: bin},
+		},
+	})
+	defer m.StopAll()
+
+	got, err := m.CallTool(ctx, []string{"echo"}, "echo__echo", `{"text":"hi"}`)
+	if err != nil || got != "hi" {
+		t.Fatalf("CallTool(echo__echo) = %q, %v", got, err)
+	}
+
+	// 会话未启用的服务器不能被调用，也不会被启动
+	if _, err := m.CallTool(ctx, []string{"echo"}, "other__echo", `{"text":"hi"}`); err == nil {
+		t.Fatal("CallTool on a server not enabled for the conversation succeeded")
+	}
+	other, _ := m.getClient("other")
+	if other.IsConnected() || other.IsRunning() {
+		t.Fatal("server not enabled for the conversation was started")
+	}
+
+	if _, err := m.CallTool(ctx, []string{"echo"}, "echo", `{}`); err == nil {
+		t.Fatal("CallTool with an invalid tool name succeeded")
+	}
+}
+
+func TestSplitMCPToolName(t *testing.T) {
+	tests := []struct {
+		name         string
+		servers      []string
+		server, tool string
+		ok           bool
+	}{
+		{"echo__echo", []string{"echo"}, "echo", "echo", true},
+		{"my__srv__echo", []string{"my__srv"}, "my__srv", "echo", true},
+		{"my__srv__echo", []string{"my", "my__srv"}, "my__srv", "echo", true},
+		{"my__srv__echo", []string{"my"}, "my", "srv__echo", true},
+		{"echo__read__file", []string{"echo"}, "echo", "read__file", true},
+		{"other__echo", []string{"echo"}, "", "", false},
+		{"echo__", []string{"echo"}, "", "", false},
+		{"echo", []string{"echo"}, "", "", false},
+		{"echo__echo", nil, "", "", false},
+	}
+	for _, tt := range tests {
+		server, tool, ok := splitMCPToolName(tt.name, tt.servers)
+		if server != tt.server || tool != tt.tool || ok != tt.ok {
+			t.Errorf("splitMCPToolName(%q, %v) = %q, %q, %v, want %q, %q, %v", tt.name, tt.servers, server, tool, ok, tt.server, tt.tool, tt.ok)
+		}
+	}
+}
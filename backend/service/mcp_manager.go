@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// mcpToolSeparator 工具全名中服务器名与工具名之间的分隔符
+// 暴露给模型的工具名为 {server}__{tool}，避免不同服务器的同名工具冲突
+const mcpToolSeparator = "__"
+
+// MCPManagerService 管理所有 MCP 服务器的连接，并将其工具暴露给对话模型
+type MCPManagerService struct {
+	ctx     context.Context
+	config  *config.MCPConfig
+	mu      sync.RWMutex
+	clients map[string]*MCPServerClient
+}
+
+// NewMCPManagerService 创建 MCP 管理器服务
+func NewMCPManagerService(ctx context.Context, cfg *config.MCPConfig) *MCPManagerService {
+	m := &MCPManagerService{
+		ctx:     ctx,
+		config:  cfg,
+		clients: make(map[string]*MCPServerClient),
+	}
+	if cfg != nil {
+		for _, serverCfg := range cfg.Servers {
+			if serverCfg == nil || serverCfg.Name == "" {
+				continue
+			}
+			m.clients[serverCfg.Name] = NewMCPServerClient(ctx, serverCfg)
+		}
+	}
+	return m
+}
+
+// IsEnabled 检查 MCP 是否启用
+func (m *MCPManagerService) IsEnabled() bool {
+	return m.config.IsEnabled()
+}
+
+// getClient 按名称获取客户端
+func (m *MCPManagerService) getClient(name string) (*MCPServerClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	client, ok := m.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("MCP server %s is not configured", name)
+	}
+	return client, nil
+}
+
+// StartAutoStart 连接所有配置了 autoStart 的服务器
+func (m *MCPManagerService) StartAutoStart() {
+	if !m.IsEnabled() {
+		return
+	}
+	for _, serverCfg := range m.config.Servers {
+		if serverCfg == nil || !serverCfg.AutoStart {
+			continue
+		}
+		if err := m.Start(serverCfg.Name); err != nil {
+			g.Log().Warningf(m.ctx, "Warning: Failed to auto-start MCP server %s: %v", serverCfg.Name, err)
+		}
+	}
+}
+
+// Start 连接指定的 MCP 服务器（stdio 服务器会启动进程）
+func (m *MCPManagerService) Start(name string) error {
+	if !m.IsEnabled() {
+		return fmt.Errorf("MCP is not enabled")
+	}
+	client, err := m.getClient(name)
+	if err != nil {
+		return err
+	}
+	return client.Connect(m.ctx)
+}
+
+// Stop 断开指定的 MCP 服务器
+func (m *MCPManagerService) Stop(name string) error {
+	client, err := m.getClient(name)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// StopAll 断开所有 MCP 服务器
+func (m *MCPManagerService) StopAll() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, client := range m.clients {
+		if !client.IsConnected() && !client.IsRunning() {
+			continue
+		}
+		if err := client.Close(); err != nil {
+			g.Log().Warningf(m.ctx, "Warning: Failed to stop MCP server %s: %v", name, err)
+		}
+	}
+}
+
+// ListServers 返回所有 MCP 服务器的状态
+func (m *MCPManagerService) ListServers() []map[string]interface{} {
+	servers := make([]map[string]interface{}, 0)
+	if m.config == nil {
+		return servers
+	}
+	for _, serverCfg := range m.config.Servers {
+		if serverCfg == nil || serverCfg.Name == "" {
+			continue
+		}
+		client, err := m.getClient(serverCfg.Name)
+		if err != nil {
+			continue
+		}
+		toolNames := make([]string, 0)
+		for _, tool := range client.Tools() {
+			toolNames = append(toolNames, tool.Name)
+		}
+		servers = append(servers, map[string]interface{}{
+			"name":      serverCfg.Name,
+			"transport": serverCfg.GetTransport(),
+			"connected": client.IsConnected(),
+			"tools":     toolNames,
+		})
+	}
+	return servers
+}
+
+// ListTools 返回指定服务器的工具（转换为 eino ToolInfo）
+// 未连接的服务器会先尝试连接
+func (m *MCPManagerService) ListTools(ctx context.Context, servers []string) ([]*schema.ToolInfo, error) {
+	if !m.IsEnabled() {
+		return nil, nil
+	}
+
+	var toolInfos []*schema.ToolInfo
+	for _, name := range servers {
+		client, err := m.getClient(name)
+		if err != nil {
+			g.Log().Warningf(ctx, "Skipping MCP server: %v", err)
+			continue
+		}
+		if !client.IsConnected() {
+			if err := client.Connect(ctx); err != nil {
+				g.Log().Warningf(ctx, "Skipping MCP server %s: %v", name, err)
+				continue
+			}
+		}
+		for _, tool := range client.Tools() {
+			info, err := mcpToolToToolInfo(name, tool)
+			if err != nil {
+				g.Log().Warningf(ctx, "Skipping MCP tool %s/%s: %v", name, tool.Name, err)
+				continue
+			}
+			toolInfos = append(toolInfos, info)
+		}
+	}
+	return toolInfos, nil
+}
+
+// CallTool 按全名（{server}__{tool}）调用工具，只允许调用 servers（会话启用的服务器）中的工具，
+// 模型返回的其他工具名（幻觉或提示注入）会被拒绝，不会连接或启动对应的服务器
+func (m *MCPManagerService) CallTool(ctx context.Context, servers []string, name, arguments string) (string, error) {
+	serverName, toolName, ok := splitMCPToolName(name, servers)
+	if !ok {
+		if !strings.Contains(name, mcpToolSeparator) {
+			return "", fmt.Errorf("invalid MCP tool name: %s", name)
+		}
+		return "", fmt.Errorf("MCP tool %s does not belong to a server enabled for this conversation", name)
+	}
+	client, err := m.getClient(serverName)
+	if err != nil {
+		return "", err
+	}
+	if !client.IsConnected() {
+		if err := client.Connect(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	g.Log().Infof(ctx, "Calling MCP tool %s/%s with arguments: %s", serverName, toolName, arguments)
+	return client.CallTool(ctx, toolName, json.RawMessage(arguments))
+}
+
+// splitMCPToolName 按会话启用的服务器名拆分工具全名，服务器名本身可能含有分隔符，
+// 多个服务器名都是前缀时取最长的
+func splitMCPToolName(name string, servers []string) (server, tool string, ok bool) {
+	for _, candidate := range servers {
+		rest, found := strings.CutPrefix(name, candidate+mcpToolSeparator)
+		if found && rest != "" && len(candidate) > len(server) {
+			server, tool, ok = candidate, rest, true
+		}
+	}
+	return server, tool, ok
+}
+
+// mcpToolToToolInfo 将 MCP 工具声明转换为 eino ToolInfo
+func mcpToolToToolInfo(serverName string, tool MCPTool) (*schema.ToolInfo, error) {
+	info := &schema.ToolInfo{
+		Name: serverName + mcpToolSeparator + tool.Name,
+		Desc: tool.Description,
+	}
+	if len(tool.InputSchema) > 0 {
+		js := &jsonschema.Schema{}
+		if err := json.Unmarshal(tool.InputSchema, js); err != nil {
+			return nil, fmt.Errorf("invalid input schema: %w", err)
+		}
+		info.ParamsOneOf = schema.NewParamsOneOfByJSONSchema(js)
+	}
+	return info, nil
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// OllamaProviderName 自动注册到 AI 配置中的提供方名称
+const OllamaProviderName = "ollama"
+
+// OllamaManagerService 管理本地 Ollama 推理服务的下载、启动和模型
+// 用于在离线环境中提供 OpenAI 兼容的本地模型
+type OllamaManagerService struct {
+	*ManagedService
+	config     atomic.Pointer[config.OllamaConfig]
+	httpClient *http.Client
+}
+
+// OllamaModel 本地已下载的模型
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// NewOllamaManagerService 创建 Ollama 管理器服务
+func NewOllamaManagerService(ctx context.Context, cfg *config.OllamaConfig) *OllamaManagerService {
+	o := &OllamaManagerService{
+		ManagedService: NewManagedService(ctx, OllamaServiceSpec(cfg)),
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+	}
+	o.config.Store(cfg)
+	return o
+}
+
+// Reconfigure 使用新的 Ollama 配置（配置变更后调用），正在运行的 Ollama 需要重启时返回 true
+func (o *OllamaManagerService) Reconfigure(cfg *config.OllamaConfig) (restart bool) {
+	o.config.Store(cfg)
+	return o.ManagedService.Reconfigure(OllamaServiceSpec(cfg))
+}
+
+// OllamaServiceSpec 返回 Ollama 的声明式服务描述
+// 文件名格式：ollama-linux-amd64.tgz / ollama-darwin.tgz / ollama-windows-amd64.zip
+// Linux 压缩包中二进制位于 bin/ 目录，macOS 和 Windows 位于根目录
+func OllamaServiceSpec(cfg *config.OllamaConfig) *config.ManagedServiceConfig {
+	return &config.ManagedServiceConfig{
+		Name:        "ollama",
+		DisplayName: "Ollama",
+		Enabled:     cfg.IsEnabled(),
+		AutoStart:   cfg.AutoStart,
+		DownloadURL: strings.TrimSuffix(cfg.DownloadURL, "/") + "/ollama-{os}-{arch}.{ext}",
+		Archive:     &config.ArchiveConfig{Format: "tgz"},
+		Binary:      "ollama",
+		Args:        []string{"serve"},
+		Env: map[string]string{
+			"OLLAMA_HOST":   cfg.GetAddress(),
+			"OLLAMA_MODELS": cfg.ModelsPath,
+		},
+		InstallPath: cfg.InstallPath,
+		Restart:     cfg.Restart,
+		StopTimeout: cfg.StopTimeout,
+		Verify:      cfg.Verify,
+		Health: &config.HealthCheckConfig{
+			Type: "http",
+			URL:  "http://" + cfg.GetAddress() + "/api/version",
+		},
+		Platforms: map[string]*config.ManagedServicePlatform{
+			// macOS 为通用二进制，不区分架构
+			"darwin":  {DownloadURL: strings.TrimSuffix(cfg.DownloadURL, "/") + "/ollama-darwin.tgz"},
+			"linux":   {Binary: "bin/ollama"},
+			"windows": {Archive: &config.ArchiveConfig{Format: "zip"}},
+		},
+	}
+}
+
+// baseURL Ollama 原生 API 地址
+func (o *OllamaManagerService) baseURL() string {
+	return "http://" + o.config.Load().GetAddress()
+}
+
+// OpenAIBaseURL 返回 Ollama 的 OpenAI 兼容接口地址
+func (o *OllamaManagerService) OpenAIBaseURL() string {
+	return o.baseURL() + "/v1"
+}
+
+// Start 启动 Ollama 服务（ollama serve）
+func (o *OllamaManagerService) Start() error {
+	if err := os.MkdirAll(o.config.Load().ModelsPath, 0755); err != nil {
+		return fmt.Errorf("failed to create models directory: %w", err)
+	}
+	return o.ManagedService.Start()
+}
+
+// GetStatus 获取 Ollama 服务状态
+func (o *OllamaManagerService) GetStatus() map[string]interface{} {
+	status := o.ManagedService.GetStatus()
+	status["baseURL"] = o.OpenAIBaseURL()
+	return status
+}
+
+// ListModels 列出本地已下载的模型
+func (o *OllamaManagerService) ListModels() ([]OllamaModel, error) {
+	resp, err := o.httpClient.Get(o.baseURL() + "/api/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ollama models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Models, nil
+}
+
+// PullModel 拉取模型，通过进度回调报告下载进度
+func (o *OllamaManagerService) PullModel(name string) error {
+	if name == "" {
+		return fmt.Errorf("model name is required")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"model": name, "stream": true})
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodPost, o.baseURL()+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// 拉取大模型耗时较长，不使用带超时的 httpClient
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to pull model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Ollama API error: %s, body: %s", resp.Status, string(data))
+	}
+
+	g.Log().Infof(o.ctx, "Pulling Ollama model: %s", name)
+
+	// 响应为逐行 JSON 的进度流
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress struct {
+			Status    string `json:"status"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+			continue
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull model %s: %s", name, progress.Error)
+		}
+		percent := 0.0
+		if progress.Total > 0 {
+			percent = float64(progress.Completed) / float64(progress.Total) * 100
+		}
+		o.NotifyProgress(progress.Completed, progress.Total, percent, fmt.Sprintf("%s: %s", name, progress.Status))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read pull progress: %w", err)
+	}
+
+	g.Log().Infof(o.ctx, "Ollama model pulled: %s", name)
+	return nil
+}
+
+// RegisterProvider 将本地 Ollama 的 OpenAI 兼容接口注册为 AI 提供方
+func (o *OllamaManagerService) RegisterProvider() error {
+	models, err := o.ListModels()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+
+	return config.RegisterAIProvider(o.ctx, &config.AIProviderConfig{
+		Name:    OllamaProviderName,
+		BaseURL: o.OpenAIBaseURL(),
+		APIKey:  OllamaProviderName, // Ollama 不校验 key，但 OpenAI 客户端要求非空
+		Models:  names,
+	})
+}
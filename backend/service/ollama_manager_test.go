@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// newTestOllama 创建连接到 handler 的 Ollama 管理器
+func newTestOllama(t *testing.T, handler http.Handler) *OllamaManagerService {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, _ := strconv.Atoi(port)
+	dir := t.TempDir()
+	return NewOllamaManagerService(context.Background(), &config.OllamaConfig{
+		Enabled:     true,
+		Host:        host,
+		Port:        portNum,
+		DownloadURL: "https://example.com/ollama",
+		InstallPath: dir,
+		ModelsPath:  dir + "/models",
+	})
+}
+
+func TestOllamaListModels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[{"name":"qwen2.5:7b","size":4683087332,"digest":"abc"},{"name":"bge-m3:latest","size":1157672605}]}`)
+	})
+	mux.HandleFunc("GET /api/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version":"0.5.0"}`)
+	})
+	o := newTestOllama(t, mux)
+
+	if !strings.HasSuffix(o.OpenAIBaseURL(), "/v1") || !strings.HasPrefix(o.OpenAIBaseURL(), "http://127.0.0.1:") {
+		t.Errorf("OpenAIBaseURL = %s", o.OpenAIBaseURL())
+	}
+	if err := o.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth: %v", err)
+	}
+	models, err := o.ListModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0].Name != "qwen2.5:7b" || models[0].Size != 4683087332 || models[1].Name != "bge-m3:latest" {
+		t.Errorf("models = %+v", models)
+	}
+}
+
+func TestOllamaListModelsError(t *testing.T) {
+	o := newTestOllama(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	if _, err := o.ListModels(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("ListModels error = %v, want the HTTP status", err)
+	}
+	if err := o.CheckHealth(); err == nil {
+		t.Error("CheckHealth succeeded on a failing server")
+	}
+}
+
+func TestOllamaPullModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		status  int
+		wantErr string
+		want    []float64 // 进度回调中的百分比
+	}{
+		{
+			name:  "progress",
+			lines: []string{`{"status":"pulling manifest"}`, `not json`, `{"status":"downloading","total":200,"completed":50}`, `{"status":"downloading","total":200,"completed":200}`, `{"status":"success"}`},
+			want:  []float64{0, 25, 100, 0},
+		},
+		{
+			name:    "error in stream",
+			lines:   []string{`{"status":"pulling manifest"}`, `{"error":"pull model manifest: file does not exist"}`},
+			wantErr: "file does not exist",
+			want:    []float64{0},
+		},
+		{
+			name:    "http error",
+			status:  http.StatusNotFound,
+			lines:   []string{`model not found`},
+			wantErr: "404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request map[string]interface{}
+			o := newTestOllama(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/api/pull" {
+					http.NotFound(w, r)
+					return
+				}
+				json.NewDecoder(r.Body).Decode(&request)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				fmt.Fprint(w, strings.Join(tt.lines, "\n"))
+			}))
+			var mu sync.Mutex
+			var got []float64
+			o.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
+				mu.Lock()
+				got = append(got, percent)
+				mu.Unlock()
+			})
+
+			err := o.PullModel("qwen2.5:7b")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("PullModel: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("PullModel error = %v, want %q", err, tt.wantErr)
+			}
+			if request["model"] != "qwen2.5:7b" || request["stream"] != true {
+				t.Errorf("request = %v", request)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("progress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	o := newTestOllama(t, http.NotFoundHandler())
+	if err := o.PullModel(""); err == nil {
+		t.Error("PullModel with an empty name succeeded")
+	}
+}
@@ -0,0 +1,670 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// startFailureLogLines 启动失败时错误信息中附带的最近日志行数
+const startFailureLogLines = 10
+
+// Supervisable 可由编排器管理的服务（各服务管理器和 BinaryManager 中的进程都满足该接口）
+type Supervisable interface {
+	ServiceName() string
+	IsInstalled() bool
+	IsRunning() bool
+	Start() error
+	Stop() error
+	CheckHealth() error
+	GetStatus() map[string]interface{}
+}
+
+// serviceNode 依赖图中的一个服务
+type serviceNode struct {
+	name      string
+	service   Supervisable
+	dependsOn []string
+	autoStart bool
+}
+
+// ServiceOrchestrator 按依赖关系编排服务：拓扑顺序启动并在每一步等待健康，逆序停止
+type ServiceOrchestrator struct {
+	ctx           context.Context
+	mu            sync.Mutex
+	nodes         map[string]*serviceNode
+	order         []string // 注册顺序，作为拓扑排序中的次序依据
+	healthTimeout time.Duration
+}
+
+// NewServiceOrchestrator 创建服务编排器
+func NewServiceOrchestrator(ctx context.Context) *ServiceOrchestrator {
+	return &ServiceOrchestrator{
+		ctx:           ctx,
+		nodes:         make(map[string]*serviceNode),
+		healthTimeout: 30 * time.Second,
+	}
+}
+
+// Register 注册服务及其依赖
+func (o *ServiceOrchestrator) Register(name string, svc Supervisable, dependsOn []string, autoStart bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, exists := o.nodes[name]; exists {
+		return fmt.Errorf("service already registered: %s", name)
+	}
+	o.nodes[name] = &serviceNode{
+		name:      name,
+		service:   svc,
+		dependsOn: append([]string(nil), dependsOn...),
+		autoStart: autoStart,
+	}
+	o.order = append(o.order, name)
+	return nil
+}
+
+// Update 更新已注册服务的依赖和自动启动设置（配置变更后调用）
+func (o *ServiceOrchestrator) Update(name string, dependsOn []string, autoStart bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	node, ok := o.nodes[name]
+	if !ok {
+		return fmt.Errorf("service not found: %s", name)
+	}
+	// 替换节点而不是原地修改，正在执行的启动计划仍使用原来的节点
+	o.nodes[name] = &serviceNode{
+		name:      name,
+		service:   node.service,
+		dependsOn: append([]string(nil), dependsOn...),
+		autoStart: autoStart,
+	}
+	return nil
+}
+
+// Restart 重启服务：先按逆序停止它和依赖它的服务，再按拓扑顺序启动它以及之前在运行的依赖方
+func (o *ServiceOrchestrator) Restart(name string) error {
+	order, err := o.sorted()
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	if _, ok := o.nodes[name]; !ok {
+		o.mu.Unlock()
+		return fmt.Errorf("service not found: %s", name)
+	}
+	dependents := o.dependentsOf(name)
+	o.mu.Unlock()
+
+	roots := []string{name}
+	for _, node := range order {
+		if dependents[node.name] && isActive(node.service) {
+			roots = append(roots, node.name)
+		}
+	}
+
+	if err := o.Stop(name); err != nil {
+		return err
+	}
+	plan, err := o.plan(roots)
+	if err != nil {
+		return err
+	}
+	for _, node := range plan {
+		if err := o.startNode(node, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetEventCallback 为所有支持事件的服务设置事件回调（崩溃、重启等）
+func (o *ServiceOrchestrator) SetEventCallback(callback ServiceEventCallback) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, name := range o.order {
+		if notifier, ok := o.nodes[name].service.(interface {
+			SetEventCallback(ServiceEventCallback)
+		}); ok {
+			notifier.SetEventCallback(callback)
+		}
+	}
+}
+
+// Get 返回指定名称的服务
+func (o *ServiceOrchestrator) Get(name string) (Supervisable, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	node, ok := o.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", name)
+	}
+	return node.service, nil
+}
+
+// Start 启动指定服务，先按拓扑顺序启动其依赖，每一步都等待健康
+// notify 用于向调用方报告进度，可以为 nil
+func (o *ServiceOrchestrator) Start(name string, notify func(status string)) error {
+	plan, err := o.plan([]string{name})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range plan {
+		if err := o.startNode(node, notify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartAutoStart 启动所有标记为 autoStart 的服务及其依赖
+// 某个服务失败时，依赖它的服务会被跳过，其他服务继续启动
+func (o *ServiceOrchestrator) StartAutoStart() error {
+	o.mu.Lock()
+	var roots []string
+	for _, name := range o.order {
+		if o.nodes[name].autoStart {
+			roots = append(roots, name)
+		}
+	}
+	o.mu.Unlock()
+
+	if len(roots) == 0 {
+		return nil
+	}
+
+	plan, err := o.plan(roots)
+	if err != nil {
+		return err
+	}
+
+	// 未启动的服务及原因，依赖它们的服务被跳过
+	failed := make(map[string]string)
+	var errs []error
+	for _, node := range plan {
+		if dep := firstFailed(node.dependsOn, failed); dep != "" {
+			failed[node.name] = "was skipped"
+			errs = append(errs, fmt.Errorf("skipped %s: dependency %s %s", node.name, dep, failed[dep]))
+			continue
+		}
+		if !node.service.IsInstalled() && node.service.CheckHealth() != nil {
+			failed[node.name] = "is not installed"
+			g.Log().Infof(o.ctx, "%s auto-start is enabled but it is not installed yet", node.service.ServiceName())
+			continue
+		}
+		if err := o.startNode(node, nil); err != nil {
+			failed[node.name] = "failed"
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stop 停止指定服务，依赖它且正在运行的服务会先按逆序停止
+func (o *ServiceOrchestrator) Stop(name string) error {
+	order, err := o.sorted()
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	target, ok := o.nodes[name]
+	if !ok {
+		o.mu.Unlock()
+		return fmt.Errorf("service not found: %s", name)
+	}
+	dependents := o.dependentsOf(name)
+	o.mu.Unlock()
+
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		if !dependents[node.name] || !isActive(node.service) {
+			continue
+		}
+		g.Log().Infof(o.ctx, "Stopping %s (depends on %s)...", node.service.ServiceName(), name)
+		if err := node.service.Stop(); err != nil {
+			g.Log().Warningf(o.ctx, "Warning: Failed to stop %s: %v", node.name, err)
+		}
+	}
+
+	return target.service.Stop()
+}
+
+// StopAll 按拓扑逆序停止所有正在运行的服务
+func (o *ServiceOrchestrator) StopAll() {
+	order, err := o.sorted()
+	if err != nil {
+		// 依赖图有环时退化为按注册逆序停止
+		g.Log().Warningf(o.ctx, "Warning: %v, stopping in reverse registration order", err)
+		o.mu.Lock()
+		order = make([]*serviceNode, 0, len(o.order))
+		for _, name := range o.order {
+			order = append(order, o.nodes[name])
+		}
+		o.mu.Unlock()
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		if !isActive(node.service) {
+			continue
+		}
+		g.Log().Infof(o.ctx, "Stopping %s...", node.service.ServiceName())
+		if err := node.service.Stop(); err != nil {
+			g.Log().Warningf(o.ctx, "Warning: Failed to stop %s: %v", node.name, err)
+		}
+	}
+}
+
+// Logs 返回指定服务的输出日志
+func (o *ServiceOrchestrator) Logs(name string) (*ServiceLog, error) {
+	svc, err := o.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	logs := serviceLogs(svc)
+	if logs == nil {
+		return nil, fmt.Errorf("service %s has no captured logs", name)
+	}
+	return logs, nil
+}
+
+// SetLogConfig 为所有捕获日志的服务应用轮转与缓冲区设置
+func (o *ServiceOrchestrator) SetLogConfig(cfg *config.ServiceLogConfig) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, name := range o.order {
+		if logs := serviceLogs(o.nodes[name].service); logs != nil {
+			logs.Configure(cfg)
+		}
+	}
+}
+
+// versionedService 支持版本管理的服务
+type versionedService interface {
+	CheckForUpdates() (*UpdateInfo, error)
+	Upgrade() error
+	Rollback() error
+}
+
+// CheckForUpdates 检查所有支持版本管理的服务是否有新版本（已禁用、外部及无下载地址的服务除外）
+func (o *ServiceOrchestrator) CheckForUpdates() []*UpdateInfo {
+	o.mu.Lock()
+	nodes := make([]*serviceNode, 0, len(o.order))
+	for _, name := range o.order {
+		nodes = append(nodes, o.nodes[name])
+	}
+	o.mu.Unlock()
+
+	updates := make([]*UpdateInfo, 0, len(nodes))
+	for _, node := range nodes {
+		svc, ok := node.service.(versionedService)
+		if !ok {
+			continue
+		}
+		if spec, ok := node.service.(interface {
+			Spec() *config.ManagedServiceConfig
+		}); ok && (spec.Spec().External || !spec.Spec().Enabled || spec.Spec().DownloadURL == "") {
+			continue
+		}
+		info, err := svc.CheckForUpdates()
+		if err != nil {
+			g.Log().Warningf(o.ctx, "Failed to check for updates of %s: %v", node.name, err)
+		}
+		updates = append(updates, info)
+	}
+	return updates
+}
+
+// Upgrade 将指定服务升级到最新版本，保留当前版本用于回滚
+func (o *ServiceOrchestrator) Upgrade(name string) error {
+	svc, err := o.versioned(name)
+	if err != nil {
+		return err
+	}
+	return svc.Upgrade()
+}
+
+// Rollback 将指定服务切换回上一个版本
+func (o *ServiceOrchestrator) Rollback(name string) error {
+	svc, err := o.versioned(name)
+	if err != nil {
+		return err
+	}
+	return svc.Rollback()
+}
+
+// CancelDownload 取消指定服务正在进行的下载
+func (o *ServiceOrchestrator) CancelDownload(name string) error {
+	svc, err := o.Get(name)
+	if err != nil {
+		return err
+	}
+	downloader, ok := svc.(interface{ CancelDownload() error })
+	if !ok {
+		return fmt.Errorf("service %s does not support downloads", name)
+	}
+	return downloader.CancelDownload()
+}
+
+// InstallFromArchive 从本地安装包离线安装指定服务
+func (o *ServiceOrchestrator) InstallFromArchive(name, archivePath string) error {
+	svc, err := o.Get(name)
+	if err != nil {
+		return err
+	}
+	installer, ok := svc.(interface{ InstallFromArchive(string) error })
+	if !ok {
+		return fmt.Errorf("service %s cannot be installed from an archive", name)
+	}
+	return installer.InstallFromArchive(archivePath)
+}
+
+// versioned 返回支持版本管理的服务
+func (o *ServiceOrchestrator) versioned(name string) (versionedService, error) {
+	node, err := o.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	svc, ok := node.(versionedService)
+	if !ok {
+		return nil, fmt.Errorf("service %s does not support versions", name)
+	}
+	return svc, nil
+}
+
+// CleanupOrphans 清理上次崩溃遗留的服务进程（依据各服务的 PID 文件）
+func (o *ServiceOrchestrator) CleanupOrphans() {
+	o.mu.Lock()
+	nodes := make([]*serviceNode, 0, len(o.order))
+	for _, name := range o.order {
+		nodes = append(nodes, o.nodes[name])
+	}
+	o.mu.Unlock()
+
+	for _, node := range nodes {
+		cleaner, ok := node.service.(interface{ CleanupOrphan() error })
+		if !ok || node.service.IsRunning() {
+			continue
+		}
+		if err := cleaner.CleanupOrphan(); err != nil {
+			g.Log().Warningf(o.ctx, "Warning: Failed to clean up orphaned %s: %v", node.name, err)
+		}
+	}
+}
+
+// IsActive 检查服务是否正在运行或等待自动重启
+func (o *ServiceOrchestrator) IsActive(name string) bool {
+	svc, err := o.Get(name)
+	return err == nil && isActive(svc)
+}
+
+// GetStatus 返回所有服务的状态以及汇总状态
+// state：healthy（运行中的服务都健康且 autoStart 服务都在运行）/ degraded / stopped
+func (o *ServiceOrchestrator) GetStatus() map[string]interface{} {
+	o.mu.Lock()
+	nodes := make([]*serviceNode, 0, len(o.order))
+	for _, name := range o.order {
+		nodes = append(nodes, o.nodes[name])
+	}
+	o.mu.Unlock()
+
+	services := make([]map[string]interface{}, 0, len(nodes))
+	running, healthy := 0, 0
+	degraded := false
+	for _, node := range nodes {
+		status := node.service.GetStatus()
+		status["name"] = node.name
+		status["displayName"] = node.service.ServiceName()
+		status["dependsOn"] = node.dependsOn
+		status["autoStart"] = node.autoStart
+		services = append(services, status)
+
+		isRunning, _ := status["running"].(bool)
+		isHealthy, _ := status["healthy"].(bool)
+		if isRunning {
+			running++
+		}
+		if isHealthy {
+			healthy++
+		}
+		if (isRunning && !isHealthy) || (node.autoStart && !isRunning && !isHealthy) {
+			degraded = true
+		}
+	}
+
+	state := "healthy"
+	switch {
+	case running == 0 && healthy == 0:
+		state = "stopped"
+	case degraded:
+		state = "degraded"
+	}
+
+	return map[string]interface{}{
+		"state":    state,
+		"total":    len(nodes),
+		"running":  running,
+		"healthy":  healthy,
+		"services": services,
+	}
+}
+
+// startNode 启动单个服务并等待其健康（已健康的服务直接跳过）
+func (o *ServiceOrchestrator) startNode(node *serviceNode, notify func(status string)) error {
+	displayName := node.service.ServiceName()
+	if node.service.IsRunning() && node.service.CheckHealth() == nil {
+		g.Log().Infof(o.ctx, "%s is already running", displayName)
+		return nil
+	}
+
+	if notify != nil {
+		notify(fmt.Sprintf("正在启动 %s...", displayName))
+	}
+	if err := node.service.Start(); err != nil {
+		return withRecentLogs(node.service, fmt.Errorf("failed to start %s: %w", displayName, err))
+	}
+	// 已接管外部运行的实例时无需等待
+	if node.service.CheckHealth() == nil {
+		return nil
+	}
+
+	if notify != nil {
+		notify(fmt.Sprintf("等待 %s 服务启动...", displayName))
+	}
+	if err := o.waitForHealth(node); err != nil {
+		return withRecentLogs(node.service, err)
+	}
+	return nil
+}
+
+// withRecentLogs 在启动失败的错误中附上服务最近的日志，便于直接看到失败原因
+func withRecentLogs(svc Supervisable, err error) error {
+	logs := serviceLogs(svc)
+	if logs == nil {
+		return err
+	}
+	tail := logs.TailText(startFailureLogLines)
+	if tail == "" {
+		return err
+	}
+	return fmt.Errorf("%w\nrecent logs:\n%s", err, tail)
+}
+
+// serviceLogs 返回服务的输出日志（不支持日志捕获时为 nil）
+func serviceLogs(svc Supervisable) *ServiceLog {
+	if l, ok := svc.(interface{ Logs() *ServiceLog }); ok {
+		return l.Logs()
+	}
+	return nil
+}
+
+// waitForHealth 等待服务健康，进程提前退出时立即失败
+func (o *ServiceOrchestrator) waitForHealth(node *serviceNode) error {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutChan := time.After(o.healthTimeout)
+	for {
+		select {
+		case <-timeoutChan:
+			return fmt.Errorf("timeout waiting for %s to become healthy", node.service.ServiceName())
+		case <-ticker.C:
+			if err := node.service.CheckHealth(); err == nil {
+				g.Log().Infof(o.ctx, "%s is healthy", node.service.ServiceName())
+				return nil
+			}
+			if !node.service.IsRunning() {
+				return fmt.Errorf("%s exited before becoming healthy", node.service.ServiceName())
+			}
+		}
+	}
+}
+
+// plan 返回启动 roots 所需的全部服务（含传递依赖），按拓扑顺序排列
+func (o *ServiceOrchestrator) plan(roots []string) ([]*serviceNode, error) {
+	order, err := o.sorted()
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	needed := make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if needed[name] {
+			return nil
+		}
+		node, ok := o.nodes[name]
+		if !ok {
+			return fmt.Errorf("service not found: %s", name)
+		}
+		needed[name] = true
+		for _, dep := range node.dependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := visit(root); err != nil {
+			o.mu.Unlock()
+			return nil, err
+		}
+	}
+	o.mu.Unlock()
+
+	plan := make([]*serviceNode, 0, len(needed))
+	for _, node := range order {
+		if needed[node.name] {
+			plan = append(plan, node)
+		}
+	}
+	return plan, nil
+}
+
+// sorted 对所有服务做拓扑排序，同层按注册顺序；依赖不存在或有环时返回错误
+func (o *ServiceOrchestrator) sorted() ([]*serviceNode, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, name := range o.order {
+		for _, dep := range o.nodes[name].dependsOn {
+			if _, ok := o.nodes[dep]; !ok {
+				return nil, fmt.Errorf("service %s depends on unknown service %s", name, dep)
+			}
+		}
+	}
+
+	done := make(map[string]bool, len(o.order))
+	result := make([]*serviceNode, 0, len(o.order))
+	for len(result) < len(o.order) {
+		progressed := false
+		for _, name := range o.order {
+			node := o.nodes[name]
+			if done[name] || firstPending(node.dependsOn, done) != "" {
+				continue
+			}
+			done[name] = true
+			result = append(result, node)
+			progressed = true
+		}
+		if !progressed {
+			var cycle []string
+			for _, name := range o.order {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle among services: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return result, nil
+}
+
+// dependentsOf 返回直接或间接依赖 name 的服务（调用方需持有锁）
+func (o *ServiceOrchestrator) dependentsOf(name string) map[string]bool {
+	dependents := make(map[string]bool)
+	changed := true
+	for changed {
+		changed = false
+		for _, n := range o.order {
+			if dependents[n] {
+				continue
+			}
+			for _, dep := range o.nodes[n].dependsOn {
+				if dep == name || dependents[dep] {
+					dependents[n] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return dependents
+}
+
+// isActive 服务正在运行或等待自动重启时返回 true
+func isActive(svc Supervisable) bool {
+	if svc.IsRunning() {
+		return true
+	}
+	if restarter, ok := svc.(interface{ RestartPending() bool }); ok {
+		return restarter.RestartPending()
+	}
+	return false
+}
+
+// firstFailed 返回第一个未启动的依赖
+func firstFailed(deps []string, failed map[string]string) string {
+	for _, dep := range deps {
+		if failed[dep] != "" {
+			return dep
+		}
+	}
+	return ""
+}
+
+// firstPending 返回第一个尚未排序的依赖
+func firstPending(deps []string, done map[string]bool) string {
+	for _, dep := range deps {
+		if !done[dep] {
+			return dep
+		}
+	}
+	return ""
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeService 记录启动和停止顺序的 Supervisable
+type fakeService struct {
+	name      string
+	installed bool
+	startErr  error
+	events    *eventLog
+
+	mu      sync.Mutex
+	running bool
+}
+
+// eventLog 多个 fakeService 共享的操作记录
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) take() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := strings.Join(l.events, ", ")
+	l.events = nil
+	return events
+}
+
+func (f *fakeService) ServiceName() string { return f.name }
+func (f *fakeService) IsInstalled() bool   { return f.installed }
+
+func (f *fakeService) IsRunning() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
+}
+
+func (f *fakeService) Start() error {
+	f.events.add("start " + f.name)
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.mu.Lock()
+	f.running = true
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeService) Stop() error {
+	f.events.add("stop " + f.name)
+	f.mu.Lock()
+	f.running = false
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeService) CheckHealth() error {
+	if !f.IsRunning() {
+		return fmt.Errorf("%s is not running", f.name)
+	}
+	return nil
+}
+
+func (f *fakeService) GetStatus() map[string]interface{} {
+	return map[string]interface{}{"running": f.IsRunning(), "healthy": f.CheckHealth() == nil}
+}
+
+// fakeNode 注册到编排器的测试服务
+type fakeNode struct {
+	name      string
+	dependsOn []string
+	autoStart bool
+	missing   bool  // 未安装
+	startErr  error // 启动失败
+}
+
+// newTestOrchestrator 按顺序注册测试服务
+func newTestOrchestrator(t *testing.T, nodes ...fakeNode) (*ServiceOrchestrator, map[string]*fakeService, *eventLog) {
+	t.Helper()
+	o := NewServiceOrchestrator(context.Background())
+	events := &eventLog{}
+	services := make(map[string]*fakeService)
+	for _, n := range nodes {
+		svc := &fakeService{name: n.name, installed: !n.missing, startErr: n.startErr, events: events}
+		services[n.name] = svc
+		if err := o.Register(n.name, svc, n.dependsOn, n.autoStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o, services, events
+}
+
+func TestOrchestratorSorted(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []fakeNode
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "registration order without dependencies",
+			nodes: []fakeNode{{name: "b"}, {name: "a"}},
+			want:  "b, a",
+		},
+		{
+			name:  "dependencies first",
+			nodes: []fakeNode{{name: "app", dependsOn: []string{"rag"}}, {name: "rag", dependsOn: []string{"qdrant"}}, {name: "qdrant"}, {name: "ollama"}},
+			want:  "qdrant, ollama, rag, app",
+		},
+		{
+			name:  "diamond",
+			nodes: []fakeNode{{name: "d", dependsOn: []string{"b", "c"}}, {name: "b", dependsOn: []string{"a"}}, {name: "c", dependsOn: []string{"a"}}, {name: "a"}},
+			want:  "a, b, c, d",
+		},
+		{
+			name:    "cycle",
+			nodes:   []fakeNode{{name: "a", dependsOn: []string{"b"}}, {name: "b", dependsOn: []string{"a"}}, {name: "c"}},
+			wantErr: "dependency cycle among services: a, b",
+		},
+		{
+			name:    "unknown dependency",
+			nodes:   []fakeNode{{name: "a", dependsOn: []string{"missing"}}},
+			wantErr: "service a depends on unknown service missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _, _ := newTestOrchestrator(t, tt.nodes...)
+			order, err := o.sorted()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("sorted error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(order))
+			for i, node := range order {
+				names[i] = node.name
+			}
+			if got := strings.Join(names, ", "); got != tt.want {
+				t.Errorf("sorted = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrchestratorRegisterDuplicate(t *testing.T) {
+	o, services, _ := newTestOrchestrator(t, fakeNode{name: "a"})
+	if err := o.Register("a", services["a"], nil, false); err == nil {
+		t.Error("registering a duplicate service succeeded")
+	}
+	if _, err := o.Get("missing"); err == nil {
+		t.Error("Get of an unknown service succeeded")
+	}
+}
+
+func TestOrchestratorStartStop(t *testing.T) {
+	o, services, events := newTestOrchestrator(t,
+		fakeNode{name: "app", dependsOn: []string{"rag"}},
+		fakeNode{name: "rag", dependsOn: []string{"qdrant"}},
+		fakeNode{name: "qdrant"},
+		fakeNode{name: "ollama"},
+	)
+
+	// 启动时先按拓扑顺序启动依赖，不相关的服务不启动
+	if err := o.Start("app", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "start qdrant, start rag, start app" {
+		t.Errorf("start events = %s", got)
+	}
+	// 已运行且健康的依赖不重复启动
+	if err := o.Start("rag", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "" {
+		t.Errorf("starting a running service: %s", got)
+	}
+
+	// 停止时先逆序停止依赖它的服务
+	services["ollama"].Start()
+	events.take()
+	if err := o.Stop("qdrant"); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "stop app, stop rag, stop qdrant" {
+		t.Errorf("stop events = %s", got)
+	}
+	if !services["ollama"].IsRunning() {
+		t.Error("unrelated service was stopped")
+	}
+
+	if err := o.Start("missing", nil); err == nil {
+		t.Error("starting an unknown service succeeded")
+	}
+	if err := o.Stop("missing"); err == nil {
+		t.Error("stopping an unknown service succeeded")
+	}
+}
+
+func TestOrchestratorStopAll(t *testing.T) {
+	o, services, events := newTestOrchestrator(t,
+		fakeNode{name: "app", dependsOn: []string{"rag"}},
+		fakeNode{name: "rag"},
+		fakeNode{name: "idle"},
+	)
+	services["rag"].Start()
+	services["app"].Start()
+	events.take()
+
+	o.StopAll()
+	if got := events.take(); got != "stop app, stop rag" {
+		t.Errorf("StopAll events = %s, want running services in reverse order", got)
+	}
+}
+
+func TestOrchestratorStartAutoStart(t *testing.T) {
+	startErr := errors.New("port in use")
+	o, services, events := newTestOrchestrator(t,
+		fakeNode{name: "qdrant", autoStart: true, startErr: startErr},
+		fakeNode{name: "rag", dependsOn: []string{"qdrant"}, autoStart: true},
+		fakeNode{name: "app", dependsOn: []string{"rag"}, autoStart: true},
+		fakeNode{name: "ollama", missing: true},
+		fakeNode{name: "chat", dependsOn: []string{"ollama"}, autoStart: true},
+		fakeNode{name: "mcp", autoStart: true},
+		fakeNode{name: "manual"},
+	)
+
+	err := o.StartAutoStart()
+	if got := events.take(); got != "start qdrant, start mcp" {
+		t.Errorf("start events = %s", got)
+	}
+	if !services["mcp"].IsRunning() || services["manual"].IsRunning() {
+		t.Error("independent auto-start service did not start, or a manual service started")
+	}
+	if err == nil {
+		t.Fatal("StartAutoStart succeeded with a failing service")
+	}
+	if !errors.Is(err, startErr) {
+		t.Errorf("error %v does not wrap the start error", err)
+	}
+	for _, want := range []string{
+		"skipped rag: dependency qdrant failed",
+		"skipped app: dependency rag was skipped",
+		"skipped chat: dependency ollama is not installed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "skipped ollama") {
+		t.Errorf("a service that is not installed is reported as an error: %v", err)
+	}
+}
+
+func TestOrchestratorRestart(t *testing.T) {
+	o, services, events := newTestOrchestrator(t,
+		fakeNode{name: "app", dependsOn: []string{"rag"}},
+		fakeNode{name: "rag", dependsOn: []string{"qdrant"}},
+		fakeNode{name: "qdrant"},
+		fakeNode{name: "ollama"},
+	)
+	if err := o.Start("app", nil); err != nil {
+		t.Fatal(err)
+	}
+	services["ollama"].Start()
+	events.take()
+
+	// 依赖方逆序停止，之后按拓扑顺序重新启动
+	if err := o.Restart("qdrant"); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "stop app, stop rag, stop qdrant, start qdrant, start rag, start app" {
+		t.Errorf("restart events = %s", got)
+	}
+
+	// 之前未运行的依赖方不启动
+	services["app"].Stop()
+	events.take()
+	if err := o.Restart("qdrant"); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "stop rag, stop qdrant, start qdrant, start rag" {
+		t.Errorf("restart events = %s", got)
+	}
+	if services["app"].IsRunning() || !services["ollama"].IsRunning() {
+		t.Error("restart started a stopped dependent or stopped an unrelated service")
+	}
+
+	// 已停止的服务重启后运行
+	services["ollama"].Stop()
+	events.take()
+	if err := o.Restart("ollama"); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "stop ollama, start ollama" {
+		t.Errorf("restart events = %s", got)
+	}
+
+	if err := o.Restart("missing"); err == nil {
+		t.Error("restarting an unknown service succeeded")
+	}
+}
+
+func TestOrchestratorRestartFailure(t *testing.T) {
+	o, services, events := newTestOrchestrator(t,
+		fakeNode{name: "rag", dependsOn: []string{"qdrant"}},
+		fakeNode{name: "qdrant"},
+	)
+	if err := o.Start("rag", nil); err != nil {
+		t.Fatal(err)
+	}
+	events.take()
+
+	startErr := errors.New("port in use")
+	services["qdrant"].startErr = startErr
+	if err := o.Restart("qdrant"); !errors.Is(err, startErr) {
+		t.Errorf("Restart error = %v, want the start error", err)
+	}
+	if got := events.take(); got != "stop rag, stop qdrant, start qdrant" {
+		t.Errorf("restart events = %s, want dependents left stopped", got)
+	}
+}
+
+func TestOrchestratorUpdate(t *testing.T) {
+	o, _, events := newTestOrchestrator(t,
+		fakeNode{name: "a", autoStart: true},
+		fakeNode{name: "b"},
+	)
+
+	// 新的依赖和自动启动设置在下一次启动时生效
+	if err := o.Update("a", []string{"b"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.StartAutoStart(); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "start b, start a" {
+		t.Errorf("start events = %s", got)
+	}
+	o.StopAll()
+	events.take()
+
+	if err := o.Update("a", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.StartAutoStart(); err != nil {
+		t.Fatal(err)
+	}
+	if got := events.take(); got != "" {
+		t.Errorf("start events after disabling auto-start = %s", got)
+	}
+
+	// 更新后的依赖同样参与环检查
+	if err := o.Update("b", []string{"a"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Update("a", []string{"b"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Start("a", nil); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("Start with a cycle = %v", err)
+	}
+
+	if err := o.Update("missing", nil, true); err == nil {
+		t.Error("updating an unknown service succeeded")
+	}
+}
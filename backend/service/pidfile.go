@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// pidRecord PID 文件内容：记录由 wachat 启动的进程，用于崩溃后清理遗留进程
+type pidRecord struct {
+	PID       int       `json:"pid"`
+	Binary    string    `json:"binary"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// writePIDFile 写入 PID 文件
+func writePIDFile(path string, cmd *exec.Cmd) error {
+	data, err := json.Marshal(pidRecord{
+		PID:       cmd.Process.Pid,
+		Binary:    cmd.Path,
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readPIDFile 读取 PID 文件
+func readPIDFile(path string) (*pidRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record pidRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid pid file %s: %w", path, err)
+	}
+	return &record, nil
+}
+
+// SetPIDFile 设置 PID 文件路径，进程启动时写入，退出时删除
+func (b *BaseServiceManager) SetPIDFile(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pidFile = path
+}
+
+// CleanupOrphan 清理上次崩溃遗留的进程：PID 文件存在且对应进程仍在运行同一可执行文件时将其停止
+func (b *BaseServiceManager) CleanupOrphan() error {
+	b.mu.Lock()
+	pidFile := b.pidFile
+	running := b.isRunning
+	timeout := b.stopTimeout
+	b.mu.Unlock()
+
+	if pidFile == "" || running {
+		return nil
+	}
+
+	record, err := readPIDFile(pidFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		os.Remove(pidFile)
+		return err
+	}
+	// PID 可能已被其他进程复用，只处理仍在运行同一可执行文件的进程
+	if record.PID <= 0 || !processRunning(record.PID, record.Binary) {
+		os.Remove(pidFile)
+		return nil
+	}
+
+	process, err := os.FindProcess(record.PID)
+	if err != nil {
+		os.Remove(pidFile)
+		return nil
+	}
+
+	g.Log().Warningf(b.ctx, "Found orphaned %s process (PID: %d) left by a previous run, stopping it", b.serviceName, record.PID)
+
+	// 遗留进程不是当前进程的子进程，只能轮询判断是否已退出
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	go func() {
+		defer close(done)
+		for processRunning(record.PID, record.Binary) {
+			select {
+			case <-quit:
+				return
+			case <-time.After(stopPollInterval):
+			}
+		}
+	}()
+	method, err := stopGracefully(b.ctx, b.serviceName, process, done, timeout)
+	close(quit)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(pidFile)
+	b.emitEvent("service:orphan-cleaned", map[string]interface{}{
+		"service": b.serviceName,
+		"pid":     record.PID,
+		"method":  method,
+	})
+	return nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPIDFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "app.pid")
+	cmd := &exec.Cmd{Path: "/opt/app/bin/app", Process: &os.Process{Pid: 4242}}
+	if err := writePIDFile(path, cmd); err != nil {
+		t.Fatal(err)
+	}
+	record, err := readPIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.PID != 4242 || record.Binary != "/opt/app/bin/app" || record.StartedAt.IsZero() {
+		t.Errorf("record = %+v", record)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPIDFile(path); err == nil {
+		t.Error("reading an invalid pid file succeeded")
+	}
+}
+
+func TestStartProcessWritesPIDFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	b := NewBaseServiceManager(context.Background(), "test")
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	b.SetPIDFile(pidFile)
+	b.SetStopTimeout(1)
+
+	cmd := shellCommand(t, "exec sleep 30")
+	if err := b.StartProcess(cmd, "test"); err != nil {
+		t.Fatal(err)
+	}
+	record, err := readPIDFile(pidFile)
+	if err != nil || record.PID != cmd.Process.Pid {
+		t.Fatalf("pid file = %+v, %v, want PID %d", record, err, cmd.Process.Pid)
+	}
+	if err := b.StopProcess("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Error("pid file was not removed after the process exited")
+	}
+}
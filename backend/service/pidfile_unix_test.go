@@ -0,0 +1,75 @@
+//go:build !windows
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupOrphan(t *testing.T) {
+	b, events := newTestBaseManager(t, RestartPolicy{Policy: "never"})
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	b.SetPIDFile(pidFile)
+
+	writeRecord := func(pid int, binary string) {
+		t.Helper()
+		cmd := &exec.Cmd{Path: binary, Process: &os.Process{Pid: pid}}
+		if err := writePIDFile(pidFile, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 没有 PID 文件时什么也不做
+	if err := b.CleanupOrphan(); err != nil {
+		t.Fatal(err)
+	}
+
+	// PID 被其他可执行文件复用时只删除 PID 文件
+	other, otherDone := startTestProcess(t, "exec sleep 30")
+	writeRecord(other.Process.Pid, "/opt/app/bin/app")
+	if err := b.CleanupOrphan(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Error("stale pid file was not removed")
+	}
+	select {
+	case <-otherDone:
+		t.Fatal("a process running another binary was stopped")
+	default:
+	}
+
+	// 仍在运行同一可执行文件的遗留进程被停止
+	orphan, orphanDone := startTestProcess(t, "exec sleep 30")
+	writeRecord(orphan.Process.Pid, "/bin/sleep")
+	if err := b.CleanupOrphan(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-orphanDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphaned process is still running")
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Error("pid file was not removed after cleaning up the orphan")
+	}
+	event := nextEvent(t, events)
+	if event.name != "service:orphan-cleaned" || event.data["pid"] != orphan.Process.Pid {
+		t.Errorf("event = %+v, want service:orphan-cleaned", event)
+	}
+
+	// 无效的 PID 文件被删除并返回错误
+	if err := os.WriteFile(pidFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CleanupOrphan(); err == nil {
+		t.Error("cleaning up with an invalid pid file succeeded")
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Error("invalid pid file was not removed")
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup 让子进程成为新进程组的组长，停止时可以连同其派生的进程一起回收
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcess 向进程组发送 SIGTERM，请求优雅退出
+func terminateProcess(process *os.Process) error {
+	return signalGroup(process, syscall.SIGTERM)
+}
+
+// killProcessGroup 向进程组发送 SIGKILL，强制结束进程及其子进程
+func killProcessGroup(process *os.Process) error {
+	return signalGroup(process, syscall.SIGKILL)
+}
+
+// signalGroup 向以 process 为组长的进程组发送信号
+// 进程不是组长（如旧版本启动的遗留进程）时只向进程本身发送
+func signalGroup(process *os.Process, sig syscall.Signal) error {
+	err := syscall.Kill(-process.Pid, sig)
+	if err == syscall.ESRCH {
+		return process.Signal(sig)
+	}
+	return err
+}
+
+// reapProcessGroup 在组长退出后结束组内遗留的进程（进程组已空时忽略错误）
+func reapProcessGroup(process *os.Process) {
+	_ = syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// processRunning 检查 PID 对应的进程是否仍在运行指定的可执行文件
+func processRunning(pid int, binary string) bool {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(strings.TrimSpace(string(out)))
+	if name == "" || name == "." {
+		return false
+	}
+	// Linux 下 comm 最长 15 个字符，可能被截断
+	base := filepath.Base(binary)
+	return name == base || (len(name) >= 15 && strings.HasPrefix(base, name))
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startTestProcess 在独立进程组中启动 script，返回进程退出时关闭的通道
+func startTestProcess(t *testing.T, script string) (*exec.Cmd, <-chan struct{}) {
+	t.Helper()
+	cmd := shellCommand(t, script)
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		killProcessGroup(cmd.Process)
+		<-done
+	})
+	return cmd, done
+}
+
+func TestStopGracefully(t *testing.T) {
+	ctx := context.Background()
+
+	cmd, done := startTestProcess(t, "exec sleep 30")
+	method, err := stopGracefully(ctx, "test", cmd.Process, done, 5*time.Second)
+	if err != nil || method != StopGraceful {
+		t.Errorf("stopping a process that exits on SIGTERM = %s, %v, want graceful", method, err)
+	}
+
+	// 忽略 SIGTERM 的进程及其子进程在宽限期后被强制结束
+	cmd, done = startTestProcess(t, "trap '' TERM; sleep 30 & wait")
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	method, err = stopGracefully(ctx, "test", cmd.Process, done, 300*time.Millisecond)
+	if err != nil || method != StopKilled {
+		t.Errorf("stopping a process that ignores SIGTERM = %s, %v, want killed", method, err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("killed after %s, before the grace period", elapsed)
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("process still running after being killed")
+	}
+}
+
+func TestStopGracefullyExitedProcess(t *testing.T) {
+	ctx := context.Background()
+
+	// 已经退出的进程不再发送信号
+	cmd, done := startTestProcess(t, "exit 0")
+	<-done
+	if method, err := stopGracefully(ctx, "test", cmd.Process, done, time.Second); err != nil || method != StopGraceful {
+		t.Errorf("stopping an exited process = %s, %v, want graceful", method, err)
+	}
+
+	// 进程已被回收（os.ErrProcessDone）但退出通知尚未送达
+	cmd = shellCommand(t, "exit 0")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	pending := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(pending) })
+	if method, err := stopGracefully(ctx, "test", cmd.Process, pending, time.Second); err != nil || method != StopGraceful {
+		t.Errorf("stopping a reaped process = %s, %v, want graceful", method, err)
+	}
+}
+
+func TestStopProcess(t *testing.T) {
+	b, events := newTestBaseManager(t, RestartPolicy{Policy: "always", MaxRestarts: 1, Backoff: time.Hour})
+	if err := b.StartProcess(shellCommand(t, "exec sleep 30"), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.StopProcess("test"); err != nil {
+		t.Fatal(err)
+	}
+	stopped := nextEvent(t, events)
+	if stopped.name != "service:stopped" || stopped.data["method"] != StopGraceful {
+		t.Errorf("event = %+v, want service:stopped graceful", stopped)
+	}
+	// 主动停止不触发重启
+	if b.IsRunning() || b.RestartPending() {
+		t.Error("service running or restarting after StopProcess")
+	}
+	if err := b.StopProcess("test"); err == nil {
+		t.Error("stopping a stopped service succeeded")
+	}
+}
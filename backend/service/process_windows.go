@@ -0,0 +1,55 @@
+//go:build windows
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+)
+
+// setProcessGroup 在新进程组中启动子进程，以便单独向其发送 CTRL_BREAK
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// terminateProcess 向进程组发送 CTRL_BREAK_EVENT（Windows 上 SIGTERM 的等价物）
+// 没有控制台的进程收不到该事件，调用方会在宽限期后强制结束
+func terminateProcess(process *os.Process) error {
+	ret, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(process.Pid))
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// killProcessGroup 强制结束进程及其子进程树
+func killProcessGroup(process *os.Process) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)).Run(); err != nil {
+		return process.Kill()
+	}
+	return nil
+}
+
+// reapProcessGroup 在 Windows 上为空操作：进程退出后其 PID 可能被复用，不能再按 PID 结束进程树
+func reapProcessGroup(process *os.Process) {}
+
+// processRunning 检查 PID 对应的进程是否仍在运行指定的可执行文件
+func processRunning(pid int, binary string) bool {
+	out, err := exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(out)), `"`+strings.ToLower(filepath.Base(binary))+`"`)
+}
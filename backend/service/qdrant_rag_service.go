@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// defaultQdrantVector go-rag 写入正文向量使用的命名向量
+const defaultQdrantVector = "content_vector"
+
+// maxKnowledgeBases 统计知识库名称时最多返回的数量
+const maxKnowledgeBases = 1000
+
+// QdrantRAGService 直接查询 Qdrant 的 RAG 检索后端（rag.backend: qdrant），不需要运行 go-rag
+// 查询向量由 OpenAI 兼容的 embeddings 接口计算，默认读取 go-rag 写入的集合和 payload
+type QdrantRAGService struct {
+	ctx       context.Context
+	mu        sync.RWMutex // 保护以下字段（配置变更时替换）
+	config    *config.RAGConfig
+	qdrant    *ragClient        // Qdrant REST API，未启用时为 nil
+	embedding *embeddingClient  // 未启用时为 nil
+	vectors   map[string]string // 集合 -> 自动选择的命名向量（"" 表示未命名的向量）
+}
+
+// QdrantSearchRequest describes a search of the qdrant backend
+type QdrantSearchRequest struct {
+	Query          string                 `json:"query"`
+	Collection     string                 `json:"collection"`     // 为空时使用 rag.qdrant.collection
+	Filter         map[string]interface{} `json:"filter"`         // payload 过滤（与 rag.qdrant.filter 同时生效）
+	TopK           int                    `json:"topK"`           // 为 0 时使用 rag.topK
+	ScoreThreshold float64                `json:"scoreThreshold"` // 为 0 时使用 rag.qdrant.scoreThreshold
+}
+
+// qdrantPoint Qdrant 返回的点
+type qdrantPoint struct {
+	ID      json.RawMessage        `json:"id"` // UUID 字符串或整数
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// NewQdrantRAGService 创建直接查询 Qdrant 的 RAG 服务（qdrantCfg 提供默认的 Qdrant 地址）
+func NewQdrantRAGService(ctx context.Context, cfg *config.RAGConfig, qdrantCfg *config.QdrantConfig) *QdrantRAGService {
+	s := &QdrantRAGService{ctx: ctx}
+	s.Reconfigure(cfg, qdrantCfg)
+	return s
+}
+
+// Reconfigure 使用新的 RAG 和 Qdrant 配置（配置变更后调用）
+func (s *QdrantRAGService) Reconfigure(cfg *config.RAGConfig, qdrantCfg *config.QdrantConfig) {
+	var qdrant *ragClient
+	var embedding *embeddingClient
+	if cfg != nil && cfg.Enabled && cfg.GetBackend() == config.RAGBackendQdrant {
+		var err error
+		qdrant, embedding, err = newQdrantRAGClients(cfg, qdrantCfg)
+		if err != nil {
+			g.Log().Errorf(s.ctx, "RAG service: failed to configure the qdrant backend: %v", err)
+			qdrant, embedding = nil, nil
+		} else {
+			g.Log().Infof(s.ctx, "RAG service will query Qdrant directly at %s (collection %s)", qdrant.baseURL, cfg.Qdrant.Collection)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = cfg
+	s.qdrant = qdrant
+	s.embedding = embedding
+	s.vectors = make(map[string]string)
+}
+
+// newQdrantRAGClients 创建 Qdrant 和 embeddings 客户端
+func newQdrantRAGClients(cfg *config.RAGConfig, qdrantCfg *config.QdrantConfig) (*ragClient, *embeddingClient, error) {
+	if cfg.Qdrant == nil || cfg.Qdrant.Collection == "" {
+		return nil, nil, fmt.Errorf("rag.qdrant.collection is not configured")
+	}
+	qdrantURL := cfg.Qdrant.URL
+	if qdrantURL == "" {
+		if qdrantCfg == nil {
+			qdrantCfg = &config.QdrantConfig{Port: 6333}
+		}
+		qdrantURL = qdrantCfg.GetURL()
+	}
+
+	header := make(http.Header)
+	if cfg.Qdrant.APIKey != "" {
+		header.Set("api-key", cfg.Qdrant.APIKey)
+	}
+	// 超时、重试和熔断沿用 rag.client，证书只使用 rag.qdrant.tls（rag.client.tls 是 go-rag 的证书）
+	settings := config.RAGClientConfig{}
+	if cfg.Client != nil {
+		settings = *cfg.Client
+	}
+	settings.TLS = cfg.Qdrant.TLS
+	qdrant, err := newHTTPClient("Qdrant", qdrantURL, config.URLAddress(qdrantURL), header, &settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	embedding, err := newEmbeddingClient(cfg.Embedding, cfg.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return qdrant, embedding, nil
+}
+
+// current 返回当前的配置和客户端，未启用时客户端为 nil
+func (s *QdrantRAGService) current() (*config.RAGConfig, *ragClient, *embeddingClient) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config, s.qdrant, s.embedding
+}
+
+// IsEnabled 检查 RAG 服务是否启用（rag.backend 为 qdrant 且配置有效）
+func (s *QdrantRAGService) IsEnabled() bool {
+	_, qdrant, _ := s.current()
+	return qdrant != nil
+}
+
+// CheckHealth 检查 Qdrant 是否可达（不受熔断影响，结果计入熔断）
+func (s *QdrantRAGService) CheckHealth() error {
+	_, qdrant, _ := s.current()
+	if qdrant == nil {
+		return fmt.Errorf("RAG service is not enabled")
+	}
+	return qdrant.checkHealth(false)
+}
+
+// isHealthy 对话前的快速检查，熔断期间直接返回 false
+func (s *QdrantRAGService) isHealthy() bool {
+	_, qdrant, _ := s.current()
+	return qdrant != nil && qdrant.checkHealth(true) == nil
+}
+
+// Search 计算查询向量并在集合中检索，返回按相似度排序的文档
+func (s *QdrantRAGService) Search(ctx context.Context, req QdrantSearchRequest) ([]*schema.Document, error) {
+	cfg, qdrant, embedding := s.current()
+	if qdrant == nil {
+		return nil, fmt.Errorf("RAG service is not enabled")
+	}
+
+	collection := req.Collection
+	if collection == "" {
+		collection = cfg.Qdrant.Collection
+	}
+	topK := req.TopK
+	if topK == 0 {
+		topK = cfg.TopK
+	}
+	if topK == 0 {
+		topK = 5
+	}
+	threshold := req.ScoreThreshold
+	if threshold == 0 {
+		threshold = cfg.Qdrant.ScoreThreshold
+	}
+
+	vectorName, err := s.vectorName(ctx, qdrant, cfg, collection)
+	if err != nil {
+		return nil, err
+	}
+	vector, err := embedding.embedQuery(ctx, req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"query":        vector,
+		"limit":        topK,
+		"with_payload": true,
+	}
+	if vectorName != "" {
+		body["using"] = vectorName
+	}
+	if threshold > 0 {
+		body["score_threshold"] = threshold
+	}
+	if filter := qdrantFilter(cfg.Qdrant.Filter, req.Filter); filter != nil {
+		body["filter"] = filter
+	}
+
+	var resp struct {
+		Result struct {
+			Points []qdrantPoint `json:"points"`
+		} `json:"result"`
+	}
+	if err := callQdrant(ctx, qdrant, http.MethodPost, "/collections/"+url.PathEscape(collection)+"/points/query", body, &resp); err != nil {
+		return nil, err
+	}
+
+	docs := make([]*schema.Document, 0, len(resp.Result.Points))
+	for _, point := range resp.Result.Points {
+		docs = append(docs, qdrantDocument(cfg.Qdrant, point))
+	}
+	g.Log().Debugf(ctx, "Retrieved %d documents from Qdrant collection %s", len(docs), collection)
+	return docs, nil
+}
+
+// KnowledgeBases 返回集合中的知识库名称（按知识库字段统计，需要 Qdrant 1.12 及以上）
+func (s *QdrantRAGService) KnowledgeBases(ctx context.Context) ([]string, error) {
+	cfg, qdrant, _ := s.current()
+	if qdrant == nil {
+		return nil, fmt.Errorf("RAG service is not enabled")
+	}
+
+	body := map[string]interface{}{
+		"key":   cfg.Qdrant.KnowledgeField,
+		"limit": maxKnowledgeBases,
+	}
+	if filter := qdrantFilter(cfg.Qdrant.Filter); filter != nil {
+		body["filter"] = filter
+	}
+	var resp struct {
+		Result struct {
+			Hits []struct {
+				Value interface{} `json:"value"`
+			} `json:"hits"`
+		} `json:"result"`
+	}
+	if err := callQdrant(ctx, qdrant, http.MethodPost, "/collections/"+url.PathEscape(cfg.Qdrant.Collection)+"/facet", body, &resp); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(resp.Result.Hits))
+	for _, hit := range resp.Result.Hits {
+		names = append(names, fmt.Sprint(hit.Value))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RetrieveDocuments 从默认知识库检索文档（未设置默认知识库时检索整个集合）
+// 检索失败返回空列表，不影响对话
+func (s *QdrantRAGService) RetrieveDocuments(ctx context.Context, query string) ([]*schema.Document, error) {
+	if !s.isHealthy() {
+		g.Log().Debug(ctx, "RAG service is not healthy, skipping retrieval")
+		return nil, nil
+	}
+
+	cfg, _, _ := s.current()
+	req := QdrantSearchRequest{Query: query}
+	if cfg.DefaultKnowledgeBase != "" {
+		req.Filter = map[string]interface{}{cfg.Qdrant.KnowledgeField: cfg.DefaultKnowledgeBase}
+	}
+	docs, err := s.Search(ctx, req)
+	if err != nil {
+		g.Log().Warningf(ctx, "Failed to retrieve documents: %v", err)
+		return nil, nil
+	}
+	return docs, nil
+}
+
+// RetrieveFromKnowledgeBases 从指定的多个知识库检索文档（一次查询），最多返回 topK 条
+func (s *QdrantRAGService) RetrieveFromKnowledgeBases(ctx context.Context, query string, knowledgeBases []string) ([]*schema.Document, error) {
+	if !s.isHealthy() {
+		g.Log().Debug(ctx, "RAG service is not healthy, skipping retrieval")
+		return nil, nil
+	}
+
+	cfg, _, _ := s.current()
+	bases := make([]interface{}, len(knowledgeBases))
+	for i, kb := range knowledgeBases {
+		bases[i] = kb
+	}
+	docs, err := s.Search(ctx, QdrantSearchRequest{
+		Query:  query,
+		Filter: map[string]interface{}{cfg.Qdrant.KnowledgeField: bases},
+	})
+	if err != nil {
+		g.Log().Warningf(ctx, "Failed to retrieve documents from %v: %v", knowledgeBases, err)
+		return nil, nil
+	}
+	return docs, nil
+}
+
+// RetrieveWithContext 检索文档并返回上下文信息
+func (s *QdrantRAGService) RetrieveWithContext(ctx context.Context, query string) (string, error) {
+	docs, err := s.RetrieveDocuments(ctx, query)
+	if err != nil || len(docs) == 0 {
+		return "", nil
+	}
+	contextStr := buildRAGContext(docs)
+	g.Log().Debugf(ctx, "Generated context: %s", contextStr)
+	return contextStr, nil
+}
+
+// vectorName 返回检索集合使用的命名向量：rag.qdrant.vectorName，
+// 否则根据集合信息选择 content_vector、唯一的命名向量或未命名的向量（结果按集合缓存）
+func (s *QdrantRAGService) vectorName(ctx context.Context, qdrant *ragClient, cfg *config.RAGConfig, collection string) (string, error) {
+	if cfg.Qdrant.VectorName != "" {
+		return cfg.Qdrant.VectorName, nil
+	}
+	s.mu.RLock()
+	name, ok := s.vectors[collection]
+	s.mu.RUnlock()
+	if ok {
+		return name, nil
+	}
+
+	var resp struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors json.RawMessage `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := callQdrant(ctx, qdrant, http.MethodGet, "/collections/"+url.PathEscape(collection), nil, &resp); err != nil {
+		return "", err
+	}
+	name, err := selectQdrantVector(resp.Result.Config.Params.Vectors)
+	if err != nil {
+		return "", fmt.Errorf("collection %s: %w", collection, err)
+	}
+
+	s.mu.Lock()
+	if s.qdrant == qdrant {
+		s.vectors[collection] = name
+	}
+	s.mu.Unlock()
+	return name, nil
+}
+
+// selectQdrantVector 根据集合的向量配置选择检索使用的向量
+// 未命名的向量配置为 {"size": ..., "distance": ...}，命名向量为 {"<name>": {"size": ...}}
+func selectQdrantVector(raw json.RawMessage) (string, error) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return "", fmt.Errorf("failed to decode vector config: %w", err)
+	}
+	if _, ok := params["size"]; ok {
+		return "", nil
+	}
+	if _, ok := params[defaultQdrantVector]; ok {
+		return defaultQdrantVector, nil
+	}
+	if len(params) == 1 {
+		for name := range params {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("cannot choose among %d named vectors, set rag.qdrant.vectorName", len(params))
+}
+
+// callQdrant 调用 Qdrant REST API 并解析响应（所有调用都是只读的，可以重试）
+func callQdrant(ctx context.Context, qdrant *ragClient, method, path string, reqBody interface{}, respData interface{}) error {
+	var body []byte
+	if reqBody != nil {
+		var err error
+		body, err = json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+	data, err := qdrant.do(ctx, method, path, body, true)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, respData); err != nil {
+		return fmt.Errorf("failed to decode Qdrant response: %w", err)
+	}
+	return nil
+}
+
+// qdrantFilter 将多组 payload 过滤合并为 Qdrant 的 filter（所有条件都需满足），没有条件时返回 nil
+// 值为标量时精确匹配，为列表时匹配其中任意一个，为映射时作为条件原样使用（如 {"range": {"gte": 1}}）
+func qdrantFilter(filters ...map[string]interface{}) map[string]interface{} {
+	var must []map[string]interface{}
+	for _, filter := range filters {
+		keys := make([]string, 0, len(filter))
+		for key := range filter {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			must = append(must, qdrantCondition(key, filter[key]))
+		}
+	}
+	if len(must) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"must": must}
+}
+
+// qdrantCondition 创建单个 payload 条件
+func qdrantCondition(key string, value interface{}) map[string]interface{} {
+	condition := map[string]interface{}{"key": key}
+	switch v := value.(type) {
+	case []interface{}:
+		condition["match"] = map[string]interface{}{"any": v}
+	case []string:
+		condition["match"] = map[string]interface{}{"any": v}
+	case map[string]interface{}:
+		for name, c := range v {
+			condition[name] = c
+		}
+	default:
+		condition["match"] = map[string]interface{}{"value": v}
+	}
+	return condition
+}
+
+// qdrantDocument 将 Qdrant 的点转换为文档：正文字段为 Content，元数据字段（JSON 字符串或对象）展开到 MetaData，
+// 其他 payload 字段原样放入 MetaData
+func qdrantDocument(cfg *config.RAGQdrantConfig, point qdrantPoint) *schema.Document {
+	doc := &schema.Document{
+		ID:       string(point.ID),
+		MetaData: map[string]any{},
+	}
+	var uuid string
+	if err := json.Unmarshal(point.ID, &uuid); err == nil {
+		doc.ID = uuid
+	}
+
+	for key, value := range point.Payload {
+		switch key {
+		case cfg.ContentField:
+			doc.Content, _ = value.(string)
+		case cfg.MetadataField:
+			switch meta := value.(type) {
+			case string:
+				var fields map[string]any
+				if err := json.Unmarshal([]byte(meta), &fields); err == nil {
+					for k, v := range fields {
+						doc.MetaData[k] = v
+					}
+				}
+			case map[string]interface{}:
+				for k, v := range meta {
+					doc.MetaData[k] = v
+				}
+			}
+		default:
+			doc.MetaData[key] = value
+		}
+	}
+	doc.WithScore(point.Score)
+	return doc
+}
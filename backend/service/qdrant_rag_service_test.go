@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// fakeQdrant 模拟 Qdrant 的集合信息、检索接口以及 embeddings 接口
+type fakeQdrant struct {
+	mu          sync.Mutex
+	vectors     map[string]string        // 集合 -> params.vectors 的 JSON
+	points      string                   // /points/query 返回的 result.points
+	queries     []map[string]interface{} // 收到的检索请求
+	infoCalls   map[string]int           // 各集合信息的请求次数
+	embedInputs [][]string               // 收到的 embeddings 输入
+	apiKeys     []string                 // 请求携带的 api-key
+}
+
+func newFakeQdrant(t *testing.T) (*fakeQdrant, *httptest.Server) {
+	f := &fakeQdrant{
+		vectors: map[string]string{
+			"go-rag":    `{"content_vector": {"size": 3, "distance": "Cosine"}, "title_vector": {"size": 3, "distance": "Cosine"}}`,
+			"single":    `{"dense": {"size": 3, "distance": "Cosine"}}`,
+			"unnamed":   `{"size": 3, "distance": "Cosine"}`,
+			"ambiguous": `{"a": {"size": 3, "distance": "Cosine"}, "b": {"size": 3, "distance": "Cosine"}}`,
+		},
+		points:    `[]`,
+		infoCalls: make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/{collection}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		name := r.PathValue("collection")
+		f.infoCalls[name]++
+		f.apiKeys = append(f.apiKeys, r.Header.Get("api-key"))
+		vectors, ok := f.vectors[name]
+		if !ok {
+			http.Error(w, `{"status": {"error": "Not found: Collection `+name+` doesn't exist!"}}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"result": {"config": {"params": {"vectors": ` + vectors + `}}}, "status": "ok"}`))
+	})
+	mux.HandleFunc("POST /collections/{collection}/points/query", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.queries = append(f.queries, body)
+		w.Write([]byte(`{"result": {"points": ` + f.points + `}, "status": "ok"}`))
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.embedInputs = append(f.embedInputs, req.Input)
+		f.mu.Unlock()
+		var resp embeddingResponse
+		for i := range req.Input {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{Index: i, Embedding: []float32{0.1, 0.2, 0.3}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// lastQuery 返回最近一次检索请求
+func (f *fakeQdrant) lastQuery(t *testing.T) map[string]interface{} {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queries) == 0 {
+		t.Fatal("no query was sent to Qdrant")
+	}
+	return f.queries[len(f.queries)-1]
+}
+
+// newTestQdrantRAG 创建连接到模拟服务的 qdrant 检索后端
+func newTestQdrantRAG(t *testing.T, url string, qdrant *config.RAGQdrantConfig) *QdrantRAGService {
+	t.Helper()
+	if qdrant.URL == "" {
+		qdrant.URL = url
+	}
+	if qdrant.Collection == "" {
+		qdrant.Collection = "go-rag"
+	}
+	qdrant.ContentField = "content"
+	qdrant.KnowledgeField = "_knowledge_name"
+	qdrant.MetadataField = "ext"
+	cfg := &config.RAGConfig{
+		Enabled:   true,
+		Backend:   config.RAGBackendQdrant,
+		TopK:      3,
+		Embedding: &config.ModelConfig{BaseURL: url, Model: "bge-m3"},
+		Qdrant:    qdrant,
+		Client:    &config.RAGClientConfig{Timeout: 5, HealthTimeout: 500},
+	}
+	s := NewQdrantRAGService(context.Background(), cfg, nil)
+	if !s.IsEnabled() {
+		t.Fatal("qdrant backend is not enabled")
+	}
+	return s
+}
+
+func TestQdrantRAGVectorSelection(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		vectorName string // rag.qdrant.vectorName
+		want       string // 请求中的 using（空表示不带 using）
+		wantErr    string
+		wantInfo   int // 集合信息的请求次数
+	}{
+		{name: "go-rag content vector", collection: "go-rag", want: "content_vector", wantInfo: 1},
+		{name: "only named vector", collection: "single", want: "dense", wantInfo: 1},
+		{name: "unnamed vector", collection: "unnamed", want: "", wantInfo: 1},
+		{name: "several named vectors", collection: "ambiguous", wantErr: "set rag.qdrant.vectorName", wantInfo: 1},
+		{name: "configured vector", collection: "ambiguous", vectorName: "b", want: "b", wantInfo: 0},
+		{name: "missing collection", collection: "missing", wantErr: "404", wantInfo: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeQdrant(t)
+			s := newTestQdrantRAG(t, server.URL, &config.RAGQdrantConfig{Collection: tt.collection, VectorName: tt.vectorName})
+
+			// 第二次检索使用缓存的选择结果
+			for i := 0; i < 2; i++ {
+				_, err := s.Search(context.Background(), QdrantSearchRequest{Query: "what is rag"})
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("Search error = %v, want %q", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Search: %v", err)
+				}
+				using, ok := fake.lastQuery(t)["using"]
+				if tt.want == "" && ok {
+					t.Fatalf("using = %v, want none", using)
+				}
+				if tt.want != "" && using != tt.want {
+					t.Fatalf("using = %v, want %s", using, tt.want)
+				}
+			}
+			if tt.wantErr == "" && fake.infoCalls[tt.collection] != tt.wantInfo {
+				t.Fatalf("collection info requested %d times, want %d", fake.infoCalls[tt.collection], tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestQdrantRAGSearchRequest(t *testing.T) {
+	fake, server := newFakeQdrant(t)
+	s := newTestQdrantRAG(t, server.URL, &config.RAGQdrantConfig{
+		APIKey:         "qdrant-key",
+		ScoreThreshold: 0.5,
+		Filter: map[string]interface{}{
+			"lang": "zh",
+			"year": map[string]interface{}{"range": map[string]interface{}{"gte": 2020}},
+			"tags": []interface{}{"go", "rag"},
+		},
+	})
+
+	tests := []struct {
+		name string
+		req  QdrantSearchRequest
+		want string // 检索请求（JSON）
+	}{
+		{
+			name: "config filter and threshold",
+			req:  QdrantSearchRequest{Query: "q"},
+			want: `{"query": [0.1, 0.2, 0.3], "limit": 3, "with_payload": true, "using": "content_vector", "score_threshold": 0.5,
+				"filter": {"must": [
+					{"key": "lang", "match": {"value": "zh"}},
+					{"key": "tags", "match": {"any": ["go", "rag"]}},
+					{"key": "year", "range": {"gte": 2020}}]}}`,
+		},
+		{
+			name: "request filter is added to the config filter",
+			req: QdrantSearchRequest{Query: "q", TopK: 7, ScoreThreshold: 0.8, Filter: map[string]interface{}{
+				"_knowledge_name": []interface{}{"a", "b"},
+				"author":          "me",
+			}},
+			want: `{"query": [0.1, 0.2, 0.3], "limit": 7, "with_payload": true, "using": "content_vector", "score_threshold": 0.8,
+				"filter": {"must": [
+					{"key": "lang", "match": {"value": "zh"}},
+					{"key": "tags", "match": {"any": ["go", "rag"]}},
+					{"key": "year", "range": {"gte": 2020}},
+					{"key": "_knowledge_name", "match": {"any": ["a", "b"]}},
+					{"key": "author", "match": {"value": "me"}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Search(context.Background(), tt.req); err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.lastQuery(t); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Fatalf("query body = %s", gotJSON)
+			}
+		})
+	}
+
+	if len(fake.embedInputs) != 2 || fake.embedInputs[0][0] != "q" {
+		t.Fatalf("embedding inputs = %v", fake.embedInputs)
+	}
+	for _, key := range fake.apiKeys {
+		if key != "qdrant-key" {
+			t.Fatalf("api-key header = %q, want qdrant-key", key)
+		}
+	}
+}
+
+func TestQdrantRAGScoreThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   float64 // rag.qdrant.scoreThreshold
+		request  float64
+		want     float64
+		wantSent bool
+	}{
+		{name: "no threshold", wantSent: false},
+		{name: "config threshold", config: 0.4, want: 0.4, wantSent: true},
+		{name: "request threshold", request: 0.7, want: 0.7, wantSent: true},
+		{name: "request overrides config", config: 0.4, request: 0.6, want: 0.6, wantSent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeQdrant(t)
+			s := newTestQdrantRAG(t, server.URL, &config.RAGQdrantConfig{ScoreThreshold: tt.config})
+			if _, err := s.Search(context.Background(), QdrantSearchRequest{Query: "q", ScoreThreshold: tt.request}); err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			got, sent := fake.lastQuery(t)["score_threshold"]
+			if sent != tt.wantSent || (sent && got != tt.want) {
+				t.Fatalf("score_threshold = %v (sent %v), want %v (sent %v)", got, sent, tt.want, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestQdrantRAGRetrieveFromKnowledgeBases(t *testing.T) {
+	fake, server := newFakeQdrant(t)
+	fake.points = `[{"id": "6f1c0c9e-2d4b-4c1a-9c55-0d7b7f3e2a10", "score": 0.9, "payload": {"content": "hello", "_knowledge_name": "a"}}]`
+	s := newTestQdrantRAG(t, server.URL, &config.RAGQdrantConfig{})
+
+	docs, err := s.RetrieveFromKnowledgeBases(context.Background(), "q", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("RetrieveFromKnowledgeBases: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Content != "hello" {
+		t.Fatalf("docs = %+v", docs)
+	}
+	filter, _ := json.Marshal(fake.lastQuery(t)["filter"])
+	if want := `{"must":[{"key":"_knowledge_name","match":{"any":["a","b"]}}]}`; string(filter) != want {
+		t.Fatalf("filter = %s, want %s", filter, want)
+	}
+}
+
+func TestQdrantDocument(t *testing.T) {
+	cfg := &config.RAGQdrantConfig{ContentField: "content", KnowledgeField: "_knowledge_name", MetadataField: "ext"}
+	tests := []struct {
+		name        string
+		point       string
+		wantID      string
+		wantContent string
+		wantMeta    map[string]interface{}
+	}{
+		{
+			name:        "uuid id and metadata as a JSON string (go-rag)",
+			point:       `{"id": "6f1c0c9e-2d4b-4c1a-9c55-0d7b7f3e2a10", "score": 0.83, "payload": {"content": "hello", "_knowledge_name": "kb", "ext": "{\"source\": \"a.md\", \"page\": 2}"}}`,
+			wantID:      "6f1c0c9e-2d4b-4c1a-9c55-0d7b7f3e2a10",
+			wantContent: "hello",
+			wantMeta:    map[string]interface{}{"_knowledge_name": "kb", "source": "a.md", "page": float64(2)},
+		},
+		{
+			name:        "integer id and metadata as an object",
+			point:       `{"id": 42, "score": 0.5, "payload": {"content": "world", "ext": {"source": "b.md"}, "lang": "en"}}`,
+			wantID:      "42",
+			wantContent: "world",
+			wantMeta:    map[string]interface{}{"source": "b.md", "lang": "en"},
+		},
+		{
+			name:     "invalid metadata and missing content",
+			point:    `{"id": 7, "score": 0.1, "payload": {"ext": "not json", "content": 3}}`,
+			wantID:   "7",
+			wantMeta: map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var point qdrantPoint
+			if err := json.Unmarshal([]byte(tt.point), &point); err != nil {
+				t.Fatal(err)
+			}
+			doc := qdrantDocument(cfg, point)
+			if doc.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", doc.ID, tt.wantID)
+			}
+			if doc.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", doc.Content, tt.wantContent)
+			}
+			if doc.Score() != point.Score {
+				t.Errorf("Score = %v, want %v", doc.Score(), point.Score)
+			}
+			// WithScore 将相似度记录在 MetaData 的 _score 中，上面已经比较过
+			meta := make(map[string]interface{})
+			for k, v := range doc.MetaData {
+				if k != "_score" {
+					meta[k] = v
+				}
+			}
+			if !reflect.DeepEqual(meta, tt.wantMeta) {
+				t.Errorf("MetaData = %v, want %v", doc.MetaData, tt.wantMeta)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// maxRAGRetryBackoff 重试等待时间的上限
+const maxRAGRetryBackoff = 5 * time.Second
+
+// ErrRAGUnavailable 熔断期间直接返回的错误（检索后端连续失败，暂停访问）
+var ErrRAGUnavailable = errors.New("RAG backend is unavailable")
+
+// ragClient 检索后端（go-rag、Qdrant、embeddings 接口）的 HTTP 客户端：超时、TLS/mTLS、认证请求头、幂等请求的重试以及熔断
+type ragClient struct {
+	name          string // 服务名称，用于错误信息
+	baseURL       string // API 地址（go-rag 含 /api）
+	address       string // host:port，用于快速检查是否可达
+	httpClient    *http.Client
+	header        http.Header // 每个请求附带的认证请求头
+	healthTimeout time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	breaker       *circuitBreaker
+}
+
+// newRAGClient 根据 RAG 配置创建 go-rag 客户端，证书文件无法读取时返回错误
+func newRAGClient(cfg *config.RAGConfig) (*ragClient, error) {
+	clientCfg := cfg.Client
+	if clientCfg == nil {
+		clientCfg = &config.RAGClientConfig{}
+	}
+
+	header := make(http.Header)
+	if clientCfg.Token != "" {
+		header.Set("Authorization", "Bearer "+clientCfg.Token)
+	}
+	if clientCfg.APIKey != "" {
+		name := clientCfg.APIKeyHeader
+		if name == "" {
+			name = "X-API-Key"
+		}
+		header.Set(name, clientCfg.APIKey)
+	}
+	return newHTTPClient("go-rag", cfg.GetAPIURL(), cfg.GetServerAddress(), header, clientCfg)
+}
+
+// newHTTPClient 创建访问 baseURL 的客户端：clientCfg 提供超时、TLS、重试和熔断设置，header 为每个请求附带的请求头
+func newHTTPClient(name, baseURL, address string, header http.Header, clientCfg *config.RAGClientConfig) (*ragClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if clientCfg.TLS != nil {
+		tlsConfig, err := newTLSConfig(clientCfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	breaker := &circuitBreaker{}
+	if clientCfg.Breaker != nil {
+		breaker.threshold = clientCfg.Breaker.Failures
+		breaker.cooldown = time.Duration(clientCfg.Breaker.Cooldown) * time.Second
+	}
+
+	return &ragClient{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		address: address,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(clientCfg.Timeout) * time.Second,
+		},
+		header:        header,
+		healthTimeout: time.Duration(clientCfg.HealthTimeout) * time.Millisecond,
+		retries:       clientCfg.GetRetries(),
+		retryBackoff:  time.Duration(clientCfg.RetryBackoff) * time.Millisecond,
+		breaker:       breaker,
+	}, nil
+}
+
+// newTLSConfig 创建客户端 TLS 配置：额外的 CA 与系统证书一起使用，设置了证书和私钥时启用 mTLS
+func newTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// do 发送请求并返回 200 响应的内容
+// idempotent 为 true 时，连接失败、超时、429 和 5xx 会按指数退避（带随机抖动）重试；熔断期间直接返回 ErrRAGUnavailable
+func (c *ragClient) do(ctx context.Context, method, path string, body []byte, idempotent bool) ([]byte, error) {
+	attempts := 1
+	if idempotent {
+		attempts += c.retries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.backoff(attempt)):
+			}
+		}
+		if err := c.breaker.allow(); err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		data, retry, err := c.send(ctx, method, path, body)
+		if err == nil {
+			c.breaker.success()
+			return data, nil
+		}
+		lastErr = err
+		if !retry {
+			// 服务可达（4xx 等），不计入熔断
+			c.breaker.success()
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			// 调用方取消或超时，不计入熔断
+			c.breaker.release()
+			return nil, err
+		}
+		c.breaker.failure()
+	}
+	return nil, lastErr
+}
+
+// send 发送一次请求，retry 表示错误是否可以重试（连接失败、超时、429、5xx）
+func (c *ragClient) send(ctx context.Context, method, path string, body []byte) (data []byte, retry bool, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to call %s API: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("%s API error: %s, body: %s", c.name, resp.Status, string(data))
+	}
+	return data, false, nil
+}
+
+// backoff 返回第 attempt 次重试前的等待时间：指数增长，在 [d/2, d] 范围内随机
+func (c *ragClient) backoff(attempt int) time.Duration {
+	d := c.retryBackoff << (attempt - 1)
+	if d <= 0 || d > maxRAGRetryBackoff {
+		d = maxRAGRetryBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// checkHealth 检查服务是否可达（TCP 连接），结果计入熔断
+// fast 为 true 时（对话前的检查）熔断期间直接返回，不再等待连接超时
+func (c *ragClient) checkHealth(fast bool) error {
+	if fast {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+	}
+	if c.address == "" {
+		return fmt.Errorf("server address not configured")
+	}
+
+	conn, err := net.DialTimeout("tcp", c.address, c.healthTimeout)
+	if err != nil {
+		c.breaker.failure()
+		return fmt.Errorf("cannot connect to %s server: %w", c.name, err)
+	}
+	conn.Close()
+	c.breaker.success()
+	return nil
+}
+
+// circuitBreaker 熔断器：连续失败 threshold 次后打开，cooldown 内的请求直接失败；
+// 之后放行一个请求试探，成功则恢复，失败则再次打开
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int       // 连续失败次数
+	openUntil time.Time // 打开状态的截止时间
+	probing   bool      // 已放行试探请求，等待其结果
+}
+
+// allow 检查是否可以发送请求
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return fmt.Errorf("%w: %d consecutive failures, retrying in %s", ErrRAGUnavailable, b.failures, wait.Round(time.Second))
+	}
+	if b.probing {
+		return fmt.Errorf("%w: waiting for a probe request", ErrRAGUnavailable)
+	}
+	b.probing = true
+	return nil
+}
+
+// success 记录一次成功，关闭熔断
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// release 放弃试探请求（请求被调用方取消），不改变失败次数
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// failure 记录一次失败，达到阈值（或试探失败）时打开熔断
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// newTestRAGClient 创建访问 url 的客户端，重试等待 1ms，熔断冷却 cooldown
+func newTestRAGClient(t *testing.T, url string, retries, failures int, cooldown time.Duration) *ragClient {
+	t.Helper()
+	c, err := newHTTPClient("go-rag", url, "", nil, &config.RAGClientConfig{
+		Timeout:      5,
+		Retries:      &retries,
+		RetryBackoff: 1,
+		Breaker:      &config.BreakerConfig{Failures: failures},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.breaker.cooldown = cooldown
+	return c
+}
+
+// newStatusServer 前 failures 次请求返回 status，之后返回 200，返回收到的请求数
+func newStatusServer(t *testing.T, status, failures int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRAGClientRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		retries      int
+		idempotent   bool
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"5xx then success", http.StatusBadGateway, 2, 2, true, 3, false},
+		{"429 then success", http.StatusTooManyRequests, 1, 2, true, 2, false},
+		{"retries exhausted", http.StatusServiceUnavailable, 5, 2, true, 3, true},
+		{"4xx not retried", http.StatusNotFound, 1, 2, true, 1, true},
+		{"non-idempotent not retried", http.StatusInternalServerError, 1, 2, false, 1, true},
+		{"retries disabled", http.StatusInternalServerError, 1, 0, true, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newStatusServer(t, tt.status, tt.failures)
+			c := newTestRAGClient(t, server.URL, tt.retries, 0, 0)
+			data, err := c.do(context.Background(), http.MethodGet, "/", nil, tt.idempotent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("do = %q, %v, want error %v", data, err, tt.wantErr)
+			}
+			if !tt.wantErr && string(data) != "ok" {
+				t.Errorf("data = %q, want ok", data)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRAGClientBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	c := newTestRAGClient(t, server.URL, 0, 2, 50*time.Millisecond)
+	ctx := context.Background()
+
+	// 连续失败 Failures 次后打开，之后的请求不再发送
+	for i := 0; i < 2; i++ {
+		if _, err := c.do(ctx, http.MethodGet, "/", nil, true); err == nil || errors.Is(err, ErrRAGUnavailable) {
+			t.Fatalf("request %d: error = %v, want the server error", i+1, err)
+		}
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/", nil, true); !errors.Is(err, ErrRAGUnavailable) {
+		t.Fatalf("error with the breaker open = %v, want ErrRAGUnavailable", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// 冷却后放行试探请求，试探失败时再次打开
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.do(ctx, http.MethodGet, "/", nil, true); err == nil || errors.Is(err, ErrRAGUnavailable) {
+		t.Fatalf("probe error = %v, want the server error", err)
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/", nil, true); !errors.Is(err, ErrRAGUnavailable) {
+		t.Fatalf("error after a failed probe = %v, want ErrRAGUnavailable", err)
+	}
+
+	// 试探成功后关闭
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := c.do(ctx, http.MethodGet, "/", nil, true); err != nil {
+			t.Fatalf("request %d after recovery: %v", i+1, err)
+		}
+	}
+	if got := requests.Load(); got != 5 {
+		t.Errorf("requests = %d, want 5", got)
+	}
+}
+
+func TestRAGClientBreakerProbe(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	c := newTestRAGClient(t, server.URL, 0, 1, time.Millisecond)
+	c.breaker.failure()
+	time.Sleep(5 * time.Millisecond)
+
+	// 冷却结束后只放行一个试探请求
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.do(ctx, http.MethodGet, "/", nil, true)
+		done <- err
+	}()
+	<-started
+	if _, err := c.do(context.Background(), http.MethodGet, "/", nil, true); !errors.Is(err, ErrRAGUnavailable) {
+		t.Errorf("second request during the probe = %v, want ErrRAGUnavailable", err)
+	}
+
+	// 取消试探请求后释放试探名额，不计入失败
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled probe = %v, want context.Canceled", err)
+	}
+	if err := c.breaker.allow(); err != nil {
+		t.Errorf("allow after the canceled probe = %v, want a new probe", err)
+	}
+	if c.breaker.failures != 1 {
+		t.Errorf("failures = %d, want 1", c.breaker.failures)
+	}
+}
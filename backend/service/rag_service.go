@@ -1,15 +1,11 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
-	"strings"
-	"time"
+	"sort"
+	"sync"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/gogf/gf/v2/frame/g"
@@ -27,82 +23,73 @@ type GoRagAPIResponse[T any] struct {
 // RAGServiceImpl 提供 RAG (Retrieval Augmented Generation) 功能
 // 通过 HTTP 调用 go-rag 服务器的 RESTful API
 type RAGServiceImpl struct {
-	ctx        context.Context
-	config     *config.RAGConfig
-	httpClient *http.Client
-	baseURL    string
+	ctx    context.Context
+	mu     sync.RWMutex // 保护 config 和 client（配置变更时替换）
+	config *config.RAGConfig
+	client *ragClient // 未配置 go-rag 地址时为 nil
 }
 
 // NewRAGService 创建 RAG 服务（通过 HTTP API）
 func NewRAGService(ctx context.Context, cfg *config.RAGConfig, aiCfg *config.AIConfig) (*RAGServiceImpl, error) {
-	if cfg == nil || !cfg.Enabled {
-		g.Log().Info(ctx, "RAG service is disabled")
-		return &RAGServiceImpl{
-			ctx:    ctx,
-			config: cfg,
-		}, nil
-	}
-
-	// 检查 go-rag 服务器配置
-	if cfg.Server == nil || cfg.Server.Address == "" {
-		g.Log().Info(ctx, "RAG service: go-rag server is not configured, RAG functions will be unavailable")
-		return &RAGServiceImpl{
-			ctx:    ctx,
-			config: cfg,
-		}, nil
-	}
-
-	// 构建 base URL
-	baseURL := fmt.Sprintf("http://localhost%s/api", cfg.Server.Address)
-	g.Log().Infof(ctx, "RAG service will use go-rag server at: %s", baseURL)
-
-	return &RAGServiceImpl{
-		ctx:        ctx,
-		config:     cfg,
-		httpClient: &http.Client{},
-		baseURL:    baseURL,
-	}, nil
+	r := &RAGServiceImpl{
+		ctx: ctx,
+	}
+	r.Reconfigure(cfg)
+	return r, nil
 }
 
-// callAPI 通用的 HTTP API 调用方法（泛型）
-func (r *RAGServiceImpl) callAPI(ctx context.Context, method, path string, reqBody interface{}, respData interface{}) error {
-	url := fmt.Sprintf("%s%s", r.baseURL, path)
-
-	var req *http.Request
-	var err error
-
-	if reqBody != nil {
-		jsonData, err := json.Marshal(reqBody)
-		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
-		}
-		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
+// Reconfigure 使用新的 RAG 配置（配置变更后调用），之后的请求发往新的 go-rag 地址
+// 证书无法加载时记录错误，RAG 功能不可用
+func (r *RAGServiceImpl) Reconfigure(cfg *config.RAGConfig) {
+	var client *ragClient
+	switch {
+	case cfg == nil || !cfg.Enabled:
+		g.Log().Info(r.ctx, "RAG service is disabled")
+	case !cfg.IsServerEnabled():
+		g.Log().Info(r.ctx, "RAG service: go-rag server is not configured, RAG functions will be unavailable")
+	default:
+		var err error
+		client, err = newRAGClient(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequestWithContext(ctx, method, url, nil)
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
+			g.Log().Errorf(r.ctx, "RAG service: failed to configure go-rag client: %v", err)
+			break
 		}
+		g.Log().Infof(r.ctx, "RAG service will use go-rag server at: %s", client.baseURL)
 	}
 
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to call go-rag API: %w", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = cfg
+	r.client = client
+}
+
+// current 返回当前的 RAG 配置和 go-rag 客户端
+func (r *RAGServiceImpl) current() (*config.RAGConfig, *ragClient) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config, r.client
+}
+
+// callAPI 通用的 HTTP API 调用方法（泛型）
+// idempotent 为 true 的请求（查询、检索）在连接失败或 5xx 时自动重试
+func (r *RAGServiceImpl) callAPI(ctx context.Context, method, path string, reqBody interface{}, respData interface{}, idempotent bool) error {
+	_, client := r.current()
+	if client == nil {
+		return fmt.Errorf("RAG service is not enabled")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("go-rag API error: %s, body: %s", resp.Status, string(body))
+	var jsonData []byte
+	if reqBody != nil {
+		var err error
+		jsonData, err = json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
 	}
 
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
+	body, err := client.do(ctx, method, path, jsonData, idempotent)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return err
 	}
 
 	// 先解析通用响应结构检查错误
@@ -126,39 +113,34 @@ func (r *RAGServiceImpl) callAPI(ctx context.Context, method, path string, reqBo
 	return nil
 }
 
-// IsEnabled 检查 RAG 服务是否启用
+// enabledClient 返回 go-rag 客户端，RAG 未启用（或 rag.backend 不是 go-rag）时返回 nil
+func (r *RAGServiceImpl) enabledClient() *ragClient {
+	cfg, client := r.current()
+	if cfg == nil || !cfg.Enabled || cfg.GetBackend() != config.RAGBackendGoRAG {
+		return nil
+	}
+	return client
+}
+
+// IsEnabled 检查 RAG 服务是否启用（rag.backend 为 go-rag 且配置了 go-rag 地址）
 func (r *RAGServiceImpl) IsEnabled() bool {
-	return r.config != nil && r.config.Enabled && r.baseURL != ""
+	return r.enabledClient() != nil
 }
 
-// CheckHealth 检查 RAG 服务是否健康（检测端口）
+// CheckHealth 检查 RAG 服务是否健康（检测端口，不受熔断影响，结果计入熔断）
 func (r *RAGServiceImpl) CheckHealth() error {
-	if !r.IsEnabled() {
+	client := r.enabledClient()
+	if client == nil {
 		return fmt.Errorf("RAG service is not enabled")
 	}
-
-	if r.config.Server == nil || r.config.Server.Address == "" {
-		return fmt.Errorf("server address not configured")
-	}
-
-	// 解析地址（如 ":8000"）
-	address := r.config.Server.Address
-	if strings.HasPrefix(address, ":") {
-		address = "localhost" + address
-	}
-
-	// 尝试连接（快速超时，避免阻塞对话）
-	conn, err := net.DialTimeout("tcp", address, 500*time.Millisecond)
-	if err != nil {
-		return fmt.Errorf("cannot connect to go-rag server: %w", err)
-	}
-	conn.Close()
-	return nil
+	return client.checkHealth(false)
 }
 
 // isHealthy 内部方法：检查服务是否健康（不抛错，只返回 true/false）
+// 熔断期间直接返回 false，避免每轮对话都等待连接超时
 func (r *RAGServiceImpl) isHealthy() bool {
-	return r.CheckHealth() == nil
+	client := r.enabledClient()
+	return client != nil && client.checkHealth(true) == nil
 }
 
 // GetKnowledgeBases 获取所有知识库列表
@@ -170,7 +152,7 @@ func (r *RAGServiceImpl) GetKnowledgeBases(ctx context.Context) (*v1.KBGetListRe
 
 	// 调用 go-rag API: GET /v1/kb
 	var apiResp GoRagAPIResponse[v1.KBGetListRes]
-	if err := r.callAPI(ctx, "GET", "/v1/kb", nil, &apiResp); err != nil {
+	if err := r.callAPI(ctx, "GET", "/v1/kb", nil, &apiResp, true); err != nil {
 		return nil, err
 	}
 
@@ -195,7 +177,8 @@ func (r *RAGServiceImpl) Retrieve(ctx context.Context, query string, knowledgeNa
 		scoreThreshold = 0.2 // go-rag 默认阈值
 	}
 
-	topK := r.config.TopK
+	cfg, _ := r.current()
+	topK := cfg.TopK
 	if topK == 0 {
 		topK = 5
 	}
@@ -211,7 +194,7 @@ func (r *RAGServiceImpl) Retrieve(ctx context.Context, query string, knowledgeNa
 	}
 
 	var apiResp GoRagAPIResponse[v1.RetrieverRes]
-	if err := r.callAPI(ctx, "POST", "/v1/retriever", reqBody, &apiResp); err != nil {
+	if err := r.callAPI(ctx, "POST", "/v1/retriever", reqBody, &apiResp, true); err != nil {
 		return nil, err
 	}
 
@@ -238,13 +221,14 @@ func (r *RAGServiceImpl) RetrieveDocuments(ctx context.Context, query string) ([
 	}
 
 	// 检查是否配置了默认知识库
-	if r.config.DefaultKnowledgeBase == "" {
+	cfg, _ := r.current()
+	if cfg.DefaultKnowledgeBase == "" {
 		g.Log().Debug(ctx, "DefaultKnowledgeBase not configured, skipping RAG retrieval")
 		return nil, nil
 	}
 
 	// 使用默认知识库和阈值
-	results, err := r.Retrieve(ctx, query, r.config.DefaultKnowledgeBase, 1.3)
+	results, err := r.Retrieve(ctx, query, cfg.DefaultKnowledgeBase, 1.3)
 	if err != nil {
 		g.Log().Warningf(ctx, "Failed to retrieve documents: %v", err)
 		return nil, nil // 检索失败返回空列表，不影响对话
@@ -253,6 +237,44 @@ func (r *RAGServiceImpl) RetrieveDocuments(ctx context.Context, query string) ([
 	return results, nil
 }
 
+// RetrieveFromKnowledgeBases 从指定的多个知识库检索文档
+// 结果按相关度合并排序，最多返回 topK 条
+func (r *RAGServiceImpl) RetrieveFromKnowledgeBases(ctx context.Context, query string, knowledgeBases []string) ([]*schema.Document, error) {
+	if !r.IsEnabled() {
+		return nil, nil
+	}
+
+	if !r.isHealthy() {
+		g.Log().Debug(ctx, "RAG service is not healthy, skipping retrieval")
+		return nil, nil
+	}
+
+	var results []*schema.Document
+	for _, kb := range knowledgeBases {
+		docs, err := r.Retrieve(ctx, query, kb, 1.3)
+		if err != nil {
+			g.Log().Warningf(ctx, "Failed to retrieve documents from %s: %v", kb, err)
+			continue
+		}
+		results = append(results, docs...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score() > results[j].Score()
+	})
+
+	cfg, _ := r.current()
+	topK := cfg.TopK
+	if topK == 0 {
+		topK = 5
+	}
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
 // RetrieveWithContext 检索文档并返回上下文信息
 // 这可以用于增强 AI 的回答
 func (r *RAGServiceImpl) RetrieveWithContext(ctx context.Context, query string) (string, error) {
@@ -267,11 +289,16 @@ func (r *RAGServiceImpl) RetrieveWithContext(ctx context.Context, query string)
 		return "", nil
 	}
 
-	// 将检索到的文档组合成上下文
+	contextStr := buildRAGContext(results)
+	g.Log().Debugf(ctx, "Generated context: %s", contextStr)
+	return contextStr, nil
+}
+
+// buildRAGContext 将检索到的文档组合成上下文
+func buildRAGContext(docs []*schema.Document) string {
 	contextStr := "以下是相关的知识库信息：\n\n"
-	for i, doc := range results {
+	for i, doc := range docs {
 		contextStr += fmt.Sprintf("%d. [相关度: %.2f] %s\n\n", i+1, doc.Score(), doc.Content)
 	}
-	g.Log().Debugf(ctx, "Generated context: %s", contextStr)
-	return contextStr, nil
+	return contextStr
 }
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangle201210/wachat/backend/config"
+	"github.com/wangle201210/wachat/backend/secret"
+)
+
+// 日志相关默认值
+const (
+	defaultLogMaxSize     = 10 << 20 // 单个日志文件最大 10MB
+	defaultLogMaxBackups  = 3        // 保留的历史日志文件数量
+	defaultLogBufferLines = 1000     // 内存中保留的最近日志行数
+	maxLogLineLength      = 64 << 10 // 单行最大长度，超过后强制换行
+)
+
+// 日志来源
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+	LogStreamSystem = "system" // wachat 自身记录的启动、退出等事件
+)
+
+// LogLine 一行服务日志
+type LogLine struct {
+	Service string    `json:"service"`
+	Time    time.Time `json:"time"`
+	Stream  string    `json:"stream"`
+	Text    string    `json:"text"`
+}
+
+// ServiceLog 捕获服务的 stdout/stderr：写入按大小轮转的日志文件，并在内存中保留最近的日志行
+type ServiceLog struct {
+	service    string
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	lines       []LogLine // 环形缓冲区
+	next        int       // 下一行写入的位置
+	full        bool      // 缓冲区是否已写满
+	subscribers map[int]func(LogLine)
+	nextID      int
+}
+
+// NewServiceLog 创建服务日志，日志文件在首次写入时打开
+func NewServiceLog(service, path string) *ServiceLog {
+	return &ServiceLog{
+		service:     service,
+		path:        path,
+		maxSize:     defaultLogMaxSize,
+		maxBackups:  defaultLogMaxBackups,
+		lines:       make([]LogLine, defaultLogBufferLines),
+		subscribers: make(map[int]func(LogLine)),
+	}
+}
+
+// Configure 应用轮转与缓冲区设置，调整缓冲区大小时保留最近的日志
+func (l *ServiceLog) Configure(cfg *config.ServiceLogConfig) {
+	if cfg == nil {
+		return
+	}
+
+	var recent []LogLine
+	if cfg.BufferLines > 0 {
+		recent = l.Tail(cfg.BufferLines)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cfg.MaxSize > 0 {
+		l.maxSize = int64(cfg.MaxSize) << 20
+	}
+	if cfg.MaxBackups > 0 {
+		l.maxBackups = cfg.MaxBackups
+	}
+	if cfg.BufferLines > 0 && cfg.BufferLines != len(l.lines) {
+		l.lines = make([]LogLine, cfg.BufferLines)
+		copy(l.lines, recent)
+		l.next = len(recent) % cfg.BufferLines
+		l.full = len(recent) == cfg.BufferLines
+	}
+}
+
+// Path 返回当前日志文件路径
+func (l *ServiceLog) Path() string {
+	return l.path
+}
+
+// Writer 返回写入指定来源（stdout / stderr）的 io.Writer，可直接赋给 exec.Cmd
+func (l *ServiceLog) Writer(stream string) io.Writer {
+	return &logStreamWriter{log: l, stream: stream}
+}
+
+// Systemf 记录一条 wachat 自身的事件（启动、退出等）
+func (l *ServiceLog) Systemf(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	l.writeFile([]byte("[wachat] " + text + "\n"))
+	l.appendLine(LogStreamSystem, text)
+}
+
+// Tail 返回最近 n 行日志（n <= 0 时返回缓冲区中的全部日志）
+func (l *ServiceLog) Tail(n int) []LogLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.lines)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	result := make([]LogLine, 0, n)
+	start := l.next - n
+	for i := 0; i < n; i++ {
+		idx := (start + i + len(l.lines)) % len(l.lines)
+		result = append(result, l.lines[idx])
+	}
+	return result
+}
+
+// TailText 以文本形式返回最近 n 行日志
+func (l *ServiceLog) TailText(n int) string {
+	lines := l.Tail(n)
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Subscribe 订阅新的日志行，返回取消订阅的函数
+func (l *ServiceLog) Subscribe(fn func(LogLine)) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextID
+	l.nextID++
+	l.subscribers[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, id)
+	}
+}
+
+// Close 关闭日志文件
+func (l *ServiceLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// appendLine 将一行日志加入缓冲区并通知订阅者（已知的密钥替换为掩码）
+func (l *ServiceLog) appendLine(stream, text string) {
+	line := LogLine{
+		Service: l.service,
+		Time:    time.Now(),
+		Stream:  stream,
+		Text:    secret.Redact(text),
+	}
+
+	l.mu.Lock()
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % len(l.lines)
+	if l.next == 0 {
+		l.full = true
+	}
+	subscribers := make([]func(LogLine), 0, len(l.subscribers))
+	for _, fn := range l.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	l.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(line)
+	}
+}
+
+// writeFile 写入日志文件（已知的密钥替换为掩码），超过大小限制时先轮转
+func (l *ServiceLog) writeFile(p []byte) {
+	p = []byte(secret.Redact(string(p)))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return
+		}
+	}
+	// 重新打开的文件可能已接近上限，同样需要检查
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		l.file.Close()
+		l.file = nil
+		l.rotate()
+		if err := l.open(); err != nil {
+			return
+		}
+	}
+
+	n, _ := l.file.Write(p)
+	l.size += int64(n)
+}
+
+// open 打开（或创建）日志文件，调用方需持有锁
+func (l *ServiceLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate 轮转日志文件：name.log -> name.log.1 -> name.log.2 ...，调用方需持有锁
+func (l *ServiceLog) rotate() {
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	os.Rename(l.path, l.path+".1")
+}
+
+// logStreamWriter 将进程输出按行拆分后写入 ServiceLog
+type logStreamWriter struct {
+	log     *ServiceLog
+	stream  string
+	mu      sync.Mutex
+	partial []byte // 尚未遇到换行符的内容
+}
+
+// Write 实现 io.Writer，日志文件与缓冲区按相同的完整行写入
+func (w *logStreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.partial = append(w.partial, p...)
+	var lines []string
+	for {
+		idx := bytes.IndexByte(w.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimRight(string(w.partial[:idx]), "\r"))
+		w.partial = w.partial[idx+1:]
+	}
+	if len(w.partial) > maxLogLineLength {
+		lines = append(lines, string(w.partial))
+		w.partial = nil
+	}
+	// 持有 w.mu 写入文件，保证并发写入时行的顺序
+	for _, line := range lines {
+		w.log.writeFile([]byte(line + "\n"))
+	}
+	w.mu.Unlock()
+
+	for _, line := range lines {
+		w.log.appendLine(w.stream, line)
+	}
+	return len(p), nil
+}
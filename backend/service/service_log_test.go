@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// newTestServiceLog 创建写入临时目录的服务日志
+func newTestServiceLog(t *testing.T, bufferLines int) *ServiceLog {
+	t.Helper()
+	l := NewServiceLog("app", filepath.Join(t.TempDir(), "logs", "app.log"))
+	l.Configure(&config.ServiceLogConfig{BufferLines: bufferLines})
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// logTexts 返回日志行的文本
+func logTexts(lines []LogLine) []string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return texts
+}
+
+func TestServiceLogRingBuffer(t *testing.T) {
+	l := newTestServiceLog(t, 3)
+	if got := l.Tail(0); len(got) != 0 {
+		t.Errorf("Tail of an empty log = %v", got)
+	}
+
+	w := l.Writer(LogStreamStdout)
+	fmt.Fprint(w, "one\ntwo\n")
+	if got := logTexts(l.Tail(0)); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Tail before wrapping = %v", got)
+	}
+
+	// 写满后覆盖最旧的行
+	fmt.Fprint(w, "three\nfour\nfive\n")
+	if got := logTexts(l.Tail(0)); !reflect.DeepEqual(got, []string{"three", "four", "five"}) {
+		t.Errorf("Tail after wrapping = %v", got)
+	}
+	if got := logTexts(l.Tail(2)); !reflect.DeepEqual(got, []string{"four", "five"}) {
+		t.Errorf("Tail(2) = %v", got)
+	}
+	if got := l.TailText(10); got != "three\nfour\nfive" {
+		t.Errorf("TailText = %q", got)
+	}
+
+	// 扩大缓冲区时保留最近的日志
+	l.Configure(&config.ServiceLogConfig{BufferLines: 4})
+	fmt.Fprint(w, "six\n")
+	if got := logTexts(l.Tail(0)); !reflect.DeepEqual(got, []string{"three", "four", "five", "six"}) {
+		t.Errorf("Tail after growing = %v", got)
+	}
+	// 缩小缓冲区时只保留最近的行
+	l.Configure(&config.ServiceLogConfig{BufferLines: 2})
+	if got := logTexts(l.Tail(0)); !reflect.DeepEqual(got, []string{"five", "six"}) {
+		t.Errorf("Tail after shrinking = %v", got)
+	}
+}
+
+func TestServiceLogWriter(t *testing.T) {
+	l := newTestServiceLog(t, 10)
+	var received []LogLine
+	unsubscribe := l.Subscribe(func(line LogLine) { received = append(received, line) })
+
+	stdout := l.Writer(LogStreamStdout)
+	stderr := l.Writer(LogStreamStderr)
+	// 跨多次写入的行在遇到换行符后才记录
+	fmt.Fprint(stdout, "hel")
+	fmt.Fprint(stdout, "lo\r\nwor")
+	fmt.Fprint(stderr, "oops\n")
+	fmt.Fprint(stdout, "ld\n")
+	l.Systemf("app exited: %d", 1)
+
+	want := []LogLine{
+		{Service: "app", Stream: LogStreamStdout, Text: "hello"},
+		{Service: "app", Stream: LogStreamStderr, Text: "oops"},
+		{Service: "app", Stream: LogStreamStdout, Text: "world"},
+		{Service: "app", Stream: LogStreamSystem, Text: "app exited: 1"},
+	}
+	for i := range received {
+		if received[i].Time.IsZero() {
+			t.Errorf("line %d has no time", i)
+		}
+		received[i].Time = want[0].Time
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("received = %+v, want %+v", received, want)
+	}
+
+	// 文件与缓冲区按相同的行写入
+	data, err := os.ReadFile(l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "hello\noops\nworld\n[wachat] app exited: 1\n" {
+		t.Errorf("log file = %q", got)
+	}
+
+	unsubscribe()
+	fmt.Fprint(stdout, "after\n")
+	if len(received) != len(want) {
+		t.Errorf("received a line after unsubscribing: %+v", received[len(received)-1])
+	}
+}
+
+func TestServiceLogLongLine(t *testing.T) {
+	l := newTestServiceLog(t, 10)
+	w := l.Writer(LogStreamStdout)
+	long := strings.Repeat("x", maxLogLineLength+1)
+	fmt.Fprint(w, long)
+	fmt.Fprint(w, "tail\n")
+
+	if got := logTexts(l.Tail(0)); len(got) != 2 || got[0] != long || got[1] != "tail" {
+		t.Errorf("lines = %d, want the long line forced out before the next line", len(got))
+	}
+	data, err := os.ReadFile(l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != long+"\ntail\n" {
+		t.Errorf("log file has %d bytes, want the forced line break", len(data))
+	}
+}
+
+func TestServiceLogRotate(t *testing.T) {
+	l := newTestServiceLog(t, 10)
+	l.maxSize = 10
+	l.maxBackups = 2
+
+	w := l.Writer(LogStreamStdout)
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(w, "line %d\n", i) // 每行 7 字节，每个文件只放得下一行
+	}
+
+	for path, want := range map[string]string{
+		l.Path():        "line 4\n",
+		l.Path() + ".1": "line 3\n",
+		l.Path() + ".2": "line 2\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(path), data, err, want)
+		}
+	}
+	if _, err := os.Stat(l.Path() + ".3"); !os.IsNotExist(err) {
+		t.Error("rotation kept more than maxBackups files")
+	}
+
+	// 重新打开时从已有文件的大小继续计算
+	l.Close()
+	fmt.Fprint(w, "abc\n")
+	if data, _ := os.ReadFile(l.Path() + ".1"); string(data) != "line 4\n" {
+		t.Errorf("after reopening, .1 = %q, want the previous file", data)
+	}
+}
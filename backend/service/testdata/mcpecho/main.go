@@ -0,0 +1,138 @@
+// mcpecho is a tiny stdio MCP server used to exercise wachat's MCP client.
+//
+// It exposes two tools, "echo" and "add", and speaks newline delimited
+// JSON-RPC 2.0 on stdin/stdout. When MCPECHO_STARTS names a file, every
+// start appends a line to it so tests can count spawned processes.
+// Declare it in config.yaml with:
+//
+//	mcp:
+//	  enabled: true
+//	  servers:
+//	    - name: "echo"
+//	      command: "go"
+//	      args: ["run", "./backend/service/testdata/mcpecho"]
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+}
+
+var tools = []map[string]interface{}{
+	{
+		"name":        "echo",
+		"description": "Echo the given text back",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text": map[string]string{"type": "string", "description": "Text to echo"},
+			},
+			"required": []string{"text"},
+		},
+	},
+	{
+		"name":        "add",
+		"description": "Add two numbers",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"a": map[string]string{"type": "number"},
+				"b": map[string]string{"type": "number"},
+			},
+			"required": []string{"a", "b"},
+		},
+	},
+}
+
+func main() {
+	if path := os.Getenv("MCPECHO_STARTS"); path != "" {
+		if f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			f.Close()
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintf(os.Stderr, "mcpecho: invalid message: %v\n", err)
+			continue
+		}
+		// Notifications carry no id and expect no response
+		if req.ID == nil {
+			continue
+		}
+
+		resp := response{JSONRPC: "2.0", ID: *req.ID}
+		switch req.Method {
+		case "initialize":
+			resp.Result = map[string]interface{}{
+				"protocolVersion": "2024-11-05",
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+				"serverInfo":      map[string]string{"name": "mcpecho", "version": "0.0.1"},
+			}
+		case "tools/list":
+			resp.Result = map[string]interface{}{"tools": tools}
+		case "tools/call":
+			resp.Result, resp.Error = callTool(req.Params)
+		default:
+			resp.Error = map[string]interface{}{"code": -32601, "message": "method not found: " + req.Method}
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			fmt.Fprintf(os.Stderr, "mcpecho: failed to write response: %v\n", err)
+			return
+		}
+	}
+}
+
+func callTool(params json.RawMessage) (interface{}, interface{}) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Text string  `json:"text"`
+			A    float64 `json:"a"`
+			B    float64 `json:"b"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, map[string]interface{}{"code": -32602, "message": err.Error()}
+	}
+
+	var text string
+	switch call.Name {
+	case "echo":
+		text = call.Arguments.Text
+	case "add":
+		text = fmt.Sprintf("%g", call.Arguments.A+call.Arguments.B)
+	default:
+		return map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "unknown tool: " + call.Name}},
+			"isError": true,
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+	}, nil
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/crypto/blake2b"
+)
+
+// maxVerifyFileSize 校验和、签名文件的最大大小
+const maxVerifyFileSize = 1 << 20
+
+// InstallRecord 安装记录：保存在安装目录中，用于事后审计下载文件的来源和哈希
+type InstallRecord struct {
+	File      string    `json:"file"`                // 下载文件名
+	URL       string    `json:"url"`                 // 下载地址
+	Version   string    `json:"version,omitempty"`   // 安装的版本
+	SHA256    string    `json:"sha256"`              // 下载文件的 SHA256
+	Verified  bool      `json:"verified"`            // SHA256 是否与固定值或发布的校验和一致
+	Source    string    `json:"source,omitempty"`    // 校验和来源（pinned 或校验和文件地址）
+	Signature string    `json:"signature,omitempty"` // 已通过的签名校验（minisign / cosign）
+	Time      time.Time `json:"time"`
+}
+
+// verifyDownload 按 verify 配置校验下载的文件，失败时返回错误（由调用方删除文件）
+func (m *ManagedService) verifyDownload(file, downloadURL string) (*InstallRecord, error) {
+	sum, err := fileSHA256(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", filepath.Base(file), err)
+	}
+
+	fileName := path.Base(downloadURL)
+	record := &InstallRecord{
+		File:   fileName,
+		URL:    downloadURL,
+		SHA256: sum,
+		Time:   time.Now(),
+	}
+
+	cfg := m.Spec().Verify
+	if cfg == nil {
+		g.Log().Warningf(m.ctx, "%s: no checksum configured, %s is not verified (sha256 %s)", m.serviceName, fileName, sum)
+		return record, nil
+	}
+
+	// SHA256：固定值优先，否则读取发布的校验和文件
+	expected, source := strings.ToLower(strings.TrimSpace(cfg.SHA256)), "pinned"
+	if expected == "" && cfg.ChecksumURL != "" {
+		source = m.expandVerifyURL(cfg.ChecksumURL, downloadURL)
+		var fetchErr error
+		expected, fetchErr = fetchChecksum(m.ctx, source, fileName)
+		if fetchErr != nil {
+			if cfg.Required {
+				return nil, fmt.Errorf("failed to get checksum of %s: %w", fileName, fetchErr)
+			}
+			g.Log().Warningf(m.ctx, "%s: failed to get checksum of %s: %v, continuing unverified", m.serviceName, fileName, fetchErr)
+		}
+	}
+	switch {
+	case expected != "":
+		if expected != sum {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", fileName, expected, sum)
+		}
+		record.Verified = true
+		record.Source = source
+		g.Log().Infof(m.ctx, "%s: sha256 of %s verified (%s)", m.serviceName, fileName, sum)
+	case cfg.Required:
+		return nil, fmt.Errorf("no checksum available for %s", fileName)
+	}
+
+	// 可选的签名校验
+	if cfg.Minisign != nil && cfg.Minisign.PublicKey != "" {
+		sigURL := cfg.Minisign.SignatureURL
+		if sigURL == "" {
+			sigURL = "{url}.minisig"
+		}
+		sig, err := fetchSmallFile(m.ctx, m.expandVerifyURL(sigURL, downloadURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download minisign signature: %w", err)
+		}
+		if err := verifyMinisign(file, sig, cfg.Minisign.PublicKey); err != nil {
+			return nil, fmt.Errorf("minisign verification failed for %s: %w", fileName, err)
+		}
+		record.Signature = "minisign"
+	}
+	if cfg.Cosign != nil && cfg.Cosign.Key != "" {
+		sigURL := cfg.Cosign.SignatureURL
+		if sigURL == "" {
+			sigURL = "{url}.sig"
+		}
+		if err := m.verifyCosign(file, m.expandVerifyURL(sigURL, downloadURL), cfg.Cosign.Key); err != nil {
+			return nil, fmt.Errorf("cosign verification failed for %s: %w", fileName, err)
+		}
+		if record.Signature != "" {
+			record.Signature += ","
+		}
+		record.Signature += "cosign"
+	}
+
+	return record, nil
+}
+
+// expandVerifyURL 替换校验地址中的 {url} {dir} {file} 及服务占位符
+func (m *ManagedService) expandVerifyURL(s, downloadURL string) string {
+	dir := downloadURL
+	if i := strings.LastIndex(downloadURL, "/"); i >= 0 {
+		dir = downloadURL[:i]
+	}
+	s = strings.NewReplacer(
+		"{url}", downloadURL,
+		"{dir}", dir,
+		"{file}", path.Base(downloadURL),
+	).Replace(s)
+	return m.expand(s)
+}
+
+// verifyCosign 调用 cosign verify-blob 校验签名
+func (m *ManagedService) verifyCosign(file, sigURL, key string) error {
+	cosign, err := exec.LookPath("cosign")
+	if err != nil {
+		return fmt.Errorf("cosign is not installed")
+	}
+
+	sig, err := fetchSmallFile(m.ctx, sigURL)
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	sigFile := file + ".sig"
+	if err := os.WriteFile(sigFile, sig, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(sigFile)
+
+	ctx, cancel := context.WithTimeout(m.ctx, time.Minute)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, cosign, "verify-blob", "--key", key, "--signature", sigFile, file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// InstallRecord 返回当前版本的安装记录（未记录时为 nil）
+func (m *ManagedService) InstallRecord() *InstallRecord {
+	data, err := os.ReadFile(filepath.Join(m.binaryDir(), m.Spec().Name+".install.json"))
+	if err != nil {
+		return nil
+	}
+	var record InstallRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil
+	}
+	return &record
+}
+
+// writeInstallRecord 将安装记录保存到版本目录
+func writeInstallRecord(dir, name string, record *InstallRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".install.json"), data, 0644)
+}
+
+// fileSHA256 计算文件的 SHA256
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchChecksum 下载校验和文件并查找指定文件的 SHA256
+func fetchChecksum(ctx context.Context, checksumURL, fileName string) (string, error) {
+	data, err := fetchSmallFile(ctx, checksumURL)
+	if err != nil {
+		return "", err
+	}
+	sum, ok := parseChecksums(data, fileName)
+	if !ok {
+		return "", fmt.Errorf("%s not listed in %s", fileName, checksumURL)
+	}
+	return sum, nil
+}
+
+// parseChecksums 解析校验和文件，支持 sha256sum 格式（"<hash>  <file>"）、
+// BSD 格式（"SHA256 (<file>) = <hash>"）以及只包含一个哈希的 .sha256 文件
+func parseChecksums(data []byte, fileName string) (string, bool) {
+	var single string
+	count := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		count++
+
+		if strings.HasPrefix(line, "SHA256 (") {
+			if name, sum, ok := strings.Cut(strings.TrimPrefix(line, "SHA256 ("), ") = "); ok && path.Base(name) == fileName {
+				return strings.ToLower(sum), true
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !isSHA256(fields[0]) {
+			continue
+		}
+		if len(fields) == 1 {
+			single = fields[0]
+			continue
+		}
+		name := strings.TrimPrefix(fields[len(fields)-1], "*")
+		if path.Base(name) == fileName {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+
+	if count == 1 && single != "" {
+		return strings.ToLower(single), true
+	}
+	return "", false
+}
+
+// isSHA256 检查字符串是否为十六进制 SHA256
+func isSHA256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// fetchSmallFile 下载校验和、签名等小文件（与安装包使用相同的代理和镜像）
+func fetchSmallFile(ctx context.Context, url string) ([]byte, error) {
+	return sharedDownloader().Fetch(ctx, url, maxVerifyFileSize)
+}
+
+// verifyMinisign 校验 minisign 签名（支持 Ed 与预哈希的 ED 两种算法）
+func verifyMinisign(file string, sigData []byte, publicKey string) error {
+	pub, err := decodeMinisignKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	// 签名文件格式：untrusted comment / 签名 / trusted comment / 全局签名
+	lines := strings.Split(strings.ReplaceAll(string(sigData), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("invalid signature file")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 74 {
+		return fmt.Errorf("invalid signature")
+	}
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("invalid trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid global signature")
+	}
+
+	algorithm, keyID, signature := string(sig[:2]), sig[2:10], sig[10:]
+	if !bytes.Equal(keyID, pub[2:10]) {
+		return fmt.Errorf("signature was made with a different key")
+	}
+
+	var message []byte
+	switch algorithm {
+	case "Ed":
+		if message, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	case "ED":
+		h, _ := blake2b.New512(nil)
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	default:
+		return fmt.Errorf("unsupported signature algorithm: %q", algorithm)
+	}
+
+	key := ed25519.PublicKey(pub[10:])
+	if !ed25519.Verify(key, message, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	if !ed25519.Verify(key, append(append([]byte{}, signature...), trustedComment...), globalSig) {
+		return fmt.Errorf("invalid global signature")
+	}
+	return nil
+}
+
+// decodeMinisignKey 解析 minisign 公钥，可以是 base64 内容或完整的 minisign.pub 文件内容
+func decodeMinisignKey(publicKey string) ([]byte, error) {
+	encoded := ""
+	for _, line := range strings.Split(publicKey, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			encoded = line
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 42 || string(key[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid minisign public key")
+	}
+	return key, nil
+}
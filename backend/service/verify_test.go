@@ -0,0 +1,225 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+	"golang.org/x/crypto/blake2b"
+)
+
+// testMinisignKey 测试用的 minisign 密钥
+type testMinisignKey struct {
+	id      []byte
+	private ed25519.PrivateKey
+	public  string // minisign.pub 第二行的 base64 内容
+}
+
+func newTestMinisignKey(t *testing.T) *testMinisignKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	key := append(append([]byte("Ed"), id...), pub...)
+	return &testMinisignKey{id: id, private: priv, public: base64.StdEncoding.EncodeToString(key)}
+}
+
+// sign 生成 minisign 签名文件内容，algorithm 为 Ed（直接签名）或 ED（预哈希）
+func (k *testMinisignKey) sign(data []byte, algorithm, trustedComment string) []byte {
+	message := data
+	if algorithm == "ED" {
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	}
+	signature := ed25519.Sign(k.private, message)
+	sig := append(append([]byte(algorithm), k.id...), signature...)
+	global := ed25519.Sign(k.private, append(append([]byte{}, signature...), trustedComment...))
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig), trustedComment, base64.StdEncoding.EncodeToString(global)))
+}
+
+// sha256Hex 返回数据的十六进制 SHA256
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseChecksums(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+	tests := []struct {
+		name   string
+		data   string
+		want   string
+		wantOK bool
+	}{
+		{"sha256sum", other + "  app-linux.tar.gz\n" + sum + "  app-darwin.tar.gz\n", sum, true},
+		{"binary mode", sum + " *app-darwin.tar.gz\n", sum, true},
+		{"path in listing", sum + "  dist/app-darwin.tar.gz\n", sum, true},
+		{"bsd", "SHA256 (app-linux.tar.gz) = " + other + "\nSHA256 (app-darwin.tar.gz) = " + strings.ToUpper(sum) + "\n", sum, true},
+		{"single hash", "# checksum\n" + strings.ToUpper(sum) + "\n", sum, true},
+		{"not listed", other + "  app-linux.tar.gz\n", "", false},
+		{"not a hash", "deadbeef  app-darwin.tar.gz\n", "", false},
+		{"several bare hashes", sum + "\n" + other + "\n", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseChecksums([]byte(tt.data), "app-darwin.tar.gz")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseChecksums = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	key := newTestMinisignKey(t)
+	file := filepath.Join(t.TempDir(), "app.tar.gz")
+	data := []byte("release archive")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pubFile := "untrusted comment: minisign public key\n" + key.public + "\n"
+
+	tests := []struct {
+		name    string
+		sig     []byte
+		key     string
+		wantErr string
+	}{
+		{"ed", key.sign(data, "Ed", "timestamp:1"), key.public, ""},
+		{"prehashed", key.sign(data, "ED", "timestamp:1"), key.public, ""},
+		{"public key file", key.sign(data, "ED", "timestamp:1"), pubFile, ""},
+		{"tampered file", key.sign([]byte("other archive"), "ED", "timestamp:1"), key.public, "invalid signature"},
+		{"other key", newTestMinisignKey(t).sign(data, "ED", "timestamp:1"), key.public, "different key"},
+		{"tampered trusted comment", []byte(strings.Replace(string(key.sign(data, "ED", "timestamp:1")), "timestamp:1", "timestamp:2", 1)), key.public, "invalid global signature"},
+		{"unknown algorithm", key.sign(data, "XX", "timestamp:1"), key.public, "unsupported signature algorithm"},
+		{"truncated", []byte("untrusted comment: x\n"), key.public, "invalid signature file"},
+		{"invalid key", key.sign(data, "ED", "timestamp:1"), "bm90IGEga2V5", "invalid minisign public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyMinisign(file, tt.sig, tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyMinisign: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyMinisign error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	data := []byte("release archive")
+	sum := sha256Hex(data)
+	key := newTestMinisignKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /releases/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  app.tar.gz\n", sum)
+	})
+	mux.HandleFunc("GET /releases/wrong.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  app.tar.gz\n", strings.Repeat("0", 64))
+	})
+	mux.HandleFunc("GET /releases/app.tar.gz.minisig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(key.sign(data, "ED", "timestamp:1"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	downloadURL := server.URL + "/releases/app.tar.gz"
+
+	tests := []struct {
+		name         string
+		verify       *config.VerifyConfig
+		wantErr      string
+		wantVerified bool
+		wantSource   string
+		wantSig      string
+	}{
+		{name: "no verify config"},
+		{name: "pinned", verify: &config.VerifyConfig{SHA256: strings.ToUpper(sum)}, wantVerified: true, wantSource: "pinned"},
+		{name: "pinned mismatch", verify: &config.VerifyConfig{SHA256: strings.Repeat("0", 64)}, wantErr: "checksum mismatch"},
+		{name: "checksum file", verify: &config.VerifyConfig{ChecksumURL: "{dir}/checksums.txt"}, wantVerified: true, wantSource: server.URL + "/releases/checksums.txt"},
+		{name: "checksum file mismatch", verify: &config.VerifyConfig{ChecksumURL: "{dir}/wrong.txt"}, wantErr: "checksum mismatch"},
+		{name: "checksum file missing", verify: &config.VerifyConfig{ChecksumURL: "{dir}/missing.txt"}},
+		{name: "checksum file missing and required", verify: &config.VerifyConfig{ChecksumURL: "{dir}/missing.txt", Required: true}, wantErr: "failed to get checksum"},
+		{name: "required without checksum", verify: &config.VerifyConfig{Required: true}, wantErr: "no checksum available"},
+		{
+			name:         "minisign",
+			verify:       &config.VerifyConfig{SHA256: sum, Minisign: &config.MinisignConfig{PublicKey: key.public}},
+			wantVerified: true,
+			wantSource:   "pinned",
+			wantSig:      "minisign",
+		},
+		{
+			name:    "minisign with another key",
+			verify:  &config.VerifyConfig{Minisign: &config.MinisignConfig{PublicKey: newTestMinisignKey(t).public}},
+			wantErr: "minisign verification failed",
+		},
+		{
+			name:    "minisign signature missing",
+			verify:  &config.VerifyConfig{Minisign: &config.MinisignConfig{PublicKey: key.public, SignatureURL: "{dir}/missing.minisig"}},
+			wantErr: "failed to download minisign signature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManagedService(t, &config.ManagedServiceConfig{DownloadURL: downloadURL, Verify: tt.verify})
+			file := filepath.Join(t.TempDir(), "app.tar.gz")
+			if err := os.WriteFile(file, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			record, err := m.verifyDownload(file, downloadURL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyDownload error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.File != "app.tar.gz" || record.URL != downloadURL || record.SHA256 != sum {
+				t.Errorf("record = %+v", record)
+			}
+			if record.Verified != tt.wantVerified || record.Source != tt.wantSource || record.Signature != tt.wantSig {
+				t.Errorf("verified, source, signature = %v, %q, %q, want %v, %q, %q",
+					record.Verified, record.Source, record.Signature, tt.wantVerified, tt.wantSource, tt.wantSig)
+			}
+		})
+	}
+}
+
+func TestExpandVerifyURL(t *testing.T) {
+	m := newTestManagedService(t, &config.ManagedServiceConfig{Version: "v1.0.0"})
+	downloadURL := "https://example.com/releases/v1.0.0/app.tar.gz"
+	tests := map[string]string{
+		"{url}.minisig":                   "https://example.com/releases/v1.0.0/app.tar.gz.minisig",
+		"{dir}/checksums.txt":             "https://example.com/releases/v1.0.0/checksums.txt",
+		"https://sums.example.com/{file}": "https://sums.example.com/app.tar.gz",
+		"{dir}/{name}-{version}.sha256":   "https://example.com/releases/v1.0.0/app-v1.0.0.sha256",
+	}
+	for tmpl, want := range tests {
+		if got := m.expandVerifyURL(tmpl, downloadURL); got != want {
+			t.Errorf("expandVerifyURL(%s) = %s, want %s", tmpl, got, want)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// 版本目录结构：
+//
+//	{installPath}/versions/<version>/   各版本的安装文件
+//	{installPath}/current               当前使用的版本
+//	{installPath}/previous              上一个版本（用于回滚）
+//
+// 工作目录、数据、日志仍位于 {installPath}，切换版本不影响数据
+const (
+	versionsDirName     = "versions"
+	currentVersionFile  = "current"
+	previousVersionFile = "previous"
+	latestVersion       = "latest"
+)
+
+// UpdateInfo 版本更新信息
+type UpdateInfo struct {
+	Service         string    `json:"service"`
+	Current         string    `json:"current"`               // 当前安装的版本（旧版安装布局为空）
+	Latest          string    `json:"latest"`                // 最新发布的版本
+	Pinned          string    `json:"pinned,omitempty"`      // 配置中固定的版本
+	UpdateAvailable bool      `json:"updateAvailable"`       // 是否有可用更新
+	ReleaseURL      string    `json:"releaseURL,omitempty"`  // 发布页面
+	PublishedAt     time.Time `json:"publishedAt,omitempty"` // 发布时间
+	CheckedAt       time.Time `json:"checkedAt"`             // 检查时间
+	Error           string    `json:"error,omitempty"`       // 检查失败的原因
+}
+
+// CurrentVersion 返回当前使用的版本（未使用版本目录的旧版安装返回空字符串）
+func (m *ManagedService) CurrentVersion() string {
+	return readVersionFile(filepath.Join(m.Spec().InstallPath, currentVersionFile))
+}
+
+// PreviousVersion 返回上一个版本（用于回滚）
+func (m *ManagedService) PreviousVersion() string {
+	return readVersionFile(filepath.Join(m.Spec().InstallPath, previousVersionFile))
+}
+
+// InstalledVersions 返回已安装的全部版本
+func (m *ManagedService) InstalledVersions() []string {
+	entries, err := os.ReadDir(filepath.Join(m.Spec().InstallPath, versionsDirName))
+	if err != nil {
+		return nil
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// CheckForUpdates 查询最新发布的版本
+func (m *ManagedService) CheckForUpdates() (*UpdateInfo, error) {
+	info := &UpdateInfo{
+		Service:   m.Spec().Name,
+		Current:   m.CurrentVersion(),
+		CheckedAt: time.Now(),
+	}
+	if pinned := m.pinnedVersion(); pinned != "" {
+		info.Pinned = pinned
+	}
+
+	release, err := m.latestRelease()
+	if err != nil {
+		info.Error = err.Error()
+		return info, err
+	}
+	info.Latest = release.TagName
+	info.ReleaseURL = release.HTMLURL
+	info.PublishedAt = release.PublishedAt
+	info.UpdateAvailable = info.Latest != "" && info.Latest != info.Current
+
+	m.mu.Lock()
+	m.lastUpdate = info
+	m.mu.Unlock()
+	return info, nil
+}
+
+// Upgrade 升级到最新版本并保留当前版本用于回滚
+func (m *ManagedService) Upgrade() error {
+	if pinned := m.pinnedVersion(); pinned != "" {
+		return fmt.Errorf("%s is pinned to %s in config, change the version to upgrade", m.serviceName, pinned)
+	}
+
+	info, err := m.CheckForUpdates()
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	if !info.UpdateAvailable {
+		return fmt.Errorf("%s is already at the latest version %s", m.serviceName, info.Current)
+	}
+
+	if err := m.install(info.Latest); err != nil {
+		return err
+	}
+	return m.switchVersion(info.Latest)
+}
+
+// Rollback 切换回上一个版本
+func (m *ManagedService) Rollback() error {
+	previous := m.PreviousVersion()
+	if previous == "" {
+		return fmt.Errorf("%s has no previous version to roll back to", m.serviceName)
+	}
+	dir, err := m.versionDir(previous)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("previous version %s of %s is no longer installed", previous, m.serviceName)
+	}
+	return m.switchVersion(previous)
+}
+
+// switchVersion 切换当前版本：运行中的服务先停止，切换后重新启动，新版本无法启动时自动切回
+// 切换成功后只保留当前版本和上一个版本
+func (m *ManagedService) switchVersion(version string) error {
+	wasRunning := m.BaseServiceManager.IsRunning()
+	if wasRunning {
+		if err := m.Stop(); err != nil {
+			return err
+		}
+	}
+
+	current, previous := m.CurrentVersion(), m.PreviousVersion()
+	if err := m.activate(version); err != nil {
+		return err
+	}
+	g.Log().Infof(m.ctx, "%s switched to version %s (previous: %s)", m.serviceName, version, current)
+
+	var err error
+	if wasRunning {
+		if err = m.Start(); err == nil {
+			err = m.WaitForHealth(30 * time.Second)
+		}
+	}
+	if err == nil || current == "" {
+		m.pruneVersions()
+		return err
+	}
+
+	// 新版本无法启动，恢复原来的 current / previous 并重新启动原版本
+	g.Log().Warningf(m.ctx, "%s %s failed to start: %v, rolling back to %s", m.serviceName, version, err, current)
+	if m.BaseServiceManager.IsRunning() {
+		m.Stop()
+	}
+	if restoreErr := m.restoreVersions(current, previous); restoreErr != nil {
+		return fmt.Errorf("%s %s failed to start (%v) and rollback failed: %w", m.serviceName, version, err, restoreErr)
+	}
+	m.pruneVersions()
+	if startErr := m.Start(); startErr != nil {
+		return fmt.Errorf("%s %s failed to start (%v), rolled back to %s but it failed to start too: %w", m.serviceName, version, err, current, startErr)
+	}
+	return fmt.Errorf("%s %s failed to start, rolled back to %s: %w", m.serviceName, version, current, err)
+}
+
+// activate 将 current 指向指定版本，原版本记为 previous
+func (m *ManagedService) activate(version string) error {
+	if err := config.ValidateVersion(version); err != nil {
+		return err
+	}
+	current := m.CurrentVersion()
+	if current != "" && current != version {
+		if err := writeVersionFile(filepath.Join(m.Spec().InstallPath, previousVersionFile), current); err != nil {
+			return err
+		}
+	}
+	return writeVersionFile(filepath.Join(m.Spec().InstallPath, currentVersionFile), version)
+}
+
+// restoreVersions 恢复切换前的 current / previous
+func (m *ManagedService) restoreVersions(current, previous string) error {
+	if err := writeVersionFile(filepath.Join(m.Spec().InstallPath, currentVersionFile), current); err != nil {
+		return err
+	}
+	previousPath := filepath.Join(m.Spec().InstallPath, previousVersionFile)
+	if previous == "" {
+		if err := os.Remove(previousPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeVersionFile(previousPath, previous)
+}
+
+// pruneVersions 只保留当前版本和上一个版本
+func (m *ManagedService) pruneVersions() {
+	keep := map[string]bool{m.CurrentVersion(): true, m.PreviousVersion(): true}
+	for _, version := range m.InstalledVersions() {
+		if keep[version] {
+			continue
+		}
+		dir, err := m.versionDir(version)
+		if err != nil {
+			g.Log().Warningf(m.ctx, "Skipping version directory of %s: %v", m.serviceName, err)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			g.Log().Warningf(m.ctx, "Failed to remove old version %s of %s: %v", version, m.serviceName, err)
+			continue
+		}
+		g.Log().Infof(m.ctx, "Removed old version %s of %s", version, m.serviceName)
+	}
+}
+
+// targetVersion 返回 Download 要安装的版本：固定版本，或查询到的最新版本
+func (m *ManagedService) targetVersion() string {
+	if pinned := m.pinnedVersion(); pinned != "" {
+		return pinned
+	}
+	release, err := m.latestRelease()
+	if err != nil {
+		g.Log().Warningf(m.ctx, "Failed to resolve latest version of %s: %v, installing as %q", m.serviceName, err, latestVersion)
+		return latestVersion
+	}
+	return release.TagName
+}
+
+// pinnedVersion 返回配置中固定的版本（未固定时为空）
+func (m *ManagedService) pinnedVersion() string {
+	version := m.Spec().Version
+	if version == "" || version == latestVersion {
+		return ""
+	}
+	return version
+}
+
+// versionDir 返回指定版本的安装目录，版本号不能用作目录名时返回错误（如 ".." 会指向安装目录的上级）
+func (m *ManagedService) versionDir(version string) (string, error) {
+	if err := config.ValidateVersion(version); err != nil {
+		return "", fmt.Errorf("%s: %w", m.serviceName, err)
+	}
+	return filepath.Join(m.Spec().InstallPath, versionsDirName, version), nil
+}
+
+// binaryDir 返回当前版本的安装目录（旧版安装布局为安装路径本身）
+func (m *ManagedService) binaryDir() string {
+	if current := m.CurrentVersion(); current != "" {
+		// CurrentVersion 只返回合法的版本号
+		return filepath.Join(m.Spec().InstallPath, versionsDirName, current)
+	}
+	return m.Spec().InstallPath
+}
+
+// versionedDownloadURL 返回指定版本的下载地址
+// GitHub 的 releases/latest/download 地址会改写为 releases/download/<version>
+func (m *ManagedService) versionedDownloadURL(version string) string {
+	downloadURL := m.Spec().DownloadURL
+	if version != latestVersion {
+		downloadURL = strings.Replace(downloadURL, "/releases/latest/download", "/releases/download/"+version, 1)
+	}
+	return m.expand(strings.ReplaceAll(downloadURL, "{version}", version))
+}
+
+// githubRelease GitHub releases API 的响应（只取用到的字段）
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// latestRelease 查询最新发布的版本
+func (m *ManagedService) latestRelease() (*githubRelease, error) {
+	apiURL := m.releasesURL()
+	if apiURL == "" {
+		return nil, fmt.Errorf("cannot determine the release source of %s, set releasesURL", m.serviceName)
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := sharedDownloader().Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query releases: %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to decode release: %w", err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("release has no tag")
+	}
+	if err := config.ValidateVersion(release.TagName); err != nil {
+		return nil, fmt.Errorf("unexpected release tag: %w", err)
+	}
+	return &release, nil
+}
+
+// releasesURL 返回查询最新版本的 API 地址，未配置时从 github.com 的下载地址推导
+func (m *ManagedService) releasesURL() string {
+	spec := m.Spec()
+	if spec.ReleasesURL != "" {
+		return m.expand(spec.ReleasesURL)
+	}
+
+	u, err := url.Parse(spec.DownloadURL)
+	if err != nil || u.Host != "github.com" {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 || parts[2] != "releases" {
+		return ""
+	}
+	return fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", parts[0], parts[1])
+}
+
+// readVersionFile 读取版本指针文件，内容不是合法的版本号时视为不存在
+func readVersionFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimSpace(string(data))
+	if config.ValidateVersion(version) != nil {
+		return ""
+	}
+	return version
+}
+
+// writeVersionFile 写入版本指针文件（先写临时文件再重命名，避免中途失败留下空文件）
+func writeVersionFile(path, version string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(version+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
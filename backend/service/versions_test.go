@@ -0,0 +1,196 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// installTestVersion 在版本目录中放入可执行文件，模拟已安装的版本
+func installTestVersion(t *testing.T, m *ManagedService, version string) string {
+	t.Helper()
+	dir := filepath.Join(m.Spec().InstallPath, versionsDirName, version)
+	binary := m.binaryPathIn(dir)
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte(version), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestVersionDir(t *testing.T) {
+	m := newTestManagedService(t, nil)
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{"v1.2.0", false},
+		{"1.2.0+build.5", false},
+		{"local-0123456789ab", false},
+		{latestVersion, false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{"a/b", true},
+		{"../a", true},
+		{`a\b`, true},
+		{"v1 beta", true},
+	}
+	for _, tt := range tests {
+		dir, err := m.versionDir(tt.version)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("versionDir(%q) = %s, want error", tt.version, dir)
+			}
+			continue
+		}
+		want := filepath.Join(m.Spec().InstallPath, versionsDirName, tt.version)
+		if err != nil || dir != want {
+			t.Errorf("versionDir(%q) = %s, %v, want %s", tt.version, dir, err, want)
+		}
+	}
+}
+
+func TestVersionPointers(t *testing.T) {
+	m := newTestManagedService(t, nil)
+	installTestVersion(t, m, "v1")
+	installTestVersion(t, m, "v2")
+	installTestVersion(t, m, "v3")
+	if m.IsInstalled() {
+		t.Error("IsInstalled = true before activating a version")
+	}
+
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if err := m.activate(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.CurrentVersion() != "v3" || m.PreviousVersion() != "v2" || !m.IsInstalled() {
+		t.Errorf("current, previous = %s, %s, want v3, v2", m.CurrentVersion(), m.PreviousVersion())
+	}
+	if got := m.getBinaryPath(); got != m.binaryPathIn(filepath.Join(m.Spec().InstallPath, versionsDirName, "v3")) {
+		t.Errorf("binary path = %s, want the v3 directory", got)
+	}
+
+	m.pruneVersions()
+	if got := m.InstalledVersions(); !reflect.DeepEqual(got, []string{"v2", "v3"}) {
+		t.Errorf("versions after pruning = %v, want [v2 v3]", got)
+	}
+
+	if err := m.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if m.CurrentVersion() != "v2" || m.PreviousVersion() != "v3" {
+		t.Errorf("after rollback current, previous = %s, %s, want v2, v3", m.CurrentVersion(), m.PreviousVersion())
+	}
+	if err := m.activate(".."); err == nil {
+		t.Error("activate(..) succeeded")
+	}
+}
+
+func TestVersionPointerTampered(t *testing.T) {
+	m := newTestManagedService(t, nil)
+	installTestVersion(t, m, "v1")
+	if err := m.activate("v1"); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(m.Spec().InstallPath, "data.db")
+	if err := os.WriteFile(data, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 指针文件中不合法的版本视为不存在，回滚不会删除或使用版本目录之外的路径
+	for _, version := range []string{"..", ".", "../other"} {
+		if err := writeVersionFile(filepath.Join(m.Spec().InstallPath, previousVersionFile), version); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.PreviousVersion(); got != "" {
+			t.Errorf("PreviousVersion with %q = %q, want empty", version, got)
+		}
+		if err := m.Rollback(); err == nil {
+			t.Errorf("Rollback to %q succeeded", version)
+		}
+	}
+	if err := writeVersionFile(filepath.Join(m.Spec().InstallPath, currentVersionFile), ".."); err != nil {
+		t.Fatal(err)
+	}
+	if m.CurrentVersion() != "" || m.IsInstalled() {
+		t.Error("a current pointer outside the versions directory is used")
+	}
+	m.pruneVersions()
+	if _, err := os.Stat(data); err != nil {
+		t.Errorf("data removed: %v", err)
+	}
+}
+
+func TestInstallRejectsUnsafeVersion(t *testing.T) {
+	m := newTestManagedService(t, &config.ManagedServiceConfig{DownloadURL: "http://127.0.0.1:1/app"})
+	for _, version := range []string{"", "..", "a/b"} {
+		err := m.install(version)
+		if err == nil || !strings.Contains(err.Error(), "invalid version") {
+			t.Errorf("install(%q) = %v, want invalid version", version, err)
+		}
+	}
+	// 校验在访问文件系统之前
+	entries, err := os.ReadDir(m.Spec().InstallPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "app.") {
+			t.Errorf("install left %s in the install directory", entry.Name())
+		}
+	}
+}
+
+func TestManagedServiceConfigValidateVersion(t *testing.T) {
+	for _, tt := range []struct {
+		version string
+		wantErr bool
+	}{
+		{"", false},
+		{latestVersion, false},
+		{"v1.2.0", false},
+		{"..", true},
+		{"../../etc", true},
+		{"a/b", true},
+	} {
+		spec := config.ManagedServiceConfig{Name: "app", Binary: "app", Version: tt.version}
+		if err := spec.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate with version %q = %v, wantErr %v", tt.version, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReleasesURL(t *testing.T) {
+	tests := []struct {
+		downloadURL, releasesURL, want string
+	}{
+		{"https://github.com/owner/repo/releases/latest/download/app-{os}.tar.gz", "", "https://api.github.com/repos/owner/repo/releases/latest"},
+		{"https://example.com/app.tar.gz", "", ""},
+		{"https://github.com/owner/repo/archive/main.zip", "", ""},
+		{"https://example.com/app.tar.gz", "https://example.com/{name}/latest.json", "https://example.com/app/latest.json"},
+	}
+	for _, tt := range tests {
+		m := newTestManagedService(t, &config.ManagedServiceConfig{DownloadURL: tt.downloadURL, ReleasesURL: tt.releasesURL})
+		if got := m.releasesURL(); got != tt.want {
+			t.Errorf("releasesURL(%s) = %q, want %q", tt.downloadURL, got, tt.want)
+		}
+	}
+
+	m := newTestManagedService(t, &config.ManagedServiceConfig{DownloadURL: "https://github.com/o/r/releases/latest/download/app-{version}-{os}.tar.gz"})
+	goos := runtime.GOOS
+	if got, want := m.versionedDownloadURL("v1.0.0"), "https://github.com/o/r/releases/download/v1.0.0/app-v1.0.0-"+goos+".tar.gz"; got != want {
+		t.Errorf("versionedDownloadURL = %s, want %s", got, want)
+	}
+	if got, want := m.versionedDownloadURL(latestVersion), "https://github.com/o/r/releases/latest/download/app-latest-"+goos+".tar.gz"; got != want {
+		t.Errorf("versionedDownloadURL(latest) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package vectorstore
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// BenchmarkOptions holds the parameters of RunBenchmark
+type BenchmarkOptions struct {
+	Chunks         int    // 文本块数量（默认 100000）
+	Dimension      int    // 向量维度（默认 1024，与 bge-m3 相同）
+	ChunksPerDoc   int    // 每个文档的文本块数量（默认 100）
+	KnowledgeBases int    // 知识库数量（默认 10）
+	Queries        int    // 每种检索执行的次数（默认 100）
+	TopK           int    // 默认 5
+	Dir            string // 不为空时写入该目录并测量重新打开的耗时（目录应为空）
+}
+
+// BenchmarkResult holds the measurements of RunBenchmark
+type BenchmarkResult struct {
+	Chunks      int           `json:"chunks"`
+	Dimension   int           `json:"dimension"`
+	Workers     int           `json:"workers"`     // 并行检索使用的 goroutine 数量（GOMAXPROCS）
+	AddTime     time.Duration `json:"addTime"`     // 写入全部文档的耗时（含写文件）
+	OpenTime    time.Duration `json:"openTime"`    // 重新打开（加载全部段文件）的耗时，未设置 Dir 时为 0
+	DiskBytes   int64         `json:"diskBytes"`   // 段文件的总大小
+	VectorBytes int64         `json:"vectorBytes"` // 向量占用的内存
+	HeapBytes   uint64        `json:"heapBytes"`   // 写入后堆内存的增长
+	Search      Latency       `json:"search"`      // 检索全部知识库
+	SearchKB    Latency       `json:"searchKB"`    // 检索单个知识库
+	SearchMeta  Latency       `json:"searchMeta"`  // 检索全部知识库并按元数据过滤（约一半的块满足条件）
+}
+
+// Latency 一组检索的耗时分布
+type Latency struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+	Max  time.Duration `json:"max"`
+}
+
+// String 格式化耗时分布
+func (l Latency) String() string {
+	return fmt.Sprintf("mean %v, p50 %v, p95 %v, max %v", l.Mean, l.P50, l.P95, l.Max)
+}
+
+// RunBenchmark 用随机向量测量写入、加载和检索的耗时，用于在目标机器上比较内置向量库和 Qdrant
+func RunBenchmark(opts BenchmarkOptions) (*BenchmarkResult, error) {
+	if opts.Chunks <= 0 {
+		opts.Chunks = 100000
+	}
+	if opts.Dimension <= 0 {
+		opts.Dimension = 1024
+	}
+	if opts.ChunksPerDoc <= 0 {
+		opts.ChunksPerDoc = 100
+	}
+	if opts.KnowledgeBases <= 0 {
+		opts.KnowledgeBases = 10
+	}
+	if opts.Queries <= 0 {
+		opts.Queries = 100
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+
+	store := NewMemoryStore()
+	if opts.Dir != "" {
+		var err error
+		if store, err = Open(opts.Dir); err != nil {
+			return nil, err
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomVector := func() []float32 {
+		v := make([]float32, opts.Dimension)
+		for i := range v {
+			v[i] = float32(rng.NormFloat64())
+		}
+		return v
+	}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	result := &BenchmarkResult{Chunks: opts.Chunks, Dimension: opts.Dimension, Workers: runtime.GOMAXPROCS(0)}
+	start := time.Now()
+	for added, doc := 0, 0; added < opts.Chunks; doc++ {
+		n := min(opts.ChunksPerDoc, opts.Chunks-added)
+		records := make([]Record, n)
+		vectors := make([][]float32, n)
+		for i := range records {
+			records[i] = Record{
+				Content:  fmt.Sprintf("chunk %d", added+i),
+				Metadata: map[string]any{"part": float64((added + i) % 2)},
+			}
+			vectors[i] = randomVector()
+		}
+		document := Document{KnowledgeBase: fmt.Sprintf("kb%d", doc%opts.KnowledgeBases), Name: fmt.Sprintf("doc%d", doc)}
+		if _, err := store.Add(document, records, vectors); err != nil {
+			return nil, err
+		}
+		added += n
+	}
+	result.AddTime = time.Since(start)
+
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if after.HeapAlloc > before.HeapAlloc {
+		result.HeapBytes = after.HeapAlloc - before.HeapAlloc
+	}
+	result.VectorBytes = store.Stats().VectorBytes
+
+	if opts.Dir != "" {
+		entries, err := os.ReadDir(opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				result.DiskBytes += info.Size()
+			}
+		}
+		start = time.Now()
+		reopened, err := Open(opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		result.OpenTime = time.Since(start)
+		if problems := reopened.Problems(); len(problems) > 0 {
+			return nil, fmt.Errorf("failed to reload segments: %s", problems[0])
+		}
+		store = reopened
+	}
+
+	measure := func(search SearchOptions) (Latency, error) {
+		durations := make([]time.Duration, opts.Queries)
+		for i := range durations {
+			query := randomVector()
+			start := time.Now()
+			if _, err := store.Search(query, search); err != nil {
+				return Latency{}, err
+			}
+			durations[i] = time.Since(start)
+		}
+		return latencyOf(durations), nil
+	}
+	var err error
+	if result.Search, err = measure(SearchOptions{TopK: opts.TopK}); err != nil {
+		return nil, err
+	}
+	if result.SearchKB, err = measure(SearchOptions{TopK: opts.TopK, KnowledgeBases: []string{"kb0"}}); err != nil {
+		return nil, err
+	}
+	if result.SearchMeta, err = measure(SearchOptions{TopK: opts.TopK, Filter: map[string]any{"part": 1}}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// latencyOf 计算耗时分布
+func latencyOf(durations []time.Duration) Latency {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	percentile := func(p float64) time.Duration {
+		return durations[min(int(float64(len(durations))*p), len(durations)-1)]
+	}
+	return Latency{
+		Mean: total / time.Duration(len(durations)),
+		P50:  percentile(0.50),
+		P95:  percentile(0.95),
+		Max:  durations[len(durations)-1],
+	}
+}
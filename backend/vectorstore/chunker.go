@@ -0,0 +1,186 @@
+package vectorstore
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sentenceEnds 句子结束的标点（过长的段落在这些字符之后切分）
+const sentenceEnds = "。！？；.!?;\n"
+
+// SplitText splits text into chunks of at most size characters (runes) overlapping by up to overlap characters
+// 优先在段落之间切分（空行，Markdown 标题另起一段），过长的段落在句子结束处切分，仍然过长时按长度切分。
+// 每个块以前一个块末尾不超过 overlap 个字符（尽量从句子或词的边界开始）开头，以保留上下文
+func SplitText(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = 500
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentLen := 0
+	flush := func() {
+		chunk := strings.TrimSpace(current.String())
+		current.Reset()
+		currentLen = 0
+		if chunk == "" {
+			return
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	for _, paragraph := range splitParagraphs(text) {
+		for i, piece := range splitLong(paragraph, size) {
+			// 段落之间空一行，同一段落切分出的片段保留原有的空白直接相连
+			sep := ""
+			if i == 0 {
+				sep = "\n\n"
+			}
+			pieceLen := utf8.RuneCountInString(piece)
+			if currentLen > 0 && currentLen+len(sep)+pieceLen > size {
+				prev := current.String()
+				flush()
+				// 新的块以前一个块的结尾开头
+				if keep := min(overlap, size-pieceLen-len(sep)); keep > 0 {
+					tail := overlapTail(strings.TrimSpace(prev), keep)
+					current.WriteString(tail)
+					currentLen = utf8.RuneCountInString(tail)
+				}
+			}
+			if currentLen == 0 {
+				sep = ""
+				piece = strings.TrimLeftFunc(piece, unicode.IsSpace)
+				pieceLen = utf8.RuneCountInString(piece)
+			}
+			current.WriteString(sep)
+			current.WriteString(piece)
+			currentLen += len(sep) + pieceLen
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitParagraphs 按空行拆分段落，Markdown 标题另起一段
+func splitParagraphs(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var paragraphs []string
+	var lines []string
+	flush := func() {
+		if p := strings.TrimSpace(strings.Join(lines, "\n")); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+		lines = lines[:0]
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			lines = append(lines, line)
+		default:
+			lines = append(lines, line)
+		}
+	}
+	flush()
+	return paragraphs
+}
+
+// splitLong 将超过 size 个字符的段落切分为句子，再合并为不超过 size 的片段（片段依次相连即为原段落）
+func splitLong(paragraph string, size int) []string {
+	if utf8.RuneCountInString(paragraph) <= size {
+		return []string{paragraph}
+	}
+
+	var sentences []string
+	start := 0
+	for i, r := range paragraph {
+		if strings.ContainsRune(sentenceEnds, r) {
+			end := i + utf8.RuneLen(r)
+			sentences = append(sentences, paragraph[start:end])
+			start = end
+		}
+	}
+	if start < len(paragraph) {
+		sentences = append(sentences, paragraph[start:])
+	}
+
+	var pieces []string
+	var current strings.Builder
+	currentLen := 0
+	for _, sentence := range sentences {
+		// 没有标点的超长句子按长度切分
+		for _, part := range splitRunes(sentence, size) {
+			partLen := utf8.RuneCountInString(part)
+			if currentLen > 0 && currentLen+partLen > size {
+				pieces = append(pieces, current.String())
+				current.Reset()
+				currentLen = 0
+			}
+			current.WriteString(part)
+			currentLen += partLen
+		}
+	}
+	if currentLen > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+// splitRunes 按 size 个字符切分字符串
+func splitRunes(s string, size int) []string {
+	if utf8.RuneCountInString(s) <= size {
+		return []string{s}
+	}
+	var parts []string
+	runes := []rune(s)
+	for len(runes) > size {
+		parts = append(parts, string(runes[:size]))
+		runes = runes[size:]
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// overlapTail 返回字符串末尾不超过 n 个字符的部分，优先从句子边界开始，其次是空白；
+// 都没有时中文等按字符截取，以空格分词的文字不从单词中间开始（返回空字符串）
+func overlapTail(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	before := runes[len(runes)-n-1]
+	if strings.ContainsRune(sentenceEnds, before) || unicode.IsSpace(before) {
+		return strings.TrimSpace(string(runes[len(runes)-n:]))
+	}
+	tail := runes[len(runes)-n:]
+	for _, boundary := range []func(r rune) bool{
+		func(r rune) bool { return strings.ContainsRune(sentenceEnds, r) },
+		unicode.IsSpace,
+	} {
+		for i, r := range tail[:len(tail)-1] {
+			if boundary(r) {
+				if t := strings.TrimSpace(string(tail[i+1:])); t != "" {
+					return t
+				}
+			}
+		}
+	}
+	if isWordRune(before) && isWordRune(tail[0]) {
+		return ""
+	}
+	return string(tail)
+}
+
+// isWordRune 判断是否为以空格分词的文字（拉丁字母、数字等），中日韩文字之间没有空格
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
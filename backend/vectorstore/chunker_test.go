@@ -0,0 +1,125 @@
+package vectorstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		size, overlap int
+		want          []string
+	}{
+		{"short text", "  hello world  ", 20, 0, []string{"hello world"}},
+		{"empty", " \n\n ", 20, 0, nil},
+		{"paragraphs merged", "first\n\n\nsecond\r\n\r\nthird", 20, 0, []string{"first\n\nsecond\n\nthird"}},
+		{
+			"markdown headings start a paragraph",
+			"# Title\nintro\n## Section\nbody text",
+			20, 0,
+			[]string{"# Title\nintro", "## Section\nbody text"},
+		},
+		{
+			"cjk sentences",
+			"第一句话。第二句话。第三句话。",
+			10, 0,
+			[]string{"第一句话。第二句话。", "第三句话。"},
+		},
+		{
+			"cjk overlap from a sentence boundary",
+			"第一句话。第二句话。第三句话。",
+			10, 5,
+			[]string{"第一句话。第二句话。", "第二句话。第三句话。"},
+		},
+		{
+			"cjk overflow without punctuation",
+			"一二三四五六七八九十甲乙",
+			8, 2,
+			[]string{"一二三四五六七八", "七八九十甲乙"},
+		},
+		{
+			"overflow without punctuation",
+			"abcdefghijklmnopqrstuvwxy",
+			10, 0,
+			[]string{"abcdefghij", "klmnopqrst", "uvwxy"},
+		},
+		{
+			"no overlap from the middle of a word",
+			"abcdefghijklmnopqrstuvwxy",
+			10, 3,
+			[]string{"abcdefghij", "klmnopqrst", "uvwxy"},
+		},
+		{
+			"overlap at a word boundary",
+			"alpha beta gamma delta. eps zeta.",
+			24, 12,
+			[]string{"alpha beta gamma delta.", "gamma delta. eps zeta."},
+		},
+		{
+			"overlap from the next word",
+			"alpha beta gamma delta. eps zeta.",
+			24, 10,
+			[]string{"alpha beta gamma delta.", "delta. eps zeta."},
+		},
+		{"invalid size and overlap", "hello", 0, -1, []string{"hello"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitText(tt.text, tt.size, tt.overlap)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitText = %q, want %q", got, tt.want)
+			}
+			size := tt.size
+			if size <= 0 {
+				size = 500
+			}
+			for _, chunk := range got {
+				if n := utf8.RuneCountInString(chunk); n > size {
+					t.Errorf("chunk %q has %d characters, more than %d", chunk, n, size)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitTextLongDocument(t *testing.T) {
+	text := strings.Repeat("This is a sentence. ", 50) + "\n\n" + strings.Repeat("这是一个句子。", 50)
+	chunks := SplitText(text, 100, 20)
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 100 {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+		if chunk != strings.TrimSpace(chunk) {
+			t.Errorf("chunk %d is not trimmed: %q", i, chunk)
+		}
+	}
+	if !strings.HasPrefix(chunks[0], "This is a sentence.") || !strings.HasSuffix(chunks[len(chunks)-1], "这是一个句子。") {
+		t.Errorf("chunks = %q", chunks)
+	}
+}
+
+func TestOverlapTail(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello world", 20, "hello world"},
+		{"one. two three", 10, "two three"},
+		{"alpha beta gamma", 7, "gamma"},
+		{"sentence one. second", 12, "second"},
+		{"abcdefghij", 4, ""},
+		{"一二三四五", 3, "三四五"},
+		{"前文。一二三四", 6, "一二三四"},
+		{"word 一二三", 3, "一二三"},
+	}
+	for _, tt := range tests {
+		if got := overlapTail(tt.s, tt.n); got != tt.want {
+			t.Errorf("overlapTail(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package vectorstore
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Match reports whether metadata (read through lookup) satisfies every condition of filter
+// 条件的值为标量时精确匹配，为列表时匹配其中任意一个，为映射时是范围条件（gt、gte、lt、lte）；
+// 元数据的值为列表（如标签）时，其中任意一个满足即可
+func Match(filter map[string]any, lookup func(key string) (any, bool)) bool {
+	for key, want := range filter {
+		value, ok := lookup(key)
+		if !ok || !matchValue(value, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue 判断单个元数据值是否满足条件
+func matchValue(value, want any) bool {
+	if values, ok := asList(value); ok {
+		for _, v := range values {
+			if matchValue(v, want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch w := want.(type) {
+	case map[string]any:
+		return matchRange(value, w)
+	default:
+		if options, ok := asList(want); ok {
+			for _, option := range options {
+				if equalValue(value, option) {
+					return true
+				}
+			}
+			return false
+		}
+		return equalValue(value, want)
+	}
+}
+
+// matchRange 判断数值是否在范围内
+func matchRange(value any, bounds map[string]any) bool {
+	v, ok := toFloat(value)
+	if !ok {
+		return false
+	}
+	for op, bound := range bounds {
+		b, ok := toFloat(bound)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "gt":
+			ok = v > b
+		case "gte":
+			ok = v >= b
+		case "lt":
+			ok = v < b
+		case "lte":
+			ok = v <= b
+		default:
+			ok = false
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValue 比较两个标量，数值按大小比较（JSON 解析后整数为 float64）
+func equalValue(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	if _, ok := toFloat(b); ok {
+		return false
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// asList 将切片转换为 []any
+func asList(value any) ([]any, bool) {
+	if list, ok := value.([]any); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// toFloat 将数值转换为 float64
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
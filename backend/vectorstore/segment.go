@@ -0,0 +1,151 @@
+package vectorstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// 段文件格式（小端）：
+//
+//	magic "WAVS" | version uint32 | header 长度 uint32 | header（JSON：文档和文本块）|
+//	向量 float32 × 文本块数 × 维度 | CRC32（IEEE，覆盖之前的全部内容）
+const (
+	segmentMagic   = "WAVS"
+	segmentVersion = 1
+)
+
+// maxSegmentHeader header 的长度上限，防止读取损坏的文件时分配过多内存
+const maxSegmentHeader = 1 << 30
+
+// errCorrupted 段文件已损坏
+var errCorrupted = errors.New("corrupted segment file")
+
+// segmentHeader 段文件的 header
+type segmentHeader struct {
+	Document Document `json:"document"`
+	Records  []Record `json:"records"`
+}
+
+// writeSegment 写入段文件（先写临时文件再重命名，写入中断不会留下不完整的文件）
+func writeSegment(path string, seg *segment) (err error) {
+	header, err := json.Marshal(segmentHeader{Document: seg.doc, Records: seg.records})
+	if err != nil {
+		return fmt.Errorf("failed to encode segment: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriterSize(io.MultiWriter(tmp, crc), 1<<16)
+	w.WriteString(segmentMagic)
+	binary.Write(w, binary.LittleEndian, uint32(segmentVersion))
+	binary.Write(w, binary.LittleEndian, uint32(len(header)))
+	w.Write(header)
+	buf := make([]byte, 4)
+	for _, v := range seg.vectors {
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(v))
+		w.Write(buf)
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err = binary.Write(tmp, binary.LittleEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	return nil
+}
+
+// readSegment 读取段文件并校验 CRC
+func readSegment(path string) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<16)
+	r := &checksumReader{r: br, crc: crc32.NewIEEE()}
+
+	prefix := make([]byte, len(segmentMagic)+8)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(segmentMagic)]) != segmentMagic {
+		return nil, errCorrupted
+	}
+	if version := binary.LittleEndian.Uint32(prefix[4:]); version != segmentVersion {
+		return nil, fmt.Errorf("unsupported segment version %d", version)
+	}
+	size := binary.LittleEndian.Uint32(prefix[8:])
+	if size > maxSegmentHeader {
+		return nil, errCorrupted
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errCorrupted
+	}
+	var header segmentHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorrupted, err)
+	}
+	doc := header.Document
+	if doc.ID == "" || doc.Dimension <= 0 || len(header.Records) != doc.Chunks {
+		return nil, errCorrupted
+	}
+
+	vectors := make([]float32, len(header.Records)*doc.Dimension)
+	buf := make([]byte, 1<<16)
+	for i := 0; i < len(vectors); {
+		n := min(len(buf)/4, len(vectors)-i)
+		if _, err := io.ReadFull(r, buf[:n*4]); err != nil {
+			return nil, errCorrupted
+		}
+		for j := 0; j < n; j++ {
+			vectors[i+j] = math.Float32frombits(binary.LittleEndian.Uint32(buf[j*4:]))
+		}
+		i += n
+	}
+
+	// 文件末尾的 CRC 不计入校验范围
+	var sum uint32
+	if err := binary.Read(br, binary.LittleEndian, &sum); err != nil || sum != r.crc.Sum32() {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorrupted)
+	}
+	return &segment{doc: doc, records: header.Records, vectors: vectors}, nil
+}
+
+// checksumReader 读取时计算已读内容的 CRC
+type checksumReader struct {
+	r   io.Reader
+	crc hash.Hash32
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,490 @@
+// Package vectorstore 进程内的向量库，用于不运行 go-rag 和 Qdrant 时的知识库检索
+//
+// 每次写入的文档（切分后的文本块及其向量）保存为目录中的一个段文件（<文档 ID>.seg），
+// 打开时全部加载到内存。检索为暴力搜索：向量写入时归一化，查询时按点积（余弦相似度）
+// 并行扫描所有块，知识库和元数据过滤在扫描时判断。十万个 1024 维文本块单核检索约 90ms，
+// 随核数近似线性下降，可以用 RunBenchmark（wachat-cli vectors bench）在目标机器上测量。
+package vectorstore
+
+import (
+	"container/heap"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentExt 段文件的扩展名
+const segmentExt = ".seg"
+
+// searchBlock 并行检索时每个任务扫描的块数
+const searchBlock = 4096
+
+// ErrNotFound 文档不存在
+var ErrNotFound = errors.New("document not found")
+
+// Record 一个文本块
+type Record struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Document 一次写入的文档，文档的所有文本块保存在同一个段文件中
+type Document struct {
+	ID            string         `json:"id"`
+	KnowledgeBase string         `json:"knowledgeBase"`
+	Name          string         `json:"name"`               // 文件名或标题
+	Metadata      map[string]any `json:"metadata,omitempty"` // 文档的元数据，文本块没有同名字段时用于过滤
+	Dimension     int            `json:"dimension"`          // 向量维度
+	Chunks        int            `json:"chunks"`             // 文本块数量
+	CreatedAt     time.Time      `json:"createdAt"`
+}
+
+// SearchOptions 检索选项
+type SearchOptions struct {
+	KnowledgeBases []string       // 只检索这些知识库（为空时检索全部）
+	Filter         map[string]any // 元数据过滤，见 Match
+	TopK           int            // 返回的数量（默认 5）
+	ScoreThreshold float64        // 最低相似度（0 表示不限制）
+}
+
+// Result 检索结果
+type Result struct {
+	Record
+	DocumentID    string  `json:"documentId"`
+	DocumentName  string  `json:"documentName"`
+	KnowledgeBase string  `json:"knowledgeBase"`
+	Score         float64 `json:"score"` // 余弦相似度
+}
+
+// Stats 向量库的统计信息
+type Stats struct {
+	Documents      int   `json:"documents"`
+	Chunks         int   `json:"chunks"`
+	KnowledgeBases int   `json:"knowledgeBases"`
+	VectorBytes    int64 `json:"vectorBytes"` // 向量占用的内存
+}
+
+// segment 内存中的段：文档、文本块和归一化后连续存放的向量
+type segment struct {
+	doc     Document
+	records []Record
+	vectors []float32 // len(records) * doc.Dimension
+}
+
+// Store 向量库
+type Store struct {
+	dir      string // 段文件目录（为空时只保存在内存中）
+	mu       sync.RWMutex
+	segments map[string]*segment // 文档 ID -> 段
+	problems []string            // 打开时无法加载的段文件
+}
+
+// Open 打开（必要时创建）目录中的向量库并加载全部段文件，损坏的段文件跳过，见 Problems
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vector store directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vector store directory: %w", err)
+	}
+
+	s := &Store{dir: dir, segments: make(map[string]*segment)}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != segmentExt {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		seg, err := readSegment(path)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		s.segments[seg.doc.ID] = seg
+	}
+	return s, nil
+}
+
+// NewMemoryStore 创建只保存在内存中的向量库
+func NewMemoryStore() *Store {
+	return &Store{segments: make(map[string]*segment)}
+}
+
+// Dir 返回段文件目录（内存向量库为空）
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Problems 返回打开时无法加载的段文件及原因
+func (s *Store) Problems() []string {
+	return s.problems
+}
+
+// Add 写入文档的文本块和向量（向量与文本块一一对应、维度相同），返回保存的文档
+// 文档 ID 为空时自动生成，已存在同 ID 的文档时替换
+func (s *Store) Add(doc Document, records []Record, vectors [][]float32) (*Document, error) {
+	if doc.KnowledgeBase == "" {
+		return nil, fmt.Errorf("knowledge base is required")
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("document has no chunks")
+	}
+	if len(vectors) != len(records) {
+		return nil, fmt.Errorf("got %d vectors for %d chunks", len(vectors), len(records))
+	}
+	dim := len(vectors[0])
+	if dim == 0 {
+		return nil, fmt.Errorf("empty vector")
+	}
+
+	if doc.ID == "" {
+		doc.ID = newID()
+	} else if !validID(doc.ID) {
+		return nil, fmt.Errorf("invalid document id %q", doc.ID)
+	}
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = time.Now()
+	}
+	doc.Dimension = dim
+	doc.Chunks = len(records)
+
+	seg := &segment{
+		doc:     doc,
+		records: make([]Record, len(records)),
+		vectors: make([]float32, 0, len(records)*dim),
+	}
+	for i, record := range records {
+		if len(vectors[i]) != dim {
+			return nil, fmt.Errorf("chunk %d has dimension %d, expected %d", i, len(vectors[i]), dim)
+		}
+		if record.ID == "" {
+			record.ID = fmt.Sprintf("%s-%d", doc.ID, i)
+		}
+		seg.records[i] = record
+		seg.vectors = append(seg.vectors, vectors[i]...)
+		normalize(seg.vectors[i*dim : (i+1)*dim])
+	}
+
+	if s.dir != "" {
+		if err := writeSegment(s.segmentPath(doc.ID), seg); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.segments[doc.ID] = seg
+	s.mu.Unlock()
+	saved := seg.doc
+	return &saved, nil
+}
+
+// Delete 删除文档
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.segments[id]; !ok {
+		return ErrNotFound
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete document: %w", err)
+		}
+	}
+	delete(s.segments, id)
+	return nil
+}
+
+// DeleteKnowledgeBase 删除知识库中的全部文档，返回删除的文档数量
+func (s *Store) DeleteKnowledgeBase(knowledgeBase string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for id, seg := range s.segments {
+		if seg.doc.KnowledgeBase != knowledgeBase {
+			continue
+		}
+		if s.dir != "" {
+			if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+				return deleted, fmt.Errorf("failed to delete document %s: %w", id, err)
+			}
+		}
+		delete(s.segments, id)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Documents 返回知识库中的文档（为空时返回全部），按写入时间排序
+func (s *Store) Documents(knowledgeBase string) []Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]Document, 0, len(s.segments))
+	for _, seg := range s.segments {
+		if knowledgeBase == "" || seg.doc.KnowledgeBase == knowledgeBase {
+			docs = append(docs, seg.doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if !docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+			return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+		}
+		return docs[i].ID < docs[j].ID
+	})
+	return docs
+}
+
+// KnowledgeBases 返回全部知识库名称（按名称排序）
+func (s *Store) KnowledgeBases() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]bool)
+	for _, seg := range s.segments {
+		seen[seg.doc.KnowledgeBase] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats 返回统计信息
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := Stats{Documents: len(s.segments)}
+	seen := make(map[string]bool)
+	for _, seg := range s.segments {
+		stats.Chunks += len(seg.records)
+		stats.VectorBytes += int64(len(seg.vectors)) * 4
+		seen[seg.doc.KnowledgeBase] = true
+	}
+	stats.KnowledgeBases = len(seen)
+	return stats
+}
+
+// Search 返回与查询向量最相似的文本块（按相似度从高到低）
+// 维度与查询不同的文档（如更换了 embedding 模型）被跳过，全部不同时返回错误
+func (s *Store) Search(query []float32, opts SearchOptions) ([]Result, error) {
+	if len(query) == 0 {
+		return nil, fmt.Errorf("empty query vector")
+	}
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 5
+	}
+	q := make([]float32, len(query))
+	copy(q, query)
+	normalize(q)
+
+	var bases map[string]bool
+	if len(opts.KnowledgeBases) > 0 {
+		bases = make(map[string]bool, len(opts.KnowledgeBases))
+		for _, name := range opts.KnowledgeBases {
+			bases[name] = true
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// 按块拆分为任务，由多个 goroutine 并行扫描
+	type task struct {
+		seg      *segment
+		from, to int
+	}
+	var tasks []task
+	mismatched, matched := 0, 0
+	for _, seg := range s.segments {
+		if bases != nil && !bases[seg.doc.KnowledgeBase] {
+			continue
+		}
+		if seg.doc.Dimension != len(q) {
+			mismatched++
+			continue
+		}
+		matched++
+		for from := 0; from < len(seg.records); from += searchBlock {
+			tasks = append(tasks, task{seg, from, min(from+searchBlock, len(seg.records))})
+		}
+	}
+	if matched == 0 && mismatched > 0 {
+		return nil, fmt.Errorf("query dimension %d does not match the stored vectors, re-ingest the documents after changing the embedding model", len(q))
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), len(tasks))
+	next := make(chan task)
+	partial := make([]candidateHeap, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(h *candidateHeap) {
+			defer wg.Done()
+			for t := range next {
+				dim := t.seg.doc.Dimension
+				for i := t.from; i < t.to; i++ {
+					if opts.Filter != nil && !t.seg.match(i, opts.Filter) {
+						continue
+					}
+					score := dot(q, t.seg.vectors[i*dim:(i+1)*dim])
+					if float64(score) < opts.ScoreThreshold {
+						continue
+					}
+					h.offer(candidate{t.seg, i, score}, topK)
+				}
+			}
+		}(&partial[w])
+	}
+	for _, t := range tasks {
+		next <- t
+	}
+	close(next)
+	wg.Wait()
+
+	var all []candidate
+	for _, h := range partial {
+		all = append(all, h...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+	if len(all) > topK {
+		all = all[:topK]
+	}
+
+	results := make([]Result, len(all))
+	for i, c := range all {
+		record := c.seg.records[c.index]
+		record.Metadata = c.seg.metadata(c.index)
+		results[i] = Result{
+			Record:        record,
+			DocumentID:    c.seg.doc.ID,
+			DocumentName:  c.seg.doc.Name,
+			KnowledgeBase: c.seg.doc.KnowledgeBase,
+			Score:         float64(c.score),
+		}
+	}
+	return results, nil
+}
+
+// match 判断文本块的元数据（文本块没有的字段使用文档的元数据）是否满足过滤条件
+func (seg *segment) match(index int, filter map[string]any) bool {
+	record := seg.records[index]
+	return Match(filter, func(key string) (any, bool) {
+		if v, ok := record.Metadata[key]; ok {
+			return v, true
+		}
+		v, ok := seg.doc.Metadata[key]
+		return v, ok
+	})
+}
+
+// metadata 返回文本块的元数据副本（合并文档的元数据，文本块的优先）
+func (seg *segment) metadata(index int) map[string]any {
+	merged := make(map[string]any, len(seg.doc.Metadata)+len(seg.records[index].Metadata))
+	for k, v := range seg.doc.Metadata {
+		merged[k] = v
+	}
+	for k, v := range seg.records[index].Metadata {
+		merged[k] = v
+	}
+	return merged
+}
+
+// segmentPath 返回文档的段文件路径
+func (s *Store) segmentPath(id string) string {
+	return filepath.Join(s.dir, id+segmentExt)
+}
+
+// candidate 检索的候选结果
+type candidate struct {
+	seg   *segment
+	index int
+	score float32
+}
+
+// candidateHeap 保留分数最高的 k 个候选（小顶堆）
+type candidateHeap []candidate
+
+func (h candidateHeap) Len() int           { return len(h) }
+func (h candidateHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h candidateHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *candidateHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *candidateHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// offer 加入候选，超过 k 个时淘汰分数最低的
+func (h *candidateHeap) offer(c candidate, k int) {
+	if h.Len() < k {
+		heap.Push(h, c)
+		return
+	}
+	if c.score > (*h)[0].score {
+		(*h)[0] = c
+		heap.Fix(h, 0)
+	}
+}
+
+// normalize 将向量归一化为单位长度（零向量保持不变）
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+}
+
+// dot 计算两个等长向量的点积
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// newID 生成随机的文档 ID
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// validID 文档 ID 用作文件名：字母、数字及 _ -
+func validID(id string) bool {
+	return id != "" && strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+	}) < 0
+}
@@ -0,0 +1,421 @@
+package vectorstore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// randomVectors 生成 n 个 dim 维的随机向量
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// addDocument 写入 n 个随机向量的文本块，返回保存的文档和向量
+func addDocument(t *testing.T, store *Store, rng *rand.Rand, doc Document, n, dim int) (*Document, [][]float32) {
+	t.Helper()
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{Content: fmt.Sprintf("%s chunk %d", doc.Name, i), Metadata: map[string]any{"part": float64(i % 2)}}
+	}
+	vectors := randomVectors(rng, n, dim)
+	saved, err := store.Add(doc, records, vectors)
+	if err != nil {
+		t.Fatalf("add %s: %v", doc.Name, err)
+	}
+	return saved, vectors
+}
+
+func TestMatch(t *testing.T) {
+	metadata := map[string]any{
+		"lang":  "go",
+		"year":  float64(2024),
+		"page":  3,
+		"score": float32(0.5),
+		"tags":  []any{"db", "search"},
+		"ids":   []string{"a", "b"},
+	}
+	lookup := func(key string) (any, bool) {
+		v, ok := metadata[key]
+		return v, ok
+	}
+
+	tests := []struct {
+		name   string
+		filter map[string]any
+		want   bool
+	}{
+		{"empty filter", nil, true},
+		{"string equal", map[string]any{"lang": "go"}, true},
+		{"string not equal", map[string]any{"lang": "rust"}, false},
+		{"missing key", map[string]any{"author": "x"}, false},
+		{"int matches float64", map[string]any{"year": 2024}, true},
+		{"float64 matches int", map[string]any{"page": float64(3)}, true},
+		{"number does not match string", map[string]any{"year": "2024"}, false},
+		{"string does not match number", map[string]any{"lang": 1}, false},
+		{"any of list", map[string]any{"lang": []any{"rust", "go"}}, true},
+		{"none of list", map[string]any{"lang": []string{"rust", "c"}}, false},
+		{"metadata list contains", map[string]any{"tags": "search"}, true},
+		{"metadata list does not contain", map[string]any{"tags": "web"}, false},
+		{"typed metadata list", map[string]any{"ids": "b"}, true},
+		{"list against list", map[string]any{"tags": []any{"web", "db"}}, true},
+		{"gt", map[string]any{"year": map[string]any{"gt": 2023}}, true},
+		{"gt boundary", map[string]any{"year": map[string]any{"gt": 2024}}, false},
+		{"gte boundary", map[string]any{"year": map[string]any{"gte": 2024}}, true},
+		{"lt", map[string]any{"page": map[string]any{"lt": 4}}, true},
+		{"lt boundary", map[string]any{"page": map[string]any{"lt": 3}}, false},
+		{"lte boundary", map[string]any{"page": map[string]any{"lte": 3}}, true},
+		{"range", map[string]any{"score": map[string]any{"gte": 0.1, "lt": 1}}, true},
+		{"out of range", map[string]any{"score": map[string]any{"gt": 0.5, "lte": 1}}, false},
+		{"range on string", map[string]any{"lang": map[string]any{"gt": 1}}, false},
+		{"non-numeric bound", map[string]any{"year": map[string]any{"gt": "2000"}}, false},
+		{"unknown operator", map[string]any{"year": map[string]any{"ne": 2000}}, false},
+		{"all conditions", map[string]any{"lang": "go", "tags": "db", "year": map[string]any{"lte": 2024}}, true},
+		{"one condition fails", map[string]any{"lang": "go", "tags": "web"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.filter, lookup); got != tt.want {
+				t.Errorf("Match(%v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	store := NewMemoryStore()
+	doc1, vectors1 := addDocument(t, store, rng, Document{KnowledgeBase: "kb1", Name: "doc1", Metadata: map[string]any{"lang": "go"}}, 10, 16)
+	doc2, vectors2 := addDocument(t, store, rng, Document{KnowledgeBase: "kb2", Name: "doc2", Metadata: map[string]any{"lang": "rust"}}, 10, 16)
+
+	// 查询向量与某个文本块相同（长度不同）时该块排在最前，相似度为 1
+	query := make([]float32, 16)
+	for i, v := range vectors2[3] {
+		query[i] = v * 3
+	}
+	results, err := store.Search(query, SearchOptions{TopK: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	top := results[0]
+	if top.DocumentID != doc2.ID || top.DocumentName != "doc2" || top.KnowledgeBase != "kb2" || top.Content != "doc2 chunk 3" {
+		t.Errorf("top result = %+v, want doc2 chunk 3", top)
+	}
+	if top.Score < 0.9999 {
+		t.Errorf("top score = %v, want 1", top.Score)
+	}
+	if top.Metadata["lang"] != "rust" || top.Metadata["part"] != float64(1) {
+		t.Errorf("top metadata = %v, want document and chunk metadata merged", top.Metadata)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results not sorted by score: %v > %v", results[i].Score, results[i-1].Score)
+		}
+	}
+
+	// 只检索 kb1：不返回 kb2 的文本块（阈值为 0 时不返回负相似度，计数时放宽）
+	results, err = store.Search(query, SearchOptions{KnowledgeBases: []string{"kb1"}, TopK: 20, ScoreThreshold: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 10 {
+		t.Errorf("got %d results from kb1, want 10", len(results))
+	}
+	for _, r := range results {
+		if r.DocumentID != doc1.ID {
+			t.Errorf("result from %s in kb1 search", r.KnowledgeBase)
+		}
+	}
+
+	// 文档元数据和文本块元数据都参与过滤
+	results, err = store.Search(vectors1[0], SearchOptions{Filter: map[string]any{"lang": "go", "part": 1}, TopK: 20, ScoreThreshold: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Errorf("got %d filtered results, want 5", len(results))
+	}
+	for _, r := range results {
+		if r.DocumentID != doc1.ID || r.Metadata["part"] != float64(1) {
+			t.Errorf("result %s does not match the filter", r.ID)
+		}
+	}
+
+	// 相似度阈值
+	results, err = store.Search(query, SearchOptions{ScoreThreshold: 0.9999, TopK: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Content != "doc2 chunk 3" {
+		t.Errorf("got %d results above the threshold, want only doc2 chunk 3", len(results))
+	}
+
+	// 维度不同
+	if _, err := store.Search(make([]float32, 8), SearchOptions{}); err == nil || !strings.Contains(err.Error(), "dimension") {
+		t.Errorf("search with dimension 8: err = %v, want dimension mismatch", err)
+	}
+	if results, err := store.Search(query, SearchOptions{KnowledgeBases: []string{"missing"}}); err != nil || len(results) != 0 {
+		t.Errorf("search in missing knowledge base = %v, %v, want no results", results, err)
+	}
+}
+
+func TestAddValidation(t *testing.T) {
+	store := NewMemoryStore()
+	records := []Record{{Content: "a"}, {Content: "b"}}
+	vectors := [][]float32{{1, 0}, {0, 1}}
+	tests := []struct {
+		name    string
+		doc     Document
+		records []Record
+		vectors [][]float32
+		wantErr string
+	}{
+		{"no knowledge base", Document{}, records, vectors, "knowledge base is required"},
+		{"no chunks", Document{KnowledgeBase: "kb"}, nil, nil, "no chunks"},
+		{"vector count", Document{KnowledgeBase: "kb"}, records, vectors[:1], "got 1 vectors for 2 chunks"},
+		{"empty vector", Document{KnowledgeBase: "kb"}, records, [][]float32{{}, {}}, "empty vector"},
+		{"dimension mismatch", Document{KnowledgeBase: "kb"}, records, [][]float32{{1, 0}, {1}}, "chunk 1 has dimension 1"},
+		{"invalid id", Document{ID: "../evil", KnowledgeBase: "kb"}, records, vectors, "invalid document id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.Add(tt.doc, tt.records, tt.vectors)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Add error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if stats := store.Stats(); stats.Documents != 0 {
+		t.Errorf("store has %d documents after failed adds", stats.Documents)
+	}
+}
+
+func TestOpenPersistence(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewPCG(3, 4))
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc1, vectors1 := addDocument(t, store, rng, Document{KnowledgeBase: "kb1", Name: "doc1", Metadata: map[string]any{"lang": "go"}}, 5, 8)
+	doc2, _ := addDocument(t, store, rng, Document{KnowledgeBase: "kb2", Name: "doc2"}, 7, 8)
+	doc3, _ := addDocument(t, store, rng, Document{KnowledgeBase: "kb2", Name: "doc3"}, 3, 8)
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := reopened.Problems(); len(problems) > 0 {
+		t.Fatalf("problems after reopening: %v", problems)
+	}
+	if got, want := reopened.Stats(), (Stats{Documents: 3, Chunks: 15, KnowledgeBases: 2, VectorBytes: 15 * 8 * 4}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if got := reopened.KnowledgeBases(); strings.Join(got, ",") != "kb1,kb2" {
+		t.Errorf("knowledge bases = %v, want [kb1 kb2]", got)
+	}
+	docs := reopened.Documents("kb1")
+	if len(docs) != 1 || docs[0].ID != doc1.ID || docs[0].Name != "doc1" || docs[0].Chunks != 5 || docs[0].Dimension != 8 ||
+		docs[0].Metadata["lang"] != "go" || !docs[0].CreatedAt.Equal(doc1.CreatedAt) {
+		t.Errorf("kb1 documents = %+v, want %+v", docs, *doc1)
+	}
+
+	results, err := reopened.Search(vectors1[2], SearchOptions{TopK: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].DocumentID != doc1.ID || results[0].Content != "doc1 chunk 2" || results[0].ID != doc1.ID+"-2" {
+		t.Errorf("search after reopening = %+v, want doc1 chunk 2", results)
+	}
+
+	// 删除后重新打开不再加载
+	if err := reopened.Delete(doc1.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Delete(doc1.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete error = %v, want ErrNotFound", err)
+	}
+	if n, err := reopened.DeleteKnowledgeBase("kb2"); err != nil || n != 2 {
+		t.Errorf("DeleteKnowledgeBase = %d, %v, want 2", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, doc2.ID+segmentExt)); !os.IsNotExist(err) {
+		t.Errorf("segment of deleted document still exists: %v", err)
+	}
+
+	// 同 ID 的文档替换原来的文档
+	addDocument(t, reopened, rng, Document{ID: doc3.ID, KnowledgeBase: "kb3", Name: "doc3 v2"}, 2, 4)
+	final, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs = final.Documents("")
+	if len(docs) != 1 || docs[0].ID != doc3.ID || docs[0].Name != "doc3 v2" || docs[0].Chunks != 2 {
+		t.Errorf("documents after replacing = %+v, want doc3 v2", docs)
+	}
+}
+
+func TestOpenSkipsCorruptSegments(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewPCG(5, 6))
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, _ := addDocument(t, store, rng, Document{KnowledgeBase: "kb", Name: "good"}, 4, 8)
+	flipped, _ := addDocument(t, store, rng, Document{KnowledgeBase: "kb", Name: "flipped"}, 4, 8)
+	truncated, _ := addDocument(t, store, rng, Document{KnowledgeBase: "kb", Name: "truncated"}, 4, 8)
+
+	// 修改一个向量字节（CRC 不匹配），截断另一个文件，再放一个不是段文件的 .seg
+	path := filepath.Join(dir, flipped.ID+segmentExt)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-10] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, truncated.ID+segmentExt)
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "garbage"+segmentExt), []byte("not a segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := reopened.Problems()
+	if len(problems) != 3 {
+		t.Fatalf("problems = %v, want 3 corrupt segments", problems)
+	}
+	for _, id := range []string{flipped.ID, truncated.ID, "garbage"} {
+		found := false
+		for _, p := range problems {
+			found = found || strings.Contains(p, id+segmentExt)
+		}
+		if !found {
+			t.Errorf("problems = %v, want %s reported", problems, id)
+		}
+	}
+	docs := reopened.Documents("")
+	if len(docs) != 1 || docs[0].ID != good.ID {
+		t.Errorf("documents = %+v, want only the intact one", docs)
+	}
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc"+segmentExt)
+	seg := &segment{
+		doc: Document{ID: "doc", KnowledgeBase: "kb", Name: "name", Dimension: 3, Chunks: 2, Metadata: map[string]any{"k": "v"}},
+		records: []Record{
+			{ID: "doc-0", Content: "first", Metadata: map[string]any{"n": float64(1)}},
+			{ID: "doc-1", Content: "second"},
+		},
+		vectors: []float32{0.1, -0.2, 0.3, 1e-7, 0, -1},
+	}
+	if err := writeSegment(path, seg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readSegment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.doc.ID != "doc" || got.doc.Name != "name" || got.doc.Metadata["k"] != "v" || len(got.records) != 2 ||
+		got.records[1].Content != "second" || got.records[0].Metadata["n"] != float64(1) {
+		t.Errorf("read segment = %+v, want %+v", got, seg)
+	}
+	if fmt.Sprint(got.vectors) != fmt.Sprint(seg.vectors) {
+		t.Errorf("vectors = %v, want %v", got.vectors, seg.vectors)
+	}
+	// 写入时不留下临时文件
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("directory has %d files, want only the segment", len(entries))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(name string, modify func([]byte) []byte) {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "doc"+segmentExt)
+			if err := os.WriteFile(p, modify(append([]byte(nil), data...)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readSegment(p); !errors.Is(err, errCorrupted) {
+				t.Errorf("readSegment error = %v, want errCorrupted", err)
+			}
+		})
+	}
+	corrupt("vector byte", func(b []byte) []byte { b[len(b)-8] ^= 1; return b })
+	corrupt("checksum", func(b []byte) []byte { b[len(b)-1] ^= 1; return b })
+	corrupt("missing checksum", func(b []byte) []byte { return b[:len(b)-4] })
+	corrupt("truncated vectors", func(b []byte) []byte { return b[:len(b)-10] })
+	corrupt("magic", func(b []byte) []byte { b[0] = 'X'; return b })
+	corrupt("header length", func(b []byte) []byte { b[8], b[9], b[10], b[11] = 0xff, 0xff, 0xff, 0xff; return b })
+	corrupt("empty", func(b []byte) []byte { return nil })
+}
+
+// BenchmarkSearch100k 十万个 1024 维文本块（10 个知识库、每个文档 100 块）的检索耗时，
+// 与 RunBenchmark 的数据相同
+func BenchmarkSearch100k(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping 100k chunk benchmark in short mode")
+	}
+	const chunks, dim, perDoc, bases = 100000, 1024, 100, 10
+	rng := rand.New(rand.NewPCG(1, 2))
+	store := NewMemoryStore()
+	for doc := 0; doc*perDoc < chunks; doc++ {
+		records := make([]Record, perDoc)
+		for i := range records {
+			records[i] = Record{Content: fmt.Sprintf("chunk %d", doc*perDoc+i), Metadata: map[string]any{"part": float64(i % 2)}}
+		}
+		document := Document{KnowledgeBase: fmt.Sprintf("kb%d", doc%bases), Name: fmt.Sprintf("doc%d", doc)}
+		if _, err := store.Add(document, records, randomVectors(rng, perDoc, dim)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	queries := randomVectors(rng, 64, dim)
+
+	for _, bm := range []struct {
+		name string
+		opts SearchOptions
+	}{
+		{"all", SearchOptions{TopK: 5}},
+		{"kb", SearchOptions{TopK: 5, KnowledgeBases: []string{"kb0"}}},
+		{"filter", SearchOptions{TopK: 5, Filter: map[string]any{"part": 1}}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.Search(queries[i%len(queries)], bm.opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/wangle201210/wachat/backend"
+	"github.com/wangle201210/wachat/backend/service"
+)
+
+// runBundle handles bundle export/import for offline installs
+func runBundle(api *backend.API, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: bundle export <file> | bundle import [-config] <file>")
+	}
+
+	switch args[0] {
+	case "export":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: bundle export <file>")
+		}
+		manifest, err := api.ExportBundle(args[1])
+		if err != nil {
+			return err
+		}
+		printManifest("exported", manifest)
+		return nil
+
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		applyConfig := fs.Bool("config", false, "replace config.yaml with the bundled one")
+		fs.Parse(args[1:])
+		if fs.NArg() < 1 {
+			return fmt.Errorf("usage: bundle import [-config] <file>")
+		}
+		manifest, err := api.ImportBundle(fs.Arg(0), *applyConfig)
+		if err != nil {
+			return err
+		}
+		printManifest("imported", manifest)
+		if manifest.Config && !*applyConfig {
+			fmt.Println("bundled config.yaml not applied (use -config)")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown bundle command: %s", args[0])
+}
+
+// printManifest prints the services contained in a bundle
+func printManifest(action string, manifest *service.BundleManifest) {
+	for _, svc := range manifest.Services {
+		fmt.Printf("%s %s %s\n", action, svc.Name, svc.Version)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wangle201210/wachat/backend"
+)
+
+// runChat runs an interactive REPL, or a one-shot reply when a message is
+// given with -m or piped through stdin
+func runChat(ctx context.Context, api *backend.API, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	conversationID := fs.String("c", "", "continue an existing conversation")
+	message := fs.String("m", "", "send a single message and exit")
+	title := fs.String("title", "CLI 会话", "title of the new conversation")
+	fs.Parse(args)
+
+	if *conversationID == "" {
+		conv, err := api.CreateConversation(*title)
+		if err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
+		*conversationID = conv.ID
+	} else if _, err := api.GetConversation(*conversationID); err != nil {
+		return fmt.Errorf("conversation %s not found: %w", *conversationID, err)
+	}
+
+	// One-shot: -m or piped stdin
+	if *message != "" {
+		return sendAndPrint(api, *conversationID, *message)
+	}
+	if !isTerminal(os.Stdin) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		content := strings.TrimSpace(string(data))
+		if content == "" {
+			return fmt.Errorf("empty message")
+		}
+		return sendAndPrint(api, *conversationID, content)
+	}
+
+	// Interactive REPL
+	fmt.Fprintf(os.Stderr, "Conversation %s (type /exit to quit)\n", *conversationID)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "/exit" || line == "/quit" {
+			return nil
+		}
+		if err := sendAndPrint(api, *conversationID, line); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// sendAndPrint sends a message and prints the streamed reply to stdout
+func sendAndPrint(api *backend.API, conversationID, content string) error {
+	done := make(chan error, 1)
+	finish := func(err error) {
+		select {
+		case done <- err:
+		default:
+		}
+	}
+
+	err := api.SendMessageStream(conversationID, content, func(eventName string, data interface{}) {
+		payload, _ := data.(map[string]interface{})
+		switch eventName {
+		case "stream:response":
+			if chunk, ok := payload["chunk"].(string); ok {
+				fmt.Print(chunk)
+			}
+		case "stream:end":
+			// stream:error is emitted first; the error is repeated here in case it was missed
+			if msg, ok := payload["error"].(string); ok && msg != "" {
+				finish(errors.New(msg))
+				return
+			}
+			fmt.Println()
+			finish(nil)
+		case "stream:error":
+			fmt.Println()
+			finish(fmt.Errorf("%v", payload["error"]))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return <-done
+}
+
+// isTerminal reports whether f is a character device (interactive terminal)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
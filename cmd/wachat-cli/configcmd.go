@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wangle201210/wachat/backend/config"
+	"github.com/wangle201210/wachat/backend/secret"
+	"github.com/wangle201210/wachat/backend/service"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig handles config get/set/effective/validate/history/diff/restore
+func runConfig(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config get <path> | config set <path> <value> | config effective [prefix] | config validate [file] | config history [target] | config diff <target> <from> [to] | config restore <target> <id>")
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) < 2 {
+			content, err := config.GetConfigContent(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Print(content)
+			return nil
+		}
+		value, err := config.GetConfigValue(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		// Scalars print as-is, sections print as YAML
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			return enc.Encode(value)
+		default:
+			fmt.Println(value)
+		}
+		return nil
+
+	case "set":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: config set <path> <value>")
+		}
+		// Parse the value as YAML so numbers and booleans keep their type
+		var value interface{} = args[2]
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(args[2]), &parsed); err == nil && parsed != nil {
+			value = parsed
+		}
+		if err := config.UpdateConfigPath(ctx, args[1], value); err != nil {
+			return err
+		}
+		fmt.Printf("%s = %v\n", args[1], value)
+		return nil
+
+	case "effective":
+		prefix := ""
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tVALUE\tSOURCE\tOVERRIDE")
+		for _, v := range config.GetEffectiveConfig() {
+			if !strings.HasPrefix(v.Path, prefix) {
+				continue
+			}
+			source := v.Source
+			if v.Env != "" {
+				source += " (" + v.Env + ")"
+			}
+			fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", v.Path, v.Value, source, v.Override)
+		}
+		return w.Flush()
+
+	case "validate":
+		var content string
+		if len(args) > 1 {
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		} else {
+			current, err := config.GetConfigContent(ctx)
+			if err != nil {
+				return err
+			}
+			content = current
+		}
+		if errs := config.ValidateContent(ctx, content); errs != nil {
+			return errs
+		}
+		fmt.Println("config is valid")
+		return nil
+
+	case "history", "diff", "restore":
+		// Registers go-rag's config.yaml as a history target
+		service.NewRAGManagerService(ctx, config.GetRAGConfig())
+		return runConfigHistory(ctx, args)
+	}
+
+	return fmt.Errorf("unknown config command: %s", args[0])
+}
+
+// runConfigHistory handles config history/diff/restore
+func runConfigHistory(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "history":
+		target := ""
+		if len(args) > 1 {
+			target = args[1]
+		}
+		versions, err := config.ListConfigVersions(target)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tID\tTIME\tSOURCE\tSIZE\t")
+		for _, v := range versions {
+			current := ""
+			if v.Current {
+				current = "(current)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", v.Target, v.ID, v.Time.Format("2006-01-02 15:04:05"), v.Source, v.Size, current)
+		}
+		return w.Flush()
+
+	case "diff":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: config diff <target> <from> [to] (to defaults to the current file)")
+		}
+		to := ""
+		if len(args) > 3 {
+			to = args[3]
+		}
+		diff, err := config.DiffConfigVersions(args[1], args[2], to)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			fmt.Println("no differences")
+			return nil
+		}
+		fmt.Print(secret.MaskText(diff))
+		return nil
+
+	case "restore":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: config restore <target> <id>")
+		}
+		if err := config.RestoreConfigVersion(ctx, args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("restored %s to %s\n", args[1], args[2])
+		return nil
+	}
+	return fmt.Errorf("unknown config command: %s", args[0])
+}
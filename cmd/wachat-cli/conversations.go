@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/wangle201210/wachat/backend"
+	"github.com/wangle201210/wachat/backend/model"
+)
+
+// runConversations handles conversations list/show/export/delete
+func runConversations(api *backend.API, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: conversations list|show|export|delete")
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		convs, err := api.ListConversations()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUPDATED\tTITLE")
+		for _, conv := range convs {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", conv.ID, conv.UpdatedAt.Format("2006-01-02 15:04"), conv.Title)
+		}
+		return w.Flush()
+
+	case "show":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: conversations show <id>")
+		}
+		conv, err := api.GetConversation(args[1])
+		if err != nil {
+			return err
+		}
+		return writeMarkdown(conv)
+
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		format := fs.String("format", "markdown", "export format: markdown or json")
+		fs.Parse(args[1:])
+		if fs.NArg() < 1 {
+			return fmt.Errorf("usage: conversations export <id> [-format markdown|json]")
+		}
+		conv, err := api.GetConversation(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		switch *format {
+		case "markdown", "md":
+			return writeMarkdown(conv)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(conv)
+		default:
+			return fmt.Errorf("unsupported format: %s", *format)
+		}
+
+	case "delete", "rm":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: conversations delete <id>")
+		}
+		if err := api.DeleteConversation(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", args[1])
+		return nil
+	}
+
+	return fmt.Errorf("unknown conversations command: %s", args[0])
+}
+
+// writeMarkdown prints a conversation as markdown
+func writeMarkdown(conv *model.Conversation) error {
+	fmt.Printf("# %s\n\n", conv.Title)
+	fmt.Printf("- ID: %s\n- Created: %s\n- Updated: %s\n\n",
+		conv.ID, conv.CreatedAt.Format("2006-01-02 15:04:05"), conv.UpdatedAt.Format("2006-01-02 15:04:05"))
+	for _, msg := range conv.Messages {
+		role := "User"
+		if msg.Role == schema.Assistant {
+			role = "Assistant"
+		}
+		fmt.Printf("## %s\n\n%s\n\n", role, msg.Content)
+	}
+	return nil
+}
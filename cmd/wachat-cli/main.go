@@ -0,0 +1,169 @@
+// Command wachat-cli is the headless entry point of wachat.
+//
+// It reuses the same backend as the desktop app (backend.NewAPI) so that
+// wachat can be used from shell scripts or on machines without a display.
+//
+// Usage:
+//
+//	wachat-cli [-v] <command> [subcommand] [flags]
+//
+// Commands:
+//
+//	chat                                     interactive REPL, or one-shot reply when stdin is piped
+//	conversations list|show|export|delete    manage saved conversations
+//	rag start|stop|status|download|logs      manage the go-rag service
+//	qdrant start|stop|status|download|logs   manage the Qdrant service
+//	ollama start|stop|status|download|logs   manage the local Ollama server
+//	service list|<name> <subcommand>         manage services declared in config
+//	<service> check|upgrade|rollback         check for, install or undo a new release
+//	<service> install <archive>              install from a local archive (offline)
+//	bundle export|import                     package installed services for air-gapped machines
+//	config get|set|effective|validate        read, write or check config.yaml values
+//	config history|diff|restore              list, compare and restore saved config versions
+//	secret status|set|delete                 manage secrets referenced as secret://<name>
+//	profile list|create|switch               manage named config profiles
+//	vectors ingest|list|search|delete|drop   manage the embedded vector store (rag.backend: embedded)
+//	vectors bench                            measure the embedded vector store with random vectors
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/wangle201210/wachat/backend"
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+const usage = `Usage: wachat-cli [-v] <command> [subcommand] [flags]
+
+Commands:
+  chat [-c id] [-m message] [-title t]   chat with the configured model
+  conversations list                     list conversations
+  conversations show <id>                print a conversation
+  conversations export <id> [-format markdown|json]
+  conversations delete <id>
+  rag start|stop|status|download         manage the go-rag service
+  qdrant start|stop|status|download      manage the Qdrant service
+  ollama start|stop|status|download      manage the local Ollama server
+  <service> logs [-n lines]              print the last lines of a service log
+  <service> check|upgrade|rollback       check for, install or undo a new release
+  <service> install <archive>            install from a local archive (offline)
+  bundle export <file>                   package installed services and configs
+  bundle import [-config] <file>         install a bundle on an offline machine
+  service list                           list services declared in config
+  service <name> start|stop|status|download|logs
+  config get <path>                      print a config value (e.g. rag.topK)
+  config set <path> <value>              write a config value (api_key/token go to the secret store)
+  config effective [prefix]              print values in effect and their source (file/env/default)
+  config validate [file]                 check config.yaml (or another file) and print located problems
+  config history [target]                saved versions of wachat, profiles/<name> or go-rag config
+  config diff <target> <from> [to]       compare two versions (to defaults to the current file)
+  config restore <target> <id>           write a saved version back
+  secret status                          show the secret store and stored names
+  secret set <name> [value]              store a secret (value read from stdin when omitted)
+  secret delete <name>                   remove a secret
+  profile list                           list profiles (* marks the active one)
+  profile create [-d desc] [-own-db] <name>
+                                         create a profile from the current ai/rag/qdrant settings
+  profile switch <name|->                activate a profile ("-" for config.yaml only)
+  vectors ingest [-kb name] [-name title] <file...>
+                                         split, embed and store UTF-8 text files (rag.backend: embedded)
+  vectors list [kb]                      list stored documents
+  vectors search [-kb a,b] [-k n] <query>
+                                         search the embedded vector store
+  vectors delete <id>                    remove a document
+  vectors drop <kb>                      remove every document of a knowledge base
+  vectors stats                          print the number of documents and chunks
+  vectors bench [-n 100000] [-dim 1024] [-queries 100] [-disk]
+                                         measure add/load/search times with random vectors
+`
+
+func main() {
+	verbose := flag.Bool("v", false, "print backend logs to stderr")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Keep stdout clean for command output, backend logs go to stderr
+	ctx := context.Background()
+	g.Log().SetWriter(os.Stderr)
+	g.Log().SetStdoutColorDisabled(true)
+	if !*verbose {
+		g.Log().SetLevelStr("error")
+	}
+
+	if _, err := config.Load(ctx); err != nil {
+		fatalf("failed to load configuration: %v", err)
+	}
+
+	// config, secret, profile and vectors bench commands don't need the backend
+	switch args[0] {
+	case "config":
+		if err := runConfig(ctx, args[1:]); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	case "secret":
+		if err := runSecret(args[1:]); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	case "profile":
+		if err := runProfile(ctx, args[1:]); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	case "vectors":
+		if len(args) > 1 && args[1] == "bench" {
+			if err := runVectorBench(args[2:]); err != nil {
+				fatalf("%v", err)
+			}
+			return
+		}
+	}
+
+	api, err := backend.NewAPI(ctx)
+	if err != nil {
+		fatalf("failed to initialize API: %v", err)
+	}
+	api.SetContext(ctx)
+
+	switch args[0] {
+	case "chat":
+		err = runChat(ctx, api, args[1:])
+	case "conversations", "conv":
+		err = runConversations(api, args[1:])
+	case "rag":
+		err = runRAG(ctx, api, args[1:])
+	case "qdrant":
+		err = runQdrant(ctx, api, args[1:])
+	case "ollama":
+		err = runOllama(ctx, api, args[1:])
+	case "service", "svc":
+		err = runManagedService(ctx, api, args[1:])
+	case "bundle":
+		err = runBundle(api, args[1:])
+	case "vectors":
+		err = runVectors(ctx, api, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// fatalf prints an error and exits with status 1
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "wachat-cli: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/wangle201210/wachat/backend/config"
+)
+
+// runProfile handles profile list/create/switch
+func runProfile(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: profile list | profile create [-d description] [-own-db] <name> | profile switch <name|->")
+	}
+
+	switch args[0] {
+	case "list":
+		profiles, err := config.ListProfiles()
+		if err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			fmt.Printf("no profiles in %s\n", config.ProfilesDir())
+			return nil
+		}
+		for _, p := range profiles {
+			marker := " "
+			if p.Active {
+				marker = "*"
+			}
+			db := ""
+			if p.OwnDatabase {
+				db = " [own database]"
+			}
+			fmt.Printf("%s %-16s %s%s\n", marker, p.Name, p.Description, db)
+		}
+		return nil
+
+	case "create":
+		fs := flag.NewFlagSet("profile create", flag.ContinueOnError)
+		description := fs.String("d", "", "description of the profile")
+		ownDB := fs.Bool("own-db", false, "keep conversations in a separate database")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: profile create [-d description] [-own-db] <name>")
+		}
+		p, err := config.CreateProfile(ctx, fs.Arg(0), *description, *ownDB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s, edit %s/config.yaml to override settings\n", p.Name, p.Dir)
+		return nil
+
+	case "switch":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: profile switch <name|->")
+		}
+		// "-" switches back to config.yaml only
+		name := args[1]
+		if name == "-" {
+			name = ""
+		}
+		if err := config.SwitchProfile(ctx, name); err != nil {
+			return err
+		}
+		if name == "" {
+			fmt.Println("using config.yaml without a profile")
+		} else {
+			fmt.Printf("switched to %s\n", name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown profile command: %s", args[0])
+}
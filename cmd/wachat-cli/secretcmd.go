@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wangle201210/wachat/backend/secret"
+)
+
+// runSecret handles secret status/set/delete
+func runSecret(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: secret status | secret set <name> [value] | secret delete <name>")
+	}
+
+	switch args[0] {
+	case "status":
+		status := secret.GetStatus()
+		if status.Error != "" && status.Backend == "" {
+			return fmt.Errorf("%s", status.Error)
+		}
+		fmt.Printf("backend: %s\n", status.Backend)
+		if status.File != "" {
+			fmt.Printf("file:    %s\n", status.File)
+			fmt.Printf("locked:  %v\n", status.Locked)
+		}
+		if status.Error != "" {
+			fmt.Printf("error:   %s\n", status.Error)
+		}
+		for _, name := range status.Names {
+			fmt.Printf("  %s\n", secret.Ref(name))
+		}
+		return nil
+
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: secret set <name> [value]")
+		}
+		// Read the value from stdin when omitted so it stays out of the shell history
+		value := ""
+		if len(args) > 2 {
+			value = args[2]
+		} else {
+			fmt.Fprintf(os.Stderr, "value for %s: ", args[1])
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("failed to read value: %w", err)
+			}
+			value = strings.TrimRight(line, "\r\n")
+		}
+		if value == "" {
+			return fmt.Errorf("value cannot be empty, use secret delete to remove it")
+		}
+		ref, err := secret.Put(args[1], value)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("stored, reference it in config.yaml as %q\n", ref)
+		return nil
+
+	case "delete":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: secret delete <name>")
+		}
+		if _, err := secret.Put(args[1], ""); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", args[1])
+		return nil
+	}
+
+	return fmt.Errorf("unknown secret command: %s", args[0])
+}
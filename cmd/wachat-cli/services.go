@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wangle201210/wachat/backend"
+	"github.com/wangle201210/wachat/backend/service"
+)
+
+// serviceManager is the common surface of ManagedService and the managers built on it
+type serviceManager interface {
+	IsInstalled() bool
+	IsRunning() bool
+	Start() error
+	Stop() error
+	Download() error
+	CancelDownload() error
+	CheckHealth() error
+	WaitForHealth(timeout time.Duration) error
+	GetStatus() map[string]interface{}
+	SetProgressCallback(callback service.ProgressCallback)
+	Logs() *service.ServiceLog
+}
+
+// managedService is a named service managed by this CLI invocation
+type managedService struct {
+	name    string
+	manager serviceManager
+}
+
+// runRAG handles rag start/stop/status/download
+func runRAG(ctx context.Context, api *backend.API, args []string) error {
+	return runService(ctx, api, managedService{name: "rag", manager: api.GetRAGManager()}, args)
+}
+
+// runQdrant handles qdrant start/stop/status/download
+func runQdrant(ctx context.Context, api *backend.API, args []string) error {
+	return runService(ctx, api, managedService{name: "qdrant", manager: api.GetQdrantManager()}, args)
+}
+
+// runOllama handles ollama start/stop/status/download
+func runOllama(ctx context.Context, api *backend.API, args []string) error {
+	return runService(ctx, api, managedService{name: "ollama", manager: api.GetOllamaManager()}, args)
+}
+
+// runManagedService handles services declared in the services section of config
+func runManagedService(ctx context.Context, api *backend.API, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: service list | service <name> start|stop|status|download|install|logs|check|upgrade|rollback")
+	}
+
+	services := api.GetManagedServices()
+	if args[0] == "list" || args[0] == "ls" {
+		for _, name := range services.Names() {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	svc, err := services.Get(args[0])
+	if err != nil {
+		return err
+	}
+	return runService(ctx, api, managedService{name: args[0], manager: svc}, args[1:])
+}
+
+// runService dispatches a service subcommand
+func runService(ctx context.Context, api *backend.API, svc managedService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s start|stop|status|download|install <archive>|logs [-n lines]|check|upgrade|rollback", svc.name)
+	}
+
+	switch args[0] {
+	case "start":
+		return superviseService(api, svc)
+	case "stop":
+		return stopSupervisor(svc)
+	case "status":
+		return printStatus(svc)
+	case "logs":
+		return printLogs(svc, args[1:])
+	case "download":
+		showProgress(svc)
+		err := svc.manager.Download()
+		fmt.Fprintln(os.Stderr)
+		return err
+	case "install":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s install <archive>", svc.name)
+		}
+		return api.InstallFromArchive(svc.name, args[1])
+	case "check":
+		return checkForUpdate(api, svc)
+	case "upgrade":
+		showProgress(svc)
+		err := api.UpgradeService(svc.name)
+		fmt.Fprintln(os.Stderr)
+		return err
+	case "rollback":
+		return api.RollbackService(svc.name)
+	}
+
+	return fmt.Errorf("unknown %s command: %s", svc.name, args[0])
+}
+
+// showProgress prints download progress to stderr and cancels the download on Ctrl-C
+// (the partial file is kept, so running the command again resumes it)
+func showProgress(svc managedService) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		signal.Stop(sigChan)
+		svc.manager.CancelDownload()
+	}()
+
+	svc.manager.SetProgressCallback(func(downloaded, total int64, percent float64, status string) {
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s %.1f%% (%d/%d)", status, percent, downloaded, total)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", status)
+		}
+	})
+}
+
+// checkForUpdate prints the installed and latest released version of the service
+func checkForUpdate(api *backend.API, svc managedService) error {
+	for _, info := range api.CheckForUpdates() {
+		if info.Service != svc.name {
+			continue
+		}
+		if info.Error != "" {
+			return fmt.Errorf("%s", info.Error)
+		}
+		current := info.Current
+		if current == "" {
+			current = "unknown"
+		}
+		fmt.Printf("installed: %s\nlatest: %s\n", current, info.Latest)
+		if info.Pinned != "" {
+			fmt.Printf("pinned: %s\n", info.Pinned)
+		}
+		if info.UpdateAvailable {
+			fmt.Printf("update available, run `wachat-cli %s upgrade`\n", svc.name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s does not support update checks", svc.name)
+}
+
+// superviseService starts the service (and its dependencies, in dependency order) in the
+// foreground and stops them when the CLI receives SIGINT/SIGTERM or `stop` is called
+func superviseService(api *backend.API, svc managedService) error {
+	if svc.manager.CheckHealth() == nil {
+		fmt.Printf("%s is already running\n", svc.name)
+		return nil
+	}
+
+	if pid, ok := readSupervisorPID(svc.name); ok && processAlive(pid) {
+		return fmt.Errorf("%s is already supervised by wachat-cli (PID %d)", svc.name, pid)
+	}
+
+	orchestrator := api.GetOrchestrator()
+	err := api.StartService(svc.name, func(status string) {
+		fmt.Fprintln(os.Stderr, status)
+	})
+	if err != nil {
+		orchestrator.StopAll()
+		return err
+	}
+
+	// Services this process started (already running ones are left alone)
+	var started []string
+	for _, status := range orchestrator.GetStatus()["services"].([]map[string]interface{}) {
+		name, _ := status["name"].(string)
+		if s, err := orchestrator.Get(name); err == nil && s.IsRunning() {
+			started = append(started, name)
+		}
+	}
+
+	if err := writeSupervisorPID(svc.name); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write PID file: %v\n", err)
+	}
+	defer removeSupervisorPID(svc.name)
+
+	fmt.Printf("%s is running (Ctrl-C or `wachat-cli %s stop` to stop)\n", svc.name, svc.name)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sigChan:
+			fmt.Fprintln(os.Stderr, "Stopping...")
+			orchestrator.StopAll()
+			return nil
+		case <-ticker.C:
+			for _, name := range started {
+				if !orchestrator.IsActive(name) {
+					orchestrator.StopAll()
+					return fmt.Errorf("%s exited unexpectedly", name)
+				}
+			}
+		}
+	}
+}
+
+// stopSupervisor asks the supervising wachat-cli process to stop the service
+func stopSupervisor(svc managedService) error {
+	pid, ok := readSupervisorPID(svc.name)
+	if !ok || !processAlive(pid) {
+		removeSupervisorPID(svc.name)
+		if svc.manager.CheckHealth() == nil {
+			return fmt.Errorf("%s is running but was not started by wachat-cli", svc.name)
+		}
+		fmt.Printf("%s is not running\n", svc.name)
+		return nil
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to signal wachat-cli (PID %d): %w", pid, err)
+	}
+
+	for i := 0; i < 30; i++ {
+		if !processAlive(pid) {
+			fmt.Printf("%s stopped\n", svc.name)
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for %s to stop", svc.name)
+}
+
+// printLogs prints the last lines of the service log file
+// The CLI rarely owns the process, so it reads the file instead of the in-memory buffer
+func printLogs(svc managedService, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	lines := fs.Int("n", 100, "number of lines to show")
+	fs.Parse(args)
+
+	logs := svc.manager.Logs()
+	if logs == nil {
+		return fmt.Errorf("%s has no captured logs", svc.name)
+	}
+	data, err := os.ReadFile(logs.Path())
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no logs yet: %s", logs.Path())
+	}
+	if err != nil {
+		return err
+	}
+
+	all := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if *lines > 0 && len(all) > *lines {
+		all = all[len(all)-*lines:]
+	}
+	fmt.Println(strings.Join(all, "\n"))
+	return nil
+}
+
+// printStatus prints the service status
+func printStatus(svc managedService) error {
+	status := svc.manager.GetStatus()
+	// The CLI process rarely owns the service, so report health directly
+	status["healthy"] = svc.manager.CheckHealth() == nil
+	if pid, ok := readSupervisorPID(svc.name); ok && processAlive(pid) {
+		status["supervisor_pid"] = pid
+	}
+
+	keys := make([]string, 0, len(status))
+	for k := range status {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s: %v\n", k, status[k])
+	}
+	return nil
+}
+
+// supervisorPIDPath returns the PID file of the wachat-cli process supervising a service
+func supervisorPIDPath(name string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "."
+	}
+	return filepath.Join(homeDir, ".wachat", "run", name+"-cli.pid")
+}
+
+func writeSupervisorPID(name string) error {
+	path := supervisorPIDPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644)
+}
+
+func readSupervisorPID(name string) (int, bool) {
+	data, err := os.ReadFile(supervisorPIDPath(name))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
+
+func removeSupervisorPID(name string) {
+	os.Remove(supervisorPIDPath(name))
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wangle201210/wachat/backend"
+	"github.com/wangle201210/wachat/backend/config"
+	"github.com/wangle201210/wachat/backend/service"
+	"github.com/wangle201210/wachat/backend/vectorstore"
+)
+
+const vectorsUsage = "usage: vectors ingest|list|search|delete|drop|stats|bench"
+
+// runVectors handles the embedded vector store commands (rag.backend: embedded)
+func runVectors(ctx context.Context, api *backend.API, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(vectorsUsage)
+	}
+
+	switch args[0] {
+	case "ingest", "add":
+		fs := flag.NewFlagSet("vectors ingest", flag.ContinueOnError)
+		kb := fs.String("kb", config.GetRAGConfig().DefaultKnowledgeBase, "knowledge base (defaults to rag.defaultKnowledgeBase)")
+		name := fs.String("name", "", "document name when a single file is ingested (defaults to the file name)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 || *kb == "" {
+			return fmt.Errorf("usage: vectors ingest -kb <knowledge base> [-name title] <file...>")
+		}
+		if *name != "" && fs.NArg() > 1 {
+			return fmt.Errorf("-name can only be used with a single file")
+		}
+		for _, path := range fs.Args() {
+			var doc *vectorstore.Document
+			var err error
+			if *name != "" {
+				var data []byte
+				if data, err = os.ReadFile(path); err != nil {
+					return err
+				}
+				doc, err = api.IngestDocument(ctx, service.IngestRequest{
+					KnowledgeBase: *kb,
+					Name:          *name,
+					Text:          string(data),
+					Metadata:      map[string]interface{}{"source": path},
+				})
+			} else {
+				doc, err = api.IngestFile(ctx, *kb, path, nil)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s  %s (%d chunks)\n", doc.ID, doc.Name, doc.Chunks)
+		}
+		return nil
+
+	case "list", "ls":
+		kb := ""
+		if len(args) > 1 {
+			kb = args[1]
+		}
+		docs, err := api.ListDocuments(kb)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tKNOWLEDGE BASE\tCHUNKS\tCREATED\tNAME")
+		for _, doc := range docs {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", doc.ID, doc.KnowledgeBase, doc.Chunks, doc.CreatedAt.Format("2006-01-02 15:04"), doc.Name)
+		}
+		return w.Flush()
+
+	case "search":
+		fs := flag.NewFlagSet("vectors search", flag.ContinueOnError)
+		kb := fs.String("kb", "", "comma-separated knowledge bases (all when empty)")
+		topK := fs.Int("k", 0, "number of results (defaults to rag.topK)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return fmt.Errorf("usage: vectors search [-kb a,b] [-k n] <query>")
+		}
+		req := service.EmbeddedSearchRequest{Query: strings.Join(fs.Args(), " "), TopK: *topK}
+		if *kb != "" {
+			req.KnowledgeBases = strings.Split(*kb, ",")
+		}
+		docs, err := api.SearchDocuments(ctx, req)
+		if err != nil {
+			return err
+		}
+		for i, doc := range docs {
+			fmt.Printf("%d. [%.3f] %s / %v\n%s\n\n", i+1, doc.Score(), doc.MetaData["_knowledge_name"], doc.MetaData["_document_name"], doc.Content)
+		}
+		return nil
+
+	case "delete", "rm":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: vectors delete <document id>")
+		}
+		if err := api.DeleteDocument(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", args[1])
+		return nil
+
+	case "drop":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: vectors drop <knowledge base>")
+		}
+		n, err := api.DeleteKnowledgeBase(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %d documents from %s\n", n, args[1])
+		return nil
+
+	case "stats":
+		stats, err := api.GetVectorStoreStats()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("documents:       %d\n", stats.Documents)
+		fmt.Printf("chunks:          %d\n", stats.Chunks)
+		fmt.Printf("knowledge bases: %d\n", stats.KnowledgeBases)
+		fmt.Printf("vector memory:   %s\n", formatBytes(stats.VectorBytes))
+		return nil
+	}
+
+	return fmt.Errorf("unknown vectors command: %s", args[0])
+}
+
+// runVectorBench measures the embedded vector store with random vectors (no backend or embedding API needed)
+func runVectorBench(args []string) error {
+	fs := flag.NewFlagSet("vectors bench", flag.ContinueOnError)
+	chunks := fs.Int("n", 100000, "number of chunks")
+	dim := fs.Int("dim", 1024, "vector dimension")
+	queries := fs.Int("queries", 100, "queries per measurement")
+	topK := fs.Int("k", 5, "results per query")
+	disk := fs.Bool("disk", false, "write segments to a temporary directory to measure file size and load time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := vectorstore.BenchmarkOptions{Chunks: *chunks, Dimension: *dim, Queries: *queries, TopK: *topK}
+	if *disk {
+		dir, err := os.MkdirTemp("", "wachat-vectors-bench-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		opts.Dir = dir
+	}
+
+	fmt.Printf("benchmarking %d chunks of dimension %d...\n", *chunks, *dim)
+	result, err := vectorstore.RunBenchmark(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("workers:         %d\n", result.Workers)
+	fmt.Printf("add:             %v\n", result.AddTime)
+	if *disk {
+		fmt.Printf("load:            %v\n", result.OpenTime)
+		fmt.Printf("disk:            %s\n", formatBytes(result.DiskBytes))
+	}
+	fmt.Printf("vector memory:   %s (heap +%s)\n", formatBytes(result.VectorBytes), formatBytes(int64(result.HeapBytes)))
+	fmt.Printf("search all:      %v\n", result.Search)
+	fmt.Printf("search one kb:   %v\n", result.SearchKB)
+	fmt.Printf("search filtered: %v\n", result.SearchMeta)
+	return nil
+}
+
+// formatBytes formats a byte count as MiB
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}